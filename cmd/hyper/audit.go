@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/hntrl/hyper/src/hyper/runtime/audit"
+	"github.com/hntrl/hyper/src/hyper/runtime/resource"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditConfig  string
+	auditProfile string
+	auditFile    string
+	auditLines   int
+	auditFollow  bool
+	auditJSON    bool
+)
+
+func init() {
+	auditCommand.PersistentFlags().StringVar(&auditConfig, "config", "", "the resource configuration file to use (defaults to hyper.yaml in the working directory, if it exists)")
+	auditCommand.PersistentFlags().StringVar(&auditProfile, "profile", "", "the profile in the resource configuration file to use")
+	auditCommand.PersistentFlags().StringVar(&auditFile, "file", "", "the file decisions are recorded to (defaults to the one in the resource configuration file)")
+	auditTailCommand.Flags().IntVarP(&auditLines, "lines", "n", 10, "how many of the last decisions to print (-1 for every one of them)")
+	auditTailCommand.Flags().BoolVarP(&auditFollow, "follow", "f", false, "keep printing decisions as they're recorded until interrupted")
+	auditTailCommand.Flags().BoolVar(&auditJSON, "json", false, "print decisions as they're recorded, one JSON object per line")
+	auditCommand.AddCommand(auditTailCommand)
+	rootCmd.AddCommand(auditCommand)
+}
+
+var auditCommand = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspects the authorization decisions made for the messages a context received",
+}
+
+var auditTailCommand = &cobra.Command{
+	Use:   "tail",
+	Short: "Prints the last authorization decisions that were recorded, oldest first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := auditPath()
+		if err != nil {
+			return err
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		return audit.Tail(ctx, path, auditLines, auditFollow, func(decision audit.Decision) error {
+			if auditJSON {
+				line, err := json.Marshal(decision)
+				if err != nil {
+					return err
+				}
+				_, err = fmt.Println(string(line))
+				return err
+			}
+			_, err := fmt.Println(formatDecision(decision))
+			return err
+		})
+	},
+}
+
+// auditPath returns the file decisions are recorded to, which is either given
+// with --file or configured in the resource configuration file
+func auditPath() (string, error) {
+	if auditFile != "" {
+		return auditFile, nil
+	}
+	path := auditConfig
+	if path == "" {
+		dir, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		path = filepath.Join(dir, "hyper.yaml")
+	}
+	config, err := resource.LoadConfiguration(path)
+	if err != nil {
+		return "", err
+	}
+	configured, err := config.AuditConfig(auditProfile)
+	if err != nil {
+		return "", err
+	}
+	if configured == nil {
+		return "", fmt.Errorf("%s doesn't configure an audit file (expected --file or an audit section)", path)
+	}
+	return configured.File, nil
+}
+
+// formatDecision returns decision as a line of text, like
+//
+//	2023-05-01T12:00:00Z c0ffee DENIED grant orders:manage on acme.orders.PlaceOrder by alice: missing grant orders:manage
+func formatDecision(decision audit.Decision) string {
+	outcome := "ALLOWED"
+	if !decision.Allowed {
+		outcome = "DENIED"
+	}
+	caller := decision.Caller
+	if caller == "" {
+		caller = "anonymous"
+	}
+	line := fmt.Sprintf("%s %s %s %s %s on %s by %s", decision.Time.Local().Format(time.RFC3339), decision.Correlation, outcome, decision.Kind, decision.Requirement, decision.Item, caller)
+	if decision.Reason != "" {
+		line += ": " + decision.Reason
+	}
+	return line
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces"
+	"github.com/hntrl/hyper/src/hyper/runtime"
+	"github.com/spf13/cobra"
+)
+
+var checkJSONOutput bool
+
+func init() {
+	checkCommand.Flags().BoolVar(&checkJSONOutput, "json", false, "print diagnostics as JSON")
+	rootCmd.AddCommand(checkCommand)
+}
+
+var checkCommand = &cobra.Command{
+	Use:   "check [FILE]",
+	Short: "Builds a hyper context and reports the errors of each item without attaching it",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, err := os.Getwd()
+		if err != nil {
+			panic(err)
+		}
+		inFile := "./index.hyper"
+		if len(args) > 0 {
+			inFile = args[0]
+		}
+		inPath := filepath.Join(dir, inFile)
+
+		diagnostics := make([]domain.Diagnostic, 0)
+		if err := checkContext(inPath); err != nil {
+			diagnostics = append(diagnostics, domain.NewDiagnostics(err, inPath)...)
+		}
+
+		if checkJSONOutput {
+			out, err := json.MarshalIndent(diagnostics, "", "  ")
+			if err != nil {
+				panic(err)
+			}
+			fmt.Println(string(out))
+		} else {
+			for _, diagnostic := range diagnostics {
+				fmt.Fprintln(os.Stderr, diagnostic.String())
+			}
+		}
+		if len(diagnostics) > 0 {
+			os.Exit(1)
+		}
+	},
+}
+
+// checkContext runs the full build pipeline against the manifest at path. The
+// process is only used to satisfy interface registration and is never attached.
+func checkContext(path string) error {
+	manifestTree, err := domain.ParseContextFromFile(path)
+	if err != nil {
+		return err
+	}
+	builder := domain.NewContextBuilder()
+	process := runtime.NewProcess()
+	interfaces.RegisterDefaults(builder, process)
+	_, err = builder.ParseContext(*manifestTree, path)
+	return err
+}
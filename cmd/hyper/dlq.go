@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hntrl/hyper/src/hyper/runtime"
+	"github.com/hntrl/hyper/src/hyper/runtime/delivery"
+	"github.com/hntrl/hyper/src/hyper/runtime/transport"
+	"github.com/spf13/cobra"
+)
+
+var (
+	dlqConfig   string
+	dlqProfile  string
+	dlqConsumer string
+	dlqAll      bool
+	dlqTimeout  time.Duration
+)
+
+func init() {
+	dlqCommand.PersistentFlags().StringVar(&dlqConfig, "config", "", "the resource configuration file to use (defaults to hyper.yaml in the working directory, if it exists)")
+	dlqCommand.PersistentFlags().StringVar(&dlqProfile, "profile", "", "the profile in the resource configuration file to use")
+	dlqCommand.PersistentFlags().StringVar(&dlqConsumer, "consumer", "", "only use the dead letters of this subscription or projection (like acme.shop.notify)")
+	dlqReplayCommand.Flags().BoolVar(&dlqAll, "all", false, "replay every dead letter")
+	dlqReplayCommand.Flags().DurationVar(&dlqTimeout, "timeout", 30*time.Second, "how long to wait for each dead letter to be handled")
+	dlqPurgeCommand.Flags().BoolVar(&dlqAll, "all", false, "remove every dead letter")
+	dlqCommand.AddCommand(dlqListCommand, dlqReplayCommand, dlqPurgeCommand)
+	rootCmd.AddCommand(dlqCommand)
+}
+
+var dlqCommand = &cobra.Command{
+	Use:   "dlq",
+	Short: "Inspects and redelivers the messages subscriptions and projections gave up on",
+}
+
+var dlqListCommand = &cobra.Command{
+	Use:   "list",
+	Short: "Lists dead letters, oldest first",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withDeadLetters(func(process *runtime.Process, store *delivery.Store) error {
+			letters, err := store.List(context.Background(), dlqConsumer)
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tCONSUMER\tSUBJECT\tATTEMPTS\tFAILED AT\tERROR")
+			for _, letter := range letters {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", letter.ID, letter.Consumer, letter.Subject, letter.Attempts, letter.FailedAt.Local().Format(time.RFC3339), strings.ReplaceAll(letter.Error, "\n", " "))
+			}
+			return w.Flush()
+		})
+	},
+}
+
+var dlqReplayCommand = &cobra.Command{
+	Use:   "replay [ID...]",
+	Short: "Sends dead letters back to the consumer that gave up on them, removing the ones it handles",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withDeadLetters(func(process *runtime.Process, store *delivery.Store) error {
+			letters, err := selectDeadLetters(store, args)
+			if err != nil {
+				return err
+			}
+			var conn transport.Transport
+			if err := process.Resource(context.Background(), "stream", &conn); err != nil {
+				return err
+			}
+			failed := 0
+			for _, letter := range letters {
+				ctx, cancel := context.WithTimeout(context.Background(), dlqTimeout)
+				err := delivery.Replay(ctx, conn, letter)
+				cancel()
+				if err == nil {
+					err = store.Delete(context.Background(), letter.ID)
+				}
+				if err != nil {
+					failed++
+					fmt.Fprintf(os.Stderr, "%s: %s\n", letter.ID, err.Error())
+					continue
+				}
+				fmt.Printf("%s: replayed to %s\n", letter.ID, letter.Consumer)
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d dead letters failed to replay", failed, len(letters))
+			}
+			return nil
+		})
+	},
+}
+
+var dlqPurgeCommand = &cobra.Command{
+	Use:   "purge [ID...]",
+	Short: "Removes dead letters without redelivering them",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return withDeadLetters(func(process *runtime.Process, store *delivery.Store) error {
+			letters, err := selectDeadLetters(store, args)
+			if err != nil {
+				return err
+			}
+			for _, letter := range letters {
+				if err := store.Delete(context.Background(), letter.ID); err != nil {
+					return err
+				}
+			}
+			fmt.Printf("removed %d dead letter(s)\n", len(letters))
+			return nil
+		})
+	},
+}
+
+// withDeadLetters calls fn with a process configured by --config and
+// --profile and the dead letter store it uses, closing the process after.
+func withDeadLetters(fn func(*runtime.Process, *delivery.Store) error) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	process := runtime.NewProcess()
+	if err := useResourceConfig(process, dlqConfig, dlqProfile, dir); err != nil {
+		return err
+	}
+	defer process.Close(context.Background())
+	store, err := process.DeadLetters(context.Background())
+	if err != nil {
+		return err
+	}
+	return fn(process, store)
+}
+
+// selectDeadLetters returns the dead letters with the given IDs, or every one
+// of them (for --consumer) with --all
+func selectDeadLetters(store *delivery.Store, ids []string) ([]delivery.DeadLetter, error) {
+	if dlqAll == (len(ids) > 0) {
+		return nil, fmt.Errorf("expected either dead letter IDs or --all")
+	}
+	letters, err := store.List(context.Background(), dlqConsumer)
+	if err != nil {
+		return nil, err
+	}
+	if dlqAll {
+		return letters, nil
+	}
+	byID := make(map[string]delivery.DeadLetter)
+	for _, letter := range letters {
+		byID[letter.ID] = letter
+	}
+	selected := make([]delivery.DeadLetter, 0, len(ids))
+	for _, id := range ids {
+		letter, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("no dead letter with ID %s", id)
+		}
+		selected = append(selected, letter)
+	}
+	return selected, nil
+}
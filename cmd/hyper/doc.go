@@ -2,28 +2,36 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"text/tabwriter"
 
+	"github.com/hntrl/hyper/src/hyper/doc"
 	"github.com/hntrl/hyper/src/hyper/domain"
 	"github.com/hntrl/hyper/src/hyper/interfaces"
 	"github.com/hntrl/hyper/src/hyper/runtime"
 	"github.com/spf13/cobra"
 )
 
+var (
+	docFormat string
+	docOutput string
+)
+
 func init() {
+	docCommand.Flags().StringVar(&docFormat, "format", "md", "output format: md, json or html")
+	docCommand.Flags().StringVarP(&docOutput, "out", "o", "", "file to write to (the directory to write the site to for html)")
 	rootCmd.AddCommand(docCommand)
 }
 
 var docCommand = &cobra.Command{
 	Use:   "doc [FILE]",
-	Short: "Prints out all the objects exported by a hyper context",
+	Short: "Documents the items declared in a hyper context",
 	Args:  cobra.MaximumNArgs(1),
-	Run: func(cmd *cobra.Command, args []string) {
+	RunE: func(cmd *cobra.Command, args []string) error {
 		dir, err := os.Getwd()
 		if err != nil {
-			panic(err)
+			return err
 		}
 		inFile := "./index.hyper"
 		if len(args) > 0 {
@@ -33,21 +41,39 @@ var docCommand = &cobra.Command{
 
 		manifestTree, err := domain.ParseContextFromFile(inPath)
 		if err != nil {
-			panic(err)
+			return err
 		}
 		builder := domain.NewContextBuilder()
 		process := runtime.NewProcess()
 		interfaces.RegisterDefaults(builder, process)
 		ctx, err := builder.ParseContext(*manifestTree, inPath)
 		if err != nil {
-			panic(err)
+			return err
 		}
+		documentation := doc.New(ctx)
 
-		fmt.Println("\nobjects:\n-------------")
-		w := tabwriter.NewWriter(os.Stdout, 1, 1, 2, ' ', 0)
-		for k, v := range ctx.Items {
-			fmt.Fprintf(w, "%s\t%T\n", k, v.HostItem)
+		if docFormat == "html" {
+			if docOutput == "" {
+				return fmt.Errorf("html output needs a directory to write to (set with --out)")
+			}
+			return doc.HTML(docOutput, documentation)
+		}
+		var out io.Writer = os.Stdout
+		if docOutput != "" {
+			file, err := os.Create(docOutput)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			out = file
+		}
+		switch docFormat {
+		case "md":
+			return doc.Markdown(out, documentation)
+		case "json":
+			return doc.JSON(out, documentation)
+		default:
+			return fmt.Errorf("unknown format %s: expected md, json or html", docFormat)
 		}
-		w.Flush()
 	},
 }
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hntrl/hyper/src/hyper/format"
+	"github.com/spf13/cobra"
+)
+
+var (
+	fmtWrite bool
+	fmtList  bool
+)
+
+func init() {
+	fmtCommand.Flags().BoolVarP(&fmtWrite, "write", "w", false, "write result to (source) file instead of stdout")
+	fmtCommand.Flags().BoolVarP(&fmtList, "list", "l", false, "list files whose formatting differs from hyper fmt's")
+	rootCmd.AddCommand(fmtCommand)
+}
+
+var fmtCommand = &cobra.Command{
+	Use:   "fmt [-w] [-l] [FILE...]",
+	Short: "Formats hyper source files",
+	Long:  "Formats hyper source files. Without any files, fmt formats standard input.",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			src, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				panic(err)
+			}
+			out, err := format.Source(src)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "<standard input>: %s\n", err.Error())
+				os.Exit(1)
+			}
+			os.Stdout.Write(out)
+			return
+		}
+		failed := false
+		for _, path := range args {
+			if err := formatFile(path); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", path, err.Error())
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func formatFile(path string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	out, err := format.Source(src)
+	if err != nil {
+		return err
+	}
+	changed := !bytes.Equal(src, out)
+	if fmtList && changed {
+		fmt.Println(path)
+	}
+	if fmtWrite {
+		if changed {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			return os.WriteFile(path, out, info.Mode().Perm())
+		}
+	} else if !fmtList {
+		os.Stdout.Write(out)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/graph"
+	"github.com/hntrl/hyper/src/hyper/interfaces"
+	"github.com/hntrl/hyper/src/hyper/runtime"
+	"github.com/spf13/cobra"
+)
+
+var graphFormat string
+
+func init() {
+	graphCommand.Flags().StringVar(&graphFormat, "format", "dot", "output format: dot or mermaid")
+	rootCmd.AddCommand(graphCommand)
+}
+
+var graphCommand = &cobra.Command{
+	Use:   "graph [FILE]",
+	Short: "Prints a diagram of how a hyper context and the contexts it imports depend on each other",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		inFile := "./index.hyper"
+		if len(args) > 0 {
+			inFile = args[0]
+		}
+		inPath := filepath.Join(dir, inFile)
+
+		manifestTree, err := domain.ParseContextFromFile(inPath)
+		if err != nil {
+			return err
+		}
+		builder := domain.NewContextBuilder()
+		process := runtime.NewProcess()
+		interfaces.RegisterDefaults(builder, process)
+		_, err = builder.ParseContext(*manifestTree, inPath)
+		if err != nil {
+			return err
+		}
+
+		switch graphFormat {
+		case "dot":
+			return graph.DOT(os.Stdout, graph.New(builder))
+		case "mermaid":
+			return graph.Mermaid(os.Stdout, graph.New(builder))
+		default:
+			return fmt.Errorf("unknown format %s: expected dot or mermaid", graphFormat)
+		}
+	},
+}
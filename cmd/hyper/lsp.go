@@ -0,0 +1,28 @@
+package main
+
+import (
+	"os"
+
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces"
+	"github.com/hntrl/hyper/src/hyper/lsp"
+	"github.com/hntrl/hyper/src/hyper/runtime"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(lspCommand)
+}
+
+var lspCommand = &cobra.Command{
+	Use:   "lsp",
+	Short: "Runs a language server for hyper source files over stdio",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		server := lsp.NewServer(os.Stdin, os.Stdout, func(builder *domain.ContextBuilder) {
+			// like check, contexts are only built and never attached
+			interfaces.RegisterDefaults(builder, runtime.NewProcess())
+		})
+		return server.Serve()
+	},
+}
@@ -10,6 +10,9 @@ import (
 var rootCmd = &cobra.Command{
 	Use:   "lang",
 	Short: `A reliable backend framework for distributed systems`,
+	// errors are printed by main, so cobra doesn't need to print them again
+	SilenceErrors: true,
+	SilenceUsage:  true,
 }
 
 func main() {
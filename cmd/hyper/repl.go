@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces"
+	"github.com/hntrl/hyper/src/hyper/repl"
+	"github.com/hntrl/hyper/src/hyper/runtime"
+	"github.com/hntrl/hyper/src/hyper/symbols"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(replCommand)
+}
+
+var replCommand = &cobra.Command{
+	Use:   "repl [FILE]",
+	Short: "Evaluates statements interactively, optionally in the scope of a context",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		table := symbols.NewSymbolTable(nil)
+		if len(args) > 0 {
+			dir, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			inPath := filepath.Join(dir, args[0])
+			manifestTree, err := domain.ParseContextFromFile(inPath)
+			if err != nil {
+				return err
+			}
+			builder := domain.NewContextBuilder()
+			interfaces.RegisterDefaults(builder, runtime.NewProcess())
+			ctx, err := builder.ParseContext(*manifestTree, inPath)
+			if err != nil {
+				return err
+			}
+			table = ctx.Symbols()
+		}
+		return repl.New(table, os.Stdout).Run(os.Stdin)
+	},
+}
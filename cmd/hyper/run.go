@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces"
+	"github.com/hntrl/hyper/src/hyper/runtime"
+	"github.com/hntrl/hyper/src/hyper/runtime/audit"
+	"github.com/hntrl/hyper/src/hyper/runtime/resource"
+	"github.com/hntrl/hyper/src/hyper/watch"
+	"github.com/spf13/cobra"
+)
+
+var (
+	runWatch           bool
+	runWatchInterval   time.Duration
+	runShutdownTimeout time.Duration
+	runConfig          string
+	runProfile         string
+	runEmbeddedBroker  bool
+	runJetStream       bool
+	runDataDir         string
+)
+
+func init() {
+	runCommand.Flags().BoolVar(&runWatch, "watch", false, "reload the context when any of the files it's built from change")
+	runCommand.Flags().DurationVar(&runWatchInterval, "watch-interval", 500*time.Millisecond, "how often to check for changes with --watch")
+	runCommand.Flags().DurationVar(&runShutdownTimeout, "shutdown-timeout", 10*time.Second, "how long to wait for in-flight work to finish when interrupted")
+	runCommand.Flags().StringVar(&runConfig, "config", "", "the resource configuration file to use (defaults to hyper.yaml next to FILE, if it exists)")
+	runCommand.Flags().StringVar(&runProfile, "profile", "", "the profile in the resource configuration file to use")
+	runCommand.Flags().BoolVar(&runEmbeddedBroker, "embedded-broker", false, "serve the stream resource from a NATS server started in this process (listening on its url, or on port 4222 if it doesn't have one)")
+	runCommand.Flags().BoolVar(&runJetStream, "jetstream", false, "enable JetStream on the embedded broker, so events are delivered durably")
+	runCommand.Flags().StringVar(&runDataDir, "data-dir", "", "the directory the embedded broker stores JetStream data in (defaults to a temporary directory that's removed when it stops)")
+	rootCmd.AddCommand(runCommand)
+}
+
+var runCommand = &cobra.Command{
+	Use:   "run [FILE]",
+	Short: "Builds a hyper context and serves it until interrupted",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		inFile := "./index.hyper"
+		if len(args) > 0 {
+			inFile = args[0]
+		}
+		inPath := filepath.Join(dir, inFile)
+
+		process := runtime.NewProcess()
+		if err := useResourceConfig(process, runConfig, runProfile, filepath.Dir(inPath)); err != nil {
+			return err
+		}
+		if err := useEmbeddedBroker(process); err != nil {
+			return err
+		}
+		builder, err := buildContext(inPath, process)
+		if err != nil {
+			return err
+		}
+		err = process.UseContextBuilder(builder)
+		if err != nil {
+			return err
+		}
+
+		// The signal channel is registered before attaching so an interrupt
+		// received while nodes are still coming up isn't lost.
+		sigCh := make(chan os.Signal, 1)
+		signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+		defer signal.Stop(sigCh)
+
+		err = process.Attach(context.Background())
+		if err != nil {
+			// release any resources the nodes that were attached acquired
+			process.Close(context.Background())
+			return err
+		}
+		if !runWatch {
+			<-sigCh
+			return shutdown(process, sigCh)
+		}
+
+		watcher := watch.NewWatcher(func() []string {
+			return watchedPaths(builder)
+		})
+		ticker := time.NewTicker(runWatchInterval)
+		defer ticker.Stop()
+		pending := false
+		for {
+			select {
+			case <-sigCh:
+				return shutdown(process, sigCh)
+			case <-ticker.C:
+				// changes are only picked up once the files have stopped
+				// changing, so files that are still being written aren't read
+				if watcher.Changed() {
+					pending = true
+					continue
+				}
+				if !pending {
+					continue
+				}
+				pending = false
+				nextBuilder, err := buildContext(inPath, process)
+				if err != nil {
+					// keep serving the last context that built
+					for _, diagnostic := range domain.NewDiagnostics(err, inPath) {
+						fmt.Fprintln(os.Stderr, diagnostic.String())
+					}
+					continue
+				}
+				if err := process.Reload(context.Background(), nextBuilder); err != nil {
+					fmt.Fprintf(os.Stderr, "cannot reload %s: %s\n", inFile, err.Error())
+					// the new context may still be served if it was only the
+					// previous one that failed to detach
+					if process.Context != nextBuilder.HostContext() {
+						continue
+					}
+				}
+				builder = nextBuilder
+				// the new context may be built from a different set of files
+				watcher.Reset()
+				fmt.Fprintf(os.Stderr, "reloaded %s\n", inFile)
+			}
+		}
+	},
+}
+
+// shutdown closes process, giving in-flight work until the shutdown timeout
+// to finish. Another signal on sigCh stops waiting for it immediately.
+func shutdown(process *runtime.Process, sigCh <-chan os.Signal) error {
+	fmt.Fprintln(os.Stderr, "shutting down...")
+	ctx, cancel := context.WithTimeout(context.Background(), runShutdownTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-sigCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return process.Close(ctx)
+}
+
+// useResourceConfig configures the resources, request timeouts, retry
+// policies, auth and audit sink of process with the file at path, or the
+// hyper.yaml file in dir if there is one.
+func useResourceConfig(process *runtime.Process, path string, profile string, dir string) error {
+	if path == "" {
+		path = filepath.Join(dir, "hyper.yaml")
+		if _, err := os.Stat(path); err != nil {
+			if profile != "" {
+				return fmt.Errorf("cannot use profile %s: no resource configuration file found", profile)
+			}
+			return nil
+		}
+	}
+	config, err := resource.LoadConfiguration(path)
+	if err != nil {
+		return err
+	}
+	resources, err := config.Profile(profile)
+	if err != nil {
+		return err
+	}
+	timeouts, err := config.RequestTimeouts(profile)
+	if err != nil {
+		return err
+	}
+	retries, err := config.RetryPolicies(profile)
+	if err != nil {
+		return err
+	}
+	authConfig, err := config.AuthConfig(profile)
+	if err != nil {
+		return err
+	}
+	auditConfig, err := config.AuditConfig(profile)
+	if err != nil {
+		return err
+	}
+	process.UseResourceConfig(resources)
+	process.UseRequestTimeouts(timeouts)
+	process.UseRetryPolicies(retries)
+	if err := process.UseAuth(authConfig); err != nil {
+		return err
+	}
+	if auditConfig == nil {
+		return nil
+	}
+	auditor, err := audit.New(*auditConfig)
+	if err != nil {
+		return err
+	}
+	return process.UseAudit(auditor)
+}
+
+// useEmbeddedBroker configures the stream resource of process to start its
+// own NATS server when --embedded-broker is set. A stream resource that's
+// already configured for NATS keeps its settings, so the server listens on
+// its URL (if it has one).
+func useEmbeddedBroker(process *runtime.Process) error {
+	if !runEmbeddedBroker {
+		if runJetStream || runDataDir != "" {
+			return fmt.Errorf("--jetstream and --data-dir can only be used with --embedded-broker")
+		}
+		return nil
+	}
+	config, ok := process.ResourceConfig("stream")
+	if !ok || config.Type != "nats" {
+		config = resource.Config{Type: "nats"}
+	}
+	embedded := true
+	config.Embedded = &embedded
+	jetStream := (config.JetStream != nil && *config.JetStream) || runJetStream || runDataDir != ""
+	config.JetStream = &jetStream
+	if runDataDir != "" {
+		dataDir, err := filepath.Abs(runDataDir)
+		if err != nil {
+			return err
+		}
+		config.DataDir = dataDir
+	}
+	process.UseResourceConfig(map[string]resource.Config{"stream": config})
+	return nil
+}
+
+// buildContext parses and builds the manifest at path with the default
+// interfaces registered against process.
+func buildContext(path string, process *runtime.Process) (*domain.ContextBuilder, error) {
+	manifestTree, err := domain.ParseContextFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	builder := domain.NewContextBuilder()
+	interfaces.RegisterDefaults(builder, process)
+	_, err = builder.ParseContext(*manifestTree, path)
+	if err != nil {
+		return nil, err
+	}
+	return builder, nil
+}
+
+// watchedPaths returns the files the contexts in builder were built from and
+// the template directories next to each of them. The other hyper files next to
+// each context are watched too, so a file that's imported by a change that
+// failed to build is still watched for the fix.
+func watchedPaths(builder *domain.ContextBuilder) []string {
+	paths := builder.Sources()
+	for path := range builder.Contexts {
+		dir := filepath.Dir(string(path))
+		paths = append(paths, filepath.Join(dir, "templates"))
+		siblings, _ := filepath.Glob(filepath.Join(dir, "*.hyper"))
+		paths = append(paths, siblings...)
+	}
+	return paths
+}
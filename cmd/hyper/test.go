@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces"
+	"github.com/hntrl/hyper/src/hyper/runtime"
+	"github.com/hntrl/hyper/src/hyper/testrunner"
+	"github.com/spf13/cobra"
+)
+
+var testRunPattern string
+
+func init() {
+	testCommand.Flags().StringVar(&testRunPattern, "run", "", "only run tests whose names match the regular expression")
+	rootCmd.AddCommand(testCommand)
+}
+
+var testCommand = &cobra.Command{
+	Use:   "test [FILE]",
+	Short: "Runs the tests declared in the *_test.hyper files next to a hyper context",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+		inFile := "./index.hyper"
+		if len(args) > 0 {
+			inFile = args[0]
+		}
+		inPath := filepath.Join(dir, inFile)
+
+		var filter *regexp.Regexp
+		if testRunPattern != "" {
+			filter, err = regexp.Compile(testRunPattern)
+			if err != nil {
+				return err
+			}
+		}
+
+		setup := func(builder *domain.ContextBuilder, process *runtime.Process) {
+			interfaces.RegisterDefaults(builder, process)
+		}
+		failed, total := 0, 0
+		err = testrunner.Run(inPath, filter, setup, func(result testrunner.Result) {
+			total++
+			if result.Passed() {
+				fmt.Printf("--- PASS: %s (%.2fs)\n", result.Name, result.Duration.Seconds())
+				return
+			}
+			failed++
+			fmt.Printf("--- FAIL: %s (%.2fs)\n", result.Name, result.Duration.Seconds())
+			fmt.Printf("    %s\n", result.Diagnostic().String())
+		})
+		if err != nil {
+			for _, diagnostic := range domain.NewDiagnostics(err, inPath) {
+				fmt.Fprintln(os.Stderr, diagnostic.String())
+			}
+			os.Exit(1)
+		}
+		if failed > 0 {
+			fmt.Printf("FAIL (%d of %d tests failed)\n", failed, total)
+			os.Exit(1)
+		}
+		fmt.Printf("ok (%d tests)\n", total)
+		return nil
+	},
+}
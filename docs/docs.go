@@ -0,0 +1,9 @@
+// Package docs holds the stylesheet built from the project site's Tailwind
+// setup, along with the templates `hyper doc` renders with it. Run `npm run
+// build` in this directory after changing the classes used in a template.
+package docs
+
+import "embed"
+
+//go:embed tailwind.css templates
+var FS embed.FS
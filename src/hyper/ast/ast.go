@@ -11,6 +11,19 @@ type Node interface {
 	Pos() tokens.Position
 }
 
+// SyntaxError is produced when the parser encounters a token it didn't expect.
+type SyntaxError struct {
+	Position tokens.Position
+	Msg      string
+}
+
+func (e SyntaxError) Error() string {
+	return fmt.Sprintf("syntax (%s): %s", e.Position.String(), e.Msg)
+}
+
 func ExpectedError(pos tokens.Position, expected tokens.Token, lit string) error {
-	return fmt.Errorf("syntax (%s): expected %s but got %s", pos.String(), expected.String(), lit)
+	return SyntaxError{
+		Position: pos,
+		Msg:      fmt.Sprintf("expected %s but got %s", expected.String(), lit),
+	}
 }
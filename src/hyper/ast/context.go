@@ -177,7 +177,7 @@ func ParseContextItem(p *parser.Parser) (*ContextItem, error) {
 	_, tok, _ := p.ScanIgnore(tokens.NEWLINE)
 	if tok == tokens.FUNC {
 		_, tok, _ = p.ScanIgnore(tokens.NEWLINE)
-		p.Rollback(startIndex - 1)
+		p.Rollback(startIndex)
 		if tok == tokens.LPAREN {
 			method, err := ParseContextObjectMethod(p)
 			if err != nil {
@@ -200,7 +200,7 @@ func ParseContextItem(p *parser.Parser) (*ContextItem, error) {
 		}
 		p.ScanIgnore(tokens.NEWLINE, tokens.COMMENT)
 		_, tok, _ = p.ScanIgnore(tokens.NEWLINE, tokens.COMMENT)
-		p.Rollback(startIndex - 1)
+		p.Rollback(startIndex)
 		if tok == tokens.LPAREN {
 			method, err := ParseContextMethod(p)
 			if err != nil {
@@ -245,7 +245,7 @@ func ParseUseStatement(p *parser.Parser) (*UseStatement, error) {
 	return statement, nil
 }
 
-// ContextObject :: COMMENT? PRIVATE? IDENT IDENT (EXTENDS Selector)? LCURLY FieldStatement* RCURLY
+// ContextObject :: COMMENT? PRIVATE? IDENT IDENT (EXTENDS Selector)? ("requires" Selector (COMMA Selector)*)? LCURLY FieldStatement* RCURLY
 type ContextObject struct {
 	pos       tokens.Position
 	Private   bool
@@ -254,6 +254,9 @@ type ContextObject struct {
 	Extends   *Selector
 	Fields    []FieldStatement
 	Comment   string
+	// Requires are the grants and policies given in the object's requires
+	// clause
+	Requires []Selector
 }
 
 func (c ContextObject) Validate() error {
@@ -306,6 +309,16 @@ func ParseContextObject(p *parser.Parser) (*ContextObject, error) {
 		obj.Extends = selector
 		pos, tok, lit = p.ScanIgnore(tokens.NEWLINE)
 	}
+	// requires isn't reserved, but nothing else can come before the object's
+	// fields
+	if tok == tokens.IDENT && lit == "requires" {
+		requires, err := parseRequires(p)
+		if err != nil {
+			return nil, err
+		}
+		obj.Requires = requires
+		pos, tok, lit = p.ScanIgnore(tokens.NEWLINE)
+	}
 
 	if tok != tokens.LCURLY {
 		return nil, ExpectedError(pos, tokens.LCURLY, lit)
@@ -393,7 +406,7 @@ func ParseContextObjectMethod(p *parser.Parser) (*ContextObjectMethod, error) {
 	return &method, nil
 }
 
-// ContextMethod :: COMMENT? PRIVATE? IDENT IDENT FunctionBlock
+// ContextMethod :: COMMENT? PRIVATE? IDENT IDENT FunctionParameters ("timeout" STRING)? ("requires" Selector (COMMA Selector)*)? LCURLY Block RCURLY
 type ContextMethod struct {
 	pos       tokens.Position
 	Private   bool
@@ -401,6 +414,11 @@ type ContextMethod struct {
 	Name      string
 	Block     FunctionBlock
 	Comment   string
+	// Timeout is the duration given in the method's timeout clause (like "5s")
+	Timeout string
+	// Requires are the grants and policies given in the method's requires
+	// clause
+	Requires []Selector
 }
 
 func (c ContextMethod) Validate() error {
@@ -435,10 +453,76 @@ func ParseContextMethod(p *parser.Parser) (*ContextMethod, error) {
 	}
 	method.Name = lit
 
-	block, err := ParseFunctionBlock(p)
+	params, err := ParseFunctionParameters(p)
 	if err != nil {
 		return nil, err
 	}
-	method.Block = *block
+	if scanClause(p, params, "timeout", tokens.STRING) {
+		pos, tok, lit = p.ScanIgnore(tokens.NEWLINE, tokens.COMMENT)
+		if tok != tokens.STRING {
+			return nil, ExpectedError(pos, tokens.STRING, lit)
+		}
+		method.Timeout = lit
+	}
+	if scanClause(p, params, "requires", tokens.IDENT) {
+		requires, err := parseRequires(p)
+		if err != nil {
+			return nil, err
+		}
+		method.Requires = requires
+	}
+	body, err := parseFunctionBody(p)
+	if err != nil {
+		return nil, err
+	}
+	method.Block = FunctionBlock{Parameters: *params, Body: *body}
 	return &method, nil
 }
+
+// scanClause scans the keyword of a clause that follows the parameters of a
+// method, and returns true if it's there. Clause keywords aren't reserved (so
+// things like cfg.timeout can still be written), which means a method without
+// a return type has the keyword of its first clause parsed as its return type.
+// That's told apart from an actual return type by the token after it, which
+// is next for the clause.
+func scanClause(p *parser.Parser, params *FunctionParameters, keyword string, next tokens.Token) bool {
+	if ret := params.ReturnType; ret != nil && !ret.IsArray && !ret.IsPartial && !ret.IsOptional && len(ret.Selector.Members) == 1 && ret.Selector.Members[0] == keyword {
+		_, tok, _ := p.ScanIgnore(tokens.NEWLINE, tokens.COMMENT)
+		p.Unscan()
+		if tok != next {
+			return false
+		}
+		params.ReturnType = nil
+		return true
+	}
+	startIndex := p.Index()
+	_, tok, lit := p.ScanIgnore(tokens.NEWLINE, tokens.COMMENT)
+	if tok == tokens.IDENT && lit == keyword {
+		return true
+	}
+	p.Rollback(startIndex)
+	return false
+}
+
+// parseRequires :: Selector (COMMA Selector)*
+//
+// It's what follows the keyword of a requires clause.
+func parseRequires(p *parser.Parser) ([]Selector, error) {
+	requires := make([]Selector, 0)
+	for {
+		selector, err := ParseSelector(p)
+		if err != nil {
+			return nil, err
+		}
+		if len(selector.Members) == 0 {
+			pos, _, lit := p.ScanIgnore(tokens.NEWLINE, tokens.COMMENT)
+			return nil, ExpectedError(pos, tokens.IDENT, lit)
+		}
+		requires = append(requires, *selector)
+		_, tok, _ := p.ScanIgnore(tokens.NEWLINE, tokens.COMMENT)
+		if tok != tokens.COMMA {
+			p.Unscan()
+			return requires, nil
+		}
+	}
+}
@@ -154,6 +154,86 @@ func TestContextWithComment(t *testing.T) {
 	}
 }
 
+// CAN CREATE CONTEXT WITH ITEMS ON ITS OPENING LINE
+func TestContextItemsOnOpeningLine(t *testing.T) {
+	err := evaluateTest(TestFixture{
+		lit: "context foo { test bar { } }",
+		parseFn: func(p *parser.Parser) (Node, error) {
+			return ParseContext(p)
+		},
+		expects: &Context{
+			pos:     tokens.Position{Line: 1, Column: 1},
+			Name:    "foo",
+			Remotes: make([]UseStatement, 0),
+			Items: []ContextItem{
+				{
+					Init: ContextObject{
+						pos:       tokens.Position{Line: 1, Column: 15},
+						Private:   false,
+						Interface: "test",
+						Name:      "bar",
+						Extends:   nil,
+						Fields:    []FieldStatement{},
+						Comment:   "",
+					},
+				},
+			},
+			Comment: "",
+		},
+		expectsError: nil,
+		endingToken:  tokens.EOF,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// CAN CREATE CONTEXT WITH A METHOD
+func TestContextWithMethod(t *testing.T) {
+	err := evaluateTest(TestFixture{
+		lit: "context foo {\n  foo bar() {}\n}",
+		parseFn: func(p *parser.Parser) (Node, error) {
+			return ParseContext(p)
+		},
+		expects: &Context{
+			pos:     tokens.Position{Line: 1, Column: 1},
+			Name:    "foo",
+			Remotes: make([]UseStatement, 0),
+			Items: []ContextItem{
+				{
+					Init: ContextMethod{
+						pos:       tokens.Position{Line: 2, Column: 3},
+						Private:   false,
+						Interface: "foo",
+						Name:      "bar",
+						Block: FunctionBlock{
+							Parameters: FunctionParameters{
+								pos: tokens.Position{Line: 2, Column: 10},
+								Arguments: ArgumentList{
+									pos:   tokens.Position{Line: 2, Column: 10},
+									Items: make([]Node, 0),
+								},
+								ReturnType: nil,
+							},
+							Body: Block{
+								pos:        tokens.Position{Line: 2, Column: 13},
+								Statements: []BlockStatement{},
+							},
+						},
+						Comment: "",
+					},
+				},
+			},
+			Comment: "",
+		},
+		expectsError: nil,
+		endingToken:  tokens.EOF,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
 // ContextObject
 // CAN CREATE CONTEXT OBJECT
 func TestContextObject(t *testing.T) {
@@ -512,3 +592,205 @@ func TestContextMethodPrivateComment(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+// CAN CREATE CONTEXT METHOD WITH TIMEOUT
+func TestContextMethodTimeout(t *testing.T) {
+	err := evaluateTest(TestFixture{
+		lit: "foo bar() String timeout \"5s\" {}",
+		parseFn: func(p *parser.Parser) (Node, error) {
+			return ParseContextMethod(p)
+		},
+		expects: &ContextMethod{
+			pos:       tokens.Position{Line: 1, Column: 1},
+			Private:   false,
+			Interface: "foo",
+			Name:      "bar",
+			Block: FunctionBlock{
+				Parameters: FunctionParameters{
+					pos: tokens.Position{Line: 1, Column: 8},
+					Arguments: ArgumentList{
+						pos:   tokens.Position{Line: 1, Column: 8},
+						Items: make([]Node, 0),
+					},
+					ReturnType: &TypeExpression{
+						pos:        tokens.Position{Line: 1, Column: 11},
+						IsArray:    false,
+						IsPartial:  false,
+						IsOptional: false,
+						Selector: Selector{
+							pos:     tokens.Position{Line: 1, Column: 11},
+							Members: []string{"String"},
+						},
+					},
+				},
+				Body: Block{
+					pos:        tokens.Position{Line: 1, Column: 32},
+					Statements: []BlockStatement{},
+				},
+			},
+			Comment: "",
+			Timeout: "5s",
+		},
+		expectsError: nil,
+		endingToken:  tokens.EOF,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// CAN CREATE CONTEXT METHOD THAT RETURNS A TYPE NAMED LIKE A CLAUSE KEYWORD
+func TestContextMethodReturningClauseKeyword(t *testing.T) {
+	err := evaluateTest(TestFixture{
+		lit: "foo bar() timeout {}",
+		parseFn: func(p *parser.Parser) (Node, error) {
+			return ParseContextMethod(p)
+		},
+		expects: &ContextMethod{
+			pos:       tokens.Position{Line: 1, Column: 1},
+			Private:   false,
+			Interface: "foo",
+			Name:      "bar",
+			Block: FunctionBlock{
+				Parameters: FunctionParameters{
+					pos: tokens.Position{Line: 1, Column: 8},
+					Arguments: ArgumentList{
+						pos:   tokens.Position{Line: 1, Column: 8},
+						Items: make([]Node, 0),
+					},
+					ReturnType: &TypeExpression{
+						pos:        tokens.Position{Line: 1, Column: 11},
+						IsArray:    false,
+						IsPartial:  false,
+						IsOptional: false,
+						Selector: Selector{
+							pos:     tokens.Position{Line: 1, Column: 11},
+							Members: []string{"timeout"},
+						},
+					},
+				},
+				Body: Block{
+					pos:        tokens.Position{Line: 1, Column: 19},
+					Statements: []BlockStatement{},
+				},
+			},
+			Comment: "",
+		},
+		expectsError: nil,
+		endingToken:  tokens.EOF,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// CAN CREATE CONTEXT METHOD THAT ONLY HAS REQUIRED GRANTS
+func TestContextMethodOnlyRequires(t *testing.T) {
+	err := evaluateTest(TestFixture{
+		lit: "foo bar() requires Baz {}",
+		parseFn: func(p *parser.Parser) (Node, error) {
+			return ParseContextMethod(p)
+		},
+		expects: &ContextMethod{
+			pos:       tokens.Position{Line: 1, Column: 1},
+			Private:   false,
+			Interface: "foo",
+			Name:      "bar",
+			Block: FunctionBlock{
+				Parameters: FunctionParameters{
+					pos: tokens.Position{Line: 1, Column: 8},
+					Arguments: ArgumentList{
+						pos:   tokens.Position{Line: 1, Column: 8},
+						Items: make([]Node, 0),
+					},
+					ReturnType: nil,
+				},
+				Body: Block{
+					pos:        tokens.Position{Line: 1, Column: 24},
+					Statements: []BlockStatement{},
+				},
+			},
+			Comment: "",
+			Requires: []Selector{
+				{pos: tokens.Position{Line: 1, Column: 20}, Members: []string{"Baz"}},
+			},
+		},
+		expectsError: nil,
+		endingToken:  tokens.EOF,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// CAN CREATE CONTEXT METHOD WITH REQUIRED GRANTS
+func TestContextMethodRequires(t *testing.T) {
+	err := evaluateTest(TestFixture{
+		lit: "foo bar() timeout \"5s\" requires Baz, qux.Quux {}",
+		parseFn: func(p *parser.Parser) (Node, error) {
+			return ParseContextMethod(p)
+		},
+		expects: &ContextMethod{
+			pos:       tokens.Position{Line: 1, Column: 1},
+			Private:   false,
+			Interface: "foo",
+			Name:      "bar",
+			Block: FunctionBlock{
+				Parameters: FunctionParameters{
+					pos: tokens.Position{Line: 1, Column: 8},
+					Arguments: ArgumentList{
+						pos:   tokens.Position{Line: 1, Column: 8},
+						Items: make([]Node, 0),
+					},
+					ReturnType: nil,
+				},
+				Body: Block{
+					pos:        tokens.Position{Line: 1, Column: 47},
+					Statements: []BlockStatement{},
+				},
+			},
+			Comment: "",
+			Timeout: "5s",
+			Requires: []Selector{
+				{pos: tokens.Position{Line: 1, Column: 33}, Members: []string{"Baz"}},
+				{pos: tokens.Position{Line: 1, Column: 38}, Members: []string{"qux", "Quux"}},
+			},
+		},
+		expectsError: nil,
+		endingToken:  tokens.EOF,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// CAN CREATE CONTEXT OBJECT WITH REQUIREMENTS
+func TestContextObjectRequires(t *testing.T) {
+	err := evaluateTest(TestFixture{
+		lit: "test foo extends bar requires Baz, qux.Quux { }",
+		parseFn: func(p *parser.Parser) (Node, error) {
+			return ParseContextObject(p)
+		},
+		expects: &ContextObject{
+			pos:       tokens.Position{Line: 1, Column: 1},
+			Private:   false,
+			Interface: "test",
+			Name:      "foo",
+			Extends: &Selector{
+				pos:     tokens.Position{Line: 1, Column: 16},
+				Members: []string{"bar"},
+			},
+			Fields:  []FieldStatement{},
+			Comment: "",
+			Requires: []Selector{
+				{pos: tokens.Position{Line: 1, Column: 31}, Members: []string{"Baz"}},
+				{pos: tokens.Position{Line: 1, Column: 36}, Members: []string{"qux", "Quux"}},
+			},
+		},
+		expectsError: nil,
+		endingToken:  tokens.EOF,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
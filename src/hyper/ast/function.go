@@ -236,6 +236,15 @@ func ParseFunctionBlock(p *parser.Parser) (*FunctionBlock, error) {
 	if err != nil {
 		return nil, err
 	}
+	block, err := parseFunctionBody(p)
+	if err != nil {
+		return nil, err
+	}
+	return &FunctionBlock{Parameters: *params, Body: *block}, nil
+}
+
+// parseFunctionBody :: LCURLY Block RCURLY
+func parseFunctionBody(p *parser.Parser) (*Block, error) {
 	pos, tok, lit := p.ScanIgnore(tokens.NEWLINE, tokens.COMMENT)
 	if tok != tokens.LCURLY {
 		return nil, ExpectedError(pos, tokens.LCURLY, lit)
@@ -248,7 +257,7 @@ func ParseFunctionBlock(p *parser.Parser) (*FunctionBlock, error) {
 	if tok != tokens.RCURLY {
 		return nil, ExpectedError(pos, tokens.RCURLY, lit)
 	}
-	return &FunctionBlock{Parameters: *params, Body: *block}, nil
+	return block, nil
 }
 
 // FunctionExpression :: FUNC IDENT FunctionBlock
@@ -547,7 +556,6 @@ func ParseBlockStatement(p *parser.Parser) (*BlockStatement, error) {
 			}
 			stmt.Init = *decl
 		} else {
-			p.Unscan()
 			for {
 				_, tok, _ := p.ScanIgnore(tokens.NEWLINE, tokens.COMMENT)
 				if tok == tokens.PERIOD || tok == tokens.IDENT {
@@ -626,7 +634,8 @@ func ParseDeclarationStatement(p *parser.Parser) (*DeclarationStatement, error)
 		if tok != tokens.IDENT {
 			return nil, ExpectedError(pos, tokens.IDENT, lit)
 		}
-		stmt.SecondaryTarget = &lit
+		secondaryTarget := lit
+		stmt.SecondaryTarget = &secondaryTarget
 		pos, tok, lit = p.ScanIgnore(tokens.NEWLINE, tokens.COMMENT)
 	}
 	if tok != tokens.DEFINE {
@@ -699,7 +708,8 @@ func ParseAssignmentStatement(p *parser.Parser) (*AssignmentStatement, error) {
 		if tok != tokens.IDENT {
 			return nil, ExpectedError(pos, tokens.IDENT, lit)
 		}
-		assign.SecondaryTarget = &lit
+		secondaryTarget := lit
+		assign.SecondaryTarget = &secondaryTarget
 		pos, tok, lit = p.ScanIgnore(tokens.NEWLINE, tokens.COMMENT)
 	} else {
 		if tok == tokens.INC || tok == tokens.DEC {
@@ -717,6 +727,7 @@ func ParseAssignmentStatement(p *parser.Parser) (*AssignmentStatement, error) {
 	}
 	assign.Operator = tok
 
+	_, tok, _ = p.ScanIgnore(tokens.NEWLINE, tokens.COMMENT)
 	p.Unscan()
 	if tok == tokens.TRY {
 		try, err := ParseTryStatement(p)
@@ -336,6 +336,45 @@ func TestBlockRejectsInvalidBlockStatements(t *testing.T) {
 	}
 }
 
+// CAN PARSE A BLOCK STARTING WITH AN ASSIGNMENT STATEMENT
+func TestBlockStartingWithAssignmentStatement(t *testing.T) {
+	err := evaluateTest(TestFixture{
+		lit: `abc = 1 }`,
+		parseFn: func(p *parser.Parser) (Node, error) {
+			return ParseBlock(p)
+		},
+		expects: &Block{
+			pos: tokens.Position{Line: 1, Column: 9},
+			Statements: []BlockStatement{
+				{
+					Init: AssignmentStatement{
+						pos: tokens.Position{Line: 1, Column: 1},
+						Target: AssignmentTargetExpression{
+							pos: tokens.Position{Line: 1, Column: 1},
+							Members: []AssignmentTargetExpressionMember{
+								{Init: "abc"},
+							},
+						},
+						Operator: tokens.ASSIGN,
+						Init: Expression{
+							pos: tokens.Position{Line: 1, Column: 7},
+							Init: Literal{
+								pos:   tokens.Position{Line: 1, Column: 7},
+								Value: int64(1),
+							},
+						},
+					},
+				},
+			},
+		},
+		expectsError: nil,
+		endingToken:  tokens.RCURLY,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
 // DeclarationStatement
 // CAN PARSE DECLARATION STATEMENTS
 func TestDeclarationStatement(t *testing.T) {
@@ -1109,8 +1148,8 @@ func TestForStatementWithAggregateForCondition(t *testing.T) {
 			Condition: ForCondition{
 				pos: tokens.Position{Line: 1, Column: 8},
 				Init: &DeclarationStatement{
-					pos:  tokens.Position{Line: 1, Column: 8},
-					Name: "idx",
+					pos:    tokens.Position{Line: 1, Column: 8},
+					Target: "idx",
 					Init: Expression{
 						pos: tokens.Position{Line: 1, Column: 13},
 						Init: Literal{
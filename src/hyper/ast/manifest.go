@@ -45,10 +45,14 @@ func ParseManifest(p *parser.Parser) (*Manifest, error) {
 
 	pos, tok, lit := p.ScanIgnore(tokens.NEWLINE, tokens.COMMENT)
 	if tok == tokens.CONTEXT {
-		p.Rollback(p.Index() - 2)
-		_, tok, _ = p.Scan()
-		if tok != tokens.COMMENT {
-			p.ScanIgnore(tokens.NEWLINE)
+		// step back to pick up the comment preceding the context (if there is
+		// one), unless the context is the first token in the file
+		if p.Index() > 0 {
+			p.Rollback(p.Index() - 2)
+			_, tok, _ = p.Scan()
+			if tok != tokens.COMMENT {
+				p.ScanIgnore(tokens.NEWLINE)
+			}
 		}
 		p.Unscan()
 		context, err := ParseContext(p)
@@ -38,6 +38,31 @@ func TestManifest(t *testing.T) {
 	}
 }
 
+// CAN PARSE MANIFEST STARTING WITH THE CONTEXT
+func TestManifestWithoutImports(t *testing.T) {
+	err := evaluateTest(TestFixture{
+		lit: "context bar {}",
+		parseFn: func(p *parser.Parser) (Node, error) {
+			return ParseManifest(p)
+		},
+		expects: &Manifest{
+			Imports: []ImportStatement{},
+			Context: Context{
+				pos:     tokens.Position{Line: 1, Column: 1},
+				Name:    "bar",
+				Remotes: []UseStatement{},
+				Items:   []ContextItem{},
+				Comment: "",
+			},
+		},
+		expectsError: nil,
+		endingToken:  tokens.EOF,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
 // ImportStatement
 // CAN PARSE IMPORT STATEMENT
 func TestImportStatement(t *testing.T) {
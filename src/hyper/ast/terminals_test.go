@@ -42,6 +42,24 @@ func TestSelectorWithSingleMember(t *testing.T) {
 	}
 }
 
+// CAN PARSE SELECTOR WITH MEMBERS NAMED LIKE CLAUSE KEYWORDS
+func TestSelectorWithClauseKeywords(t *testing.T) {
+	err := evaluateTest(TestFixture{
+		lit: "cfg.timeout.requires\n",
+		parseFn: func(p *parser.Parser) (Node, error) {
+			return ParseSelector(p)
+		},
+		expects: &Selector{
+			pos:     tokens.Position{Line: 1, Column: 1},
+			Members: []string{"cfg", "timeout", "requires"},
+		},
+		endingToken: tokens.EOF,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
 // Literal
 // CAN PARSE STRING LITERAL
 func TestStringLiteral(t *testing.T) {
@@ -0,0 +1,236 @@
+// Package doc extracts the documentation of a context from its items and
+// renders it as Markdown, JSON or a static HTML site.
+package doc
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/symbols"
+)
+
+type Context struct {
+	Name    string   `json:"name"`
+	Comment string   `json:"comment,omitempty"`
+	Imports []string `json:"imports,omitempty"`
+	Items   []Item   `json:"items"`
+	// Roles is which grants the context's roles have, or nil if it doesn't
+	// declare any roles
+	Roles *RoleMatrix `json:"roles,omitempty"`
+}
+
+// RoleMatrix is the grants each of a context's roles has, for reviewing who
+// can do what. Each role has whether it has the grant in the same position in
+// Grants.
+type RoleMatrix struct {
+	Grants []string     `json:"grants"`
+	Roles  []RoleGrants `json:"roles"`
+}
+
+type RoleGrants struct {
+	Role    string `json:"role"`
+	Granted []bool `json:"granted"`
+}
+
+// Item is the documentation of a single context item. Which of the fields are
+// set depends on the interface the item was declared with.
+type Item struct {
+	Name      string `json:"name"`
+	Interface string `json:"interface"`
+	Comment   string `json:"comment,omitempty"`
+	Private   bool   `json:"private,omitempty"`
+	// Fields are the properties of the class the item declares
+	Fields []Field `json:"fields,omitempty"`
+	// Values are the members of an enum
+	Values []string `json:"values,omitempty"`
+	// Class is the class of the value the item holds (like a parameter)
+	Class   string `json:"class,omitempty"`
+	Default string `json:"default,omitempty"`
+	// Arguments, Payload and Returns describe the items that can be called
+	Arguments []string `json:"arguments,omitempty"`
+	Payload   string   `json:"payload,omitempty"`
+	Returns   string   `json:"returns,omitempty"`
+	// Topic is the subject the item is sent or received on
+	Topic string `json:"topic,omitempty"`
+	// Timeout is how long requests to the item wait for a reply by default
+	Timeout string `json:"timeout,omitempty"`
+	// Requires are the grants callers must have to call the item
+	Requires []string `json:"requires,omitempty"`
+	// Event is the event a subscription receives
+	Event string `json:"event,omitempty"`
+	// Grant is the name a grant is checked by
+	Grant string `json:"grant,omitempty"`
+	// Role is the name a role is given to callers with, Extends are the roles
+	// it extends and Grants are every grant it has (including the ones of the
+	// roles it extends)
+	Role    string   `json:"role,omitempty"`
+	Extends []string `json:"extends,omitempty"`
+	Grants  []string `json:"grants,omitempty"`
+}
+
+type Field struct {
+	Name  string `json:"name"`
+	Class string `json:"class"`
+}
+
+// Describer is implemented by context items that have more to document than
+// the properties of the class they declare.
+type Describer interface {
+	Describe(*Item)
+}
+
+// New returns the documentation of ctx, with its items in the order they were
+// declared.
+func New(ctx *domain.Context) Context {
+	manifest := ctx.Manifest()
+	out := Context{
+		Name:    ctx.Identifier,
+		Comment: cleanComment(manifest.Context.Comment),
+		Imports: make([]string, len(manifest.Imports)),
+		Items:   make([]Item, 0),
+	}
+	for idx, importStatement := range manifest.Imports {
+		out.Imports[idx] = importStatement.Source
+	}
+	for _, contextItem := range manifest.Context.Items {
+		var item Item
+		var fieldOrder []string
+		switch node := contextItem.Init.(type) {
+		case ast.ContextObject:
+			item = Item{Name: node.Name, Interface: node.Interface, Comment: cleanComment(node.Comment), Private: node.Private}
+			fieldOrder = fieldNames(node)
+		case ast.ContextMethod:
+			item = Item{Name: node.Name, Interface: node.Interface, Comment: cleanComment(node.Comment), Private: node.Private}
+		case ast.FunctionExpression:
+			item = Item{Name: node.Name, Interface: "func"}
+			if fn, ok := ctx.Selectors[node.Name].(symbols.Callable); ok {
+				item.Arguments = classNames(fn.Arguments())
+				if fn.Returns() != nil {
+					item.Returns = ClassName(fn.Returns())
+				}
+			}
+			out.Items = append(out.Items, item)
+			continue
+		default:
+			continue
+		}
+		hostItem := ctx.Items[item.Name].HostItem
+		if class, ok := hostItem.(symbols.Class); ok {
+			item.Fields = classFields(class, fieldOrder)
+		}
+		if describer, ok := hostItem.(Describer); ok {
+			describer.Describe(&item)
+		}
+		out.Items = append(out.Items, item)
+	}
+	out.Roles = roleMatrix(out.Items)
+	return out
+}
+
+// roleMatrix returns the matrix of the roles in items and the grants they
+// have, with the grants in the order they were declared
+func roleMatrix(items []Item) *RoleMatrix {
+	matrix := RoleMatrix{Grants: make([]string, 0), Roles: make([]RoleGrants, 0)}
+	columns := make(map[string]int)
+	addGrant := func(grant string) {
+		if _, ok := columns[grant]; !ok {
+			columns[grant] = len(matrix.Grants)
+			matrix.Grants = append(matrix.Grants, grant)
+		}
+	}
+	for _, item := range items {
+		if item.Grant != "" {
+			addGrant(item.Grant)
+		}
+		for _, grant := range item.Grants {
+			addGrant(grant)
+		}
+	}
+	for _, item := range items {
+		if item.Role == "" {
+			continue
+		}
+		row := RoleGrants{Role: item.Role, Granted: make([]bool, len(matrix.Grants))}
+		for _, grant := range item.Grants {
+			row.Granted[columns[grant]] = true
+		}
+		matrix.Roles = append(matrix.Roles, row)
+	}
+	if len(matrix.Roles) == 0 {
+		return nil
+	}
+	return &matrix
+}
+
+// classFields returns the properties of class, starting with the ones in order
+// (the fields in the order they were declared) followed by the rest of them
+// (like the ones inherited with `extends`) sorted by name.
+func classFields(class symbols.Class, order []string) []Field {
+	descriptors := class.Descriptors()
+	if descriptors == nil || len(descriptors.Properties) == 0 {
+		return nil
+	}
+	fields := make([]Field, 0, len(descriptors.Properties))
+	seen := make(map[string]bool)
+	for _, name := range order {
+		if property, ok := descriptors.Properties[name]; ok && !seen[name] {
+			fields = append(fields, Field{Name: name, Class: ClassName(property.PropertyClass)})
+			seen[name] = true
+		}
+	}
+	rest := make([]string, 0)
+	for name := range descriptors.Properties {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		fields = append(fields, Field{Name: name, Class: ClassName(descriptors.Properties[name].PropertyClass)})
+	}
+	return fields
+}
+
+func fieldNames(node ast.ContextObject) []string {
+	names := make([]string, 0, len(node.Fields))
+	for _, field := range node.Fields {
+		switch fieldNode := field.Init.(type) {
+		case ast.FieldExpression:
+			names = append(names, fieldNode.Name)
+		case ast.FieldAssignmentExpression:
+			names = append(names, fieldNode.Name)
+		}
+	}
+	return names
+}
+
+// ClassName returns the name a class is referred to by in documentation
+func ClassName(class symbols.Class) string {
+	if class == nil {
+		return ""
+	}
+	if descriptors := class.Descriptors(); descriptors != nil && descriptors.Name != "" {
+		return descriptors.Name
+	}
+	return "Any"
+}
+
+func classNames(classes []symbols.Class) []string {
+	names := make([]string, len(classes))
+	for idx, class := range classes {
+		names[idx] = ClassName(class)
+	}
+	return names
+}
+
+// cleanComment turns the lines of a comment (which are joined by a literal \n
+// by the parser) back into text.
+func cleanComment(comment string) string {
+	lines := strings.Split(comment, "\\n")
+	for idx, line := range lines {
+		lines[idx] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
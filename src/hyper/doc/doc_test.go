@@ -0,0 +1,197 @@
+package doc_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hntrl/hyper/src/hyper/doc"
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces"
+	"github.com/hntrl/hyper/src/hyper/interfaces/access"
+	"github.com/hntrl/hyper/src/hyper/interfaces/stream"
+)
+
+const manifest = `import "time"
+
+// The shop sells things
+context shop {
+  // A person in the shop
+  type Person {
+    name String
+    born time.DateTime
+  }
+
+  enum Status {
+    OPEN "open"
+    CLOSED "closed"
+  }
+
+  // Placed when a person buys something
+  event OrderPlaced {
+    buyer Person
+  }
+
+  grant ManageOrders {
+    name = "orders:manage"
+    description = "Can manage every order"
+  }
+
+  grant ViewOrders {
+    name = "orders:view"
+  }
+
+  // Works in the shop
+  role Staff {
+    grant ViewOrders
+  }
+
+  role Manager extends Staff {
+    name = "manager"
+    grant ManageOrders
+  }
+
+  role Owner extends Manager {}
+
+  // Signed in as the person ordering
+  policy OrdersForSelf(user: UserContext, person: Person) Bool {
+    return user.id == person.name
+  }
+
+  // Places an order
+  command PlaceOrder(person: Person) Status timeout "30s" requires ManageOrders, OrdersForSelf {
+    return Status.OPEN
+  }
+
+  func double(a: Int) Int {
+    return a * 2
+  }
+}
+`
+
+func buildDocumentation(t *testing.T) doc.Context {
+	path := filepath.Join(t.TempDir(), "index.hyper")
+	if err := os.WriteFile(path, []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := domain.ParseContextFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := domain.NewContextBuilder()
+	builder.RegisterInterface("type", interfaces.TypeInterface{})
+	builder.RegisterInterface("enum", interfaces.EnumInterface{})
+	builder.RegisterInterface("grant", access.GrantInterface{})
+	builder.RegisterInterface("role", access.RoleInterface{})
+	builder.RegisterInterface("event", stream.EventInterface{})
+	builder.RegisterInterface("command", stream.CommandInterface{})
+	builder.RegisterInterface("policy", stream.PolicyInterface{})
+	builder.RegisterSelector("UserContext", stream.UserContext)
+	ctx, err := builder.ParseContext(*tree, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc.New(ctx)
+}
+
+// CAN DOCUMENT CONTEXT ITEMS
+func TestNew(t *testing.T) {
+	documentation := buildDocumentation(t)
+	if documentation.Name != "shop" || documentation.Comment != "The shop sells things" {
+		t.Fatalf("Expected context shop with its comment, but got %s (%q)", documentation.Name, documentation.Comment)
+	}
+	items := make(map[string]doc.Item)
+	names := make([]string, len(documentation.Items))
+	for idx, item := range documentation.Items {
+		items[item.Name] = item
+		names[idx] = item.Name
+	}
+	expectedOrder := "Person,Status,OrderPlaced,ManageOrders,ViewOrders,Staff,Manager,Owner,OrdersForSelf,PlaceOrder,double"
+	if strings.Join(names, ",") != expectedOrder {
+		t.Fatalf("Expected items %s, but got %s", expectedOrder, strings.Join(names, ","))
+	}
+
+	tests := []struct {
+		name    string
+		actual  interface{}
+		expects interface{}
+	}{
+		{"Person.Interface", items["Person"].Interface, "type"},
+		{"Person.Comment", items["Person"].Comment, "A person in the shop"},
+		{"Person.Fields", items["Person"].Fields, []doc.Field{{Name: "name", Class: "String"}, {Name: "born", Class: "DateTime"}}},
+		{"Status.Values", items["Status"].Values, []string{"CLOSED", "OPEN"}},
+		{"OrderPlaced.Topic", items["OrderPlaced"].Topic, "shop.OrderPlaced"},
+		{"OrderPlaced.Fields", items["OrderPlaced"].Fields, []doc.Field{{Name: "buyer", Class: "Person"}}},
+		{"ManageOrders.Comment", items["ManageOrders"].Comment, "Can manage every order"},
+		{"ManageOrders.Grant", items["ManageOrders"].Grant, "orders:manage"},
+		{"Staff.Grants", items["Staff"].Grants, []string{"orders:view"}},
+		{"Manager.Role", items["Manager"].Role, "manager"},
+		{"Manager.Extends", items["Manager"].Extends, []string{"Staff"}},
+		{"Manager.Grants", items["Manager"].Grants, []string{"orders:manage", "orders:view"}},
+		{"Owner.Grants", items["Owner"].Grants, []string{"orders:manage", "orders:view"}},
+		{"Roles", documentation.Roles, &doc.RoleMatrix{
+			Grants: []string{"orders:manage", "orders:view"},
+			Roles: []doc.RoleGrants{
+				{Role: "Staff", Granted: []bool{false, true}},
+				{Role: "manager", Granted: []bool{true, true}},
+				{Role: "Owner", Granted: []bool{true, true}},
+			},
+		}},
+		{"OrdersForSelf.Interface", items["OrdersForSelf"].Interface, "policy"},
+		{"OrdersForSelf.Arguments", items["OrdersForSelf"].Arguments, []string{"UserContext"}},
+		{"OrdersForSelf.Payload", items["OrdersForSelf"].Payload, "Person"},
+		{"OrdersForSelf.Returns", items["OrdersForSelf"].Returns, "Boolean"},
+		{"PlaceOrder.Payload", items["PlaceOrder"].Payload, "Person"},
+		{"PlaceOrder.Returns", items["PlaceOrder"].Returns, "Status"},
+		{"PlaceOrder.Topic", items["PlaceOrder"].Topic, "shop.PlaceOrder"},
+		{"PlaceOrder.Timeout", items["PlaceOrder"].Timeout, "30s"},
+		{"PlaceOrder.Requires", items["PlaceOrder"].Requires, []string{"orders:manage", "OrdersForSelf"}},
+		{"double.Arguments", items["double"].Arguments, []string{"Integer"}},
+		{"double.Returns", items["double"].Returns, "Integer"},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.actual, test.expects) {
+			t.Errorf("Expected %s to be %v, but got %v", test.name, test.expects, test.actual)
+		}
+	}
+}
+
+// CAN RENDER MARKDOWN
+func TestMarkdown(t *testing.T) {
+	var out bytes.Buffer
+	if err := doc.Markdown(&out, buildDocumentation(t)); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"# shop\n\nThe shop sells things\n",
+		"## type Person\n\nA person in the shop\n\n| Field | Class |\n| --- | --- |\n| `name` | `String` |\n| `born` | `DateTime` |\n",
+		"## role Manager\n\n- **Role:** `manager`\n- **Extends:** `Staff`\n- **Grants:** `orders:manage, orders:view`\n",
+		"## Roles\n\n| Role | `orders:manage` | `orders:view` |\n| --- | :---: | :---: |\n| `Staff` |  | ✓ |\n| `manager` | ✓ | ✓ |\n| `Owner` | ✓ | ✓ |\n",
+		"## command PlaceOrder\n\nPlaces an order\n\n- **Payload:** `Person`\n- **Returns:** `Status`\n- **Topic:** `shop.PlaceOrder`\n- **Timeout:** `30s`\n- **Requires:** `orders:manage, OrdersForSelf`\n",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("Expected markdown to contain\n%s\nbut got\n%s", expected, out.String())
+		}
+	}
+}
+
+// CAN RENDER A STATIC SITE
+func TestHTML(t *testing.T) {
+	dir := t.TempDir()
+	if err := doc.HTML(dir, buildDocumentation(t)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "tailwind.css")); err != nil {
+		t.Fatalf("Expected the stylesheet to be written: %s", err)
+	}
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(index), `<h2 id="PlaceOrder" class="pt-8 mt-4"><span class="text-blue-500">command</span> PlaceOrder</h2>`) {
+		t.Errorf("Expected index.html to document PlaceOrder, but got\n%s", index)
+	}
+}
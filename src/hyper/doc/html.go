@@ -0,0 +1,35 @@
+package doc
+
+import (
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/hntrl/hyper/docs"
+)
+
+var contextTemplate = template.Must(template.New("context.html").Funcs(template.FuncMap{
+	"details": itemDetails,
+}).ParseFS(docs.FS, "templates/context.html"))
+
+// HTML writes the documentation of a context as a static site in dir, styled
+// with the same stylesheet as the project's own site.
+func HTML(dir string, ctx Context) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	stylesheet, err := fs.ReadFile(docs.FS, "tailwind.css")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tailwind.css"), stylesheet, 0644); err != nil {
+		return err
+	}
+	file, err := os.Create(filepath.Join(dir, "index.html"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return contextTemplate.Execute(file, ctx)
+}
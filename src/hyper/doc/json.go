@@ -0,0 +1,16 @@
+package doc
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// JSON writes the documentation of a context as indented JSON
+func JSON(w io.Writer, ctx Context) error {
+	out, err := json.MarshalIndent(ctx, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(out, '\n'))
+	return err
+}
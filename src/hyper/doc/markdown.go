@@ -0,0 +1,122 @@
+package doc
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Markdown writes the documentation of a context as a Markdown document
+func Markdown(w io.Writer, ctx Context) error {
+	var out strings.Builder
+	fmt.Fprintf(&out, "# %s\n", ctx.Name)
+	if ctx.Comment != "" {
+		fmt.Fprintf(&out, "\n%s\n", ctx.Comment)
+	}
+	if len(ctx.Imports) > 0 {
+		imports := make([]string, len(ctx.Imports))
+		for idx, source := range ctx.Imports {
+			imports[idx] = "`" + source + "`"
+		}
+		fmt.Fprintf(&out, "\n**Imports:** %s\n", strings.Join(imports, ", "))
+	}
+	for _, item := range ctx.Items {
+		fmt.Fprintf(&out, "\n## %s %s", item.Interface, item.Name)
+		if item.Private {
+			out.WriteString(" (private)")
+		}
+		out.WriteString("\n")
+		if item.Comment != "" {
+			fmt.Fprintf(&out, "\n%s\n", item.Comment)
+		}
+		if details := itemDetails(item); len(details) > 0 {
+			out.WriteString("\n")
+			for _, detail := range details {
+				fmt.Fprintf(&out, "- **%s:** `%s`\n", detail.Label, detail.Value)
+			}
+		}
+		if len(item.Values) > 0 {
+			out.WriteString("\n| Value |\n| --- |\n")
+			for _, value := range item.Values {
+				fmt.Fprintf(&out, "| `%s` |\n", value)
+			}
+		}
+		if len(item.Fields) > 0 {
+			out.WriteString("\n| Field | Class |\n| --- | --- |\n")
+			for _, field := range item.Fields {
+				fmt.Fprintf(&out, "| `%s` | `%s` |\n", field.Name, field.Class)
+			}
+		}
+	}
+	if ctx.Roles != nil {
+		out.WriteString("\n## Roles\n\n| Role |")
+		for _, grant := range ctx.Roles.Grants {
+			fmt.Fprintf(&out, " `%s` |", grant)
+		}
+		out.WriteString("\n| --- |" + strings.Repeat(" :---: |", len(ctx.Roles.Grants)) + "\n")
+		for _, role := range ctx.Roles.Roles {
+			fmt.Fprintf(&out, "| `%s` |", role.Role)
+			for _, granted := range role.Granted {
+				if granted {
+					out.WriteString(" ✓ |")
+				} else {
+					out.WriteString("  |")
+				}
+			}
+			out.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+type detail struct {
+	Label string
+	Value string
+}
+
+// itemDetails returns the labelled one-line facts about an item, shared by
+// the Markdown and HTML output
+func itemDetails(item Item) []detail {
+	details := make([]detail, 0)
+	if item.Class != "" {
+		details = append(details, detail{"Class", item.Class})
+	}
+	if item.Default != "" {
+		details = append(details, detail{"Default", item.Default})
+	}
+	if item.Arguments != nil {
+		details = append(details, detail{"Arguments", "(" + strings.Join(item.Arguments, ", ") + ")"})
+	}
+	if item.Payload != "" {
+		details = append(details, detail{"Payload", item.Payload})
+	}
+	if item.Returns != "" {
+		details = append(details, detail{"Returns", item.Returns})
+	}
+	if item.Event != "" {
+		details = append(details, detail{"Event", item.Event})
+	}
+	if item.Topic != "" {
+		details = append(details, detail{"Topic", item.Topic})
+	}
+	if item.Timeout != "" {
+		details = append(details, detail{"Timeout", item.Timeout})
+	}
+	if item.Requires != nil {
+		details = append(details, detail{"Requires", strings.Join(item.Requires, ", ")})
+	}
+	if item.Grant != "" {
+		details = append(details, detail{"Grant", item.Grant})
+	}
+	if item.Role != "" {
+		details = append(details, detail{"Role", item.Role})
+	}
+	if len(item.Extends) > 0 {
+		details = append(details, detail{"Extends", strings.Join(item.Extends, ", ")})
+	}
+	if len(item.Grants) > 0 {
+		details = append(details, detail{"Grants", strings.Join(item.Grants, ", ")})
+	}
+	return details
+}
@@ -1,13 +1,16 @@
 package domain
 
 import (
+	"bytes"
 	"fmt"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/hntrl/hyper/src/hyper/ast"
 	"github.com/hntrl/hyper/src/hyper/stdlib"
 	"github.com/hntrl/hyper/src/hyper/symbols"
+	"github.com/hntrl/hyper/src/hyper/symbols/errors"
 )
 
 type ContextPath string
@@ -17,6 +20,10 @@ type ContextBuilder struct {
 	Contexts          map[ContextPath]*Context
 	interfaces        map[string]interface{}
 	selectorOverrides map[string]symbols.ScopeValue
+	sources           map[ContextPath][]byte
+	// failedDependency is set when an item that's resolved while resolving
+	// another one fails, so the other one isn't reported as failing too
+	failedDependency bool
 }
 
 func NewContextBuilder() *ContextBuilder {
@@ -24,6 +31,7 @@ func NewContextBuilder() *ContextBuilder {
 		Contexts:          make(map[ContextPath]*Context),
 		interfaces:        make(map[string]interface{}),
 		selectorOverrides: make(map[string]symbols.ScopeValue),
+		sources:           make(map[ContextPath][]byte),
 	}
 }
 
@@ -37,29 +45,61 @@ func (bd *ContextBuilder) ParseContext(node ast.Manifest, path string) (*Context
 	if err != nil {
 		return nil, err
 	}
+	errs := make([]error, 0)
 	for _, ctx := range bd.Contexts {
-		for key := range ctx.unresolvedItems {
-			err := ctx.resolveItem(key)
-			if err != nil {
-				return nil, fmt.Errorf("cannot import %s: %s", ctx.Identifier, err.Error())
+		itemErrs := bd.resolveItems(ctx)
+		if len(itemErrs) == 0 {
+			if err := ctx.propagateObjectMethods(); err != nil {
+				itemErrs = append(itemErrs, err)
+			} else if err := ctx.resolveDeferred(); err != nil {
+				itemErrs = append(itemErrs, err)
 			}
 		}
-		err := ctx.propagateObjectMethods()
-		if err != nil {
-			return nil, fmt.Errorf("cannot import %s: %s", ctx.Identifier, err.Error())
+		for _, err := range itemErrs {
+			errs = append(errs, fmt.Errorf("cannot import %s: %w", ctx.Identifier, err))
 		}
 	}
+	if len(errs) > 0 {
+		return nil, joinBuildErrors(errs)
+	}
 	return bd.Contexts[bd.hostContextPath], nil
 }
+
+// resolveItems resolves every item in ctx, and returns the errors of the ones
+// that failed in the order they're declared. Items that only failed because an
+// item they use failed aren't included, since the error is with the other item.
+func (bd *ContextBuilder) resolveItems(ctx *Context) []error {
+	errs := make([]error, 0)
+	for _, item := range ctx.manifestNode.Context.Items {
+		key := itemName(item.Init)
+		if _, ok := ctx.unresolvedItems[key]; ok {
+			bd.failedDependency = false
+			if err := ctx.resolveItem(key); err != nil && bd.failedDependency {
+				continue
+			}
+		}
+		if err, ok := ctx.failedItems[key]; ok {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
 func (bd *ContextBuilder) addContext(node ast.Manifest, path string) error {
 	cwd := filepath.Dir(path)
+	itemSources := make([]ContextPath, len(node.Context.Items))
+	for idx := range itemSources {
+		itemSources[idx] = ContextPath(path)
+	}
 	for _, useStatement := range node.Context.Remotes {
 		remotePath := filepath.Join(cwd, useStatement.Source)
-		itemSet, err := ParseContextItemSetFromFile(remotePath)
+		itemSet, err := bd.parseContextItemSet(remotePath)
 		if err != nil {
 			return err
 		}
 		node.Context.Items = append(node.Context.Items, itemSet.Items...)
+		for range itemSet.Items {
+			itemSources = append(itemSources, ContextPath(remotePath))
+		}
 	}
 	ctx := &Context{
 		Identifier:       node.Context.Name,
@@ -68,7 +108,9 @@ func (bd *ContextBuilder) addContext(node ast.Manifest, path string) error {
 		Items:            make(map[string]ContextItem),
 		ImportedContexts: make([]ContextPath, 0),
 		unresolvedItems:  make(map[string]ast.Node),
+		failedItems:      make(map[string]error),
 		manifestNode:     node,
+		itemSources:      itemSources,
 		builder:          bd,
 	}
 	for k, v := range bd.selectorOverrides {
@@ -101,6 +143,46 @@ func (bd *ContextBuilder) RegisterInterface(key string, val interface{}) {
 	bd.interfaces[key] = val
 }
 
+// RegisterSource makes the builder use src as the contents of the file at path
+// instead of reading it from disk (like for an unsaved buffer in an editor).
+func (bd *ContextBuilder) RegisterSource(path string, src []byte) {
+	bd.sources[ContextPath(path)] = src
+}
+
+func (bd *ContextBuilder) parseContext(path string) (*ast.Manifest, error) {
+	if src, ok := bd.sources[ContextPath(path)]; ok {
+		return ParseContext(bytes.NewReader(src), path)
+	}
+	return ParseContextFromFile(path)
+}
+func (bd *ContextBuilder) parseContextItemSet(path string) (*ast.ContextItemSet, error) {
+	if src, ok := bd.sources[ContextPath(path)]; ok {
+		return ParseContextItemSet(bytes.NewReader(src), path)
+	}
+	return ParseContextItemSetFromFile(path)
+}
+
+// Sources returns the paths of every file the builder read to build its
+// contexts: the manifests and the item sets they pulled in with `use`.
+func (bd *ContextBuilder) Sources() []string {
+	seen := make(map[ContextPath]bool)
+	sources := make([]string, 0)
+	for _, ctx := range bd.Contexts {
+		paths := []ContextPath{ctx.Path}
+		for _, useStatement := range ctx.manifestNode.Context.Remotes {
+			paths = append(paths, ContextPath(filepath.Join(filepath.Dir(string(ctx.Path)), useStatement.Source)))
+		}
+		for _, path := range paths {
+			if !seen[path] {
+				seen[path] = true
+				sources = append(sources, string(path))
+			}
+		}
+	}
+	sort.Strings(sources)
+	return sources
+}
+
 func (bd *ContextBuilder) HostContext() *Context {
 	return bd.GetContextByPath(string(bd.hostContextPath))
 }
@@ -123,8 +205,13 @@ type Context struct {
 	Selectors        map[string]symbols.ScopeValue
 	ImportedContexts []ContextPath
 	unresolvedItems  map[string]ast.Node
-	manifestNode     ast.Manifest
-	builder          *ContextBuilder
+	// failedItems are the errors of the items that couldn't be resolved
+	failedItems  map[string]error
+	manifestNode ast.Manifest
+	builder      *ContextBuilder
+	// itemSources holds the file each item in manifestNode was parsed from,
+	// since items can be pulled in from other files with `use`
+	itemSources []ContextPath
 }
 
 func (ctx *Context) ImportPackage(source string) error {
@@ -137,10 +224,11 @@ func (ctx *Context) ImportPackage(source string) error {
 		return err
 	}
 	if existingContext := ctx.builder.GetContextByPath(absPath); existingContext != nil {
+		ctx.ImportedContexts = append(ctx.ImportedContexts, ContextPath(absPath))
 		addContextToSelectors(ctx, existingContext)
 		return nil
 	}
-	manifest, err := ParseContextFromFile(absPath)
+	manifest, err := ctx.builder.parseContext(absPath)
 	if err != nil {
 		return err
 	}
@@ -159,11 +247,11 @@ func (ctx *Context) ImportPackage(source string) error {
 func (ctx *Context) addObject(node ast.ContextObject) error {
 	targetInterface, ok := ctx.builder.interfaces[node.Interface]
 	if !ok {
-		return fmt.Errorf("cannot find interface %s", node.Interface)
+		return errors.NodeError(node, errors.UnknownInterface, "cannot find interface %s", node.Interface)
 	}
 	contextObjectInterface, ok := targetInterface.(ContextObjectInterface)
 	if !ok {
-		return fmt.Errorf("interface %s does not implement ContextObjectInterface", node.Interface)
+		return errors.NodeError(node, errors.InvalidInterface, "interface %s does not implement ContextObjectInterface", node.Interface)
 	}
 	contextItem, err := contextObjectInterface.FromNode(ctx, node)
 	if err != nil {
@@ -175,11 +263,11 @@ func (ctx *Context) addObject(node ast.ContextObject) error {
 func (ctx *Context) addMethod(node ast.ContextMethod) error {
 	targetInterface, ok := ctx.builder.interfaces[node.Interface]
 	if !ok {
-		return fmt.Errorf("cannot find interface %s", node.Interface)
+		return errors.NodeError(node, errors.UnknownInterface, "cannot find interface %s", node.Interface)
 	}
 	contextMethodInterface, ok := targetInterface.(ContextMethodInterface)
 	if !ok {
-		return fmt.Errorf("interface %s does not implement ContextMethodInterface", node.Interface)
+		return errors.NodeError(node, errors.InvalidInterface, "interface %s does not implement ContextMethodInterface", node.Interface)
 	}
 	contextItem, err := contextMethodInterface.FromNode(ctx, node)
 	if err != nil {
@@ -198,41 +286,89 @@ func (ctx *Context) addFunction(node ast.FunctionExpression) error {
 	return nil
 }
 func (ctx *Context) resolveItem(key string) error {
+	var err error
 	switch node := ctx.unresolvedItems[key].(type) {
 	case ast.ContextMethod:
-		err := ctx.addMethod(node)
-		if err != nil {
-			return err
-		}
+		err = ctx.addMethod(node)
 	case ast.ContextObject:
-		err := ctx.addObject(node)
-		if err != nil {
-			return err
-		}
+		err = ctx.addObject(node)
 	case ast.FunctionExpression:
-		err := ctx.addFunction(node)
-		if err != nil {
-			return err
-		}
+		err = ctx.addFunction(node)
 	}
 	delete(ctx.unresolvedItems, key)
-	return nil
+	if err != nil {
+		err = wrapBuildError(ctx.sourceOf(key), err)
+		ctx.failedItems[key] = err
+	}
+	return err
+}
+
+// sourceOf returns the path of the file the item with the given name was
+// declared in.
+func (ctx *Context) sourceOf(key string) ContextPath {
+	_, path := ctx.Declaration(key)
+	return path
+}
+
+// Declaration returns the node the item with the given name was declared with
+// and the path of the file it was declared in. If there isn't an item with that
+// name, the node is nil.
+func (ctx *Context) Declaration(key string) (ast.Node, ContextPath) {
+	for idx, item := range ctx.manifestNode.Context.Items {
+		if itemName(item.Init) == key {
+			return item.Init, ctx.itemSources[idx]
+		}
+	}
+	return nil, ctx.Path
+}
+
+// Manifest returns the syntax tree the context was built from, with the items
+// pulled in with `use` appended to the context's items.
+func (ctx *Context) Manifest() ast.Manifest {
+	return ctx.manifestNode
+}
+
+func itemName(node ast.Node) string {
+	switch node := node.(type) {
+	case ast.ContextObject:
+		return node.Name
+	case ast.ContextMethod:
+		return node.Name
+	case ast.FunctionExpression:
+		return node.Name
+	}
+	return ""
 }
 
 func (ctx *Context) propagateObjectMethods() error {
-	for _, node := range ctx.manifestNode.Context.Items {
+	for idx, node := range ctx.manifestNode.Context.Items {
 		if objectMethodNode, ok := node.Init.(ast.ContextObjectMethod); ok {
 			target, ok := ctx.Items[objectMethodNode.Target]
 			if !ok {
-				return fmt.Errorf("cannot find target %s", objectMethodNode.Target)
+				return wrapBuildError(ctx.itemSources[idx], fmt.Errorf("cannot find target %s", objectMethodNode.Target))
 			}
 			methodReceiver, ok := target.HostItem.(ObjectMethodReceiver)
 			if !ok {
-				return fmt.Errorf("cannot add method %s to %s: target does not implement ObjectMethodReceiver", objectMethodNode.Name, objectMethodNode.Target)
+				return wrapBuildError(ctx.itemSources[idx], fmt.Errorf("cannot add method %s to %s: target does not implement ObjectMethodReceiver", objectMethodNode.Name, objectMethodNode.Target))
 			}
 			err := methodReceiver.AddMethod(ctx, objectMethodNode)
 			if err != nil {
-				return err
+				return wrapBuildError(ctx.itemSources[idx], err)
+			}
+		}
+	}
+	return nil
+}
+
+func (ctx *Context) resolveDeferred() error {
+	for idx, node := range ctx.manifestNode.Context.Items {
+		item, ok := ctx.Items[itemName(node.Init)]
+		if !ok {
+			continue
+		}
+		if resolver, ok := item.HostItem.(DeferredResolver); ok {
+			if err := resolver.ResolveDeferred(ctx); err != nil {
+				return wrapBuildError(ctx.itemSources[idx], err)
 			}
 		}
 	}
@@ -243,12 +379,28 @@ func (ctx *Context) Symbols() *symbols.SymbolTable {
 	return symbols.NewSymbolTable(ctx)
 }
 
+func (ctx *Context) Keys() []string {
+	keys := make([]string, 0, len(ctx.Selectors))
+	for key := range ctx.Selectors {
+		keys = append(keys, key)
+	}
+	for _, item := range ctx.manifestNode.Context.Items {
+		if name := itemName(item.Init); name != "" {
+			if _, ok := ctx.Selectors[name]; !ok {
+				keys = append(keys, name)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
 func (ctx *Context) Get(key string) (symbols.ScopeValue, error) {
 	if _, ok := ctx.unresolvedItems[key]; ok {
-		err := ctx.resolveItem(key)
-		if err != nil {
-			return nil, err
-		}
+		ctx.resolveItem(key)
+	}
+	if err, ok := ctx.failedItems[key]; ok {
+		ctx.builder.failedDependency = true
+		return nil, err
 	}
 	if selector, ok := ctx.Selectors[key]; ok {
 		return selector, nil
@@ -263,17 +415,35 @@ type RemoteContext struct {
 	inner *Context
 }
 
+// Get returns the remote item of the item named key, which is nil for items
+// that aren't exported (like private ones). Selectors that aren't items of the
+// context are returned as they are.
 func (rc *RemoteContext) Get(key string) (symbols.ScopeValue, error) {
 	obj, err := rc.inner.Get(key)
 	if err != nil {
-		return nil, fmt.Errorf("cannot import %s: %s", rc.inner.Identifier, err.Error())
+		return nil, fmt.Errorf("cannot import %s: %w", rc.inner.Identifier, err)
 	}
-	if contextItem, ok := obj.(ContextItem); ok {
+	if contextItem, ok := rc.inner.Items[key]; ok {
 		return contextItem.RemoteItem, nil
 	}
 	return obj, nil
 }
 
+// Context returns the context the remote items are accessed from.
+func (rc *RemoteContext) Context() *Context {
+	return rc.inner
+}
+
+func (rc *RemoteContext) Keys() []string {
+	keys := make([]string, 0)
+	for _, key := range rc.inner.Keys() {
+		if obj, err := rc.Get(key); err == nil && obj != nil {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
 // Domain is the ambiguous object that is used to separate contexts by their
 // selector parts into an object that the interpreter can understand.
 type Domain map[string]symbols.ScopeValue
@@ -292,6 +462,14 @@ func NewDomainFromSelectors(selectors map[string]symbols.ScopeValue) Domain {
 func (d Domain) Get(key string) (symbols.ScopeValue, error) {
 	return d[key], nil
 }
+func (d Domain) Keys() []string {
+	keys := make([]string, 0, len(d))
+	for key := range d {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
 func (d Domain) AddContextBySelector(selector string, ctx *Context) error {
 	selectorParts := strings.Split(selector, ".")
 	if len(selectorParts) == 1 {
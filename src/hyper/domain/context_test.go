@@ -0,0 +1,67 @@
+package domain_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces"
+)
+
+const brokenManifest = `context shop {
+  type Order {
+    total Money
+  }
+
+  type Refund {
+    order Order
+  }
+
+  type Person {
+    name String
+  }
+
+  type Receipt {
+    buyer Person
+    printedAt Time
+  }
+}
+`
+
+// CAN REPORT THE ERRORS OF EVERY ITEM THAT FAILS TO BUILD
+func TestParseContextErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.hyper")
+	if err := os.WriteFile(path, []byte(brokenManifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tree, err := domain.ParseContextFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := domain.NewContextBuilder()
+	builder.RegisterInterface("type", interfaces.TypeInterface{})
+	_, err = builder.ParseContext(*tree, path)
+	if err == nil {
+		t.Fatal("Expected the context to fail to build")
+	}
+
+	// Refund only fails because Order does, so it isn't reported on its own
+	diagnostics := domain.NewDiagnostics(err, path)
+	expected := []struct {
+		line    int
+		column  int
+		message string
+	}{
+		{3, 11, "unknown selector Money"},
+		{16, 15, "unknown selector Time"},
+	}
+	if len(diagnostics) != len(expected) {
+		t.Fatalf("Expected %d diagnostics, but got %+v", len(expected), diagnostics)
+	}
+	for idx, diagnostic := range diagnostics {
+		if diagnostic.Path != path || diagnostic.Line != expected[idx].line || diagnostic.Column != expected[idx].column || diagnostic.Message != expected[idx].message {
+			t.Errorf("Expected %s:%d:%d: %s, but got %s", path, expected[idx].line, expected[idx].column, expected[idx].message, diagnostic.String())
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/parser"
+	symbolErrors "github.com/hntrl/hyper/src/hyper/symbols/errors"
+)
+
+// BuildError associates an error produced while building a context with the
+// file it originated from.
+type BuildError struct {
+	Path ContextPath
+	Err  error
+}
+
+func (e BuildError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Err.Error())
+}
+func (e BuildError) Unwrap() error {
+	return e.Err
+}
+
+// wrapBuildError attributes err to path unless it has already been attributed
+// to a (more specific) file further down the call stack.
+func wrapBuildError(path ContextPath, err error) error {
+	var buildErr BuildError
+	if errors.As(err, &buildErr) {
+		return err
+	}
+	return BuildError{Path: path, Err: err}
+}
+
+// joinBuildErrors returns the errors of building a context as one, which can
+// be unpacked into a diagnostic for each of them with NewDiagnostics
+func joinBuildErrors(errs []error) error {
+	return errors.Join(errs...)
+}
+
+// Diagnostic is a positioned, machine readable representation of an error
+// produced while parsing or building a context.
+type Diagnostic struct {
+	Path    string            `json:"file"`
+	Line    int               `json:"line"`
+	Column  int               `json:"column"`
+	Code    symbolErrors.Code `json:"code"`
+	Message string            `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s:%d:%d: %d: %s", d.Path, d.Line, d.Column, d.Code, d.Message)
+}
+
+// NewDiagnostic unpacks err into a Diagnostic. If the error can't be traced
+// back to a particular file, defaultPath is used instead.
+func NewDiagnostic(err error, defaultPath string) Diagnostic {
+	diagnostic := Diagnostic{
+		Path:    defaultPath,
+		Message: err.Error(),
+	}
+	var buildErr BuildError
+	if errors.As(err, &buildErr) {
+		diagnostic.Path = string(buildErr.Path)
+		diagnostic.Message = buildErr.Err.Error()
+	}
+	var interpreterErr symbolErrors.InterpreterError
+	var syntaxErr ast.SyntaxError
+	var lexerErr parser.LexerError
+	switch {
+	case errors.As(err, &interpreterErr):
+		diagnostic.Code = interpreterErr.Code
+		diagnostic.Message = interpreterErr.Msg
+		if interpreterErr.Node != nil {
+			pos := interpreterErr.Node.Pos()
+			diagnostic.Line, diagnostic.Column = pos.Line, pos.Column
+		}
+	case errors.As(err, &syntaxErr):
+		diagnostic.Code = symbolErrors.InvalidSyntaxTree
+		diagnostic.Message = syntaxErr.Msg
+		diagnostic.Line, diagnostic.Column = syntaxErr.Position.Line, syntaxErr.Position.Column
+	case errors.As(err, &lexerErr):
+		diagnostic.Code = symbolErrors.InvalidSyntaxTree
+		diagnostic.Message = lexerErr.Unwrap().Error()
+		diagnostic.Line, diagnostic.Column = lexerErr.Pos().Line, lexerErr.Pos().Column
+	}
+	return diagnostic
+}
+
+// NewDiagnostics unpacks err into a Diagnostic for each of the errors it's
+// made up of (like the ones of each item that failed to build).
+func NewDiagnostics(err error, defaultPath string) []Diagnostic {
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		diagnostics := make([]Diagnostic, 0)
+		for _, err := range joined.Unwrap() {
+			diagnostics = append(diagnostics, NewDiagnostics(err, defaultPath)...)
+		}
+		return diagnostics
+	}
+	return []Diagnostic{NewDiagnostic(err, defaultPath)}
+}
@@ -2,6 +2,7 @@ package domain
 
 import (
 	"bufio"
+	"io"
 	"os"
 
 	"github.com/hntrl/hyper/src/hyper/ast"
@@ -15,16 +16,24 @@ func ParseContextFromFile(path string) (*ast.Manifest, error) {
 	if err != nil {
 		return nil, err
 	}
-	lexer := parser.NewLexer(bufio.NewReader(file))
+	defer file.Close()
+	return ParseContext(file, path)
+}
+
+// ParseContext parses the manifest read from r. path is only used to
+// attribute errors to the file the source belongs to.
+func ParseContext(r io.Reader, path string) (manifest *ast.Manifest, err error) {
+	defer recoverLexerError(path, &err)
+	lexer := parser.NewLexer(bufio.NewReader(r))
 	parser := parser.NewParser(lexer)
 
-	manifest, err := ast.ParseManifest(parser)
+	manifest, err = ast.ParseManifest(parser)
 	if err != nil {
-		return nil, err
+		return nil, BuildError{Path: ContextPath(path), Err: err}
 	}
 	err = manifest.Validate()
 	if err != nil {
-		return nil, err
+		return nil, BuildError{Path: ContextPath(path), Err: err}
 	}
 	return manifest, nil
 }
@@ -34,16 +43,36 @@ func ParseContextItemSetFromFile(path string) (*ast.ContextItemSet, error) {
 	if err != nil {
 		return nil, err
 	}
-	lexer := parser.NewLexer(bufio.NewReader(file))
+	defer file.Close()
+	return ParseContextItemSet(file, path)
+}
+
+// ParseContextItemSet parses the context items read from r. path is only used
+// to attribute errors to the file the source belongs to.
+func ParseContextItemSet(r io.Reader, path string) (items *ast.ContextItemSet, err error) {
+	defer recoverLexerError(path, &err)
+	lexer := parser.NewLexer(bufio.NewReader(r))
 	parser := parser.NewParser(lexer)
 
-	items, err := ast.ParseContextItemSet(parser)
+	items, err = ast.ParseContextItemSet(parser)
 	if err != nil {
-		return nil, err
+		return nil, BuildError{Path: ContextPath(path), Err: err}
 	}
 	err = items.Validate()
 	if err != nil {
-		return nil, err
+		return nil, BuildError{Path: ContextPath(path), Err: err}
 	}
 	return items, nil
 }
+
+// recoverLexerError turns the panics raised by the lexer (on an unexpected
+// EOF or a failed read) into an error returned from the parse function.
+func recoverLexerError(path string, err *error) {
+	if r := recover(); r != nil {
+		lexerErr, ok := r.(parser.LexerError)
+		if !ok {
+			panic(r)
+		}
+		*err = BuildError{Path: ContextPath(path), Err: lexerErr}
+	}
+}
@@ -16,6 +16,14 @@ type ObjectMethodReceiver interface {
 	AddMethod(*Context, ast.ContextObjectMethod) error
 }
 
+// DeferredResolver is implemented by items that refer to items that can't be
+// resolved while the item itself is (like an entity that requires a policy
+// deciding on the entity). They're resolved once every item in the context
+// is, after object methods are added.
+type DeferredResolver interface {
+	ResolveDeferred(*Context) error
+}
+
 type ContextItem struct {
 	HostItem   symbols.ScopeValue
 	RemoteItem symbols.ScopeValue
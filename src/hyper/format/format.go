@@ -0,0 +1,146 @@
+// Package format implements the canonical formatting of hyper source.
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"reflect"
+
+	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/parser"
+	"github.com/hntrl/hyper/src/hyper/tokens"
+)
+
+// Source formats the hyper source in src, which can either be a manifest
+// (a context with its imports) or a set of context items pulled in with `use`.
+//
+// The formatted source is parsed again before it is returned, and an error is
+// returned if it doesn't produce a syntax tree equivalent to the original.
+func Source(src []byte) ([]byte, error) {
+	original, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	info, err := readSource(src)
+	if err != nil {
+		return nil, err
+	}
+	p := newPrinter(info)
+	switch node := original.(type) {
+	case *ast.Manifest:
+		p.manifest(*node)
+	case *ast.ContextItemSet:
+		p.itemSet(*node)
+	}
+	out := []byte(p.String())
+
+	formatted, err := parse(out)
+	if err != nil {
+		return nil, fmt.Errorf("format: formatted source does not parse: %s", err.Error())
+	}
+	if !equivalent(reflect.ValueOf(original), reflect.ValueOf(formatted)) {
+		return nil, fmt.Errorf("format: formatted source is not equivalent to the original")
+	}
+	return out, nil
+}
+
+// Node returns the canonical source representation of a manifest or context
+// item set. Since there is no source to take comments from, only the comments
+// kept in the tree (like the ones documenting context items) are printed.
+func Node(node ast.Node) ([]byte, error) {
+	p := newPrinter(nil)
+	switch node := node.(type) {
+	case ast.Manifest:
+		p.manifest(node)
+	case *ast.Manifest:
+		p.manifest(*node)
+	case ast.ContextItemSet:
+		p.itemSet(node)
+	case *ast.ContextItemSet:
+		p.itemSet(*node)
+	default:
+		return nil, fmt.Errorf("format: cannot format %T", node)
+	}
+	return []byte(p.String()), nil
+}
+
+// parse parses src as a manifest if it starts with an import or context
+// statement, and as a context item set otherwise.
+func parse(src []byte) (node ast.Node, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			lexerErr, ok := r.(parser.LexerError)
+			if !ok {
+				panic(r)
+			}
+			err = lexerErr
+		}
+	}()
+	lexer := parser.NewLexer(bufio.NewReader(bytes.NewReader(src)))
+	p := parser.NewParser(lexer)
+	_, tok, _ := p.ScanIgnore(tokens.NEWLINE, tokens.COMMENT)
+	p.Rollback(-1)
+
+	if tok == tokens.IMPORT || tok == tokens.CONTEXT {
+		manifest, err := ast.ParseManifest(p)
+		if err != nil {
+			return nil, err
+		}
+		if err := manifest.Validate(); err != nil {
+			return nil, err
+		}
+		return manifest, nil
+	}
+	items, err := ast.ParseContextItemSet(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := items.Validate(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// equivalent compares two syntax trees while ignoring where each node is
+// positioned in the source (which are the only unexported fields of a node).
+func equivalent(a, b reflect.Value) bool {
+	if a.IsValid() != b.IsValid() {
+		return false
+	}
+	if !a.IsValid() {
+		return true
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+	switch a.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if a.IsNil() || b.IsNil() {
+			return a.IsNil() == b.IsNil()
+		}
+		return equivalent(a.Elem(), b.Elem())
+	case reflect.Struct:
+		for idx := 0; idx < a.NumField(); idx++ {
+			if !a.Type().Field(idx).IsExported() {
+				continue
+			}
+			if !equivalent(a.Field(idx), b.Field(idx)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if a.Len() != b.Len() {
+			return false
+		}
+		for idx := 0; idx < a.Len(); idx++ {
+			if !equivalent(a.Index(idx), b.Index(idx)) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a.Interface() == b.Interface()
+	}
+}
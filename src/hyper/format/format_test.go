@@ -0,0 +1,179 @@
+package format
+
+import (
+	"testing"
+)
+
+type TestFixture struct {
+	lit     string
+	expects string
+}
+
+func evaluateTest(t *testing.T, test TestFixture) {
+	out, err := Source([]byte(test.lit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != test.expects {
+		t.Fatalf("Expected formatted source to be\n%s\nbut got\n%s", test.expects, string(out))
+	}
+	again, err := Source(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(out) {
+		t.Fatalf("Expected formatting to be idempotent, but got\n%s", string(again))
+	}
+}
+
+// CAN FORMAT MANIFEST
+func TestManifest(t *testing.T) {
+	evaluateTest(t, TestFixture{
+		lit: "import \"./foo.hyper\"\nimport \"time\"\ncontext bar {\nuse \"./items.hyper\"\n    type Baz {}\n}",
+		expects: `import "./foo.hyper"
+import "time"
+
+context bar {
+  use "./items.hyper"
+
+  type Baz {}
+}
+`,
+	})
+}
+
+// CAN FORMAT CONTEXT ITEM SET
+func TestContextItemSet(t *testing.T) {
+	evaluateTest(t, TestFixture{
+		lit:     "private type Foo extends bar.Baz requires Qux { a String }\nfunc (Foo) greet() String { return \"hi\" }\nquery Bar(id: String, {skip: Int?}) []Foo {}\ncommand Baz() timeout '5s' requires Qux, a.B {}",
+		expects: "private type Foo extends bar.Baz requires Qux {\n  a String\n}\n\nfunc (Foo) greet() String {\n  return \"hi\"\n}\n\nquery Bar(id: String, {skip: Int?}) []Foo {}\n\ncommand Baz() timeout \"5s\" requires Qux, a.B {}\n",
+	})
+}
+
+// CAN ALIGN FIELDS
+func TestFieldAlignment(t *testing.T) {
+	evaluateTest(t, TestFixture{
+		lit: `context foo {
+  parameter SecretKey {
+    type String
+    name = "key"
+    defaultValue="password1234"
+
+    description = "My super secret key"
+  }
+  enum Color { Red "red"
+  Green 'gr"een' }
+}`,
+		expects: `context foo {
+  parameter SecretKey {
+    type         String
+    name         = "key"
+    defaultValue = "password1234"
+
+    description = "My super secret key"
+  }
+
+  enum Color {
+    Red   "red"
+    Green 'gr"een'
+  }
+}
+`,
+	})
+}
+
+// CAN PRESERVE COMMENTS
+func TestComments(t *testing.T) {
+	evaluateTest(t, TestFixture{
+		lit: `// about foo
+context foo {
+  // about Person
+  // continued
+  type Person {
+    name String // about age
+    age  Number
+    // left at the end
+  }
+
+  // floating
+
+  func bar() {
+    // leading
+    x := 1 // trailing
+
+
+    return x
+    // end of block
+  }
+}
+`,
+		expects: `// about foo
+context foo {
+  // about Person
+  // continued
+  type Person {
+    name String // about age
+    age  Number
+    // left at the end
+  }
+
+  // floating
+
+  func bar() {
+    // leading
+    x := 1 // trailing
+
+    return x
+    // end of block
+  }
+}
+`,
+	})
+}
+
+// CAN FORMAT STATEMENTS
+func TestStatements(t *testing.T) {
+	evaluateTest(t, TestFixture{
+		lit: `func foo(a: Number) Number {
+  y, err := try bar.baz(a, "s")[0:2]
+  if (a > 2 && !y) { return -a } else if ((a + 1) * 2 == 4) { print(a) } else { throw errors.New("a", "b") }
+  for (i := 0; i < 10; i) { continue }
+  for (idx, val in []Float{1.0, 2.5}) { break }
+  while (true) { guard a }
+  switch (a) {
+  case 1:
+  print(a)
+  default:
+  z := Person{name: "a", ...other}
+  }
+  return {a: 1}
+}`,
+		expects: `func foo(a: Number) Number {
+  y, err := try bar.baz(a, "s")[0:2]
+  if (a > 2 && !y) {
+    return -a
+  } else if ((a + 1) * 2 == 4) {
+    print(a)
+  } else {
+    throw errors.New("a", "b")
+  }
+  for (i := 0; i < 10; i) {
+    continue
+  }
+  for (idx, val in []Float{1.0, 2.5}) {
+    break
+  }
+  while (true) {
+    guard a
+  }
+  switch (a) {
+    case 1:
+      print(a)
+    default:
+      z := Person{name: "a", ...other}
+  }
+  return {a: 1}
+}
+`,
+	})
+}
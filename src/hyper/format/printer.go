@@ -0,0 +1,785 @@
+package format
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/tokens"
+)
+
+const indentation = "  "
+
+// comment is a COMMENT token lifted out of the source. The parser only keeps
+// comments that document context items and fields, so the rest are
+// re-interleaved into the output by their position.
+type comment struct {
+	line int
+	text string
+	// spans is the number of source lines the comment occupies
+	spans int
+	// followedByBlank is set if there is an empty line between the comment
+	// and whatever follows it. This decides whether the parser attaches the
+	// comment to the next item, so it has to survive formatting.
+	followedByBlank bool
+}
+
+type printer struct {
+	lines      []string
+	current    strings.Builder
+	lineIndent int
+	indent     int
+
+	// wantBlank is set when an empty line should separate the next line
+	// written from the last. It is dropped at the start and end of blocks.
+	wantBlank bool
+	// lastLine is the source line of the last node (or closing brace) printed
+	lastLine int
+	// lastCodeIdx is the index in lines of the last line that holds code,
+	// which is where trailing comments are attached
+	lastCodeIdx int
+
+	comments   []comment
+	src        *source
+	useComment bool
+}
+
+func newPrinter(src *source) *printer {
+	p := &printer{lastCodeIdx: -1}
+	if src != nil {
+		p.src = src
+		p.comments = src.comments
+	} else {
+		p.useComment = true
+	}
+	return p
+}
+
+func (p *printer) String() string {
+	p.newline()
+	for len(p.lines) > 0 && p.lines[len(p.lines)-1] == "" {
+		p.lines = p.lines[:len(p.lines)-1]
+	}
+	return strings.Join(p.lines, "\n") + "\n"
+}
+
+// write appends s to the line currently being printed
+func (p *printer) write(s string) {
+	if p.current.Len() == 0 {
+		if p.wantBlank && len(p.lines) > 0 && p.lines[len(p.lines)-1] != "" {
+			p.lines = append(p.lines, "")
+		}
+		p.wantBlank = false
+		p.lineIndent = p.indent
+	}
+	p.current.WriteString(s)
+}
+
+// newline finishes the line currently being printed
+func (p *printer) newline() {
+	if p.current.Len() == 0 {
+		return
+	}
+	p.lines = append(p.lines, strings.Repeat(indentation, p.lineIndent)+p.current.String())
+	p.current.Reset()
+	p.lastCodeIdx = len(p.lines) - 1
+}
+
+// openBlock writes the opening brace of a block and moves into it
+func (p *printer) openBlock() {
+	p.write("{")
+	p.newline()
+	p.indent++
+	p.wantBlank = false
+}
+
+// closeBlock flushes any comments left inside the block, and writes the
+// closing brace. endLine is the source line of the closing brace, if known.
+func (p *printer) closeBlock(endLine int) {
+	p.flushComments(endLine)
+	p.newline()
+	p.indent--
+	p.wantBlank = false
+	p.write("}")
+	if endLine > 0 {
+		p.lastLine = endLine
+	}
+}
+
+// hasCommentsBefore reports if there are pending comments before line
+func (p *printer) hasCommentsBefore(line int) bool {
+	return line > 0 && len(p.comments) > 0 && p.comments[0].line < line
+}
+
+// flushComments prints all of the pending comments that appear before line.
+// Comments on the same line as the last printed node are kept as trailing
+// comments of that line.
+func (p *printer) flushComments(line int) {
+	if line <= 0 {
+		return
+	}
+	for len(p.comments) > 0 && p.comments[0].line < line {
+		c := p.comments[0]
+		p.comments = p.comments[1:]
+		parts := commentParts(c.text)
+		if c.line == p.lastLine && p.current.Len() == 0 && p.lastCodeIdx >= 0 {
+			p.lines[p.lastCodeIdx] += " " + parts[0]
+			parts = parts[1:]
+		} else {
+			p.newline()
+			if p.lastLine > 0 && c.line > p.lastLine+1 {
+				p.wantBlank = true
+			}
+		}
+		for _, part := range parts {
+			p.write(part)
+			p.newline()
+		}
+		p.lastLine = c.line + c.spans - 1
+		if c.followedByBlank {
+			p.wantBlank = true
+		}
+	}
+}
+
+// nodeComment prints the Comment field of a node when there isn't any source
+// to take comments from
+func (p *printer) nodeComment(text string) {
+	if !p.useComment || text == "" {
+		return
+	}
+	for _, part := range commentParts(text) {
+		p.write(part)
+		p.newline()
+	}
+}
+
+// beginNode prepares the printer for a node that starts on a new line at the
+// given source line
+func (p *printer) beginNode(line int) {
+	p.flushComments(line)
+	p.newline()
+	if p.lastLine > 0 && line > p.lastLine+1 {
+		p.wantBlank = true
+	}
+	if line > 0 {
+		p.lastLine = line
+	}
+}
+
+// commentParts splits a comment literal into printable comments. The lexer
+// joins consecutive line comments with an escaped newline, and block comments
+// keep their own newlines.
+func commentParts(text string) []string {
+	parts := strings.Split(text, "\\n")
+	for idx, part := range parts {
+		if strings.Contains(part, "\n") {
+			parts[idx] = "/*" + part + "*/"
+		} else {
+			parts[idx] = "//" + part
+		}
+	}
+	return parts
+}
+
+// Manifest :: ImportStatement* Context
+func (p *printer) manifest(node ast.Manifest) {
+	for _, imp := range node.Imports {
+		p.beginNode(imp.Pos().Line)
+		p.write(fmt.Sprintf("import %s", quote(imp.Source)))
+		p.newline()
+	}
+	if len(node.Imports) > 0 {
+		p.wantBlank = true
+	}
+	p.context(node.Context)
+	p.flushComments(maxLine)
+}
+
+// ContextItemSet :: ContextItem*
+func (p *printer) itemSet(node ast.ContextItemSet) {
+	for idx, item := range node.Items {
+		if idx > 0 {
+			p.wantBlank = true
+		}
+		p.contextItem(item)
+	}
+	p.flushComments(maxLine)
+}
+
+// Context :: COMMENT? CONTEXT Selector LCURLY (UseStatement | ContextItem)* RCURLY
+func (p *printer) context(node ast.Context) {
+	p.beginNode(node.Pos().Line)
+	p.nodeComment(node.Comment)
+	p.write(fmt.Sprintf("context %s ", node.Name))
+	endLine := p.closingLine(node.Pos())
+	if len(node.Remotes) == 0 && len(node.Items) == 0 && !p.hasCommentsBefore(endLine) {
+		p.write("{}")
+		p.newline()
+		return
+	}
+	p.openBlock()
+	// use statements and items are printed in the order they appear in so that
+	// comments stay next to whatever they were written for
+	remoteIdx, itemIdx := 0, 0
+	var lastWasUse bool
+	for remoteIdx < len(node.Remotes) || itemIdx < len(node.Items) {
+		useNext := itemIdx >= len(node.Items) ||
+			(remoteIdx < len(node.Remotes) && before(node.Remotes[remoteIdx].Pos(), node.Items[itemIdx].Pos()))
+		if remoteIdx+itemIdx > 0 && !(useNext && lastWasUse) {
+			p.wantBlank = true
+		}
+		if useNext {
+			use := node.Remotes[remoteIdx]
+			p.beginNode(use.Pos().Line)
+			p.write(fmt.Sprintf("use %s", quote(use.Source)))
+			p.newline()
+			remoteIdx++
+		} else {
+			p.contextItem(node.Items[itemIdx])
+			itemIdx++
+		}
+		lastWasUse = useNext
+	}
+	p.closeBlock(endLine)
+	p.newline()
+}
+
+// ContextItem :: (ContextObject | ContextObjectMethod | ContextMethod | FunctionExpression)
+func (p *printer) contextItem(node ast.ContextItem) {
+	switch item := node.Init.(type) {
+	case ast.ContextObject:
+		p.contextObject(item)
+	case ast.ContextObjectMethod:
+		p.beginNode(item.Pos().Line)
+		p.write(fmt.Sprintf("func (%s) %s", item.Target, item.Name))
+		p.functionBlock(item.Block)
+	case ast.ContextMethod:
+		p.beginNode(item.Pos().Line)
+		p.nodeComment(item.Comment)
+		if item.Private {
+			p.write("private ")
+		}
+		p.write(fmt.Sprintf("%s %s", item.Interface, item.Name))
+		p.functionParameters(item.Block.Parameters)
+		if item.Timeout != "" {
+			p.write(" timeout " + quote(item.Timeout))
+		}
+		if len(item.Requires) > 0 {
+			p.write(" requires " + requires(item.Requires))
+		}
+		p.write(" ")
+		p.block(item.Block.Body)
+	case ast.FunctionExpression:
+		p.beginNode(item.Pos().Line)
+		p.functionExpression(item)
+	}
+	p.newline()
+}
+
+// ContextObject :: COMMENT? PRIVATE? IDENT IDENT (EXTENDS Selector)? LCURLY FieldStatement* RCURLY
+func (p *printer) contextObject(node ast.ContextObject) {
+	p.beginNode(node.Pos().Line)
+	p.nodeComment(node.Comment)
+	if node.Private {
+		p.write("private ")
+	}
+	p.write(fmt.Sprintf("%s %s ", node.Interface, node.Name))
+	if node.Extends != nil {
+		p.write(fmt.Sprintf("extends %s ", selector(*node.Extends)))
+	}
+	if len(node.Requires) > 0 {
+		p.write(fmt.Sprintf("requires %s ", requires(node.Requires)))
+	}
+	endLine := p.closingLine(node.Pos())
+	if len(node.Fields) == 0 && !p.hasCommentsBefore(endLine) {
+		p.write("{}")
+		return
+	}
+	p.openBlock()
+	for _, group := range p.fieldGroups(node.Fields) {
+		width := 0
+		for _, field := range group {
+			if name := fieldName(field); len(name) > width {
+				width = len(name)
+			}
+		}
+		for _, field := range group {
+			p.beginNode(field.Pos().Line)
+			p.nodeComment(field.Comment)
+			name := fieldName(field)
+			p.write(name + strings.Repeat(" ", width-len(name)+1))
+			switch init := field.Init.(type) {
+			case ast.FieldAssignmentExpression:
+				p.write("= ")
+				p.expression(init.Init)
+			case ast.EnumExpression:
+				p.write(quote(init.Init))
+			case ast.FieldExpression:
+				p.write(typeExpression(init.Init))
+			}
+			p.newline()
+		}
+	}
+	p.closeBlock(endLine)
+}
+
+// fieldGroups splits fields into runs that aren't separated by an empty line
+// in the source. Each run is aligned on its own.
+func (p *printer) fieldGroups(fields []ast.FieldStatement) [][]ast.FieldStatement {
+	groups := make([][]ast.FieldStatement, 0)
+	start := 0
+	for idx := 1; idx <= len(fields); idx++ {
+		if idx == len(fields) || p.src.hasBlankBetween(fields[idx-1].Pos().Line, fields[idx].Pos().Line) {
+			groups = append(groups, fields[start:idx])
+			start = idx
+		}
+	}
+	return groups
+}
+
+func fieldName(field ast.FieldStatement) string {
+	switch init := field.Init.(type) {
+	case ast.FieldAssignmentExpression:
+		return init.Name
+	case ast.EnumExpression:
+		return init.Name
+	case ast.FieldExpression:
+		return init.Name
+	}
+	return ""
+}
+
+// FunctionExpression :: FUNC IDENT FunctionBlock
+func (p *printer) functionExpression(node ast.FunctionExpression) {
+	p.write(fmt.Sprintf("func %s", node.Name))
+	p.functionBlock(node.Body)
+}
+
+// FunctionBlock :: FunctionParameters LCURLY Block RCURLY
+func (p *printer) functionBlock(node ast.FunctionBlock) {
+	p.functionParameters(node.Parameters)
+	p.write(" ")
+	p.block(node.Body)
+}
+
+func (p *printer) functionParameters(node ast.FunctionParameters) {
+	p.write("(")
+	p.write(argumentList(node.Arguments))
+	p.write(")")
+	if node.ReturnType != nil {
+		p.write(" " + typeExpression(*node.ReturnType))
+	}
+}
+
+// block writes a braced block of statements
+func (p *printer) block(node ast.Block) {
+	endLine := node.Pos().Line
+	if len(node.Statements) == 0 && !p.hasCommentsBefore(endLine) {
+		p.write("{}")
+		return
+	}
+	p.openBlock()
+	p.statements(node.Statements)
+	p.closeBlock(endLine)
+}
+
+func (p *printer) statements(stmts []ast.BlockStatement) {
+	for _, stmt := range stmts {
+		p.beginNode(stmt.Pos().Line)
+		p.statement(stmt)
+		p.newline()
+	}
+}
+
+// BlockStatement :: Expression
+//
+//	| DeclarationStatement
+//	| AssignmentStatement
+//	| IfStatement
+//	| WhileStatement
+//	| ForStatement
+//	| ContinueStatement
+//	| BreakStatement
+//	| SwitchBlock
+//	| GuardStatement
+//	| ReturnStatement
+//	| ThrowStatement
+//	| TryStatement
+func (p *printer) statement(node ast.BlockStatement) {
+	switch stmt := node.Init.(type) {
+	case ast.Expression:
+		p.expression(stmt)
+	case ast.DeclarationStatement:
+		p.declaration(stmt)
+	case ast.AssignmentStatement:
+		p.assignment(stmt)
+	case ast.IfStatement:
+		p.ifStatement(stmt)
+	case ast.WhileStatement:
+		p.write("while (")
+		p.expression(stmt.Condition)
+		p.write(") ")
+		p.block(stmt.Body)
+	case ast.ForStatement:
+		p.write("for (")
+		switch cond := stmt.Condition.(type) {
+		case ast.ForCondition:
+			if cond.Init != nil {
+				p.declaration(*cond.Init)
+				p.write("; ")
+			}
+			p.expression(cond.Condition)
+			p.write("; ")
+			switch update := cond.Update.(type) {
+			case ast.Expression:
+				p.expression(update)
+			case ast.AssignmentStatement:
+				p.assignment(update)
+			}
+		case ast.RangeCondition:
+			p.write(fmt.Sprintf("%s, %s in ", cond.Index, cond.Value))
+			p.expression(cond.Target)
+		}
+		p.write(") ")
+		p.block(stmt.Body)
+	case ast.ContinueStatement:
+		p.write("continue")
+	case ast.BreakStatement:
+		p.write("break")
+	case ast.SwitchBlock:
+		p.switchBlock(stmt)
+	case ast.GuardStatement:
+		p.write("guard ")
+		p.expression(stmt.Init)
+	case ast.ReturnStatement:
+		p.write("return ")
+		p.expression(stmt.Init)
+	case ast.ThrowStatement:
+		p.write("throw ")
+		p.expression(stmt.Init)
+	case ast.TryStatement:
+		p.write("try ")
+		p.expression(stmt.Init)
+	}
+}
+
+// DeclarationStatement :: IDENT (COMMA IDENT)? DEFINE (Expression | TryStatement)
+func (p *printer) declaration(node ast.DeclarationStatement) {
+	p.write(node.Target)
+	if node.SecondaryTarget != nil {
+		p.write(", " + *node.SecondaryTarget)
+	}
+	p.write(" := ")
+	p.statementInit(node.Init)
+}
+
+// AssignmentStatement :: AssignmentTargetExpression token(IsAssignmentOperator) Expression
+//
+//	| AssignmentTargetExpression (INC | DEC)
+func (p *printer) assignment(node ast.AssignmentStatement) {
+	for idx, member := range node.Target.Members {
+		switch init := member.Init.(type) {
+		case string:
+			if idx > 0 {
+				p.write(".")
+			}
+			p.write(init)
+		case ast.IndexExpression:
+			p.indexExpression(init)
+		}
+	}
+	// INC and DEC are stored as a binary operator applied with a literal 1
+	if node.Operator == tokens.ADD || node.Operator == tokens.SUB {
+		if node.Operator == tokens.ADD {
+			p.write("++")
+		} else {
+			p.write("--")
+		}
+		return
+	}
+	if node.SecondaryTarget != nil {
+		p.write(", " + *node.SecondaryTarget)
+	}
+	p.write(fmt.Sprintf(" %s ", node.Operator))
+	p.statementInit(node.Init)
+}
+
+func (p *printer) statementInit(node ast.Node) {
+	switch init := node.(type) {
+	case ast.Expression:
+		p.expression(init)
+	case ast.TryStatement:
+		p.write("try ")
+		p.expression(init.Init)
+	}
+}
+
+// IfStatement :: IF LPAREN Expression RPAREN InlineBlock (ELSE IfStatement)? (ELSE Block)?
+func (p *printer) ifStatement(node ast.IfStatement) {
+	p.write("if (")
+	p.expression(node.Condition)
+	p.write(") ")
+	p.block(node.Body)
+	switch alt := node.Alternate.(type) {
+	case ast.IfStatement:
+		p.write(" else ")
+		p.ifStatement(alt)
+	case ast.Block:
+		p.write(" else ")
+		p.block(alt)
+	}
+}
+
+// SwitchBlock :: SWITCH LPAREN Expression RPAREN LCURLY SwitchStatement* RCURLY
+func (p *printer) switchBlock(node ast.SwitchBlock) {
+	p.write("switch (")
+	p.expression(node.Target)
+	p.write(") ")
+	if len(node.Statements) == 0 {
+		p.write("{}")
+		return
+	}
+	p.openBlock()
+	var endLine int
+	for _, stmt := range node.Statements {
+		p.beginNode(stmt.Pos().Line)
+		if stmt.IsDefault {
+			p.write("default:")
+		} else {
+			p.write("case ")
+			p.expression(*stmt.Condition)
+			p.write(":")
+		}
+		p.newline()
+		p.indent++
+		p.wantBlank = false
+		p.statements(stmt.Body.Statements)
+		p.indent--
+		// the body of the last case ends at the closing brace of the switch
+		endLine = stmt.Body.Pos().Line
+	}
+	p.closeBlock(endLine)
+}
+
+// Expression :: Literal
+//
+//	| TemplateLiteral
+//	| ArrayExpression
+//	| InstanceExpression
+//	| UnaryExpression
+//	| BinaryExpression
+//	| ObjectPattern
+//	| FunctionExpression
+//	| ValueExpression
+//	| LPAREN Expression RPAREN
+func (p *printer) expression(node ast.Expression) {
+	switch expr := node.Init.(type) {
+	case ast.Literal:
+		p.write(literal(expr))
+	case ast.TemplateLiteral:
+		p.write("`")
+		for _, part := range expr.Parts {
+			switch part := part.(type) {
+			case string:
+				p.write(part)
+			case ast.Expression:
+				p.write("{")
+				p.expression(part)
+				p.write("}")
+			case *ast.Expression:
+				p.write("{")
+				p.expression(*part)
+				p.write("}")
+			}
+		}
+		p.write("`")
+	case ast.ArrayExpression:
+		p.write("[]" + typeExpression(expr.Init) + "{")
+		for idx, elem := range expr.Elements {
+			if idx > 0 {
+				p.write(", ")
+			}
+			p.expression(elem)
+		}
+		p.write("}")
+	case ast.InstanceExpression:
+		p.write(selector(expr.Selector))
+		p.propertyList(expr.Properties)
+	case ast.ObjectPattern:
+		p.propertyList(expr.Properties)
+	case ast.UnaryExpression:
+		p.write(expr.Operator.String())
+		p.expression(expr.Init)
+	case ast.BinaryExpression:
+		p.expression(expr.Left)
+		p.write(fmt.Sprintf(" %s ", expr.Operator))
+		p.expression(expr.Right)
+	case ast.FunctionExpression:
+		p.functionExpression(expr)
+	case ast.ValueExpression:
+		for idx, member := range expr.Members {
+			switch init := member.Init.(type) {
+			case string:
+				if idx > 0 {
+					p.write(".")
+				}
+				p.write(init)
+			case ast.CallExpression:
+				p.write("(")
+				for argIdx, arg := range init.Arguments {
+					if argIdx > 0 {
+						p.write(", ")
+					}
+					p.expression(arg)
+				}
+				p.write(")")
+			case ast.IndexExpression:
+				p.indexExpression(init)
+			}
+		}
+	case ast.Expression:
+		p.write("(")
+		p.expression(expr)
+		p.write(")")
+	}
+}
+
+// IndexExpression :: LSQUARE Expression? SEMICOLON? Expression? RSQUARE
+func (p *printer) indexExpression(node ast.IndexExpression) {
+	p.write("[")
+	if node.Left != nil {
+		p.expression(*node.Left)
+	}
+	if node.IsRange {
+		p.write(":")
+	}
+	if node.Right != nil {
+		p.expression(*node.Right)
+	}
+	p.write("]")
+}
+
+// PropertyList :: (Property | SpreadElement) (COMMA PropertyList)?
+func (p *printer) propertyList(node ast.PropertyList) {
+	if len(node) == 0 {
+		p.write("{}")
+		return
+	}
+	p.write("{")
+	for idx, prop := range node {
+		if idx > 0 {
+			p.write(", ")
+		}
+		switch prop := prop.(type) {
+		case ast.Property:
+			p.write(prop.Key + ": ")
+			p.expression(prop.Init)
+		case ast.SpreadElement:
+			p.write("...")
+			p.expression(prop.Init)
+		}
+	}
+	p.write("}")
+}
+
+// ArgumentList :: (ArgumentItem | ArgumentObject) (COMMA ArgumentList)?
+func argumentList(node ast.ArgumentList) string {
+	args := make([]string, len(node.Items))
+	for idx, item := range node.Items {
+		switch item := item.(type) {
+		case ast.ArgumentItem:
+			args[idx] = argumentItem(item)
+		case ast.ArgumentObject:
+			items := make([]string, len(item.Items))
+			for itemIdx, objItem := range item.Items {
+				items[itemIdx] = argumentItem(objItem)
+			}
+			args[idx] = "{" + strings.Join(items, ", ") + "}"
+		}
+	}
+	return strings.Join(args, ", ")
+}
+
+// ArgumentItem :: IDENT COLON TypeExpression
+func argumentItem(node ast.ArgumentItem) string {
+	return node.Key + ": " + typeExpression(node.Init)
+}
+
+// TypeExpression :: (LSQUARE RSQUARE)? Selector QUESTION?
+//
+//	| (LSQUARE RSQUARE)? PARTIAL LT Selector GT QUESTION?
+func typeExpression(node ast.TypeExpression) string {
+	out := selector(node.Selector)
+	if node.IsPartial {
+		out = tokens.PARTIAL.String() + "<" + out + ">"
+	}
+	if node.IsArray {
+		out = "[]" + out
+	}
+	if node.IsOptional {
+		out += "?"
+	}
+	return out
+}
+
+// Selector :: IDENT (PERIOD IDENT)*
+func selector(node ast.Selector) string {
+	return strings.Join(node.Members, ".")
+}
+
+// requires returns the selectors in a requires clause
+func requires(nodes []ast.Selector) string {
+	selectors := make([]string, len(nodes))
+	for idx, node := range nodes {
+		selectors[idx] = selector(node)
+	}
+	return strings.Join(selectors, ", ")
+}
+
+// Literal :: STRING
+//
+//	| INT
+//	| FLOAT
+func literal(node ast.Literal) string {
+	switch val := node.Value.(type) {
+	case string:
+		return quote(val)
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		out := strconv.FormatFloat(val, 'f', -1, 64)
+		if !strings.Contains(out, ".") {
+			out += ".0"
+		}
+		return out
+	case bool:
+		return strconv.FormatBool(val)
+	case nil:
+		return "nil"
+	}
+	return fmt.Sprint(node.Value)
+}
+
+// quote wraps a string value in quotes. The lexer doesn't support escaping
+// the terminator, so single quotes are used for values holding double quotes.
+func quote(val string) string {
+	if strings.Contains(val, `"`) && !strings.Contains(val, "'") {
+		return "'" + val + "'"
+	}
+	return `"` + val + `"`
+}
+
+func before(a, b tokens.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+}
+
+// closingLine returns the source line of the brace that closes the first block
+// opened at or after pos, or 0 if there isn't any source to search
+func (p *printer) closingLine(pos tokens.Position) int {
+	if p.src == nil {
+		return 0
+	}
+	return p.src.closingLine(pos)
+}
@@ -0,0 +1,98 @@
+package format
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	"github.com/hntrl/hyper/src/hyper/parser"
+	"github.com/hntrl/hyper/src/hyper/tokens"
+)
+
+const maxLine = int(^uint(0) >> 1)
+
+type sourceToken struct {
+	pos tokens.Position
+	tok tokens.Token
+}
+
+// source holds what the printer needs to know about the original text that
+// isn't kept in the syntax tree
+type source struct {
+	lines    []string
+	tokens   []sourceToken
+	comments []comment
+}
+
+func readSource(src []byte) (out *source, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			lexerErr, ok := r.(parser.LexerError)
+			if !ok {
+				panic(r)
+			}
+			err = lexerErr
+		}
+	}()
+	out = &source{
+		lines:    strings.Split(string(src), "\n"),
+		tokens:   make([]sourceToken, 0),
+		comments: make([]comment, 0),
+	}
+	lexer := parser.NewLexer(bufio.NewReader(bytes.NewReader(src)))
+	for {
+		pos, tok, lit := lexer.Lex()
+		if tok == tokens.EOF {
+			break
+		}
+		out.tokens = append(out.tokens, sourceToken{pos, tok})
+		if tok == tokens.COMMENT {
+			c := comment{
+				line:  pos.Line,
+				text:  lit,
+				spans: strings.Count(lit, "\\n") + strings.Count(lit, "\n") + 1,
+			}
+			endLine := c.line + c.spans - 1
+			c.followedByBlank = out.hasBlankBetween(endLine, endLine+2)
+			out.comments = append(out.comments, c)
+		}
+	}
+	return out, nil
+}
+
+// closingLine returns the line of the brace that closes the first block
+// opened at or after pos
+func (s *source) closingLine(pos tokens.Position) int {
+	depth := 0
+	for _, token := range s.tokens {
+		if before(token.pos, pos) {
+			continue
+		}
+		switch token.tok {
+		case tokens.LCURLY:
+			depth++
+		case tokens.RCURLY:
+			if depth == 0 {
+				continue
+			}
+			depth--
+			if depth == 0 {
+				return token.pos.Line
+			}
+		}
+	}
+	return 0
+}
+
+// hasBlankBetween reports if there is an empty line between two lines
+func (s *source) hasBlankBetween(from, to int) bool {
+	if s == nil {
+		return false
+	}
+	for line := from + 1; line < to && line <= len(s.lines); line++ {
+		if strings.TrimSpace(s.lines[line-1]) == "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+// Package graph describes how the contexts built by a ContextBuilder depend on
+// each other, and renders that as a Graphviz or Mermaid diagram.
+package graph
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/symbols"
+)
+
+type EdgeKind string
+
+const (
+	// ImportEdge is drawn from a context to a context it imports
+	ImportEdge EdgeKind = "imports"
+	// CallEdge is drawn from a context to a context whose methods (like
+	// commands and queries) it calls
+	CallEdge EdgeKind = "calls"
+	// ConsumeEdge is drawn from a context to a context whose events it
+	// consumes (like with a subscription or a projection)
+	ConsumeEdge EdgeKind = "consumes"
+)
+
+type Edge struct {
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Kind  EdgeKind `json:"kind"`
+	Label string   `json:"label,omitempty"`
+}
+
+type Graph struct {
+	Contexts []string `json:"contexts"`
+	Edges    []Edge   `json:"edges"`
+}
+
+// EventConsumer is implemented by context items that handle events. Topics
+// are formatted like the topics of events: the identifier of the context the
+// event belongs to followed by the name of the event.
+type EventConsumer interface {
+	ConsumedTopics() []string
+}
+
+// New returns the graph of the contexts in builder. Edges are only drawn
+// between different contexts.
+func New(builder *domain.ContextBuilder) Graph {
+	g := Graph{Contexts: make([]string, 0), Edges: make([]Edge, 0)}
+	seen := make(map[Edge]bool)
+	addEdge := func(edge Edge) {
+		if edge.From != edge.To && !seen[edge] {
+			seen[edge] = true
+			g.Edges = append(g.Edges, edge)
+		}
+	}
+	for _, ctx := range builder.Contexts {
+		g.Contexts = append(g.Contexts, ctx.Identifier)
+		for _, path := range ctx.ImportedContexts {
+			if imported := builder.GetContextByPath(string(path)); imported != nil {
+				addEdge(Edge{From: ctx.Identifier, To: imported.Identifier, Kind: ImportEdge})
+			}
+		}
+		for _, edge := range callEdges(ctx) {
+			addEdge(edge)
+		}
+		for _, edge := range consumeEdges(ctx) {
+			addEdge(edge)
+		}
+	}
+	sort.Strings(g.Contexts)
+	sort.Slice(g.Edges, func(i, j int) bool {
+		a, b := g.Edges[i], g.Edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Label < b.Label
+	})
+	return g
+}
+
+// callEdges finds the calls made anywhere in the context's items to methods
+// that belong to another context.
+func callEdges(ctx *domain.Context) []Edge {
+	table := ctx.Symbols()
+	edges := make([]Edge, 0)
+	for _, item := range ctx.Manifest().Context.Items {
+		inspect(reflect.ValueOf(item.Init), func(expr ast.ValueExpression) {
+			target, name := calledRemoteItem(table, calledSelector(expr))
+			if target == nil {
+				return
+			}
+			if method, ok := declaration(target, name).(ast.ContextMethod); ok {
+				edges = append(edges, Edge{
+					From:  ctx.Identifier,
+					To:    target.Identifier,
+					Kind:  CallEdge,
+					Label: fmt.Sprintf("%s %s", method.Interface, method.Name),
+				})
+			}
+		})
+	}
+	return edges
+}
+
+// calledSelector returns the members of the selector a value expression
+// starts by calling (like `other.PlaceOrder` in `other.PlaceOrder(order)`)
+func calledSelector(expr ast.ValueExpression) []string {
+	members := make([]string, 0)
+	for _, member := range expr.Members {
+		switch init := member.Init.(type) {
+		case string:
+			members = append(members, init)
+		case ast.CallExpression:
+			return members
+		default:
+			return nil
+		}
+	}
+	return nil
+}
+
+// calledRemoteItem finds the context and the name of the item in it that a
+// called selector refers to. The item doesn't have to be the last member,
+// since items can have methods of their own (like
+// `other.PlaceOrder.withTimeout`).
+func calledRemoteItem(table *symbols.SymbolTable, members []string) (*domain.Context, string) {
+	for idx := len(members) - 1; idx > 0; idx-- {
+		parent, err := table.ResolveSelector(ast.Selector{Members: members[:idx]})
+		if err != nil {
+			continue
+		}
+		if remoteContext, ok := parent.(*domain.RemoteContext); ok {
+			return remoteContext.Context(), members[idx]
+		}
+	}
+	return nil, ""
+}
+
+// consumeEdges finds the items in ctx that consume events from other contexts
+func consumeEdges(ctx *domain.Context) []Edge {
+	edges := make([]Edge, 0)
+	for _, name := range ctx.Keys() {
+		consumer, ok := ctx.Items[name].HostItem.(EventConsumer)
+		if !ok {
+			continue
+		}
+		itemLabel := name
+		if node, ok := declaration(ctx, name).(ast.ContextObject); ok {
+			itemLabel = node.Interface + " " + name
+		} else if node, ok := declaration(ctx, name).(ast.ContextMethod); ok {
+			itemLabel = node.Interface + " " + name
+		}
+		for _, topic := range consumer.ConsumedTopics() {
+			separator := strings.LastIndex(topic, ".")
+			if separator == -1 {
+				continue
+			}
+			edges = append(edges, Edge{
+				From:  ctx.Identifier,
+				To:    topic[:separator],
+				Kind:  ConsumeEdge,
+				Label: fmt.Sprintf("event %s (%s)", topic[separator+1:], itemLabel),
+			})
+		}
+	}
+	return edges
+}
+
+func declaration(ctx *domain.Context, name string) ast.Node {
+	node, _ := ctx.Declaration(name)
+	return node
+}
+
+// inspect calls fn with every value expression in the syntax tree under value
+func inspect(value reflect.Value, fn func(ast.ValueExpression)) {
+	switch value.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if !value.IsNil() {
+			inspect(value.Elem(), fn)
+		}
+	case reflect.Struct:
+		if expr, ok := value.Interface().(ast.ValueExpression); ok {
+			fn(expr)
+		}
+		for idx := 0; idx < value.NumField(); idx++ {
+			if value.Type().Field(idx).IsExported() {
+				inspect(value.Field(idx), fn)
+			}
+		}
+	case reflect.Slice:
+		for idx := 0; idx < value.Len(); idx++ {
+			inspect(value.Index(idx), fn)
+		}
+	}
+}
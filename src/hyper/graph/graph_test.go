@@ -0,0 +1,131 @@
+package graph_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/graph"
+	"github.com/hntrl/hyper/src/hyper/interfaces"
+	"github.com/hntrl/hyper/src/hyper/interfaces/stream"
+)
+
+var testFiles = map[string]string{
+	"index.hyper": `import "./orders.hyper"
+import "./billing.hyper"
+
+context acme.shop {
+  query Checkout(order: acme.orders.Order) Int {
+    total := acme.billing.Total(order)
+    return total
+  }
+
+  query Cancel(order: acme.orders.Order) Int {
+    return acme.billing.Refund.withTimeout("30s", order)
+  }
+
+  sub notify(event: acme.orders.OrderPlaced) {
+    print(event.id)
+  }
+}
+`,
+	"orders.hyper": `context acme.orders {
+  type Order {
+    id Int
+  }
+
+  event OrderPlaced {
+    id Int
+  }
+}
+`,
+	"billing.hyper": `import "./orders.hyper"
+
+context acme.billing {
+  query Total(order: acme.orders.Order) Int {
+    return order.id * 2
+  }
+
+  query Refund(order: acme.orders.Order) Int {
+    return order.id
+  }
+}
+`,
+}
+
+func buildGraph(t *testing.T) graph.Graph {
+	dir := t.TempDir()
+	for name, content := range testFiles {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "index.hyper")
+	tree, err := domain.ParseContextFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := domain.NewContextBuilder()
+	builder.RegisterInterface("type", interfaces.TypeInterface{})
+	builder.RegisterInterface("event", stream.EventInterface{})
+	builder.RegisterInterface("query", stream.QueryInterface{})
+	builder.RegisterInterface("sub", stream.SubscriptionInterface{})
+	if _, err := builder.ParseContext(*tree, path); err != nil {
+		t.Fatal(err)
+	}
+	return graph.New(builder)
+}
+
+// CAN GRAPH CONTEXT DEPENDENCIES
+func TestNew(t *testing.T) {
+	g := buildGraph(t)
+	if strings.Join(g.Contexts, ",") != "acme.billing,acme.orders,acme.shop" {
+		t.Fatalf("Expected contexts acme.billing, acme.orders and acme.shop, but got %v", g.Contexts)
+	}
+	expects := []graph.Edge{
+		{From: "acme.billing", To: "acme.orders", Kind: graph.ImportEdge},
+		{From: "acme.shop", To: "acme.billing", Kind: graph.CallEdge, Label: "query Refund"},
+		{From: "acme.shop", To: "acme.billing", Kind: graph.CallEdge, Label: "query Total"},
+		{From: "acme.shop", To: "acme.billing", Kind: graph.ImportEdge},
+		{From: "acme.shop", To: "acme.orders", Kind: graph.ConsumeEdge, Label: "event OrderPlaced (sub notify)"},
+		{From: "acme.shop", To: "acme.orders", Kind: graph.ImportEdge},
+	}
+	if len(g.Edges) != len(expects) {
+		t.Fatalf("Expected edges %v, but got %v", expects, g.Edges)
+	}
+	for idx, edge := range g.Edges {
+		if edge != expects[idx] {
+			t.Errorf("Expected edge %d to be %v, but got %v", idx, expects[idx], edge)
+		}
+	}
+}
+
+// CAN RENDER DIAGRAMS
+func TestRender(t *testing.T) {
+	g := buildGraph(t)
+	var dot, mermaid bytes.Buffer
+	if err := graph.DOT(&dot, g); err != nil {
+		t.Fatal(err)
+	}
+	if err := graph.Mermaid(&mermaid, g); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		output   string
+		expected string
+	}{
+		{dot.String(), `  "acme.shop" -> "acme.billing" [label="calls query Total"];`},
+		{dot.String(), `  "acme.shop" -> "acme.orders" [label="consumes event OrderPlaced (sub notify)", style=dashed];`},
+		{dot.String(), `  "acme.shop" -> "acme.orders";`},
+		{mermaid.String(), `  c2 -- "calls query Total" --> c0`},
+		{mermaid.String(), `  c2 -. "consumes event OrderPlaced (sub notify)" .-> c1`},
+	}
+	for _, test := range tests {
+		if !strings.Contains(test.output, test.expected+"\n") {
+			t.Errorf("Expected output to contain\n%s\nbut got\n%s", test.expected, test.output)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package graph
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DOT writes the graph in the Graphviz DOT language
+func DOT(w io.Writer, g Graph) error {
+	var out strings.Builder
+	out.WriteString("digraph contexts {\n")
+	out.WriteString("  node [shape=box];\n")
+	for _, ctx := range g.Contexts {
+		fmt.Fprintf(&out, "  %s;\n", strconv.Quote(ctx))
+	}
+	for _, edge := range g.Edges {
+		attributes := make([]string, 0)
+		if edge.Kind != ImportEdge {
+			attributes = append(attributes, "label="+strconv.Quote(string(edge.Kind)+" "+edge.Label))
+		}
+		if edge.Kind == ConsumeEdge {
+			attributes = append(attributes, "style=dashed")
+		}
+		fmt.Fprintf(&out, "  %s -> %s", strconv.Quote(edge.From), strconv.Quote(edge.To))
+		if len(attributes) > 0 {
+			fmt.Fprintf(&out, " [%s]", strings.Join(attributes, ", "))
+		}
+		out.WriteString(";\n")
+	}
+	out.WriteString("}\n")
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+// Mermaid writes the graph as a Mermaid flowchart
+func Mermaid(w io.Writer, g Graph) error {
+	var out strings.Builder
+	out.WriteString("flowchart LR\n")
+	// context identifiers can contain periods, which mermaid doesn't allow in
+	// node ids
+	ids := make(map[string]string)
+	for idx, ctx := range g.Contexts {
+		ids[ctx] = fmt.Sprintf("c%d", idx)
+		fmt.Fprintf(&out, "  %s[%s]\n", ids[ctx], mermaidString(ctx))
+	}
+	for _, edge := range g.Edges {
+		from, to := ids[edge.From], ids[edge.To]
+		if to == "" {
+			// the context an event belongs to isn't always built
+			to = fmt.Sprintf("c%d", len(ids))
+			ids[edge.To] = to
+			fmt.Fprintf(&out, "  %s[%s]\n", to, mermaidString(edge.To))
+		}
+		switch edge.Kind {
+		case ImportEdge:
+			fmt.Fprintf(&out, "  %s --> %s\n", from, to)
+		case CallEdge:
+			fmt.Fprintf(&out, "  %s -- %s --> %s\n", from, mermaidString(string(edge.Kind)+" "+edge.Label), to)
+		case ConsumeEdge:
+			fmt.Fprintf(&out, "  %s -. %s .-> %s\n", from, mermaidString(string(edge.Kind)+" "+edge.Label), to)
+		}
+	}
+	_, err := io.WriteString(w, out.String())
+	return err
+}
+
+func mermaidString(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, "#quot;") + `"`
+}
@@ -7,4 +7,5 @@ import (
 
 func RegisterDefaults(builder *domain.ContextBuilder, process *runtime.Process) {
 	builder.RegisterInterface("grant", GrantInterface{})
+	builder.RegisterInterface("role", RoleInterface{})
 }
@@ -2,6 +2,7 @@ package access
 
 import (
 	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/doc"
 	"github.com/hntrl/hyper/src/hyper/domain"
 	"github.com/hntrl/hyper/src/hyper/symbols"
 	"github.com/hntrl/hyper/src/hyper/symbols/errors"
@@ -79,3 +80,10 @@ func (GrantValue) Class() symbols.Class {
 func (GrantValue) Value() interface{} {
 	return nil
 }
+
+func (gv GrantValue) Describe(item *doc.Item) {
+	if gv.Description != "" {
+		item.Comment = gv.Description
+	}
+	item.Grant = gv.Name
+}
@@ -0,0 +1,279 @@
+package access
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/doc"
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/symbols"
+	"github.com/hntrl/hyper/src/hyper/symbols/errors"
+)
+
+// RoleInterface declares roles, which bundle grants under a name that can be
+// given to callers instead of each of the grants. Roles list their grants with
+// `grant` fields and the roles they extend with `role` fields (or an extends
+// clause), and have every grant of the roles they extend.
+//
+//	role Manager extends Staff {
+//	  name = "shop:manager"
+//	  grant ManageOrders
+//	  role Auditor
+//	}
+type RoleInterface struct{}
+
+func (RoleInterface) FromNode(ctx *domain.Context, node ast.ContextObject) (*domain.ContextItem, error) {
+	table := ctx.Symbols()
+	if node.Private {
+		return nil, errors.NodeError(node, 0, "role cannot be private: roles aren't exported")
+	}
+	// the roles a role extends are checked for cycles before they're resolved,
+	// since resolving a role in a cycle would resolve itself again
+	if err := checkRoleCycle(ctx, node, []string{node.Name}); err != nil {
+		return nil, err
+	}
+	role := RoleValue{
+		Name:        node.Name,
+		Description: node.Comment,
+		Extends:     make([]RoleValue, 0),
+		Grants:      make([]GrantValue, 0),
+		identifier:  node.Name,
+		nameNode:    node,
+	}
+	for _, selector := range roleParents(node) {
+		value, err := table.ResolveSelector(selector)
+		if err != nil {
+			return nil, err
+		}
+		parent, ok := value.(RoleValue)
+		if !ok {
+			return nil, errors.NodeError(selector, 0, "%s is not a role: roles can only extend roles", strings.Join(selector.Members, "."))
+		}
+		role.Extends = append(role.Extends, parent)
+	}
+	for _, item := range node.Fields {
+		switch field := item.Init.(type) {
+		case ast.FieldAssignmentExpression:
+			switch field.Name {
+			case "name":
+				nameValue, err := table.ResolveExpression(field.Init)
+				if err != nil {
+					return nil, err
+				}
+				strValue, ok := nameValue.(symbols.StringValue)
+				if !ok {
+					return nil, errors.NodeError(field.Init, 0, "expected String for name, got %s", nameValue.Class().Descriptors().Name)
+				}
+				role.Name = string(strValue)
+				role.nameNode = field
+			case "description":
+				descriptionValue, err := table.ResolveExpression(field.Init)
+				if err != nil {
+					return nil, err
+				}
+				strValue, ok := descriptionValue.(symbols.StringValue)
+				if !ok {
+					return nil, errors.NodeError(field.Init, 0, "expected String for description, got %s", descriptionValue.Class().Descriptors().Name)
+				}
+				role.Description = string(strValue)
+			default:
+				return nil, errors.NodeError(field, 0, "unrecognized assignment %s in role", field.Name)
+			}
+		case ast.FieldExpression:
+			switch field.Name {
+			case "grant":
+				value, err := table.ResolveSelector(field.Init.Selector)
+				if err != nil {
+					return nil, err
+				}
+				grant, ok := value.(GrantValue)
+				if !ok {
+					return nil, errors.NodeError(field.Init, 0, "%s is not a grant", strings.Join(field.Init.Selector.Members, "."))
+				}
+				role.Grants = append(role.Grants, grant)
+			case "role":
+				// resolved with the extends clause
+			default:
+				return nil, errors.NodeError(field, 0, "unrecognized field %s in role (expected grant or role)", field.Name)
+			}
+		default:
+			return nil, errors.NodeError(field, 0, "%T not allowed in role", item)
+		}
+	}
+	return &domain.ContextItem{
+		HostItem:   role,
+		RemoteItem: nil,
+	}, nil
+}
+
+// roleParents returns the selectors of the roles node extends
+func roleParents(node ast.ContextObject) []ast.Selector {
+	parents := make([]ast.Selector, 0)
+	if node.Extends != nil {
+		parents = append(parents, *node.Extends)
+	}
+	for _, item := range node.Fields {
+		if field, ok := item.Init.(ast.FieldExpression); ok && field.Name == "role" {
+			parents = append(parents, field.Init.Selector)
+		}
+	}
+	return parents
+}
+
+// checkRoleCycle returns an error if node extends (directly or not) any of the
+// roles in path, which are the roles that led to it
+func checkRoleCycle(ctx *domain.Context, node ast.ContextObject, path []string) error {
+	for _, selector := range roleParents(node) {
+		if len(selector.Members) != 1 {
+			return errors.NodeError(selector, 0, "roles can only extend roles in the same context")
+		}
+		name := selector.Members[0]
+		for _, visited := range path {
+			if visited == name {
+				return errors.NodeError(selector, 0, "role cycle: %s", strings.Join(append(path, name), " -> "))
+			}
+		}
+		decl, _ := ctx.Declaration(name)
+		parent, ok := decl.(ast.ContextObject)
+		if !ok || parent.Interface != node.Interface {
+			continue
+		}
+		if err := checkRoleCycle(ctx, parent, append(path[:len(path):len(path)], name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	Role            = RoleClass{}
+	RoleDescriptors = &symbols.ClassDescriptors{
+		Name: "Role",
+	}
+)
+
+type RoleClass struct{}
+
+func (RoleClass) Descriptors() *symbols.ClassDescriptors {
+	return RoleDescriptors
+}
+
+type RoleValue struct {
+	Name        string
+	Description string
+	// Extends are the roles the role has every grant of
+	Extends []RoleValue
+	// Grants are the grants the role lists itself
+	Grants []GrantValue
+
+	// identifier is the name the role is declared with, and nameNode is where
+	// the name it's given to callers with is set
+	identifier string
+	nameNode   ast.Node
+}
+
+// ResolveDeferred checks that no role declared before this one is given to
+// callers with the same name, since callers can only be given one of them
+func (rv RoleValue) ResolveDeferred(ctx *domain.Context) error {
+	for _, item := range ctx.Manifest().Context.Items {
+		node, ok := item.Init.(ast.ContextObject)
+		if !ok {
+			continue
+		}
+		if node.Name == rv.identifier {
+			return nil
+		}
+		if other, ok := ctx.Items[node.Name].HostItem.(RoleValue); ok && other.Name == rv.Name {
+			return errors.NodeError(rv.nameNode, 0, "role %s is already given to callers as %s", node.Name, rv.Name)
+		}
+	}
+	return nil
+}
+
+func (RoleValue) Class() symbols.Class {
+	return Role
+}
+func (RoleValue) Value() interface{} {
+	return nil
+}
+
+// AllGrants returns the grants the role has, including the ones of the roles
+// it extends, sorted by name
+func (rv RoleValue) AllGrants() []GrantValue {
+	grants := make(map[string]GrantValue)
+	rv.collectGrants(grants)
+	out := make([]GrantValue, 0, len(grants))
+	for _, grant := range grants {
+		out = append(out, grant)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func (rv RoleValue) collectGrants(grants map[string]GrantValue) {
+	for _, grant := range rv.Grants {
+		grants[grant.Name] = grant
+	}
+	for _, parent := range rv.Extends {
+		parent.collectGrants(grants)
+	}
+}
+
+// HasGrant returns true if the role has the grant with the given name
+func (rv RoleValue) HasGrant(name string) bool {
+	for _, grant := range rv.Grants {
+		if grant.Name == name {
+			return true
+		}
+	}
+	for _, parent := range rv.Extends {
+		if parent.HasGrant(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rv RoleValue) Describe(item *doc.Item) {
+	if rv.Description != "" {
+		item.Comment = rv.Description
+	}
+	item.Role = rv.Name
+	item.Extends = make([]string, len(rv.Extends))
+	for idx, parent := range rv.Extends {
+		item.Extends[idx] = parent.Name
+	}
+	item.Grants = make([]string, 0)
+	for _, grant := range rv.AllGrants() {
+		item.Grants = append(item.Grants, grant.Name)
+	}
+}
+
+// Roles are the roles declared in a context, by the name they're given to
+// callers with
+type Roles map[string]RoleValue
+
+// ContextRoles returns the roles declared in ctx
+func ContextRoles(ctx *domain.Context) Roles {
+	roles := make(Roles)
+	for _, item := range ctx.Items {
+		if role, ok := item.HostItem.(RoleValue); ok {
+			roles[role.Name] = role
+		}
+	}
+	return roles
+}
+
+// HasGrant returns true if any of the named roles has the grant with the given
+// name. Names that aren't roles in r are ignored.
+func (r Roles) HasGrant(names []string, grant string) bool {
+	for _, name := range names {
+		if role, ok := r[name]; ok && role.HasGrant(grant) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,8 +2,10 @@ package interfaces
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/doc"
 	"github.com/hntrl/hyper/src/hyper/domain"
 	"github.com/hntrl/hyper/src/hyper/symbols"
 	"github.com/hntrl/hyper/src/hyper/symbols/errors"
@@ -81,6 +83,14 @@ func (en Enum) Descriptors() *symbols.ClassDescriptors {
 	}
 }
 
+func (en Enum) Describe(item *doc.Item) {
+	item.Values = make([]string, 0, len(en.Items))
+	for name := range en.Items {
+		item.Values = append(item.Values, name)
+	}
+	sort.Strings(item.Values)
+}
+
 type EnumItem struct {
 	parentType  *Enum
 	stringValue string `hash:"ignore"`
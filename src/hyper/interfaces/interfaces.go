@@ -16,5 +16,6 @@ func RegisterDefaults(builder *domain.ContextBuilder, process *runtime.Process)
 	builder.RegisterInterface("file", FileInterface{})
 	builder.RegisterInterface("param", ParameterInterface{})
 	builder.RegisterInterface("template", TemplateInterface{})
+	builder.RegisterInterface("test", TestInterface{})
 	builder.RegisterInterface("type", TypeInterface{})
 }
@@ -1,10 +1,13 @@
 package interfaces
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 
 	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/doc"
 	"github.com/hntrl/hyper/src/hyper/domain"
 	"github.com/hntrl/hyper/src/hyper/symbols"
 	"github.com/hntrl/hyper/src/hyper/symbols/errors"
@@ -80,7 +83,16 @@ func (pm Parameter) Value() interface{} {
 	return nil
 }
 
-func (pm Parameter) Attach(process *runtime.Process) error {
+func (pm Parameter) Describe(item *doc.Item) {
+	item.Class = doc.ClassName(pm.parentType)
+	if pm.defaultValue != nil {
+		if serialized, err := json.Marshal(pm.defaultValue.Value()); err == nil {
+			item.Default = string(serialized)
+		}
+	}
+}
+
+func (pm Parameter) Attach(ctx context.Context, process *runtime.Process) error {
 	varName := fmt.Sprintf("param_%s", pm.Name)
 	rawValue := os.Getenv(varName)
 	if rawValue == "" {
@@ -101,6 +113,6 @@ func (pm Parameter) Attach(process *runtime.Process) error {
 	process.Context.Selectors[pm.Name] = constructedValue
 	return nil
 }
-func (pm Parameter) Detach() error {
+func (pm Parameter) Detach(ctx context.Context) error {
 	return nil
 }
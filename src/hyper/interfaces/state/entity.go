@@ -2,6 +2,7 @@ package state
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"strconv"
@@ -9,17 +10,14 @@ import (
 	"time"
 
 	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/doc"
 	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces/stream"
 	"github.com/hntrl/hyper/src/hyper/symbols"
 	"github.com/hntrl/hyper/src/hyper/symbols/errors"
 	"github.com/hntrl/hyper/src/runtime/"
 	"github.com/hntrl/hyper/src/runtime//log"
-	"github.com/hntrl/hyper/src/runtime//resource"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	mongoOptions "go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/hntrl/hyper/src/runtime//storage"
 )
 
 var seededRand = rand.New(rand.NewSource(time.Now().UnixNano()))
@@ -68,8 +66,9 @@ func (EntityInterface) FromNode(ctx *domain.Context, node ast.ContextObject) (*d
 		}
 	}
 	store := &EntityStore{
-		entityType: ent,
-		methods:    make(map[EffectType]symbols.Function),
+		entityType:    ent,
+		methods:       make(map[EffectType]symbols.Function),
+		requiresNodes: node.Requires,
 	}
 	if !node.Private {
 		return &domain.ContextItem{
@@ -85,14 +84,48 @@ func (EntityInterface) FromNode(ctx *domain.Context, node ast.ContextObject) (*d
 }
 
 // EntityStore is synonymous to Entity (it uses the same value type
-// EntityValue). Only difference is this acts as the connection to the database
-// for the host context.
+// EntityValue). Only difference is this acts as the connection to the storage
+// backend for the host context.
 type EntityStore struct {
 	entityType   Entity
-	eventLog     *mongo.Collection               `hash:"ignore"`
-	projection   *mongo.Collection               `hash:"ignore"`
+	eventLog     storage.EventLog                `hash:"ignore"`
+	projection   storage.Collection              `hash:"ignore"`
 	cancelStream context.CancelFunc              `hash:"ignore"`
+	streamDone   chan struct{}                   `hash:"ignore"`
 	methods      map[EffectType]symbols.Function `hash:"ignore"`
+
+	// requires are the grants and policies writes to the entity require,
+	// resolved from the selectors in its requires clause once every item in
+	// the context is (since policies can decide on the entity)
+	requires      stream.Requirements `hash:"ignore"`
+	requiresNodes []ast.Selector      `hash:"ignore"`
+	// item is the name decisions on writes to the entity are audited under
+	item string `hash:"ignore"`
+}
+
+func (es *EntityStore) ResolveDeferred(ctx *domain.Context) error {
+	requires, err := stream.ParseRequirements(ctx.Symbols(), es.requiresNodes, es)
+	if err != nil {
+		return err
+	}
+	es.requires = requires
+	es.item = fmt.Sprintf("%s.%s", ctx.Identifier, es.entityType.Name)
+	return nil
+}
+
+func (es EntityStore) Describe(item *doc.Item) {
+	item.Requires = append(item.Requires, es.requires.Names()...)
+}
+
+// authorize checks the requirements of the entity for a write of value made
+// from the scope st. Writes the process makes on its own behalf (like in
+// subscriptions) aren't checked. Writes made after the message being handled
+// has run past its deadline are refused.
+func (es EntityStore) authorize(st *symbols.SymbolTable, value symbols.ValueObject) error {
+	if err := stream.CheckDeadline(st); err != nil {
+		return err
+	}
+	return es.requires.AuthorizeFrom(st, es.item, value)
 }
 
 func (es EntityStore) Descriptors() *symbols.ClassDescriptors {
@@ -105,30 +138,19 @@ func (es EntityStore) Descriptors() *symbols.ClassDescriptors {
 			},
 			Returns: symbols.NewArrayClass(EntityInstance{entityStore: es}),
 			Handler: func(filterValue *EntityValue, options QueryOptionsValue) (*symbols.ArrayValue, error) {
-				dbFindOptions := mongoOptions.Find()
-				if options.Skip != -1 {
-					dbFindOptions = dbFindOptions.SetSkip(options.Skip)
-				}
-				if options.Limit != -1 {
-					dbFindOptions = dbFindOptions.SetLimit(options.Limit)
-				}
-				filter := make(bson.M)
+				filter := make(storage.Filter)
 				err := flattenObject(filterValue, filter, "state.")
 				if err != nil {
 					return nil, err
 				}
-				cursor, err := es.projection.Find(context.TODO(), filter, dbFindOptions)
+				records, err := es.projection.Find(context.TODO(), filter, options.FindOptions())
 				if err != nil {
 					return nil, err
 				}
-				var results []EntityState
-				if err = cursor.All(context.TODO(), &results); err != nil {
-					return nil, err
-				}
 				instanceType := EntityInstance{entityStore: es}
-				arr := symbols.NewArray(instanceType, len(results))
-				for idx, item := range results {
-					instanceValue, err := item.EntityInstance(es)
+				arr := symbols.NewArray(instanceType, len(records))
+				for idx, record := range records {
+					instanceValue, err := entityStateFromRecord(record).EntityInstance(es)
 					if err != nil {
 						return nil, err
 					}
@@ -144,19 +166,14 @@ func (es EntityStore) Descriptors() *symbols.ClassDescriptors {
 			},
 			Returns: EntityInstance{entityStore: es},
 			Handler: func(filterValue *EntityValue, options QueryOptionsValue) (*EntityInstanceValue, error) {
-				dbFindOptions := mongoOptions.FindOne()
-				if options.Skip != -1 {
-					dbFindOptions = dbFindOptions.SetSkip(options.Skip)
-				}
-				filter := make(bson.M)
+				filter := make(storage.Filter)
 				err := flattenObject(filterValue, filter, "state.")
 				if err != nil {
 					return nil, err
 				}
-				var result EntityState
-				err = es.projection.FindOne(context.TODO(), filter, dbFindOptions).Decode(&result)
+				record, err := es.projection.FindOne(context.TODO(), filter, options.FindOptions())
 				if err != nil {
-					if err == mongo.ErrNoDocuments {
+					if err == storage.ErrNotFound {
 						return nil, symbols.ErrorValue{
 							Name:    "NotFound",
 							Message: "no matching entities",
@@ -164,7 +181,7 @@ func (es EntityStore) Descriptors() *symbols.ClassDescriptors {
 					}
 					return nil, err
 				}
-				return result.EntityInstance(es)
+				return entityStateFromRecord(record).EntityInstance(es)
 			},
 		}),
 		"insert": symbols.NewFunction(symbols.FunctionOptions{
@@ -177,36 +194,46 @@ func (es EntityStore) Descriptors() *symbols.ClassDescriptors {
 					EntityID:  strconv.Itoa(seededRand.Int())[0:12],
 					Timestamp: time.Now(),
 					Effect:    EffectTypeCreate,
-					State:     stateValue.Value(),
+					State:     stateValue.Value().(map[string]interface{}),
 				}
-				if _, err := es.eventLog.InsertOne(context.TODO(), state); err != nil {
+				if _, err := es.eventLog.Append(context.TODO(), state.event()); err != nil {
 					return nil, err
 				}
 				return state.EntityInstance(es)
 			},
+		}).WithGuard(func(st *symbols.SymbolTable, args ...symbols.ValueObject) error {
+			return es.authorize(st, args[0])
 		}),
 	}
 	return &descriptors
 }
 
-// This acts as the updater between the event log and the projection.
-func (es EntityStore) iterateChangeStream(routineCtx context.Context, stream *mongo.ChangeStream) {
-	defer stream.Close(routineCtx)
-	for stream.Next(routineCtx) {
-		var event EntityStateInsertEvent
-		if err := stream.Decode(&event); err != nil {
-			panic(err)
-		}
-		switch event.FullDocument.Effect {
+// This acts as the updater between the event log and the projection. Once
+// routineCtx is cancelled no more events are taken from the stream, but the
+// event that's being handled is handled to completion.
+func (es EntityStore) iterateChangeStream(routineCtx context.Context, changes storage.EventStream, done chan struct{}) {
+	defer close(done)
+	defer changes.Close(context.Background())
+	handlerCtx := context.Background()
+	for changes.Next(routineCtx) {
+		event := entityStateEventFromEvent(changes.Event())
+		switch event.Effect {
 		case EffectTypeCreate:
-			// Create a new working record
+			// Create a new working record, unless it was already created when
+			// the projection was caught up with the event log
 			state := EntityState{
-				EntityID:  event.FullDocument.EntityID,
-				CreatedAt: event.FullDocument.Timestamp,
-				UpdatedAt: event.FullDocument.Timestamp,
-				State:     event.FullDocument.State,
+				EntityID:  event.EntityID,
+				CreatedAt: event.Timestamp,
+				UpdatedAt: event.Timestamp,
+				State:     event.State,
+			}
+			record, err := es.projection.FindOne(handlerCtx, storage.Filter{"entity_id": event.EntityID}, storage.FindOptions{})
+			if err == nil {
+				state.RecordID = record.ID
+				err = es.projection.Upsert(handlerCtx, state.record())
+			} else if err == storage.ErrNotFound {
+				_, err = es.projection.Insert(handlerCtx, state.record().Data)
 			}
-			_, err := es.projection.InsertOne(routineCtx, state)
 			if err != nil {
 				panic(err)
 			}
@@ -215,28 +242,24 @@ func (es EntityStore) iterateChangeStream(routineCtx context.Context, stream *mo
 				if err != nil {
 					panic(err)
 				}
-				_, err = fn.Call(value)
+				_, err = stream.AsProcess(&fn).Call(value)
 				if err != nil {
 					panic(err)
 				}
 			}
 		case EffectTypeUpdate:
 			// Update the working record
-			filter := EntityState{EntityID: event.FullDocument.EntityID}
+			filter := storage.Filter{"entity_id": event.EntityID}
 			updateMethod, hasUpdateMethod := es.methods[EffectTypeUpdate]
-			var currentState EntityState
-			if hasUpdateMethod {
-				err := es.projection.FindOne(routineCtx, filter).Decode(&currentState)
-				if err != nil {
-					panic(err)
-				}
+			record, err := es.projection.FindOne(handlerCtx, filter, storage.FindOptions{})
+			if err != nil {
+				panic(err)
 			}
-			_, err := es.projection.UpdateOne(routineCtx, filter, bson.M{
-				"$set": EntityState{
-					UpdatedAt: event.FullDocument.Timestamp,
-					State:     event.FullDocument.State,
-				},
-			})
+			currentState := entityStateFromRecord(record)
+			newState := currentState
+			newState.UpdatedAt = event.Timestamp
+			newState.State = event.State
+			err = es.projection.Upsert(handlerCtx, newState.record())
 			if err != nil {
 				panic(err)
 			}
@@ -245,35 +268,42 @@ func (es EntityStore) iterateChangeStream(routineCtx context.Context, stream *mo
 				if err != nil {
 					panic(err)
 				}
-				newInstance, err := event.FullDocument.EntityInstance(es)
+				newInstance, err := event.EntityInstance(es)
 				if err != nil {
 					panic(err)
 				}
-				_, err = updateMethod.Call(currentInstance, newInstance)
+				_, err = stream.AsProcess(&updateMethod).Call(currentInstance, newInstance)
 				if err != nil {
 					panic(err)
 				}
 			}
 		case EffectTypeDelete:
 			// Delete the working record
-			_, err := es.projection.DeleteOne(routineCtx, EntityState{
-				EntityID: event.FullDocument.EntityID,
-			})
-			if err != nil {
+			filter := storage.Filter{"entity_id": event.EntityID}
+			record, err := es.projection.FindOne(handlerCtx, filter, storage.FindOptions{})
+			if err != nil && err != storage.ErrNotFound {
 				panic(err)
 			}
+			if err == nil {
+				if err := es.projection.Delete(handlerCtx, record.ID); err != nil {
+					panic(err)
+				}
+			}
 			if fn, ok := es.methods[EffectTypeDelete]; ok {
-				value, err := event.FullDocument.EntityInstance(es)
+				value, err := event.EntityInstance(es)
 				if err != nil {
 					panic(err)
 				}
-				_, err = fn.Call(value)
+				_, err = stream.AsProcess(&fn).Call(value)
 				if err != nil {
 					panic(err)
 				}
 			}
 		}
 	}
+	if err := changes.Err(); err != nil {
+		log.Printf(log.LevelERROR, EntityStreamSignal, "event stream for %s stopped: %s", es.entityType.Name, err.Error())
+	}
 }
 
 func (es *EntityStore) AddMethod(ctx *domain.Context, node ast.ContextObjectMethod) error {
@@ -326,42 +356,118 @@ func (es *EntityStore) AddMethod(ctx *domain.Context, node ast.ContextObjectMeth
 	return nil
 }
 
-func (es *EntityStore) Attach(process *runtime.Process) error {
-	var conn resource.MongoConnection
-	err := process.Resource("mdb", &conn)
+func (es *EntityStore) Attach(ctx context.Context, process *runtime.Process) error {
+	var driver storage.Driver
+	err := process.Resource(ctx, "state", &driver)
 	if err != nil {
 		return err
 	}
-	dbName := strings.Replace(process.Context.Identifier, ".", "_", -1)
-	es.eventLog, err = conn.EnsureCollection(dbName, fmt.Sprintf("%s_events", es.entityType.Name))
+	namespace := strings.Replace(process.Context.Identifier, ".", "_", -1)
+	es.eventLog, err = driver.EventLog(ctx, namespace, fmt.Sprintf("%s_events", es.entityType.Name))
 	if err != nil {
 		return err
 	}
-	es.projection, err = conn.EnsureCollection(dbName, fmt.Sprintf("%s_projection", es.entityType.Name))
+	es.projection, err = driver.Collection(ctx, namespace, fmt.Sprintf("%s_projection", es.entityType.Name))
 	if err != nil {
 		return err
 	}
-	pipeline := mongo.Pipeline{
-		{{
-			Key:   "$match",
-			Value: bson.D{{Key: "operationType", Value: "insert"}},
-		}},
-	}
-	streamOptions := mongoOptions.ChangeStream().SetFullDocument(mongoOptions.UpdateLookup)
-	stream, err := es.eventLog.Watch(context.Background(), pipeline, streamOptions)
+	// the projection is caught up after subscribing, so no event is missed in
+	// between. The ones that are in both are applied again by the change
+	// stream, which is harmless.
+	changes, err := es.eventLog.Subscribe(ctx)
 	if err != nil {
 		return err
 	}
+	if err := es.catchUpProjection(ctx); err != nil {
+		changes.Close(ctx)
+		return fmt.Errorf("cannot catch up the projection of %s: %w", es.entityType.Name, err)
+	}
 	routineCtx, cancel := context.WithCancel(context.Background())
 	es.cancelStream = cancel
-	go es.iterateChangeStream(routineCtx, stream)
+	es.streamDone = make(chan struct{})
+	go es.iterateChangeStream(routineCtx, changes, es.streamDone)
 	return nil
 }
-func (es *EntityStore) Detach() error {
+
+// catchUpProjection brings the projection up to date with the event log. An
+// event and the change it makes to the projection aren't written together, so
+// a process that stopped in between them leaves the projection behind. Records
+// are only ever moved forward, and the entity's hooks aren't run for the
+// events that are caught up on (they were already run, or the process stopped
+// before it got to them).
+func (es EntityStore) catchUpProjection(ctx context.Context) error {
+	events, err := es.eventLog.Events(ctx, "")
+	if err != nil {
+		return err
+	}
+	states := make(map[string]EntityState)
+	deleted := make(map[string]bool)
+	for _, event := range events {
+		event := entityStateEventFromEvent(event)
+		switch event.Effect {
+		case EffectTypeCreate:
+			states[event.EntityID] = EntityState{
+				EntityID:  event.EntityID,
+				CreatedAt: event.Timestamp,
+				UpdatedAt: event.Timestamp,
+				State:     event.State,
+			}
+		case EffectTypeUpdate:
+			if state, ok := states[event.EntityID]; ok {
+				state.UpdatedAt = event.Timestamp
+				state.State = event.State
+				states[event.EntityID] = state
+			}
+		case EffectTypeDelete:
+			delete(states, event.EntityID)
+			deleted[event.EntityID] = true
+		}
+	}
+	records, err := es.projection.Find(ctx, storage.Filter{}, storage.FindOptions{})
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		current := entityStateFromRecord(record)
+		if deleted[current.EntityID] {
+			if err := es.projection.Delete(ctx, record.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		state, ok := states[current.EntityID]
+		if !ok {
+			continue
+		}
+		delete(states, current.EntityID)
+		if current.UpdatedAt.Before(state.UpdatedAt) {
+			state.RecordID = record.ID
+			if err := es.projection.Upsert(ctx, state.record()); err != nil {
+				return err
+			}
+		}
+	}
+	for _, state := range states {
+		if _, err := es.projection.Insert(ctx, state.record().Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Detach stops the change stream and waits for the event it's handling (if
+// any) to be handled, unless ctx is done first.
+func (es *EntityStore) Detach(ctx context.Context) error {
 	es.cancelStream()
+	var err error
+	select {
+	case <-es.streamDone:
+	case <-ctx.Done():
+		err = fmt.Errorf("change stream for %s didn't stop in time: %w", es.entityType.Name, ctx.Err())
+	}
 	es.eventLog = nil
 	es.projection = nil
-	return nil
+	return err
 }
 
 type Entity struct {
@@ -374,6 +480,7 @@ type Entity struct {
 func (ent Entity) Descriptors() *symbols.ClassDescriptors {
 	propertyMap := make(symbols.ClassPropertyMap)
 	for name, class := range ent.Properties {
+		name := name
 		propertyMap[name] = symbols.PropertyAttributes(symbols.PropertyOptions{
 			Class: class,
 			Getter: func(val *EntityValue) (symbols.ValueObject, error) {
@@ -430,6 +537,7 @@ type EntityInstance struct {
 func (ei EntityInstance) Descriptors() *symbols.ClassDescriptors {
 	propertyMap := make(symbols.ClassPropertyMap)
 	for name, class := range ei.entityStore.entityType.Properties {
+		name := name
 		propertyMap[name] = symbols.PropertyAttributes(symbols.PropertyOptions{
 			Class: class,
 			Getter: func(obj *EntityInstanceValue) (symbols.ValueObject, error) {
@@ -446,20 +554,20 @@ func (ei EntityInstance) Descriptors() *symbols.ClassDescriptors {
 					ei.entityStore.entityType,
 				},
 				Returns: nil,
-				Handler: func(instanceValue *EntityInstanceValue, updatedValue EntityValue) error {
+				Handler: func(instanceValue *EntityInstanceValue, updatedValue *EntityValue) error {
 					state := EntityStateEvent{
 						EntityID:  instanceValue.entityID,
 						Timestamp: time.Now(),
 						Effect:    EffectTypeUpdate,
-						State:     updatedValue,
+						State:     updatedValue.Value().(map[string]interface{}),
 					}
-					if _, err := instanceValue.instanceType.entityStore.eventLog.InsertOne(context.TODO(), state); err != nil {
+					if _, err := instanceValue.instanceType.entityStore.eventLog.Append(context.TODO(), state.event()); err != nil {
 						return err
 					}
 					instanceValue.data = updatedValue.data
 					return nil
 				},
-			}),
+			}).WithGuard(ei.authorize),
 			"delete": symbols.NewClassMethod(symbols.ClassMethodOptions{
 				Class:     ei,
 				Arguments: []symbols.Class{},
@@ -470,12 +578,12 @@ func (ei EntityInstance) Descriptors() *symbols.ClassDescriptors {
 						Timestamp: time.Now(),
 						Effect:    EffectTypeDelete,
 					}
-					if _, err := instanceValue.instanceType.entityStore.eventLog.InsertOne(context.TODO(), state); err != nil {
+					if _, err := instanceValue.instanceType.entityStore.eventLog.Append(context.TODO(), state.event()); err != nil {
 						return err
 					}
 					return nil
 				},
-			}),
+			}).WithGuard(ei.authorize),
 			"mutable": symbols.NewClassMethod(symbols.ClassMethodOptions{
 				Class:     ei,
 				Arguments: []symbols.Class{},
@@ -492,6 +600,13 @@ func (ei EntityInstance) Descriptors() *symbols.ClassDescriptors {
 	}
 }
 
+// authorize checks the requirements of the entity for updating or deleting
+// the instance that's the first of args, which is what policies decide on
+func (ei EntityInstance) authorize(st *symbols.SymbolTable, args ...symbols.ValueObject) error {
+	instanceValue := args[0].(*EntityInstanceValue)
+	return ei.entityStore.authorize(st, &EntityValue{entityType: ei.entityStore.entityType, data: instanceValue.data})
+}
+
 type EntityInstanceValue struct {
 	instanceType EntityInstance
 	entityID     string
@@ -519,9 +634,9 @@ const (
 	EffectTypeDelete EffectType = "DELETE"
 )
 
-func unmarshalEntityToInstanceValue(entityStore EntityStore, entityID string, state interface{}) (*EntityInstanceValue, error) {
+func unmarshalEntityToInstanceValue(entityStore EntityStore, entityID string, state map[string]interface{}) (*EntityInstanceValue, error) {
 	instanceType := EntityInstance{entityStore: entityStore}
-	bytes, err := bson.MarshalExtJSON(state, false, true)
+	bytes, err := json.Marshal(state)
 	if err != nil {
 		return nil, err
 	}
@@ -529,24 +644,44 @@ func unmarshalEntityToInstanceValue(entityStore EntityStore, entityID string, st
 	if err != nil {
 		return nil, err
 	}
-	constructedStateValue, err := symbols.Construct(instanceType, stateValue)
+	constructedStateValue, err := symbols.Construct(entityStore.entityType, stateValue)
 	if err != nil {
 		return nil, err
 	}
 	return &EntityInstanceValue{
 		instanceType: instanceType,
 		entityID:     entityID,
-		data:         constructedStateValue.(EntityValue).data,
+		data:         constructedStateValue.(*EntityValue).data,
 	}, nil
 }
 
 // Represents the internal model of the entity event log
 type EntityStateEvent struct {
-	RecordID  *primitive.ObjectID `bson:"_id,omitempty"`
-	EntityID  string              `bson:"entity_id,omitempty"`
-	Timestamp time.Time           `bson:"timestamp,omitempty"`
-	Effect    EffectType          `bson:"esfect,omitempty"`
-	State     interface{}         `bson:"state,omitempty"`
+	RecordID  string
+	EntityID  string
+	Timestamp time.Time
+	Effect    EffectType
+	State     map[string]interface{}
+}
+
+func entityStateEventFromEvent(event storage.Event) EntityStateEvent {
+	return EntityStateEvent{
+		RecordID:  event.ID,
+		EntityID:  event.EntityID,
+		Timestamp: event.Timestamp,
+		Effect:    EffectType(event.Effect),
+		State:     event.State,
+	}
+}
+
+func (es EntityStateEvent) event() storage.Event {
+	return storage.Event{
+		ID:        es.RecordID,
+		EntityID:  es.EntityID,
+		Timestamp: es.Timestamp,
+		Effect:    string(es.Effect),
+		State:     es.State,
+	}
 }
 
 func (es EntityStateEvent) EntityInstance(entityStore EntityStore) (*EntityInstanceValue, error) {
@@ -555,18 +690,34 @@ func (es EntityStateEvent) EntityInstance(entityStore EntityStore) (*EntityInsta
 
 // Represents the internal model of the working record
 type EntityState struct {
-	RecordID  *primitive.ObjectID `bson:"_id,omitempty"`
-	EntityID  string              `bson:"entity_id,omitempty"`
-	CreatedAt time.Time           `bson:"created_at,omitempty"`
-	UpdatedAt time.Time           `bson:"updated_at,omitempty"`
-	State     interface{}         `bson:"state,omitempty"`
+	RecordID  string
+	EntityID  string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	State     map[string]interface{}
 }
 
-func (es EntityState) EntityInstance(entityStore EntityStore) (*EntityInstanceValue, error) {
-	return unmarshalEntityToInstanceValue(entityStore, es.EntityID, es.State)
+func entityStateFromRecord(record storage.Record) EntityState {
+	state := EntityState{RecordID: record.ID}
+	state.EntityID, _ = record.Data["entity_id"].(string)
+	state.CreatedAt, _ = record.Data["created_at"].(time.Time)
+	state.UpdatedAt, _ = record.Data["updated_at"].(time.Time)
+	state.State, _ = record.Data["state"].(map[string]interface{})
+	return state
+}
+
+func (es EntityState) record() storage.Record {
+	return storage.Record{
+		ID: es.RecordID,
+		Data: map[string]interface{}{
+			"entity_id":  es.EntityID,
+			"created_at": es.CreatedAt,
+			"updated_at": es.UpdatedAt,
+			"state":      es.State,
+		},
+	}
 }
 
-// Represents the event given from the database change stream when an entity state event is inserted
-type EntityStateInsertEvent struct {
-	FullDocument EntityStateEvent `bson:"fullDocument"`
+func (es EntityState) EntityInstance(entityStore EntityStore) (*EntityInstanceValue, error) {
+	return unmarshalEntityToInstanceValue(entityStore, es.EntityID, es.State)
 }
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/hntrl/hyper/src/hyper/symbols"
+	"github.com/hntrl/hyper/src/runtime//storage"
 )
 
 var (
@@ -79,3 +80,15 @@ func (qo QueryOptionsValue) Class() symbols.Class {
 func (qo QueryOptionsValue) Value() interface{} {
 	return qo
 }
+
+// FindOptions returns the options that are set as storage find options
+func (qo QueryOptionsValue) FindOptions() storage.FindOptions {
+	options := storage.FindOptions{}
+	if qo.Skip != -1 {
+		options.Skip = qo.Skip
+	}
+	if qo.Limit != -1 {
+		options.Limit = qo.Limit
+	}
+	return options
+}
@@ -2,7 +2,9 @@ package state
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/hntrl/hyper/src/hyper/ast"
@@ -11,14 +13,11 @@ import (
 	"github.com/hntrl/hyper/src/hyper/symbols"
 	"github.com/hntrl/hyper/src/hyper/symbols/errors"
 	"github.com/hntrl/hyper/src/runtime/"
+	"github.com/hntrl/hyper/src/runtime//delivery"
 	"github.com/hntrl/hyper/src/runtime//log"
-	"github.com/hntrl/hyper/src/runtime//resource"
+	"github.com/hntrl/hyper/src/runtime//transport"
 
-	"github.com/nats-io/nats.go"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	mongoOptions "go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/hntrl/hyper/src/runtime//storage"
 )
 
 var ProjectionSignal = log.Signal("PROJECTION")
@@ -82,8 +81,11 @@ func (ProjectionInterface) FromNode(ctx *domain.Context, node ast.ContextObject)
 
 type ProjectionStore struct {
 	projectionType Projection
-	collection     *mongo.Collection                  `hash:"ignore"`
-	events         map[*stream.Event]symbols.Callable `hash:"ignore"`
+	collection     storage.Collection                       `hash:"ignore"`
+	events         map[*stream.Event]symbols.Callable       `hash:"ignore"`
+	subs           *transport.Subscriptions                 `hash:"ignore"`
+	handlers       map[string]func(transport.Message) error `hash:"ignore"`
+	delivery       *delivery.Consumer                       `hash:"ignore"`
 }
 
 func (ps ProjectionStore) Descriptors() *symbols.ClassDescriptors {
@@ -97,51 +99,22 @@ func (ps ProjectionStore) Descriptors() *symbols.ClassDescriptors {
 			},
 			Returns: symbols.NewArrayClass(projectionRecordType),
 			Handler: func(filterValue *ProjectionValue, options QueryOptionsValue) (*symbols.ArrayValue, error) {
-				dbFindOptions := mongoOptions.Find()
-				if options.Skip != -1 {
-					dbFindOptions = dbFindOptions.SetSkip(options.Skip)
-				}
-				if options.Limit != -1 {
-					dbFindOptions = dbFindOptions.SetLimit(options.Limit)
-				}
-
-				filter := make(bson.M)
+				filter := make(storage.Filter)
 				err := flattenObject(filterValue, filter, "")
 				if err != nil {
 					return nil, err
 				}
-				cursor, err := ps.collection.Find(context.TODO(), filter, dbFindOptions)
+				records, err := ps.collection.Find(context.TODO(), filter, options.FindOptions())
 				if err != nil {
 					return nil, err
 				}
-
-				cursorIndex := 0
-				arr := symbols.NewArray(projectionRecordType, cursor.RemainingBatchLength())
-				for cursor.Next(context.TODO()) {
-					var record bson.M
-					err := cursor.Decode(&record)
-					if err != nil {
-						return nil, err
-					}
-					bytes, err := bson.MarshalExtJSON(record, false, true)
-					if err != nil {
-						return nil, err
-					}
-					recordValue, err := symbols.ValueFromBytes(bytes)
-					if err != nil {
-						return nil, err
-					}
-					constructedRecordValue, err := symbols.Construct(ps.projectionType, recordValue)
+				arr := symbols.NewArray(projectionRecordType, len(records))
+				for idx, record := range records {
+					recordValue, err := ps.recordValue(record)
 					if err != nil {
 						return nil, err
 					}
-					recordID := cursor.Current.Lookup("_id").ObjectID()
-					arr.Set(cursorIndex, ProjectionRecordValue{
-						projectionRecordType: projectionRecordType,
-						recordID:             &recordID,
-						data:                 constructedRecordValue.(*ProjectionValue).data,
-					})
-					cursorIndex++
+					arr.Set(idx, *recordValue)
 				}
 				return arr, nil
 			},
@@ -153,40 +126,16 @@ func (ps ProjectionStore) Descriptors() *symbols.ClassDescriptors {
 			},
 			Returns: projectionRecordType,
 			Handler: func(filterValue *ProjectionValue, options QueryOptionsValue) (*ProjectionRecordValue, error) {
-				dbFindOptions := mongoOptions.FindOne()
-				if options.Skip != -1 {
-					dbFindOptions = dbFindOptions.SetSkip(options.Skip)
-				}
-
-				filter := make(bson.M)
+				filter := make(storage.Filter)
 				err := flattenObject(filterValue, filter, "")
 				if err != nil {
 					return nil, err
 				}
-
-				var record bson.M
-				err = ps.collection.FindOne(context.TODO(), filter, dbFindOptions).Decode(&record)
-				if err != nil {
-					return nil, err
-				}
-				bytes, err := bson.MarshalExtJSON(record, false, true)
-				if err != nil {
-					return nil, err
-				}
-				recordValue, err := symbols.ValueFromBytes(bytes)
-				if err != nil {
-					return nil, err
-				}
-				constructedRecordValue, err := symbols.Construct(ps.projectionType, recordValue)
+				record, err := ps.collection.FindOne(context.TODO(), filter, options.FindOptions())
 				if err != nil {
 					return nil, err
 				}
-				recordID := record["_id"].(primitive.ObjectID)
-				return &ProjectionRecordValue{
-					projectionRecordType: projectionRecordType,
-					recordID:             &recordID,
-					data:                 constructedRecordValue.(*ProjectionValue).data,
-				}, nil
+				return ps.recordValue(record)
 			},
 		}),
 		"insert": symbols.NewFunction(symbols.FunctionOptions{
@@ -195,14 +144,13 @@ func (ps ProjectionStore) Descriptors() *symbols.ClassDescriptors {
 			},
 			Returns: projectionRecordType,
 			Handler: func(projectionValue *ProjectionValue) (*ProjectionRecordValue, error) {
-				res, err := ps.collection.InsertOne(context.TODO(), projectionValue.Value())
+				record, err := ps.collection.Insert(context.TODO(), projectionValue.Value().(map[string]interface{}))
 				if err != nil {
 					return nil, err
 				}
-				recordID := res.InsertedID.(primitive.ObjectID)
 				return &ProjectionRecordValue{
 					projectionRecordType: projectionRecordType,
-					recordID:             &recordID,
+					recordID:             record.ID,
 					data:                 projectionValue.data,
 				}, nil
 			},
@@ -211,6 +159,35 @@ func (ps ProjectionStore) Descriptors() *symbols.ClassDescriptors {
 	return &descriptors
 }
 
+func (ps ProjectionStore) recordValue(record storage.Record) (*ProjectionRecordValue, error) {
+	bytes, err := json.Marshal(record.Data)
+	if err != nil {
+		return nil, err
+	}
+	recordValue, err := symbols.ValueFromBytes(bytes)
+	if err != nil {
+		return nil, err
+	}
+	constructedRecordValue, err := symbols.Construct(ps.projectionType, recordValue)
+	if err != nil {
+		return nil, err
+	}
+	return &ProjectionRecordValue{
+		projectionRecordType: ProjectionRecord{projectionStore: ps},
+		recordID:             record.ID,
+		data:                 constructedRecordValue.(*ProjectionValue).data,
+	}, nil
+}
+
+func (ps *ProjectionStore) ConsumedTopics() []string {
+	topics := make([]string, 0, len(ps.events))
+	for event := range ps.events {
+		topics = append(topics, string(event.Topic))
+	}
+	sort.Strings(topics)
+	return topics
+}
+
 func (ps *ProjectionStore) AddMethod(ctx *domain.Context, node ast.ContextObjectMethod) error {
 	arguments := node.Block.Parameters.Arguments.Items
 	if node.Name != "onEvent" {
@@ -247,47 +224,89 @@ func (ps *ProjectionStore) AddMethod(ctx *domain.Context, node ast.ContextObject
 	}
 }
 
-func (ps *ProjectionStore) Attach(process *runtime.Process) error {
-	var dbConn resource.MongoConnection
-	err := process.Resource("mdb", &dbConn)
+func (ps *ProjectionStore) Attach(ctx context.Context, process *runtime.Process) error {
+	var driver storage.Driver
+	err := process.Resource(ctx, "state", &driver)
 	if err != nil {
 		return err
 	}
-	var streamConn resource.NatsConnection
-	err = process.Resource("stream", &streamConn)
+	var streamConn transport.Transport
+	err = process.Resource(ctx, "stream", &streamConn)
 	if err != nil {
 		return err
 	}
 
-	dbName := strings.Replace(process.Context.Identifier, ".", "_", -1)
-	collection, err := dbConn.EnsureCollection(dbName, ps.projectionType.Name)
+	namespace := strings.Replace(process.Context.Identifier, ".", "_", -1)
+	collection, err := driver.Collection(ctx, namespace, ps.projectionType.Name)
 	if err != nil {
 		return err
 	}
 	ps.collection = collection
 
+	name := fmt.Sprintf("%s.%s", process.Context.Identifier, ps.projectionType.Name)
+	ps.handlers = make(map[string]func(transport.Message) error)
+	ps.delivery = delivery.NewConsumer(name, process.RetryPolicy(name), streamConn, process.DeadLetters, ProjectionEventSignal)
+	ps.subs = &transport.Subscriptions{}
+	callback := func(m transport.Message) {
+		ps.delivery.Handle(m, ps.handle)
+	}
+	durable, isDurable := streamConn.(transport.DurableTransport)
 	for evPtr, fn := range ps.events {
-		ev := *evPtr
-		streamConn.Client.QueueSubscribe(string(ev.Topic), "projection_group", func(m *nats.Msg) {
+		ev, fn := *evPtr, fn
+		ps.handlers[string(ev.Topic)] = func(m transport.Message) error {
 			value, err := symbols.ValueFromBytes(m.Data)
 			if err != nil {
-				return
+				return delivery.Permanent(err)
 			}
 			constructedValue, err := symbols.Construct(ev, value)
 			if err != nil {
-				return
-			}
-			_, err = fn.Call(constructedValue)
-			if err != nil {
-				return
+				return delivery.Permanent(err)
 			}
-		})
+			_, err = stream.AsProcess(fn).Call(constructedValue)
+			return err
+		}
+	}
+	for evPtr := range ps.events {
+		ev := *evPtr
+		// with a durable transport, a projection that's deployed for the
+		// first time is built from every event that's been kept
+		if isDurable {
+			err = ps.subs.SubscribeDurable(durable, ev.Stream(), string(ev.Topic), name+"."+ev.Name, transport.DurableOptions{DeliverAll: true}, callback)
+		} else {
+			err = ps.subs.QueueSubscribe(streamConn, string(ev.Topic), name, callback)
+		}
+		if err != nil {
+			ps.subs.Drain(ctx)
+			return err
+		}
+	}
+	// replays of dead letters are sent to the projection's own topic
+	if err := ps.subs.QueueSubscribe(streamConn, name, name, callback); err != nil {
+		ps.subs.Drain(ctx)
+		return err
 	}
 	return nil
 }
-func (ps *ProjectionStore) Detach(process *runtime.Process) error {
+
+// handle calls the onEvent handler for the event m was published as
+func (ps *ProjectionStore) handle(m transport.Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	handler, ok := ps.handlers[m.Subject]
+	if !ok {
+		return delivery.Permanent(fmt.Errorf("no handler for %s", m.Subject))
+	}
+	return handler(m)
+}
+
+func (ps *ProjectionStore) Detach(ctx context.Context) error {
+	ps.delivery.Close()
+	err := ps.subs.Drain(ctx)
 	ps.collection = nil
-	return nil
+	return err
 }
 
 type Projection struct {
@@ -300,6 +319,7 @@ type Projection struct {
 func (p Projection) Descriptors() *symbols.ClassDescriptors {
 	propertyMap := make(symbols.ClassPropertyMap)
 	for name, class := range p.Properties {
+		name := name
 		propertyMap[name] = symbols.PropertyAttributes(symbols.PropertyOptions{
 			Class: class,
 			Getter: func(val *EntityValue) (symbols.ValueObject, error) {
@@ -356,6 +376,7 @@ type ProjectionRecord struct {
 func (pr ProjectionRecord) Descriptors() *symbols.ClassDescriptors {
 	propertyMap := make(symbols.ClassPropertyMap)
 	for name, class := range pr.projectionStore.projectionType.Properties {
+		name := name
 		propertyMap[name] = symbols.PropertyAttributes(symbols.PropertyOptions{
 			Class: class,
 			Getter: func(obj *EntityInstanceValue) (symbols.ValueObject, error) {
@@ -371,7 +392,10 @@ func (pr ProjectionRecord) Descriptors() *symbols.ClassDescriptors {
 				Arguments: []symbols.Class{pr.projectionStore.projectionType},
 				Returns:   nil,
 				Handler: func(projectionValue *ProjectionRecordValue, updateValue *ProjectionValue) error {
-					_, err := pr.projectionStore.collection.UpdateOne(context.TODO(), bson.M{"_id": projectionValue.recordID}, updateValue.Value())
+					err := pr.projectionStore.collection.Upsert(context.TODO(), storage.Record{
+						ID:   projectionValue.recordID,
+						Data: updateValue.Value().(map[string]interface{}),
+					})
 					projectionValue.data = updateValue.data
 					return err
 				},
@@ -381,8 +405,7 @@ func (pr ProjectionRecord) Descriptors() *symbols.ClassDescriptors {
 				Arguments: []symbols.Class{},
 				Returns:   nil,
 				Handler: func(projectionValue *ProjectionRecordValue) error {
-					_, err := pr.projectionStore.collection.DeleteOne(context.TODO(), bson.M{"_id": projectionValue.recordID})
-					return err
+					return pr.projectionStore.collection.Delete(context.TODO(), projectionValue.recordID)
 				},
 			}),
 			"mutable": symbols.NewClassMethod(symbols.ClassMethodOptions{
@@ -403,7 +426,7 @@ func (pr ProjectionRecord) Descriptors() *symbols.ClassDescriptors {
 
 type ProjectionRecordValue struct {
 	projectionRecordType ProjectionRecord
-	recordID             *primitive.ObjectID `bson:"_id"`
+	recordID             string
 	data                 map[string]symbols.ValueObject
 }
 
@@ -415,6 +438,6 @@ func (p ProjectionRecordValue) Value() interface{} {
 	for k, v := range p.data {
 		out[k] = v.Value()
 	}
-	out["$_id"] = p.recordID.String()
+	out["$_id"] = p.recordID
 	return out
 }
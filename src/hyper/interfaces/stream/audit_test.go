@@ -0,0 +1,142 @@
+package stream_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/hntrl/hyper/src/runtime/"
+	"github.com/hntrl/hyper/src/runtime//audit"
+	"github.com/hntrl/hyper/src/runtime//auth"
+)
+
+// memorySink keeps the decisions recorded to it, or fails to record any of
+// them if broken is set
+type memorySink struct {
+	mu        sync.Mutex
+	decisions []audit.Decision
+	broken    bool
+}
+
+func (s *memorySink) Record(decision audit.Decision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.broken {
+		return errors.New("disk full")
+	}
+	s.decisions = append(s.decisions, decision)
+	return nil
+}
+func (s *memorySink) Close() error {
+	return nil
+}
+
+// recorded returns the requirements that were checked on item, and whether
+// the caller was allowed by them
+func (s *memorySink) recorded(item string, caller string) map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]bool)
+	for _, decision := range s.decisions {
+		if decision.Item == item && decision.Caller == caller {
+			out[decision.Requirement] = decision.Allowed
+		}
+	}
+	return out
+}
+
+var auditFiles = map[string]string{
+	"index.hyper": `context shop {
+  grant ManageOrders {
+    name = "orders:manage"
+  }
+
+  entity Note requires ManageOrders {
+    text String
+  }
+
+  command Place() String requires ManageOrders {
+    return "placed"
+  }
+
+  func write() String {
+    note := Note.insert(Note{ text: "hi" })
+    return note.text
+  }
+
+  query Checkout() String {
+    return Place()
+  }
+
+  query Write() String {
+    return write()
+  }
+}
+`,
+}
+
+// CAN RECORD DECISIONS MADE ON LOCAL CALLS AND ENTITY WRITES
+func TestAuditLocalCalls(t *testing.T) {
+	dir := writeFiles(t, auditFiles)
+	secret := writeSecret(t)
+	sink := &memorySink{}
+	serve(t, dir, "index.hyper", t.Name(), func(process *runtime.Process) {
+		process.UseAuth(&auth.Config{Algorithm: auth.HS256, VerifyKey: secret})
+		process.UseAudit(&audit.Auditor{Sink: sink})
+	})
+	conn := connect(t, t.Name())
+	ada := sign(t, auth.Claims{"sub": "ada", "grants": []string{"orders:manage"}})
+	bob := sign(t, auth.Claims{"sub": "bob"})
+
+	tests := []struct {
+		subject string
+		caller  string
+		token   string
+		expects string
+		item    string
+	}{
+		{"shop.Checkout", "ada", ada, `"placed"`, "shop.Place"},
+		{"shop.Checkout", "bob", bob, `{"$error":{"name":"Unauthorized","message":"missing grant orders:manage"}}`, "shop.Place"},
+		{"shop.Write", "ada", ada, `"hi"`, "shop.Note"},
+		{"shop.Write", "bob", bob, `{"$error":{"name":"Unauthorized","message":"missing grant orders:manage"}}`, "shop.Note"},
+	}
+	for _, test := range tests {
+		if _, reply := send(t, conn, test.subject, test.token, "{}"); reply != test.expects {
+			t.Errorf("Expected %s as %s to reply %s, but got %s", test.subject, test.caller, test.expects, reply)
+		}
+		allowed, ok := sink.recorded(test.item, test.caller)["orders:manage"]
+		if !ok {
+			t.Errorf("Expected the decision on %s for %s to be recorded", test.item, test.caller)
+		} else if allowed != (test.caller == "ada") {
+			t.Errorf("Expected the decision on %s for %s to be recorded as allowed=%t", test.item, test.caller, !allowed)
+		}
+	}
+}
+
+// CAN DENY MESSAGES WHOSE DECISIONS CAN'T BE RECORDED
+func TestAuditFailClosed(t *testing.T) {
+	tests := []struct {
+		failClosed bool
+		expects    string
+	}{
+		{false, `"placed"`},
+		{true, `{"$error":{"name":"Unauthorized","message":"cannot record the decision on grant orders:manage"}}`},
+	}
+	for _, test := range tests {
+		dir := writeFiles(t, auditFiles)
+		secret := writeSecret(t)
+		bus := t.Name()
+		if test.failClosed {
+			bus += "/closed"
+		}
+		serve(t, dir, "index.hyper", bus, func(process *runtime.Process) {
+			process.UseAuth(&auth.Config{Algorithm: auth.HS256, VerifyKey: secret})
+			process.UseAudit(&audit.Auditor{Sink: &memorySink{broken: true}, FailClosed: test.failClosed})
+		})
+		conn := connect(t, bus)
+		ada := sign(t, auth.Claims{"sub": "ada", "grants": []string{"orders:manage"}})
+		if _, reply := send(t, conn, "shop.Place", ada, "{}"); reply != test.expects {
+			t.Errorf("Expected placing with failClosed=%t to reply %s, but got %s", test.failClosed, test.expects, reply)
+		}
+	}
+}
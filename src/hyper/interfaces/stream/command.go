@@ -1,18 +1,23 @@
 package stream
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/doc"
 	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces/access"
 	"github.com/hntrl/hyper/src/hyper/symbols"
 	"github.com/hntrl/hyper/src/hyper/symbols/errors"
 	"github.com/hntrl/hyper/src/runtime/"
+	"github.com/hntrl/hyper/src/runtime//audit"
+	"github.com/hntrl/hyper/src/runtime//auth"
 	"github.com/hntrl/hyper/src/runtime//log"
-	"github.com/hntrl/hyper/src/runtime//resource"
-	"github.com/nats-io/nats.go"
+	"github.com/hntrl/hyper/src/runtime//transport"
 )
 
 var CommandSignal = log.Signal("COMMAND")
@@ -30,6 +35,10 @@ func (CommandInterface) FromNode(ctx *domain.Context, node ast.ContextMethod) (*
 	if err != nil {
 		return nil, err
 	}
+	timeout, err := parseTimeout(node)
+	if err != nil {
+		return nil, err
+	}
 	cmd := Command{
 		Name:        node.Name,
 		Private:     node.Private,
@@ -37,18 +46,24 @@ func (CommandInterface) FromNode(ctx *domain.Context, node ast.ContextMethod) (*
 		Topic:       Topic(fmt.Sprintf("%s.%s", ctx.Identifier, node.Name)),
 		PayloadType: nil,
 		Returns:     fn.Returns(),
+		Timeout:     timeout,
 	}
 	if len(fn.Arguments()) == 1 {
 		cmd.PayloadType = fn.Arguments()[0]
 	}
-	consumer := CommandConsumer{
-		cmd:     cmd,
-		handler: fn,
+	cmd.Requires, err = ParseRequirements(table, node.Requires, cmd.PayloadType)
+	if err != nil {
+		return nil, err
+	}
+	consumer := &CommandConsumer{
+		cmd:         cmd,
+		handler:     fn,
+		hostContext: ctx,
 	}
 	if !node.Private {
 		return &domain.ContextItem{
 			HostItem:   consumer,
-			RemoteItem: CommandEmitter{cmd: cmd},
+			RemoteItem: &CommandEmitter{cmd: cmd},
 		}, nil
 	} else {
 		return &domain.ContextItem{
@@ -65,13 +80,28 @@ type Command struct {
 	Topic       Topic
 	PayloadType symbols.Class
 	Returns     symbols.Class
+	// Timeout is the timeout the command declares, or 0 if it doesn't
+	Timeout time.Duration
+	// Requires are the grants callers must have and the policies that must
+	// allow them for the command's handler to run
+	Requires Requirements
 }
 
 // CommandConsumer represents the abstraction used by the runtime to attach to a stream and process incoming messages on behalf of a Command.
 type CommandConsumer struct {
 	cmd     Command
 	handler symbols.Callable
-	stream  *resource.NatsConnection
+	stream  transport.Transport
+	subs    *transport.Subscriptions
+	running *sync.WaitGroup
+	auth    *auth.Authenticator
+	// hostContext is the context the consumer belongs to, which it looks up
+	// the roles callers can have in
+	hostContext *domain.Context
+	roles       access.Roles
+	// audit records the authorization decisions made for the messages the
+	// consumer receives
+	audit *audit.Auditor
 }
 
 func (consumer CommandConsumer) Arguments() []symbols.Class {
@@ -84,44 +114,116 @@ func (consumer CommandConsumer) Returns() symbols.Class {
 	return consumer.cmd.Returns
 }
 func (consumer CommandConsumer) Call(args ...symbols.ValueObject) (symbols.ValueObject, error) {
-	return consumer.handler.Call(args...)
+	return consumer.CallFrom(nil, args...)
 }
 
-func (consumer *CommandConsumer) Attach(process runtime.Process) error {
-	consumer.stream.Client.QueueSubscribe(string(consumer.cmd.Topic), "handler_queue", func(m *nats.Msg) {
-		var payload symbols.ValueObject
-		if consumer.cmd.PayloadType != nil {
-			value, err := symbols.ValueFromBytes(m.Data)
-			if err != nil {
-
-			}
-			payload, err = symbols.Construct(consumer.cmd.PayloadType, value)
-			if err != nil {
+// CallFrom calls the handler locally on behalf of the caller of the message
+// being handled in st, which has to meet the command's requirements the same as
+// if they had sent it a message
+func (consumer CommandConsumer) CallFrom(st *symbols.SymbolTable, args ...symbols.ValueObject) (symbols.ValueObject, error) {
+	var payload symbols.ValueObject
+	if len(args) > 0 {
+		payload = args[0]
+	}
+	if err := consumer.cmd.Requires.AuthorizeFrom(st, string(consumer.cmd.Topic), payload); err != nil {
+		return nil, err
+	}
+	return withMessage(consumer.handler, callerMessage(st)).Call(args...)
+}
+func (consumer CommandConsumer) Describe(item *doc.Item) {
+	item.Payload = doc.ClassName(consumer.cmd.PayloadType)
+	item.Returns = doc.ClassName(consumer.cmd.Returns)
+	item.Topic = string(consumer.cmd.Topic)
+	if consumer.cmd.Timeout != 0 {
+		item.Timeout = consumer.cmd.Timeout.String()
+	}
+	item.Requires = append(item.Requires, consumer.cmd.Requires.Names()...)
+}
 
-			}
+func (consumer *CommandConsumer) Attach(ctx context.Context, process *runtime.Process) error {
+	var conn transport.Transport
+	err := process.Resource(ctx, "stream", &conn)
+	if err != nil {
+		return err
+	}
+	consumer.stream = conn
+	consumer.subs = &transport.Subscriptions{}
+	consumer.running = &sync.WaitGroup{}
+	consumer.auth = process.Authenticator()
+	consumer.roles = access.ContextRoles(consumer.hostContext)
+	consumer.audit = process.Audit()
+	return consumer.subs.QueueSubscribe(conn, string(consumer.cmd.Topic), "handler_queue", func(m transport.Message) {
+		ctx, cancel := m.Context(context.Background())
+		defer cancel()
+		correlation := m.CorrelationID()
+		bytes, err := consumer.handle(ctx, m, correlation)
+		if err != nil && ctx.Err() != nil {
+			log.Printf(log.LevelWARN, CommandMessageSignal, "\"%s\" timed out: the requester stopped waiting for a reply, and the handler is refused any more side effects", consumer.cmd.Topic)
+			return
 		}
-		result, err := consumer.handler.Call(payload)
 		if err != nil {
-
+			log.Printf(log.LevelERROR, CommandMessageSignal, "\"%s\" failed (correlation id %s): %s", consumer.cmd.Topic, correlation, err.Error())
+			bytes = marshalErrorReply(err, correlation)
 		}
 		if consumer.cmd.Returns != nil {
-			bytes, err := json.Marshal(result.Value())
-			if err != nil {
-
-			}
 			m.Respond(bytes)
 		}
 	})
-	return nil
 }
-func (consumer *CommandConsumer) Detach(process runtime.Process) error {
+
+// handle calls the command's handler with the payload in m and returns what
+// should be replied with. It stops waiting for the handler when ctx is done,
+// and the handler is refused any side effects it tries to have after that.
+func (consumer *CommandConsumer) handle(ctx context.Context, m transport.Message, correlation string) (bytes []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	token, claims, err := consumer.auth.Identify(m.Header)
+	if err != nil {
+		return nil, symbols.ErrorValue{Name: "Unauthorized", Message: err.Error()}
+	}
+	var payload symbols.ValueObject
+	if consumer.cmd.PayloadType != nil {
+		value, err := symbols.ValueFromBytes(m.Data)
+		if err != nil {
+			return nil, err
+		}
+		payload, err = symbols.Construct(consumer.cmd.PayloadType, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	deadline, _ := ctx.Deadline()
+	msg := newMessageValue(correlation, deadline, token, claims, consumer.roles, consumer.audit)
+	if err := consumer.cmd.Requires.Authorize(msg, string(consumer.cmd.Topic), payload); err != nil {
+		return nil, err
+	}
+	handler := withMessage(consumer.handler, msg)
+	result, err := callHandler(ctx, consumer.running, handler, payload)
+	if err != nil {
+		return nil, err
+	}
+	if consumer.cmd.Returns == nil || result == nil {
+		return nil, nil
+	}
+	return json.Marshal(result.Value())
+}
+func (consumer *CommandConsumer) Detach(ctx context.Context) error {
+	err := consumer.subs.Drain(ctx)
+	if err == nil {
+		err = waitForHandlers(ctx, consumer.running)
+	}
 	consumer.stream = nil
-	return nil
+	return err
 }
 
 type CommandEmitter struct {
-	cmd    Command
-	stream *resource.NatsConnection
+	cmd     Command
+	stream  transport.Transport
+	timeout time.Duration
+	auth    *auth.Authenticator
 }
 
 func (emitter CommandEmitter) Arguments() []symbols.Class {
@@ -134,6 +236,28 @@ func (emitter CommandEmitter) Returns() symbols.Class {
 	return emitter.cmd.Returns
 }
 func (emitter CommandEmitter) Call(args ...symbols.ValueObject) (symbols.ValueObject, error) {
+	return emitter.call(MessageValue{}, emitter.timeout, args...)
+}
+
+// CallFrom calls the command on behalf of the caller of the message being handled
+// in st, if there is one
+func (emitter CommandEmitter) CallFrom(st *symbols.SymbolTable, args ...symbols.ValueObject) (symbols.ValueObject, error) {
+	return emitter.call(callerMessage(st), emitter.timeout, args...)
+}
+
+// Get resolves the methods of the emitter
+func (emitter *CommandEmitter) Get(key string) (symbols.ScopeValue, error) {
+	if key == "withTimeout" {
+		return timeoutCall{
+			arguments: emitter.Arguments(),
+			returns:   emitter.Returns(),
+			call:      emitter.call,
+		}, nil
+	}
+	return nil, nil
+}
+
+func (emitter CommandEmitter) call(caller MessageValue, timeout time.Duration, args ...symbols.ValueObject) (symbols.ValueObject, error) {
 	if emitter.stream == nil {
 		panic("stream connection not initialized")
 	}
@@ -145,47 +269,40 @@ func (emitter CommandEmitter) Call(args ...symbols.ValueObject) (symbols.ValueOb
 			return nil, err
 		}
 	}
+	header, err := callerHeader(emitter.auth, caller)
+	if err != nil {
+		return nil, err
+	}
 	if emitter.cmd.Returns != nil {
-		res, err := emitter.stream.Client.Request(string(emitter.cmd.Topic), bytes, time.Second*5)
-		if err != nil {
-			return nil, err
-		}
-		value, err := symbols.ValueFromBytes(res.Data)
+		value, err := request(emitter.stream, emitter.cmd.Topic, header, bytes, timeout)
 		if err != nil {
 			return nil, err
 		}
-		if mapValue, ok := value.(*symbols.MapValue); ok {
-			if errValue := mapValue.Get("$error"); errValue != nil {
-				if errMapValue, ok := errValue.(*symbols.MapValue); ok {
-					constructedErr, err := symbols.Construct(symbols.Error, errMapValue)
-					if err != nil {
-						return nil, err
-					}
-					return nil, constructedErr.(symbols.ErrorValue)
-				}
-				return nil, symbols.ErrorValue{
-					Name:    "InternalError",
-					Message: "unknown error was returned upstream",
-				}
-			}
-		}
 		return symbols.Construct(emitter.cmd.Returns, value)
 	} else {
-		err := emitter.stream.Client.Publish(string(emitter.cmd.Topic), bytes)
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		err := emitter.stream.Publish(ctx, transport.Message{
+			Subject: string(emitter.cmd.Topic),
+			Header:  header,
+			Data:    bytes,
+		})
 		return nil, err
 	}
 }
 
-func (emitter *CommandEmitter) Attach(process runtime.Process) error {
-	var conn resource.NatsConnection
-	err := process.Resource("stream", &conn)
+func (emitter *CommandEmitter) Attach(ctx context.Context, process *runtime.Process) error {
+	var conn transport.Transport
+	err := process.Resource(ctx, "stream", &conn)
 	if err != nil {
 		return err
 	}
-	emitter.stream = &conn
+	emitter.stream = conn
+	emitter.timeout = requestTimeout(process, emitter.cmd.Topic, emitter.cmd.Timeout)
+	emitter.auth = process.Authenticator()
 	return nil
 }
-func (emitter *CommandEmitter) Detach(process runtime.Process) error {
+func (emitter *CommandEmitter) Detach(ctx context.Context) error {
 	emitter.stream = nil
 	return nil
 }
@@ -0,0 +1,113 @@
+package stream_test
+
+import (
+	"context"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces"
+	"github.com/hntrl/hyper/src/hyper/symbols"
+	"github.com/hntrl/hyper/src/runtime/"
+	"github.com/hntrl/hyper/src/runtime//resource"
+	"github.com/hntrl/hyper/src/runtime//transport"
+)
+
+var deadlineFiles = map[string]string{
+	"index.hyper": `context shop {
+  event Placed {
+    id Int
+  }
+
+  entity Note {
+    text String
+  }
+
+  command Write() String {
+    pause()
+    Note.insert(Note{ text: "late" })
+    reached()
+    return "written"
+  }
+
+  command Announce() String {
+    pause()
+    emit(Placed{ id: 1 })
+    reached()
+    return "announced"
+  }
+}
+`,
+}
+
+// CAN REFUSE SIDE EFFECTS ONCE A MESSAGE'S DEADLINE HAS PASSED
+func TestDeadlineSideEffects(t *testing.T) {
+	for _, subject := range []string{"shop.Write", "shop.Announce"} {
+		dir := writeFiles(t, deadlineFiles)
+		path := filepath.Join(dir, "index.hyper")
+		bus := t.Name() + "/" + subject
+
+		// handlers pause until they're resumed, and count how many of them made
+		// it past their side effect
+		resume := make(chan struct{}, 1)
+		var reached int32
+		tree, err := domain.ParseContextFromFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		process := runtime.NewProcess()
+		process.UseResourceConfig(map[string]resource.Config{
+			"stream": {Type: "bus", URL: bus},
+			"state":  {Type: "memory"},
+		})
+		builder := domain.NewContextBuilder()
+		interfaces.RegisterDefaults(builder, process)
+		builder.RegisterSelector("pause", symbols.NewFunction(symbols.FunctionOptions{
+			Handler: func() error {
+				<-resume
+				return nil
+			},
+		}))
+		builder.RegisterSelector("reached", symbols.NewFunction(symbols.FunctionOptions{
+			Handler: func() error {
+				atomic.AddInt32(&reached, 1)
+				return nil
+			},
+		}))
+		if _, err := builder.ParseContext(*tree, path); err != nil {
+			t.Fatal(err)
+		}
+		process.UseContextBuilder(builder)
+		if err := process.Attach(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		conn := connect(t, bus)
+
+		// a handler that's resumed in time has its side effect
+		resume <- struct{}{}
+		if _, reply := send(t, conn, subject, "", "{}"); reply == "" || reply[0] != '"' {
+			t.Errorf("Expected %s to reply in time, but got %s", subject, reply)
+		}
+
+		// a handler that's resumed after the requester gave up doesn't
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		_, err = conn.Request(ctx, transport.Message{Subject: subject, Data: []byte("{}")}.WithDeadline(ctx))
+		cancel()
+		if err == nil {
+			t.Fatalf("Expected %s to time out", subject)
+		}
+		resume <- struct{}{}
+		// closing the process waits for the handlers it stopped waiting for
+		closeCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err = process.Close(closeCtx)
+		cancel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count := atomic.LoadInt32(&reached); count != 1 {
+			t.Errorf("Expected %s to be refused its side effect after its deadline, but %d handlers had theirs", subject, count)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package stream
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/hntrl/hyper/src/hyper/symbols"
+)
+
+// errorReply is what a consumer replies with in place of a result when it
+// fails to handle a message.
+type errorReply struct {
+	Error *replyError `json:"$error"`
+}
+
+type replyError struct {
+	Name    string      `json:"name"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// newReplyError returns what's replied with for err. Errors that weren't
+// thrown as an Error object can say things about the process the caller
+// shouldn't know (like where its files are), so they're replied with as an
+// InternalError that only has the correlation id of the message to find them
+// in the logs by.
+func newReplyError(err error, correlation string) *replyError {
+	if errValue, ok := err.(symbols.ErrorValue); ok {
+		return &replyError{
+			Name:    errValue.Name,
+			Message: errValue.Message,
+			Data:    replyErrorData(errValue.Data, correlation),
+		}
+	}
+	return internalReplyError(correlation)
+}
+
+func internalReplyError(correlation string) *replyError {
+	return &replyError{Name: "InternalError", Message: fmt.Sprintf("the message couldn't be handled (correlation id %s)", correlation)}
+}
+
+// replyErrorData converts the data of an error into something that can be
+// serialized, like the errors of each property in a ValidationError.
+func replyErrorData(data interface{}, correlation string) interface{} {
+	switch data := data.(type) {
+	case map[string]error:
+		out := make(map[string]interface{}, len(data))
+		for key, err := range data {
+			out[key] = newReplyError(err, correlation)
+		}
+		return out
+	case error:
+		return newReplyError(data, correlation)
+	case symbols.ValueObject:
+		return data.Value()
+	}
+	return data
+}
+
+// marshalErrorReply serializes err as an error reply to the message with the
+// given correlation id. Errors that weren't thrown as an Error object are sent
+// as an InternalError.
+func marshalErrorReply(err error, correlation string) []byte {
+	bytes, marshalErr := json.Marshal(errorReply{Error: newReplyError(err, correlation)})
+	if marshalErr != nil {
+		bytes, _ = json.Marshal(errorReply{Error: internalReplyError(correlation)})
+	}
+	return bytes
+}
+
+// unmarshalErrorReply returns the error in data if it's an error reply
+func unmarshalErrorReply(data []byte) (error, bool) {
+	var reply struct {
+		Error json.RawMessage `json:"$error"`
+	}
+	if err := json.Unmarshal(data, &reply); err != nil || reply.Error == nil {
+		return nil, false
+	}
+	var replyErr replyError
+	if err := json.Unmarshal(reply.Error, &replyErr); err != nil || replyErr.Name == "" {
+		return symbols.ErrorValue{
+			Name:    "InternalError",
+			Message: "unknown error was returned upstream",
+		}, true
+	}
+	return symbols.ErrorValue{
+		Name:    replyErr.Name,
+		Message: replyErr.Message,
+		Data:    replyErr.Data,
+	}, true
+}
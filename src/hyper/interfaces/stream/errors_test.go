@@ -0,0 +1,71 @@
+package stream_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hntrl/hyper/src/runtime//transport"
+)
+
+var errorFiles = map[string]string{
+	"index.hyper": `import "errors"
+
+context shop {
+  type Order {
+    id Int
+  }
+
+  command Place(order: Order) String {
+    throw errors.New("OutOfStock", "there's nothing left to order")
+  }
+
+  query Find(order: Order) String {
+    throw errors.New("NotFound", "there's no such order")
+  }
+}
+`,
+}
+
+// CAN REPLY WITH THE ERRORS COMMANDS AND QUERIES FAIL WITH
+func TestErrorReply(t *testing.T) {
+	dir := writeFiles(t, errorFiles)
+	serve(t, dir, "index.hyper", t.Name(), nil)
+	conn := connect(t, t.Name())
+
+	tests := []struct {
+		subject string
+		data    string
+		expects string
+	}{
+		// errors thrown as an Error object are replied with as they are
+		{"shop.Place", `{"id":1}`, `{"$error":{"name":"OutOfStock","message":"there's nothing left to order"}}`},
+		{"shop.Find", `{"id":1}`, `{"$error":{"name":"NotFound","message":"there's no such order"}}`},
+		// and the rest only by the correlation id they're logged with
+		{"shop.Place", `{"id":`, `{"$error":{"name":"InternalError","message":"the message couldn't be handled (correlation id c0ffee)"}}`},
+		{"shop.Find", `{"id":`, `{"$error":{"name":"InternalError","message":"the message couldn't be handled (correlation id c0ffee)"}}`},
+	}
+	for _, test := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		reply, err := conn.Request(ctx, transport.Message{
+			Subject: test.subject,
+			Header:  transport.Header{transport.CorrelationHeader: "c0ffee"},
+			Data:    []byte(test.data),
+		})
+		cancel()
+		if err != nil {
+			t.Fatalf("%s: %s", test.subject, err)
+		}
+		if string(reply.Data) != test.expects {
+			t.Errorf("Expected %s with %s to reply %s, but got %s", test.subject, test.data, test.expects, reply.Data)
+		}
+	}
+
+	// replies without a correlation id in the message are given a new one
+	_, reply := send(t, conn, "shop.Find", "", `{"id":`)
+	prefix, suffix := `{"$error":{"name":"InternalError","message":"the message couldn't be handled (correlation id `, `)"}}`
+	if !strings.HasPrefix(reply, prefix) || !strings.HasSuffix(reply, suffix) || len(reply) == len(prefix)+len(suffix) {
+		t.Errorf("Expected the reply to have a new correlation id, but got %s", reply)
+	}
+}
@@ -1,16 +1,19 @@
 package stream
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/doc"
 	"github.com/hntrl/hyper/src/hyper/domain"
 	"github.com/hntrl/hyper/src/hyper/symbols"
 	"github.com/hntrl/hyper/src/hyper/symbols/errors"
 	"github.com/hntrl/hyper/src/runtime/"
 	"github.com/hntrl/hyper/src/runtime//log"
-	"github.com/hntrl/hyper/src/runtime//resource"
+	"github.com/hntrl/hyper/src/runtime//transport"
 )
 
 type EventInterface struct{}
@@ -87,8 +90,8 @@ func (ev Event) Descriptors() *symbols.ClassDescriptors {
 	return &symbols.ClassDescriptors{
 		Name: ev.Name,
 		Constructors: symbols.ClassConstructorSet{
-			symbols.Constructor(symbols.Map, func(val *symbols.MapValue) (EventObject, error) {
-				return EventObject{
+			symbols.Constructor(symbols.Map, func(val *symbols.MapValue) (*EventObject, error) {
+				return &EventObject{
 					parentType: ev,
 					data:       val.Map(),
 				}, nil
@@ -98,6 +101,18 @@ func (ev Event) Descriptors() *symbols.ClassDescriptors {
 	}
 }
 
+// Stream returns the name of the stream durable transports keep the event in.
+// The events of each context are kept in a stream of their own, named after
+// the context.
+func (ev Event) Stream() string {
+	topic := string(ev.Topic)
+	return topic[:strings.LastIndex(topic, ".")]
+}
+
+func (ev Event) Describe(item *doc.Item) {
+	item.Topic = string(ev.Topic)
+}
+
 type EventObject struct {
 	parentType Event
 	data       map[string]symbols.ValueObject
@@ -123,8 +138,8 @@ func makeEventEmitterFunction(process *runtime.Process) symbols.Callable {
 			if !ok {
 				return fmt.Errorf("cannot emit non-event")
 			}
-			var conn resource.NatsConnection
-			err := process.Resource("nats", &conn)
+			var conn transport.Transport
+			err := process.Resource(context.Background(), "stream", &conn)
 			if err != nil {
 				return err
 			}
@@ -132,7 +147,15 @@ func makeEventEmitterFunction(process *runtime.Process) symbols.Callable {
 			if err != nil {
 				return err
 			}
-			err = conn.Client.Publish(string(eventObject.parentType.Topic), bytes)
+			msg := transport.Message{
+				Subject: string(eventObject.parentType.Topic),
+				Data:    bytes,
+			}
+			if durable, ok := conn.(transport.DurableTransport); ok {
+				err = durable.PublishDurable(context.Background(), eventObject.parentType.Stream(), msg)
+			} else {
+				err = conn.Publish(context.Background(), msg)
+			}
 			if err != nil {
 				return err
 			}
@@ -140,5 +163,7 @@ func makeEventEmitterFunction(process *runtime.Process) symbols.Callable {
 
 			return nil
 		},
+	}).WithGuard(func(st *symbols.SymbolTable, args ...symbols.ValueObject) error {
+		return CheckDeadline(st)
 	})
 }
@@ -0,0 +1,71 @@
+package stream_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hntrl/hyper/src/runtime/"
+	"github.com/hntrl/hyper/src/runtime//auth"
+)
+
+var grantFiles = map[string]string{
+	"index.hyper": `context shop {
+  grant ManageOrders {
+    name = "orders:manage"
+  }
+
+  command PlaceOrder() String requires ManageOrders {
+    return "placed"
+  }
+
+  query ListOrders() String requires ManageOrders {
+    return "listed"
+  }
+}
+`,
+	"unknown.hyper": `context shop {
+  command PlaceOrder() String requires ManageOrders {
+    return "placed"
+  }
+}
+`,
+}
+
+// CAN ENFORCE THE GRANTS COMMANDS AND QUERIES REQUIRE
+func TestGrant(t *testing.T) {
+	dir := writeFiles(t, grantFiles)
+	secret := writeSecret(t)
+	serve(t, dir, "index.hyper", t.Name(), func(process *runtime.Process) {
+		process.UseAuth(&auth.Config{Algorithm: auth.HS256, VerifyKey: secret})
+	})
+	conn := connect(t, t.Name())
+	granted := sign(t, auth.Claims{"sub": "ada", "grants": []string{"orders:manage"}})
+	ungranted := sign(t, auth.Claims{"sub": "bob", "grants": []string{"orders:view"}})
+
+	tests := []struct {
+		subject string
+		caller  string
+		token   string
+		expects string
+	}{
+		{"shop.PlaceOrder", "a caller with the grant", granted, `"placed"`},
+		{"shop.ListOrders", "a caller with the grant", granted, `"listed"`},
+		{"shop.PlaceOrder", "a caller without the grant", ungranted, `{"$error":{"name":"Unauthorized","message":"missing grant orders:manage"}}`},
+		{"shop.ListOrders", "a caller without the grant", ungranted, `{"$error":{"name":"Unauthorized","message":"missing grant orders:manage"}}`},
+		{"shop.PlaceOrder", "an anonymous caller", "", `{"$error":{"name":"Unauthorized","message":"authentication is required for grant orders:manage"}}`},
+	}
+	for _, test := range tests {
+		if _, reply := send(t, conn, test.subject, test.token, "{}"); reply != test.expects {
+			t.Errorf("Expected %s from %s to reply %s, but got %s", test.subject, test.caller, test.expects, reply)
+		}
+	}
+}
+
+// CAN REJECT REQUIRING GRANTS THAT DON'T EXIST
+func TestUnknownGrant(t *testing.T) {
+	dir := writeFiles(t, grantFiles)
+	_, err := build(dir, "unknown.hyper", runtime.NewProcess())
+	if err == nil || !strings.Contains(err.Error(), "(2:40) unknown selector ManageOrders") {
+		t.Errorf("Expected requiring a grant that doesn't exist to fail the build where it's required, but got %v", err)
+	}
+}
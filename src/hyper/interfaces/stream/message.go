@@ -1,10 +1,19 @@
 package stream
 
 import (
+	"encoding/json"
+	"fmt"
+	"time"
+
 	"github.com/hntrl/hyper/src/hyper/interfaces/access"
 	"github.com/hntrl/hyper/src/hyper/symbols"
+	"github.com/hntrl/hyper/src/runtime//audit"
+	"github.com/hntrl/hyper/src/runtime//auth"
+	"github.com/hntrl/hyper/src/runtime//log"
 )
 
+var AuditSignal = log.Signal("AUDIT")
+
 var (
 	Message            = MessageClass{}
 	MessageDescriptors = &symbols.ClassDescriptors{
@@ -30,6 +39,108 @@ type MessageValue struct {
 	context MessageContextValue
 }
 
+// newMessageValue returns the message handlers see as self. The token and its
+// claims are empty if the caller is anonymous, and roles are the roles of the
+// context the handler belongs to. The authorization decisions made for the
+// message are recorded with auditor (if there is one). deadline is when the
+// requester stops waiting for a reply, or zero if they wait indefinitely.
+func newMessageValue(correlation string, deadline time.Time, token string, claims auth.Claims, roles access.Roles, auditor *audit.Auditor) MessageValue {
+	return MessageValue{
+		context: MessageContextValue{
+			user:        UserContextValue{token: token, claims: claims, roles: roles},
+			correlation: correlation,
+			deadline:    deadline,
+			audit:       auditor,
+		},
+	}
+}
+
+// processMessage returns the message handlers the process runs on its own
+// behalf see as self (like the handlers of subscriptions). correlation is the
+// correlation ID of the message they were started by, if there is one.
+func processMessage(correlation string) MessageValue {
+	return MessageValue{
+		context: MessageContextValue{
+			correlation: correlation,
+			process:     true,
+		},
+	}
+}
+
+// withMessage returns handler with msg in its scope as self. msg is the frame
+// handler runs in, so it's passed on to the functions handler calls.
+func withMessage(handler symbols.Callable, msg MessageValue) symbols.Callable {
+	if fn, ok := handler.(*symbols.Function); ok {
+		return fn.WithScope(map[string]symbols.ScopeValue{"self": msg}).WithFrame(msg)
+	}
+	return handler
+}
+
+// AsProcess returns handler run on behalf of the process itself instead of a
+// caller (like a test, or a hook that runs when an entity changes), so the
+// requests it makes carry the process's own identity
+func AsProcess(handler symbols.Callable) symbols.Callable {
+	return withMessage(handler, processMessage(""))
+}
+
+// Caller returns the message being handled in the scope st, including in the
+// functions its handler calls. It returns false if st isn't handling a message
+// (like when st is nil).
+func Caller(st *symbols.SymbolTable) (MessageValue, bool) {
+	if st == nil {
+		return MessageValue{}, false
+	}
+	msg, ok := st.Frame.(MessageValue)
+	return msg, ok
+}
+
+// callerMessage returns the message being handled in the scope st, or an
+// anonymous one if there isn't one
+func callerMessage(st *symbols.SymbolTable) MessageValue {
+	msg, _ := Caller(st)
+	return msg
+}
+
+// CheckDeadline returns a Timeout error if the message being handled in the
+// scope st has run past its deadline. Handlers can't be interrupted, so this is
+// checked before each side effect they have (like emitting an event or writing
+// an entity) instead, which stops a handler the requester has given up on from
+// making changes they'll never hear about.
+func CheckDeadline(st *symbols.SymbolTable) error {
+	msg, ok := Caller(st)
+	if !ok || msg.context.deadline.IsZero() || time.Now().Before(msg.context.deadline) {
+		return nil
+	}
+	return symbols.ErrorValue{Name: "Timeout", Message: "the deadline for handling the message has passed"}
+}
+
+// record records a decision made for the message with its auditor. Decisions
+// that can't be recorded are logged, and the message is denied if the auditor
+// fails closed.
+func (msg MessageValue) record(item string, kind audit.Kind, requirement string, allowed bool, reason string) error {
+	if msg.context.audit == nil {
+		return nil
+	}
+	err := msg.context.audit.Record(audit.Decision{
+		Time:        time.Now().UTC(),
+		Correlation: msg.context.correlation,
+		Caller:      msg.context.user.claims.Subject(),
+		Item:        item,
+		Kind:        kind,
+		Requirement: requirement,
+		Allowed:     allowed,
+		Reason:      reason,
+	})
+	if err == nil {
+		return nil
+	}
+	log.Printf(log.LevelERROR, AuditSignal, "cannot record %s %s on \"%s\": %s", kind, requirement, item, err.Error())
+	if msg.context.audit.FailClosed {
+		return symbols.ErrorValue{Name: "Unauthorized", Message: fmt.Sprintf("cannot record the decision on %s %s", kind, requirement)}
+	}
+	return nil
+}
+
 func (msg MessageValue) Class() symbols.Class {
 	return Message
 }
@@ -60,6 +171,16 @@ func (MessageContextClass) Descriptors() *symbols.ClassDescriptors {
 
 type MessageContextValue struct {
 	user UserContextValue
+	// correlation identifies the incoming message, and is sent along with the
+	// requests made while handling it
+	correlation string
+	// deadline is when the requester stops waiting for a reply, after which
+	// the handler can't have any more side effects
+	deadline time.Time
+	// process is set on the messages the process handles on its own behalf,
+	// which don't have a caller
+	process bool
+	audit   *audit.Auditor
 }
 
 func (ctx MessageContextValue) Class() symbols.Class {
@@ -73,6 +194,29 @@ var (
 	UserContext            = UserContextClass{}
 	UserContextDescriptors = &symbols.ClassDescriptors{
 		Name: "UserContext",
+		Properties: symbols.ClassPropertyMap{
+			"id": symbols.PropertyAttributes(symbols.PropertyOptions{
+				Class: symbols.String,
+				Getter: func(user UserContextValue) (symbols.StringValue, error) {
+					return symbols.StringValue(user.claims.Subject()), nil
+				},
+			}),
+			"authenticated": symbols.PropertyAttributes(symbols.PropertyOptions{
+				Class: symbols.Boolean,
+				Getter: func(user UserContextValue) (symbols.BooleanValue, error) {
+					return symbols.BooleanValue(user.claims != nil), nil
+				},
+			}),
+			"claims": symbols.PropertyAttributes(symbols.PropertyOptions{
+				Class: symbols.Map,
+				Getter: func(user UserContextValue) (symbols.ValueObject, error) {
+					if user.claims == nil {
+						return symbols.NewMapValue(), nil
+					}
+					return symbols.ValueFromInterface(map[string]interface{}(user.claims))
+				},
+			}),
+		},
 		Prototype: symbols.ClassPrototypeMap{
 			"hasGrant": symbols.NewClassMethod(symbols.ClassMethodOptions{
 				Class: UserContext,
@@ -81,7 +225,28 @@ var (
 				},
 				Returns: symbols.Boolean,
 				Handler: func(user UserContextValue, grant access.GrantValue) (symbols.BooleanValue, error) {
-					return symbols.BooleanValue(false), nil
+					return symbols.BooleanValue(user.hasGrant(grant.Name)), nil
+				},
+			}),
+			"claim": symbols.NewClassMethod(symbols.ClassMethodOptions{
+				Class: UserContext,
+				Arguments: []symbols.Class{
+					symbols.String,
+				},
+				Returns: symbols.String,
+				Handler: func(user UserContextValue, name symbols.StringValue) (symbols.StringValue, error) {
+					switch value := user.claims[string(name)].(type) {
+					case nil:
+						return symbols.StringValue(""), nil
+					case string:
+						return symbols.StringValue(value), nil
+					default:
+						bytes, err := json.Marshal(value)
+						if err != nil {
+							return "", err
+						}
+						return symbols.StringValue(bytes), nil
+					}
 				},
 			}),
 		},
@@ -94,7 +259,23 @@ func (UserContextClass) Descriptors() *symbols.ClassDescriptors {
 	return UserContextDescriptors
 }
 
+// UserContextValue is the caller of a message. Anonymous callers don't have a
+// token or claims.
 type UserContextValue struct {
+	token  string
+	claims auth.Claims
+	roles  access.Roles
+}
+
+// hasGrant returns true if the caller's token grants name, either directly or
+// through one of the roles it gives the caller
+func (ctx UserContextValue) hasGrant(name string) bool {
+	for _, grant := range ctx.claims.Grants() {
+		if grant == name {
+			return true
+		}
+	}
+	return ctx.roles.HasGrant(ctx.claims.Roles(), name)
 }
 
 func (ctx UserContextValue) Class() symbols.Class {
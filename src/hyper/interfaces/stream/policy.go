@@ -0,0 +1,219 @@
+package stream
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/doc"
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces/access"
+	"github.com/hntrl/hyper/src/hyper/symbols"
+	"github.com/hntrl/hyper/src/hyper/symbols/errors"
+	"github.com/hntrl/hyper/src/runtime//audit"
+)
+
+// PolicyInterface declares policies, which decide whether a caller can use an
+// item from who they are and what they send it. A policy is a function of the
+// caller and (optionally) the payload that returns whether they're allowed,
+// and is attached to items in their requires clause like a grant.
+//
+//	policy OwnsOrder(user: UserContext, order: Order) Bool {
+//	  return order.owner == user.id
+//	}
+type PolicyInterface struct{}
+
+func (PolicyInterface) FromNode(ctx *domain.Context, node ast.ContextMethod) (*domain.ContextItem, error) {
+	table := ctx.Symbols()
+	if node.Private {
+		return nil, errors.NodeError(node, 0, "policy cannot be private: policies aren't exported")
+	}
+	if node.Timeout != "" || len(node.Requires) > 0 {
+		return nil, errors.NodeError(node, 0, "policy cannot have a timeout or requires clause")
+	}
+	arguments := node.Block.Parameters.Arguments
+	if len(arguments.Items) < 1 || len(arguments.Items) > 2 {
+		return nil, errors.NodeError(arguments, errors.InvalidArgumentLength, "policy must have a UserContext argument and optionally a payload argument")
+	}
+	fn, err := table.ResolveFunctionBlock(node.Block)
+	if err != nil {
+		return nil, err
+	}
+	if !symbols.ClassEquals(fn.Arguments()[0], UserContext) {
+		return nil, errors.NodeError(arguments, 0, "policy's first argument must be UserContext")
+	}
+	if fn.Returns() == nil || !symbols.ClassEquals(fn.Returns(), symbols.Boolean) {
+		return nil, errors.NodeError(node, 0, "policy must return Bool")
+	}
+	policy := PolicyValue{
+		Name:    node.Name,
+		Comment: node.Comment,
+		handler: fn,
+	}
+	if len(fn.Arguments()) == 2 {
+		policy.Payload = fn.Arguments()[1]
+	}
+	return &domain.ContextItem{
+		HostItem:   policy,
+		RemoteItem: nil,
+	}, nil
+}
+
+var (
+	Policy            = PolicyClass{}
+	PolicyDescriptors = &symbols.ClassDescriptors{
+		Name: "Policy",
+	}
+)
+
+type PolicyClass struct{}
+
+func (PolicyClass) Descriptors() *symbols.ClassDescriptors {
+	return PolicyDescriptors
+}
+
+type PolicyValue struct {
+	Name    string
+	Comment string
+	// Payload is the class of the payload the policy decides on, or nil if it
+	// only decides on the caller
+	Payload symbols.Class
+	handler *symbols.Function
+}
+
+func (PolicyValue) Class() symbols.Class {
+	return Policy
+}
+func (PolicyValue) Value() interface{} {
+	return nil
+}
+
+func (pv PolicyValue) Describe(item *doc.Item) {
+	item.Arguments = []string{doc.ClassName(UserContext)}
+	if pv.Payload != nil {
+		item.Payload = doc.ClassName(pv.Payload)
+	}
+	item.Returns = doc.ClassName(symbols.Boolean)
+}
+
+// Allows returns whether the policy allows user to send payload
+func (pv PolicyValue) Allows(user UserContextValue, payload symbols.ValueObject) (bool, error) {
+	args := []symbols.ValueObject{user}
+	if pv.Payload != nil {
+		args = append(args, payload)
+	}
+	result, err := pv.handler.Call(args...)
+	if err != nil {
+		return false, err
+	}
+	allowed, ok := result.(symbols.BooleanValue)
+	if !ok {
+		return false, fmt.Errorf("policy %s returned %T instead of Bool", pv.Name, result)
+	}
+	return bool(allowed), nil
+}
+
+// Requirements are the grants and policies an item requires of whoever uses
+// it, given in the item's requires clause
+type Requirements struct {
+	Grants   []access.GrantValue
+	Policies []PolicyValue
+}
+
+// ParseRequirements resolves the grants and policies in a requires clause.
+// payload is the class of the payload the item receives, which the policies
+// have to decide on (nil if the item doesn't receive one).
+func ParseRequirements(table *symbols.SymbolTable, selectors []ast.Selector, payload symbols.Class) (Requirements, error) {
+	requirements := Requirements{
+		Grants:   make([]access.GrantValue, 0),
+		Policies: make([]PolicyValue, 0),
+	}
+	for _, selector := range selectors {
+		value, err := table.ResolveSelector(selector)
+		if err != nil {
+			return requirements, err
+		}
+		switch required := value.(type) {
+		case access.GrantValue:
+			requirements.Grants = append(requirements.Grants, required)
+		case PolicyValue:
+			if required.Payload != nil && (payload == nil || !symbols.ClassEquals(required.Payload, payload)) {
+				return requirements, errors.NodeError(selector, 0, "policy %s decides on %s, which isn't what it's required on receives", required.Name, required.Payload.Descriptors().Name)
+			}
+			requirements.Policies = append(requirements.Policies, required)
+		default:
+			return requirements, errors.NodeError(selector, 0, "%s is not a grant or a policy: only grants and policies can be required", strings.Join(selector.Members, "."))
+		}
+	}
+	return requirements, nil
+}
+
+// Names returns the names of the grants and policies in the requirements
+func (r Requirements) Names() []string {
+	names := make([]string, 0, len(r.Grants)+len(r.Policies))
+	for _, grant := range r.Grants {
+		names = append(names, grant.Name)
+	}
+	for _, policy := range r.Policies {
+		names = append(names, policy.Name)
+	}
+	return names
+}
+
+// Authorize returns an Unauthorized error if the caller of msg doesn't have
+// every grant in the requirements, or any of the policies doesn't allow them
+// to send payload to item. Each grant and policy that's checked is recorded
+// with the auditor of msg, which denies the caller anyway if it fails closed
+// and can't record that they were allowed. The process's own messages aren't
+// checked.
+func (r Requirements) Authorize(msg MessageValue, item string, payload symbols.ValueObject) error {
+	if msg.context.process {
+		return nil
+	}
+	user := msg.context.user
+	for _, grant := range r.Grants {
+		if user.hasGrant(grant.Name) {
+			if err := msg.record(item, audit.Grant, grant.Name, true, ""); err != nil {
+				return err
+			}
+			continue
+		}
+		reason := fmt.Sprintf("missing grant %s", grant.Name)
+		if user.claims == nil {
+			reason = fmt.Sprintf("authentication is required for grant %s", grant.Name)
+		}
+		msg.record(item, audit.Grant, grant.Name, false, reason)
+		return symbols.ErrorValue{Name: "Unauthorized", Message: reason}
+	}
+	for _, policy := range r.Policies {
+		allowed, err := policy.Allows(user, payload)
+		if err != nil {
+			msg.record(item, audit.Policy, policy.Name, false, err.Error())
+			return err
+		}
+		if !allowed {
+			reason := fmt.Sprintf("denied by policy %s", policy.Name)
+			msg.record(item, audit.Policy, policy.Name, false, reason)
+			return symbols.ErrorValue{Name: "Unauthorized", Message: reason}
+		}
+		if err := msg.record(item, audit.Policy, policy.Name, true, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AuthorizeFrom checks the requirements for a use of item made from the scope
+// st, on behalf of the caller of the message st is handling. If st isn't
+// handling a message there's no caller to check the requirements against, so
+// the use is denied unless there aren't any.
+func (r Requirements) AuthorizeFrom(st *symbols.SymbolTable, item string, payload symbols.ValueObject) error {
+	msg, ok := Caller(st)
+	if ok {
+		return r.Authorize(msg, item, payload)
+	}
+	if len(r.Grants) == 0 && len(r.Policies) == 0 {
+		return nil
+	}
+	return symbols.ErrorValue{Name: "Unauthorized", Message: fmt.Sprintf("%s can only be used while handling a message", item)}
+}
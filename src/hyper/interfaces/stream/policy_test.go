@@ -0,0 +1,173 @@
+package stream_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hntrl/hyper/src/hyper/interfaces"
+	"github.com/hntrl/hyper/src/hyper/interfaces/state"
+	"github.com/hntrl/hyper/src/hyper/symbols"
+	"github.com/hntrl/hyper/src/runtime/"
+	"github.com/hntrl/hyper/src/runtime//auth"
+)
+
+var policyFiles = map[string]string{
+	"index.hyper": `import "errors"
+
+context shop {
+  type Order {
+    id Int
+    owner String
+  }
+
+  entity Note requires OwnsNote {
+    owner String
+    text String
+  }
+
+  policy OwnsOrder(user: UserContext, order: Order) Bool {
+    return order.owner == user.id
+  }
+
+  policy OwnsNote(user: UserContext, note: Note) Bool {
+    return note.owner == user.id
+  }
+
+  policy Decides(user: UserContext) Bool {
+    if (user.id == "eve") {
+      throw errors.New("Broken", "cannot decide on eve")
+    }
+    return true
+  }
+
+  query Cancel(order: Order) String requires OwnsOrder, Decides {
+    return "cancelled"
+  }
+
+  func write(owner: String) String {
+    note := Note.insert(Note{ owner: owner, text: "first" })
+    return note.owner
+  }
+
+  query Write(order: Order) String {
+    return write(order.owner)
+  }
+
+  // gives the note away to someone else after writing it, after which it
+  // can't be changed by whoever wrote it anymore
+  query GiveAway(order: Order) String {
+    note := Note.insert(Note{ owner: order.owner, text: "first" })
+    note.update(Note{ owner: "bob", text: "second" })
+    note.delete()
+    return note.owner
+  }
+
+  test writesAsProcess() {
+    expect(write("nobody"), "nobody")
+  }
+}
+`,
+	"mismatch.hyper": `context shop {
+  type Order {
+    id Int
+  }
+
+  type Refund {
+    id Int
+  }
+
+  policy ForOrders(user: UserContext, order: Order) Bool {
+    return true
+  }
+
+  query Cancel(refund: Refund) String requires ForOrders {
+    return "cancelled"
+  }
+}
+`,
+}
+
+// CAN DECIDE ON MESSAGES WITH POLICIES
+func TestPolicy(t *testing.T) {
+	dir := writeFiles(t, policyFiles)
+	secret := writeSecret(t)
+	serve(t, dir, "index.hyper", t.Name(), func(process *runtime.Process) {
+		process.UseAuth(&auth.Config{Algorithm: auth.HS256, VerifyKey: secret})
+	})
+	conn := connect(t, t.Name())
+	ada := sign(t, auth.Claims{"sub": "ada"})
+	eve := sign(t, auth.Claims{"sub": "eve"})
+
+	tests := []struct {
+		caller  string
+		token   string
+		data    string
+		expects string
+	}{
+		{"the owner", ada, `{"id":1,"owner":"ada"}`, `"cancelled"`},
+		{"someone else", ada, `{"id":1,"owner":"bob"}`, `{"$error":{"name":"Unauthorized","message":"denied by policy OwnsOrder"}}`},
+		{"an anonymous caller", "", `{"id":1,"owner":"ada"}`, `{"$error":{"name":"Unauthorized","message":"denied by policy OwnsOrder"}}`},
+		{"a caller the policy fails on", eve, `{"id":1,"owner":"eve"}`, `{"$error":{"name":"Broken","message":"cannot decide on eve"}}`},
+	}
+	for _, test := range tests {
+		if _, reply := send(t, conn, "shop.Cancel", test.token, test.data); reply != test.expects {
+			t.Errorf("Expected cancelling as %s to reply %s, but got %s", test.caller, test.expects, reply)
+		}
+	}
+}
+
+// CAN DECIDE ON ENTITY WRITES WITH POLICIES
+func TestEntityPolicy(t *testing.T) {
+	dir := writeFiles(t, policyFiles)
+	secret := writeSecret(t)
+	shop := serve(t, dir, "index.hyper", t.Name(), func(process *runtime.Process) {
+		process.UseAuth(&auth.Config{Algorithm: auth.HS256, VerifyKey: secret})
+	})
+	conn := connect(t, t.Name())
+	ada := sign(t, auth.Claims{"sub": "ada"})
+	bob := sign(t, auth.Claims{"sub": "bob"})
+
+	// the entity is written by a function the query calls, which is checked
+	// against the caller of the query all the same
+	if _, reply := send(t, conn, "shop.Write", bob, `{"id":1,"owner":"ada"}`); reply != `{"$error":{"name":"Unauthorized","message":"denied by policy OwnsNote"}}` {
+		t.Errorf("Expected inserting someone else's note to be denied, but got %s", reply)
+	}
+	if _, reply := send(t, conn, "shop.Write", ada, `{"id":1,"owner":"ada"}`); reply != `"ada"` {
+		t.Fatalf("Expected inserting your own note to be allowed, but got %s", reply)
+	}
+	// updating and deleting are decided on the note as it is before the
+	// change, so the note can be given away but not taken back
+	if _, reply := send(t, conn, "shop.GiveAway", ada, `{"id":1,"owner":"ada"}`); reply != `{"$error":{"name":"Unauthorized","message":"denied by policy OwnsNote"}}` {
+		t.Errorf("Expected deleting someone else's note to be denied, but got %s", reply)
+	}
+	if _, reply := send(t, conn, "shop.GiveAway", bob, `{"id":1,"owner":"bob"}`); reply != `"bob"` {
+		t.Errorf("Expected updating and deleting your own note to be allowed, but got %s", reply)
+	}
+
+	// the process writes on its own behalf, without a caller to check
+	if err := shop.Items["writesAsProcess"].HostItem.(interfaces.Test).Run(); err != nil {
+		t.Errorf("Expected the process to be able to write the entity: %s", err)
+	}
+	// writes that aren't made while handling a message are denied, since
+	// there's no one to check the requirements against
+	insert := shop.Items["Note"].HostItem.(*state.EntityStore).Descriptors().ClassProperties["insert"].(*symbols.Function)
+	mapValue := symbols.NewMapValue()
+	mapValue.Set("owner", symbols.StringValue("ada"))
+	mapValue.Set("text", symbols.StringValue("first"))
+	note, err := symbols.Construct(insert.Arguments()[0], mapValue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := insert.Call(note); err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("Expected a write without a caller to be denied, but got %v", err)
+	}
+}
+
+// CAN REJECT POLICIES REQUIRED ON ITEMS THEY DON'T DECIDE ON
+func TestPolicyPayloadMismatch(t *testing.T) {
+	dir := writeFiles(t, policyFiles)
+	_, err := build(dir, "mismatch.hyper", runtime.NewProcess())
+	if err == nil || !strings.Contains(err.Error(), "policy ForOrders decides on Order") {
+		t.Errorf("Expected requiring a policy on the wrong payload to fail, but got %v", err)
+	}
+}
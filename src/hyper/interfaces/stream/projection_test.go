@@ -0,0 +1,89 @@
+package stream_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hntrl/hyper/src/runtime/"
+	"github.com/hntrl/hyper/src/runtime//resource"
+	"github.com/hntrl/hyper/src/runtime//storage"
+)
+
+var projectionFiles = map[string]string{
+	"index.hyper": `context shop {
+  entity Note {
+    text String
+  }
+}
+`,
+}
+
+// CAN CATCH UP ON EVENTS THE PROJECTION MISSED
+func TestProjectionCatchUp(t *testing.T) {
+	ctx := context.Background()
+	dir := writeFiles(t, projectionFiles)
+	path := filepath.Join(dir, "state.db")
+	created := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	updated := created.Add(time.Hour)
+
+	// the events were written, but the process stopped before the projection
+	// was changed with all of them
+	res, err := resource.FileStore{Config: resource.Config{Path: path}}.Attach(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := res.(resource.FileStore)
+	log, _ := store.EventLog(ctx, "shop", "Note_events")
+	coll, _ := store.Collection(ctx, "shop", "Note_projection")
+	for _, event := range []storage.Event{
+		{EntityID: "a", Timestamp: created, Effect: "CREATE", State: map[string]interface{}{"text": "first"}},
+		{EntityID: "a", Timestamp: updated, Effect: "UPDATE", State: map[string]interface{}{"text": "second"}},
+		{EntityID: "b", Timestamp: created, Effect: "CREATE", State: map[string]interface{}{"text": "gone"}},
+		{EntityID: "b", Timestamp: updated, Effect: "DELETE", State: map[string]interface{}{"text": "gone"}},
+		{EntityID: "c", Timestamp: created, Effect: "CREATE", State: map[string]interface{}{"text": "missing"}},
+	} {
+		if _, err := log.Append(ctx, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stale, _ := coll.Insert(ctx, map[string]interface{}{"entity_id": "a", "created_at": created, "updated_at": created, "state": map[string]interface{}{"text": "first"}})
+	coll.Insert(ctx, map[string]interface{}{"entity_id": "b", "created_at": created, "updated_at": created, "state": map[string]interface{}{"text": "gone"}})
+	store.Detach(ctx)
+
+	process := runtime.NewProcess()
+	process.UseResourceConfig(map[string]resource.Config{
+		"stream": {Type: "bus", URL: t.Name()},
+		"state":  {Type: "file", Path: path},
+	})
+	if _, err := build(dir, "index.hyper", process); err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Attach(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = resource.FileStore{Config: resource.Config{Path: path}}.Attach(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store = res.(resource.FileStore)
+	defer store.Detach(ctx)
+	coll, _ = store.Collection(ctx, "shop", "Note_projection")
+	records, _ := coll.Find(ctx, storage.Filter{}, storage.FindOptions{})
+	texts := make(map[string]interface{})
+	for _, record := range records {
+		state, _ := record.Data["state"].(map[string]interface{})
+		texts[record.Data["entity_id"].(string)] = state["text"]
+		if record.Data["entity_id"] == "a" && record.ID != stale.ID {
+			t.Errorf("Expected the record of a to be kept, but it was replaced with %s", record.ID)
+		}
+	}
+	if len(texts) != 2 || texts["a"] != "second" || texts["c"] != "missing" {
+		t.Errorf("Expected the projection to be caught up with the events, but got %v", texts)
+	}
+}
@@ -1,18 +1,23 @@
 package stream
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/doc"
 	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces/access"
 	"github.com/hntrl/hyper/src/hyper/symbols"
 	"github.com/hntrl/hyper/src/hyper/symbols/errors"
 	"github.com/hntrl/hyper/src/runtime/"
+	"github.com/hntrl/hyper/src/runtime//audit"
+	"github.com/hntrl/hyper/src/runtime//auth"
 	"github.com/hntrl/hyper/src/runtime//log"
-	"github.com/hntrl/hyper/src/runtime//resource"
-	"github.com/nats-io/nats.go"
+	"github.com/hntrl/hyper/src/runtime//transport"
 )
 
 var QuerySignal = log.Signal("QUERY")
@@ -33,6 +38,10 @@ func (QueryInterface) FromNode(ctx *domain.Context, node ast.ContextMethod) (*do
 	if err != nil {
 		return nil, err
 	}
+	timeout, err := parseTimeout(node)
+	if err != nil {
+		return nil, err
+	}
 	query := Query{
 		Name:        node.Name,
 		Private:     node.Private,
@@ -40,18 +49,24 @@ func (QueryInterface) FromNode(ctx *domain.Context, node ast.ContextMethod) (*do
 		Topic:       Topic(fmt.Sprintf("%s.%s", ctx.Identifier, node.Name)),
 		PayloadType: nil,
 		Returns:     fn.Returns(),
+		Timeout:     timeout,
 	}
 	if len(fn.Arguments()) == 1 {
 		query.PayloadType = fn.Arguments()[0]
 	}
-	consumer := QueryConsumer{
-		query:   query,
-		handler: fn,
+	query.Requires, err = ParseRequirements(table, node.Requires, query.PayloadType)
+	if err != nil {
+		return nil, err
+	}
+	consumer := &QueryConsumer{
+		query:       query,
+		handler:     fn,
+		hostContext: ctx,
 	}
 	if !node.Private {
 		return &domain.ContextItem{
 			HostItem:   consumer,
-			RemoteItem: QueryEmitter{query: query},
+			RemoteItem: &QueryEmitter{query: query},
 		}, nil
 	} else {
 		return &domain.ContextItem{
@@ -68,12 +83,27 @@ type Query struct {
 	Topic       Topic
 	PayloadType symbols.Class
 	Returns     symbols.Class
+	// Timeout is the timeout the query declares, or 0 if it doesn't
+	Timeout time.Duration
+	// Requires are the grants callers must have and the policies that must
+	// allow them for the query's handler to run
+	Requires Requirements
 }
 
 type QueryConsumer struct {
 	query   Query
 	handler symbols.Callable
-	stream  *resource.NatsConnection
+	stream  transport.Transport
+	subs    *transport.Subscriptions
+	running *sync.WaitGroup
+	auth    *auth.Authenticator
+	// hostContext is the context the consumer belongs to, which it looks up
+	// the roles callers can have in
+	hostContext *domain.Context
+	roles       access.Roles
+	// audit records the authorization decisions made for the messages the
+	// consumer receives
+	audit *audit.Auditor
 }
 
 func (consumer QueryConsumer) Arguments() []symbols.Class {
@@ -86,49 +116,114 @@ func (consumer QueryConsumer) Returns() symbols.Class {
 	return consumer.query.Returns
 }
 func (consumer QueryConsumer) Call(args ...symbols.ValueObject) (symbols.ValueObject, error) {
-	return consumer.handler.Call(args...)
+	return consumer.CallFrom(nil, args...)
+}
+
+// CallFrom calls the handler locally on behalf of the caller of the message
+// being handled in st, which has to meet the query's requirements the same as
+// if they had sent it a message
+func (consumer QueryConsumer) CallFrom(st *symbols.SymbolTable, args ...symbols.ValueObject) (symbols.ValueObject, error) {
+	var payload symbols.ValueObject
+	if len(args) > 0 {
+		payload = args[0]
+	}
+	if err := consumer.query.Requires.AuthorizeFrom(st, string(consumer.query.Topic), payload); err != nil {
+		return nil, err
+	}
+	return withMessage(consumer.handler, callerMessage(st)).Call(args...)
+}
+func (consumer QueryConsumer) Describe(item *doc.Item) {
+	item.Payload = doc.ClassName(consumer.query.PayloadType)
+	item.Returns = doc.ClassName(consumer.query.Returns)
+	item.Topic = string(consumer.query.Topic)
+	if consumer.query.Timeout != 0 {
+		item.Timeout = consumer.query.Timeout.String()
+	}
+	item.Requires = append(item.Requires, consumer.query.Requires.Names()...)
 }
 
-func (consumer *QueryConsumer) Attach(process *runtime.Process) error {
-	var conn resource.NatsConnection
-	err := process.Resource("stream", &conn)
+func (consumer *QueryConsumer) Attach(ctx context.Context, process *runtime.Process) error {
+	var conn transport.Transport
+	err := process.Resource(ctx, "stream", &conn)
 	if err != nil {
 		return err
 	}
-	consumer.stream = &conn
-	consumer.stream.Client.QueueSubscribe(string(consumer.query.Topic), "handler_queue", func(m *nats.Msg) {
-		var payload symbols.ValueObject
-		if consumer.query.PayloadType != nil {
-			var err error
-			payload, err = symbols.ValueFromBytes(m.Data)
-			if err != nil {
-
-			}
-			payload, err = symbols.Construct(consumer.query.PayloadType, payload)
-			if err != nil {
-
-			}
+	consumer.stream = conn
+	consumer.subs = &transport.Subscriptions{}
+	consumer.running = &sync.WaitGroup{}
+	consumer.auth = process.Authenticator()
+	consumer.roles = access.ContextRoles(consumer.hostContext)
+	consumer.audit = process.Audit()
+	return consumer.subs.QueueSubscribe(conn, string(consumer.query.Topic), "handler_queue", func(m transport.Message) {
+		ctx, cancel := m.Context(context.Background())
+		defer cancel()
+		correlation := m.CorrelationID()
+		bytes, err := consumer.handle(ctx, m, correlation)
+		if err != nil && ctx.Err() != nil {
+			log.Printf(log.LevelWARN, QueryMessageSignal, "\"%s\" timed out: the requester stopped waiting for a reply, and the handler is refused any more side effects", consumer.query.Topic)
+			return
 		}
-		result, err := consumer.handler.Call(payload)
 		if err != nil {
+			log.Printf(log.LevelERROR, QueryMessageSignal, "\"%s\" failed (correlation id %s): %s", consumer.query.Topic, correlation, err.Error())
+			bytes = marshalErrorReply(err, correlation)
+		}
+		m.Respond(bytes)
+	})
+}
 
+// handle calls the query's handler with the payload in m and returns what
+// should be replied with. It stops waiting for the handler when ctx is done,
+// and the handler is refused any side effects it tries to have after that.
+func (consumer *QueryConsumer) handle(ctx context.Context, m transport.Message, correlation string) (bytes []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
 		}
-		bytes, err := json.Marshal(result.Value())
+	}()
+	token, claims, err := consumer.auth.Identify(m.Header)
+	if err != nil {
+		return nil, symbols.ErrorValue{Name: "Unauthorized", Message: err.Error()}
+	}
+	var payload symbols.ValueObject
+	if consumer.query.PayloadType != nil {
+		value, err := symbols.ValueFromBytes(m.Data)
 		if err != nil {
-
+			return nil, err
 		}
-		m.Respond(bytes)
-	})
-	return nil
+		payload, err = symbols.Construct(consumer.query.PayloadType, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	deadline, _ := ctx.Deadline()
+	msg := newMessageValue(correlation, deadline, token, claims, consumer.roles, consumer.audit)
+	if err := consumer.query.Requires.Authorize(msg, string(consumer.query.Topic), payload); err != nil {
+		return nil, err
+	}
+	handler := withMessage(consumer.handler, msg)
+	result, err := callHandler(ctx, consumer.running, handler, payload)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return json.Marshal(nil)
+	}
+	return json.Marshal(result.Value())
 }
-func (consumer *QueryConsumer) Detach() error {
+func (consumer *QueryConsumer) Detach(ctx context.Context) error {
+	err := consumer.subs.Drain(ctx)
+	if err == nil {
+		err = waitForHandlers(ctx, consumer.running)
+	}
 	consumer.stream = nil
-	return nil
+	return err
 }
 
 type QueryEmitter struct {
-	query  Query
-	stream *resource.NatsConnection
+	query   Query
+	stream  transport.Transport
+	timeout time.Duration
+	auth    *auth.Authenticator
 }
 
 func (emitter QueryEmitter) Arguments() []symbols.Class {
@@ -141,6 +236,28 @@ func (emitter QueryEmitter) Returns() symbols.Class {
 	return emitter.query.Returns
 }
 func (emitter QueryEmitter) Call(args ...symbols.ValueObject) (symbols.ValueObject, error) {
+	return emitter.call(MessageValue{}, emitter.timeout, args...)
+}
+
+// CallFrom calls the query on behalf of the caller of the message being handled
+// in st, if there is one
+func (emitter QueryEmitter) CallFrom(st *symbols.SymbolTable, args ...symbols.ValueObject) (symbols.ValueObject, error) {
+	return emitter.call(callerMessage(st), emitter.timeout, args...)
+}
+
+// Get resolves the methods of the emitter
+func (emitter *QueryEmitter) Get(key string) (symbols.ScopeValue, error) {
+	if key == "withTimeout" {
+		return timeoutCall{
+			arguments: emitter.Arguments(),
+			returns:   emitter.Returns(),
+			call:      emitter.call,
+		}, nil
+	}
+	return nil, nil
+}
+
+func (emitter QueryEmitter) call(caller MessageValue, timeout time.Duration, args ...symbols.ValueObject) (symbols.ValueObject, error) {
 	if emitter.stream == nil {
 		panic("stream connection not initialized")
 	}
@@ -152,42 +269,29 @@ func (emitter QueryEmitter) Call(args ...symbols.ValueObject) (symbols.ValueObje
 			return nil, err
 		}
 	}
-	res, err := emitter.stream.Client.Request(string(emitter.query.Topic), bytes, time.Second*5)
+	header, err := callerHeader(emitter.auth, caller)
 	if err != nil {
 		return nil, err
 	}
-	value, err := symbols.ValueFromBytes(res.Data)
+	value, err := request(emitter.stream, emitter.query.Topic, header, bytes, timeout)
 	if err != nil {
 		return nil, err
 	}
-	if mapValue, ok := value.(*symbols.MapValue); ok {
-		if errValue := mapValue.Get("$error"); errValue != nil {
-			if errMapValue, ok := errValue.(*symbols.MapValue); ok {
-				mappedError, err := symbols.Construct(symbols.Error, errMapValue)
-				if err != nil {
-					return nil, err
-				}
-				return nil, mappedError.(symbols.ErrorValue)
-			}
-			return nil, symbols.ErrorValue{
-				Name:    "InternalError",
-				Message: "unknown error was returned upstream",
-			}
-		}
-	}
 	return symbols.Construct(emitter.query.Returns, value)
 }
 
-func (emitter *QueryEmitter) Attach(process *runtime.Process) error {
-	var conn resource.NatsConnection
-	err := process.Resource("stream", &conn)
+func (emitter *QueryEmitter) Attach(ctx context.Context, process *runtime.Process) error {
+	var conn transport.Transport
+	err := process.Resource(ctx, "stream", &conn)
 	if err != nil {
 		return err
 	}
-	emitter.stream = &conn
+	emitter.stream = conn
+	emitter.timeout = requestTimeout(process, emitter.query.Topic, emitter.query.Timeout)
+	emitter.auth = process.Authenticator()
 	return nil
 }
-func (emitter *QueryEmitter) Detach() error {
+func (emitter *QueryEmitter) Detach(ctx context.Context) error {
 	emitter.stream = nil
 	return nil
 }
@@ -0,0 +1,68 @@
+package stream_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hntrl/hyper/src/runtime/"
+)
+
+var remoteFiles = map[string]string{
+	"billing.hyper": `context acme.billing {
+  command Charge() String {
+    return "charged"
+  }
+
+  query Balance() String {
+    return "0.00"
+  }
+
+  private query Ledger() String {
+    return "secret"
+  }
+}
+`,
+	"shop.hyper": `import "./billing.hyper"
+
+context acme.shop {
+  command Checkout() String {
+    return acme.billing.Charge() + " " + acme.billing.Balance()
+  }
+}
+`,
+	"peek.hyper": `import "./billing.hyper"
+
+context acme.peek {
+  query Peek() String {
+    return acme.billing.Ledger()
+  }
+}
+`,
+}
+
+// CAN RESOLVE THE COMMANDS AND QUERIES OF ANOTHER CONTEXT
+func TestRemoteItems(t *testing.T) {
+	dir := writeFiles(t, remoteFiles)
+	bus := t.Name()
+	serve(t, dir, "shop.hyper", bus, nil)
+	conn := connect(t, bus)
+
+	// the items acme.shop sees of acme.billing send it messages instead of
+	// calling its handlers, so they fail until it's served by a process
+	if _, reply := send(t, conn, "acme.shop.Checkout", "", "{}"); !strings.Contains(reply, "InternalError") {
+		t.Errorf("Expected acme.billing to be unreachable before it's served, but got %s", reply)
+	}
+	serve(t, dir, "billing.hyper", bus, nil)
+	if _, reply := send(t, conn, "acme.shop.Checkout", "", "{}"); reply != `"charged 0.00"` {
+		t.Errorf("Expected the commands and queries of acme.billing to be called over the bus, but got %s", reply)
+	}
+}
+
+// CAN KEEP PRIVATE ITEMS FROM BEING ACCESSED BY OTHER CONTEXTS
+func TestRemotePrivateItems(t *testing.T) {
+	dir := writeFiles(t, remoteFiles)
+	_, err := build(dir, "peek.hyper", runtime.NewProcess())
+	if err == nil || !strings.Contains(err.Error(), "Ledger") {
+		t.Errorf("Expected accessing a private query of another context to fail the build, but got %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package stream_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hntrl/hyper/src/runtime/"
+	"github.com/hntrl/hyper/src/runtime//auth"
+)
+
+var roleFiles = map[string]string{
+	"index.hyper": `context shop {
+  grant ViewOrders {
+    name = "orders:view"
+  }
+
+  grant ManageOrders {
+    name = "orders:manage"
+  }
+
+  role Staff {
+    grant ViewOrders
+  }
+
+  role Manager extends Staff {
+    name = "shop:manager"
+    grant ManageOrders
+  }
+
+  role Owner extends Manager {}
+
+  query ListOrders() String requires ViewOrders {
+    return "listed"
+  }
+
+  command PlaceOrder() String requires ManageOrders {
+    return "placed"
+  }
+}
+`,
+	"cycle.hyper": `context shop {
+  role Staff extends Owner {}
+
+  role Manager extends Staff {}
+
+  role Owner {
+    role Manager
+  }
+}
+`,
+	"duplicate.hyper": `context shop {
+  role Staff {}
+
+  role Clerk {
+    name = "Staff"
+  }
+}
+`,
+}
+
+// CAN GIVE CALLERS THE GRANTS OF THEIR ROLES AND THE ROLES THOSE EXTEND
+func TestRole(t *testing.T) {
+	dir := writeFiles(t, roleFiles)
+	secret := writeSecret(t)
+	serve(t, dir, "index.hyper", t.Name(), func(process *runtime.Process) {
+		process.UseAuth(&auth.Config{Algorithm: auth.HS256, VerifyKey: secret})
+	})
+	conn := connect(t, t.Name())
+	denied := `{"$error":{"name":"Unauthorized","message":"missing grant orders:manage"}}`
+
+	tests := []struct {
+		roles   []string
+		subject string
+		expects string
+	}{
+		{[]string{"Staff"}, "shop.ListOrders", `"listed"`},
+		{[]string{"Staff"}, "shop.PlaceOrder", denied},
+		{[]string{"shop:manager"}, "shop.ListOrders", `"listed"`},
+		{[]string{"shop:manager"}, "shop.PlaceOrder", `"placed"`},
+		{[]string{"Owner"}, "shop.ListOrders", `"listed"`},
+		{[]string{"Owner"}, "shop.PlaceOrder", `"placed"`},
+		// roles are given by the name they're given to callers with
+		{[]string{"Manager"}, "shop.PlaceOrder", denied},
+		{[]string{"Janitor", "Staff"}, "shop.ListOrders", `"listed"`},
+	}
+	for _, test := range tests {
+		token := sign(t, auth.Claims{"sub": "ada", "roles": test.roles})
+		if _, reply := send(t, conn, test.subject, token, "{}"); reply != test.expects {
+			t.Errorf("Expected %s with roles %v to reply %s, but got %s", test.subject, test.roles, test.expects, reply)
+		}
+	}
+}
+
+// CAN REJECT ROLES THAT CAN'T BE TOLD APART
+func TestInvalidRoles(t *testing.T) {
+	dir := writeFiles(t, roleFiles)
+	tests := []struct {
+		name    string
+		expects string
+	}{
+		{"cycle.hyper", "role cycle: "},
+		{"duplicate.hyper", "(5:5) role Staff is already given to callers as Staff"},
+	}
+	for _, test := range tests {
+		_, err := build(dir, test.name, runtime.NewProcess())
+		if err == nil || !strings.Contains(err.Error(), test.expects) {
+			t.Errorf("Expected building %s to fail with %q, but got %v", test.name, test.expects, err)
+		}
+	}
+}
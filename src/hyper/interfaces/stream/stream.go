@@ -1,16 +1,190 @@
 package stream
 
 import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hntrl/hyper/src/hyper/ast"
 	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/symbols"
+	"github.com/hntrl/hyper/src/hyper/symbols/errors"
 	"github.com/hntrl/hyper/src/runtime/"
+	"github.com/hntrl/hyper/src/runtime//auth"
+	"github.com/hntrl/hyper/src/runtime//transport"
 )
 
 type Topic string
 
+// DefaultRequestTimeout is how long requests to commands and queries wait for
+// a reply when neither the item nor the process sets a timeout
+const DefaultRequestTimeout = 5 * time.Second
+
 func RegisterDefaults(builder *domain.ContextBuilder, process *runtime.Process) {
 	builder.RegisterInterface("command", CommandInterface{})
 	builder.RegisterInterface("event", EventInterface{})
 	builder.RegisterInterface("query", QueryInterface{})
 	builder.RegisterInterface("sub", SubscriptionInterface{})
+	builder.RegisterInterface("policy", PolicyInterface{})
+	builder.RegisterSelector("UserContext", UserContext)
 	builder.RegisterSelector("emit", makeEventEmitterFunction(process))
 }
+
+// parseTimeout returns the duration in the timeout clause of node, or 0 if it
+// doesn't have one
+func parseTimeout(node ast.ContextMethod) (time.Duration, error) {
+	if node.Timeout == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(node.Timeout)
+	if err != nil || timeout <= 0 {
+		return 0, errors.NodeError(node, 0, "invalid timeout %q: expected a duration greater than 0 (like \"5s\")", node.Timeout)
+	}
+	return timeout, nil
+}
+
+// requestTimeout returns how long requests to topic should wait for a reply.
+// Timeouts configured on the process take precedence over the one the item
+// declares.
+func requestTimeout(process *runtime.Process, topic Topic, declared time.Duration) time.Duration {
+	if timeout, ok := process.RequestTimeout(string(topic)); ok {
+		return timeout
+	}
+	if declared != 0 {
+		return declared
+	}
+	return DefaultRequestTimeout
+}
+
+// timeoutCall is the withTimeout method of emitters, which sends a request
+// with a timeout given at the call site instead of the one the emitter was
+// attached with (like `orders.PlaceOrder.withTimeout("30s", order)`)
+type timeoutCall struct {
+	arguments []symbols.Class
+	returns   symbols.Class
+	call      func(MessageValue, time.Duration, ...symbols.ValueObject) (symbols.ValueObject, error)
+}
+
+func (fn timeoutCall) Arguments() []symbols.Class {
+	return append([]symbols.Class{symbols.String}, fn.arguments...)
+}
+func (fn timeoutCall) Returns() symbols.Class {
+	return fn.returns
+}
+func (fn timeoutCall) Call(args ...symbols.ValueObject) (symbols.ValueObject, error) {
+	return fn.callAs(MessageValue{}, args...)
+}
+func (fn timeoutCall) CallFrom(st *symbols.SymbolTable, args ...symbols.ValueObject) (symbols.ValueObject, error) {
+	return fn.callAs(callerMessage(st), args...)
+}
+func (fn timeoutCall) callAs(caller MessageValue, args ...symbols.ValueObject) (symbols.ValueObject, error) {
+	value := string(args[0].(symbols.StringValue))
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return nil, symbols.ErrorValue{
+			Name:    "BadRequest",
+			Message: fmt.Sprintf("invalid timeout %q: expected a duration greater than 0 (like \"5s\")", value),
+		}
+	}
+	return fn.call(caller, timeout, args[1:]...)
+}
+
+// callerHeader returns the header requests made while handling the message
+// caller are sent with, which carries its correlation ID and the token that
+// identifies its caller. Requests made on behalf of a caller only ever forward
+// the caller's token (and none if they're anonymous), and only the process's
+// own messages are sent with a token signed for the process.
+func callerHeader(authenticator *auth.Authenticator, caller MessageValue) (transport.Header, error) {
+	token := caller.context.user.token
+	if caller.context.process {
+		var err error
+		if token, err = authenticator.Token(); err != nil {
+			return nil, err
+		}
+	}
+	header := transport.Header{}
+	if token != "" {
+		header[auth.Header] = token
+	}
+	if caller.context.correlation != "" {
+		header[transport.CorrelationHeader] = caller.context.correlation
+	}
+	return header, nil
+}
+
+// request sends data to topic and waits until timeout for the reply. The
+// deadline is sent along with the request so the consumer can give up at the
+// same time, and errors the consumer replies with are returned as errors.
+func request(stream transport.Transport, topic Topic, header transport.Header, data []byte, timeout time.Duration) (symbols.ValueObject, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	msg := transport.Message{Subject: string(topic), Header: header, Data: data}
+	res, err := stream.Request(ctx, msg.WithDeadline(ctx))
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, symbols.ErrorValue{
+				Name:    "Timeout",
+				Message: fmt.Sprintf("\"%s\" didn't reply within %s", topic, timeout),
+			}
+		}
+		return nil, err
+	}
+	if err, ok := unmarshalErrorReply(res.Data); ok {
+		return nil, err
+	}
+	return symbols.ValueFromBytes(res.Data)
+}
+
+// callHandler calls handler with args, but stops waiting for it once ctx is
+// done. The interpreter can't be interrupted, so a handler that's given up on
+// keeps running in the background until it returns (see CheckDeadline for how
+// it's kept from having side effects meanwhile); running keeps track of those
+// so detaching can wait for them.
+func callHandler(ctx context.Context, running *sync.WaitGroup, handler symbols.Callable, args ...symbols.ValueObject) (symbols.ValueObject, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		return handler.Call(args...)
+	}
+	type result struct {
+		value symbols.ValueObject
+		err   error
+	}
+	done := make(chan result, 1)
+	running.Add(1)
+	go func() {
+		var res result
+		defer func() {
+			if r := recover(); r != nil {
+				res.err = fmt.Errorf("panic: %v", r)
+			}
+			done <- res
+			running.Done()
+		}()
+		res.value, res.err = handler.Call(args...)
+	}()
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// waitForHandlers waits for the handlers that were given up on to return, or
+// for ctx to be done
+func waitForHandlers(ctx context.Context, running *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,193 @@
+package stream_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces"
+	"github.com/hntrl/hyper/src/hyper/symbols"
+	"github.com/hntrl/hyper/src/runtime/"
+	"github.com/hntrl/hyper/src/runtime//auth"
+	"github.com/hntrl/hyper/src/runtime//resource"
+	"github.com/hntrl/hyper/src/runtime//transport"
+)
+
+const testSecret = "a-shared-secret-that-is-long-enough"
+
+// writeFiles writes files to a temporary directory and returns it
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// writeSecret writes the key tokens are signed with in tests and returns its
+// path
+func writeSecret(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte(testSecret), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// build builds the context declared in the file name in dir with the
+// interfaces process provides
+func build(dir string, name string, process *runtime.Process) (*domain.Context, error) {
+	path := filepath.Join(dir, name)
+	tree, err := domain.ParseContextFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	builder := domain.NewContextBuilder()
+	interfaces.RegisterDefaults(builder, process)
+	ctx, err := builder.ParseContext(*tree, path)
+	if err != nil {
+		return nil, err
+	}
+	process.UseContextBuilder(builder)
+	return ctx, nil
+}
+
+// serve builds the context declared in the file name in dir, and attaches it
+// to a process that keeps state in memory and is connected to the bus named
+// bus. configure is called with the process before the context is built.
+func serve(t *testing.T, dir string, name string, bus string, configure func(*runtime.Process)) *domain.Context {
+	process := runtime.NewProcess()
+	process.UseResourceConfig(map[string]resource.Config{
+		"stream": {Type: "bus", URL: bus},
+		"state":  {Type: "memory"},
+	})
+	if configure != nil {
+		configure(process)
+	}
+	ctx, err := build(dir, name, process)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Attach(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { process.Close(context.Background()) })
+	return ctx
+}
+
+// connect returns a connection to the bus named bus
+func connect(t *testing.T, bus string) transport.Transport {
+	res, err := resource.Bus{Config: resource.Config{URL: bus}}.Attach(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Detach(context.Background()) })
+	return res.(transport.Transport)
+}
+
+// sign returns a token for subject signed with the test secret
+func sign(t *testing.T, claims auth.Claims) string {
+	signer, err := auth.LoadSigner(auth.HS256, writeSecret(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims["exp"] = time.Now().Add(time.Minute).Unix()
+	token, err := signer.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// send sends data to subject with token (if there is one), and returns what
+// was replied with
+func send(t *testing.T, conn transport.Transport, subject string, token string, data string) (symbols.ValueObject, string) {
+	header := transport.Header{}
+	if token != "" {
+		header[auth.Header] = token
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	reply, err := conn.Request(ctx, transport.Message{Subject: subject, Header: header, Data: []byte(data)})
+	if err != nil {
+		t.Fatalf("%s: %s", subject, err)
+	}
+	value, err := symbols.ValueFromBytes(reply.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value, string(reply.Data)
+}
+
+var callerFiles = map[string]string{
+	"billing.hyper": `context acme.billing {
+  query Whoami() String {
+    return self.ctx.user.id
+  }
+}
+`,
+	"shop.hyper": `import "./billing.hyper"
+
+context acme.shop {
+  func ask() String {
+    return acme.billing.Whoami()
+  }
+
+  query Direct() String {
+    return acme.billing.Whoami()
+  }
+
+  query ViaHelper() String {
+    return ask()
+  }
+
+  test asProcess() {
+    expect(ask(), "acme.shop")
+  }
+}
+`,
+}
+
+// CAN FORWARD THE CALLER OF A MESSAGE THROUGH NESTED CALLS
+func TestCallerForwarding(t *testing.T) {
+	dir := writeFiles(t, callerFiles)
+	secret := writeSecret(t)
+	bus := t.Name()
+	serve(t, dir, "billing.hyper", bus, func(process *runtime.Process) {
+		process.UseAuth(&auth.Config{Algorithm: auth.HS256, VerifyKey: secret})
+	})
+	shop := serve(t, dir, "shop.hyper", bus, func(process *runtime.Process) {
+		process.UseAuth(&auth.Config{Algorithm: auth.HS256, VerifyKey: secret, SigningKey: secret, Subject: "acme.shop"})
+	})
+	conn := connect(t, bus)
+	token := sign(t, auth.Claims{"sub": "ada"})
+
+	tests := []struct {
+		subject string
+		token   string
+		expects string
+	}{
+		{"acme.shop.Direct", token, "ada"},
+		{"acme.shop.ViaHelper", token, "ada"},
+		// anonymous callers stay anonymous, instead of being given the
+		// identity of the process that handles their message
+		{"acme.shop.Direct", "", ""},
+		{"acme.shop.ViaHelper", "", ""},
+	}
+	for _, test := range tests {
+		value, reply := send(t, conn, test.subject, test.token, "{}")
+		if value != symbols.StringValue(test.expects) {
+			t.Errorf("Expected %s to be called by %q, but got %s", test.subject, test.expects, reply)
+		}
+	}
+
+	// the process's own calls are made with its own identity
+	if err := shop.Items["asProcess"].HostItem.(interfaces.Test).Run(); err != nil {
+		t.Errorf("Expected calls made by the process to carry its identity: %s", err)
+	}
+}
@@ -1,16 +1,18 @@
 package stream
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/doc"
 	"github.com/hntrl/hyper/src/hyper/domain"
 	"github.com/hntrl/hyper/src/hyper/symbols"
 	"github.com/hntrl/hyper/src/hyper/symbols/errors"
 	"github.com/hntrl/hyper/src/runtime/"
+	"github.com/hntrl/hyper/src/runtime//delivery"
 	"github.com/hntrl/hyper/src/runtime//log"
-	"github.com/hntrl/hyper/src/runtime//resource"
-	"github.com/nats-io/nats.go"
+	"github.com/hntrl/hyper/src/runtime//transport"
 )
 
 var SubscriptionSignal = log.Signal("SUBSCRIPTION")
@@ -45,7 +47,7 @@ func (SubscriptionInterface) FromNode(ctx *domain.Context, node ast.ContextMetho
 		Event:   event,
 	}
 	return &domain.ContextItem{
-		HostItem: SubscriptionConsumer{
+		HostItem: &SubscriptionConsumer{
 			sub:     sub,
 			handler: fn,
 		},
@@ -62,35 +64,76 @@ type Subscription struct {
 }
 
 type SubscriptionConsumer struct {
-	sub     Subscription
-	handler symbols.Callable
-	stream  *resource.NatsConnection
+	sub      Subscription
+	handler  symbols.Callable
+	stream   transport.Transport
+	subs     *transport.Subscriptions
+	delivery *delivery.Consumer
 }
 
-func (consumer *SubscriptionConsumer) Attach(process *runtime.Process) error {
-	var conn resource.NatsConnection
-	err := process.Resource("stream", &conn)
+func (consumer SubscriptionConsumer) Describe(item *doc.Item) {
+	item.Event = consumer.sub.Event.Name
+	item.Topic = string(consumer.sub.Event.Topic)
+}
+
+func (consumer SubscriptionConsumer) ConsumedTopics() []string {
+	return []string{string(consumer.sub.Event.Topic)}
+}
+
+func (consumer *SubscriptionConsumer) Attach(ctx context.Context, process *runtime.Process) error {
+	var conn transport.Transport
+	err := process.Resource(ctx, "stream", &conn)
 	if err != nil {
 		return err
 	}
-	consumer.stream = &conn
-	consumer.stream.Client.QueueSubscribe(string(consumer.sub.Topic), "subscription_queue", func(m *nats.Msg) {
-		value, err := symbols.ValueFromBytes(m.Data)
-		if err != nil {
-
-		}
-		payload, err := symbols.Construct(consumer.sub.Event, value)
-		if err != nil {
-
-		}
-		_, err = consumer.handler.Call(payload)
-		if err != nil {
+	name := string(consumer.sub.Topic)
+	consumer.stream = conn
+	consumer.delivery = delivery.NewConsumer(name, process.RetryPolicy(name), conn, process.DeadLetters, SubscriptionEventSignal)
+	consumer.subs = &transport.Subscriptions{}
+	callback := func(m transport.Message) {
+		consumer.delivery.Handle(m, consumer.handle)
+	}
+	// every instance of the subscription shares one queue so each event is
+	// only handled once. With a durable transport, events published while
+	// the subscription isn't running are delivered once it is.
+	event := consumer.sub.Event
+	if durable, ok := conn.(transport.DurableTransport); ok {
+		err = consumer.subs.SubscribeDurable(durable, event.Stream(), string(event.Topic), name, transport.DurableOptions{}, callback)
+	} else {
+		err = consumer.subs.QueueSubscribe(conn, string(event.Topic), name, callback)
+	}
+	// replays of dead letters are sent to the subscription's own topic
+	if err == nil {
+		err = consumer.subs.QueueSubscribe(conn, name, name, callback)
+	}
+	if err != nil {
+		consumer.subs.Drain(ctx)
+		return err
+	}
+	return nil
+}
 
+func (consumer *SubscriptionConsumer) handle(m transport.Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
 		}
-	})
-	return nil
+	}()
+	value, err := symbols.ValueFromBytes(m.Data)
+	if err != nil {
+		return delivery.Permanent(err)
+	}
+	payload, err := symbols.Construct(consumer.sub.Event, value)
+	if err != nil {
+		return delivery.Permanent(err)
+	}
+	_, err = withMessage(consumer.handler, processMessage(m.CorrelationID())).Call(payload)
+	return err
 }
-func (consumer *SubscriptionConsumer) Detach() error {
+
+func (consumer *SubscriptionConsumer) Detach(ctx context.Context) error {
+	consumer.delivery.Close()
+	err := consumer.subs.Drain(ctx)
 	consumer.stream = nil
-	return nil
+	return err
 }
@@ -5,6 +5,7 @@ import (
 	"path"
 
 	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/doc"
 	"github.com/hntrl/hyper/src/hyper/domain"
 	"github.com/hntrl/hyper/src/hyper/symbols"
 	"github.com/hntrl/hyper/src/hyper/symbols/errors"
@@ -96,6 +97,11 @@ type TemplateBuilder struct {
 	blocks     *blocks.Blocks
 }
 
+func (tb TemplateBuilder) Describe(item *doc.Item) {
+	item.Arguments = []string{doc.ClassName(tb.parentType)}
+	item.Returns = doc.ClassName(tb.Returns())
+}
+
 func (tb TemplateBuilder) Arguments() []symbols.Class {
 	return []symbols.Class{tb.parentType}
 }
@@ -0,0 +1,104 @@
+package interfaces
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces/stream"
+	"github.com/hntrl/hyper/src/hyper/symbols"
+	"github.com/hntrl/hyper/src/hyper/symbols/errors"
+	"github.com/hntrl/hyper/src/hyper/tokens"
+)
+
+type TestInterface struct{}
+
+func (TestInterface) FromNode(ctx *domain.Context, node ast.ContextMethod) (*domain.ContextItem, error) {
+	table := ctx.Symbols()
+	if node.Private {
+		return nil, errors.NodeError(node, 0, "test cannot be private: tests aren't exported")
+	}
+	if len(node.Block.Parameters.Arguments.Items) > 0 {
+		return nil, errors.NodeError(node.Block.Parameters.Arguments, 0, "test cannot have arguments")
+	}
+	if node.Block.Parameters.ReturnType != nil {
+		return nil, errors.NodeError(node.Block.Parameters, 0, "test cannot return a value")
+	}
+	table.Immutable["assert"] = assertFunction
+	table.Immutable["expect"] = expectFunction
+	fn, err := table.ResolveFunctionBlock(node.Block)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.ContextItem{
+		HostItem: Test{
+			Name:    node.Name,
+			Comment: node.Comment,
+			handler: fn,
+		},
+		RemoteItem: nil,
+	}, nil
+}
+
+// Test is a block of statements that fails if any of the assertions made in it
+// fail (or if it throws).
+type Test struct {
+	Name    string
+	Comment string
+	handler symbols.Callable
+}
+
+func (t Test) Run() error {
+	_, err := stream.AsProcess(t.handler).Call()
+	return err
+}
+
+// assert fails the test it's called in if the condition is false
+var assertFunction = symbols.NewFunction(symbols.FunctionOptions{
+	Arguments: []symbols.Class{symbols.Boolean},
+	Returns:   nil,
+	Handler: func(condition symbols.BooleanValue) error {
+		if !condition {
+			return errors.StandardError(errors.FailedAssertion, "assertion failed")
+		}
+		return nil
+	},
+})
+
+// expect fails the test it's called in if the two values aren't equal
+var expectFunction = symbols.NewFunction(symbols.FunctionOptions{
+	Arguments: []symbols.Class{symbols.Any, symbols.Any},
+	Returns:   nil,
+	Handler: func(actual, expected symbols.ValueObject) error {
+		if !valuesEqual(actual, expected) {
+			return errors.StandardError(errors.FailedAssertion, "expected %s, got %s", describeValue(expected), describeValue(actual))
+		}
+		return nil
+	},
+})
+
+// valuesEqual compares two values with the class's equality comparator if it
+// has one, and by their underlying value otherwise.
+func valuesEqual(a, b symbols.ValueObject) bool {
+	if equal, err := symbols.Compare(tokens.EQUALS, a, b); err == nil {
+		return equal
+	}
+	return symbols.ClassEquals(a.Class(), b.Class()) && reflect.DeepEqual(a.Value(), b.Value())
+}
+
+func describeValue(value symbols.ValueObject) string {
+	if _, ok := value.(symbols.NilValue); ok {
+		return "nil"
+	}
+	className := "Any"
+	if descriptors := value.Class().Descriptors(); descriptors != nil {
+		className = descriptors.Name
+	}
+	serialized, err := json.Marshal(value.Value())
+	if err != nil {
+		return fmt.Sprintf("%v (%s)", value.Value(), className)
+	}
+	return fmt.Sprintf("%s (%s)", serialized, className)
+}
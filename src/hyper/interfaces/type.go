@@ -69,6 +69,7 @@ type TypeClass struct {
 func (tc TypeClass) Descriptors() *symbols.ClassDescriptors {
 	propertyMap := make(symbols.ClassPropertyMap)
 	for name, class := range tc.Properties {
+		name := name
 		propertyMap[name] = symbols.PropertyAttributes(symbols.PropertyOptions{
 			Class: class,
 			Getter: func(val *TypeValue) (symbols.ValueObject, error) {
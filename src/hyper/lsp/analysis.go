@@ -0,0 +1,296 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/symbols"
+)
+
+// snapshot is the result of building the context declared in a manifest, along
+// with everything it imports.
+type snapshot struct {
+	path    string
+	builder *domain.ContextBuilder
+	err     error
+}
+
+// contextOf returns the context the file at path belongs to, which is either
+// the context it declares or the context that pulls its items in with `use`.
+func (s *snapshot) contextOf(path string) *domain.Context {
+	if ctx := s.builder.GetContextByPath(path); ctx != nil {
+		return ctx
+	}
+	for _, ctx := range s.builder.Contexts {
+		for _, useStatement := range ctx.Manifest().Context.Remotes {
+			if resolvePath(string(ctx.Path), useStatement.Source) == path {
+				return ctx
+			}
+		}
+	}
+	return nil
+}
+
+// declaration returns the node the last member of a selector was declared
+// with, and the path of the file it was declared in. Each member is looked up
+// in what the members before it resolve to: items of contexts, contexts in
+// domains, and fields of the context objects that were declared before.
+func declaration(ctx *domain.Context, members []string) (ast.Node, domain.ContextPath) {
+	table := ctx.Symbols()
+	var scope symbols.ScopeValue = ctx
+	var node ast.Node
+	var path domain.ContextPath
+	for idx, member := range members {
+		if idx > 0 {
+			value, err := table.ResolveSelector(ast.Selector{Members: members[:idx]})
+			if err != nil {
+				return nil, ""
+			}
+			scope = value
+		}
+		switch scopeValue := scope.(type) {
+		case *domain.Context:
+			node, path = itemDeclaration(scopeValue, member)
+		case *domain.RemoteContext:
+			node, path = itemDeclaration(scopeValue.Context(), member)
+		case domain.Domain:
+			node, path = contextDeclaration(scopeValue[member])
+		default:
+			node = fieldDeclaration(node, member)
+		}
+		if node == nil {
+			return nil, ""
+		}
+	}
+	return node, path
+}
+
+func itemDeclaration(ctx *domain.Context, name string) (ast.Node, domain.ContextPath) {
+	if node, path := ctx.Declaration(name); node != nil {
+		return node, path
+	}
+	return contextDeclaration(ctx.Selectors[name])
+}
+
+func contextDeclaration(value symbols.ScopeValue) (ast.Node, domain.ContextPath) {
+	if remoteContext, ok := value.(*domain.RemoteContext); ok {
+		ctx := remoteContext.Context()
+		return ctx.Manifest().Context, ctx.Path
+	}
+	return nil, ""
+}
+
+func fieldDeclaration(node ast.Node, name string) ast.Node {
+	object, ok := node.(ast.ContextObject)
+	if !ok {
+		return nil
+	}
+	for _, field := range object.Fields {
+		switch fieldNode := field.Init.(type) {
+		case ast.FieldExpression:
+			if fieldNode.Name == name {
+				return fieldNode
+			}
+		case ast.FieldAssignmentExpression:
+			if fieldNode.Name == name {
+				return fieldNode
+			}
+		case ast.EnumExpression:
+			if fieldNode.Name == name {
+				return fieldNode
+			}
+		}
+	}
+	return nil
+}
+
+// describe returns the markdown shown when hovering over a value
+func describe(name string, value symbols.ScopeValue, node ast.Node) string {
+	var out strings.Builder
+	switch val := value.(type) {
+	case *domain.Context:
+		fmt.Fprintf(&out, "```hyper\ncontext %s\n```\n", val.Identifier)
+	case *domain.RemoteContext:
+		fmt.Fprintf(&out, "```hyper\ncontext %s\n```\n", val.Context().Identifier)
+	case domain.Domain:
+		fmt.Fprintf(&out, "```hyper\ndomain %s\n```\n", name)
+	case symbols.Class:
+		describeClass(&out, val)
+	case symbols.Callable:
+		fmt.Fprintf(&out, "```hyper\nfunc %s%s\n```\n", name, signature(val.Arguments(), val.Returns()))
+	case symbols.ValueObject:
+		fmt.Fprintf(&out, "```hyper\n%s %s\n```\n", name, className(val.Class()))
+		describeClassMembers(&out, val.Class())
+	case symbols.KeyedObject:
+		fmt.Fprintf(&out, "```hyper\npackage %s\n```\n", name)
+	default:
+		return ""
+	}
+	if comment := commentOf(node); comment != "" {
+		out.WriteString("\n" + comment + "\n")
+	}
+	return out.String()
+}
+
+func describeClass(out *strings.Builder, class symbols.Class) {
+	fmt.Fprintf(out, "```hyper\n%s\n```\n", className(class))
+	describeClassMembers(out, class)
+}
+
+func describeClassMembers(out *strings.Builder, class symbols.Class) {
+	descriptors := class.Descriptors()
+	if descriptors == nil {
+		return
+	}
+	if len(descriptors.Properties) > 0 {
+		out.WriteString("\n**Properties**\n\n")
+		for _, key := range sortedKeys(descriptors.Properties) {
+			fmt.Fprintf(out, "- `%s %s`\n", key, className(descriptors.Properties[key].PropertyClass))
+		}
+	}
+	if len(descriptors.Prototype) > 0 {
+		out.WriteString("\n**Methods**\n\n")
+		for _, key := range sortedKeys(descriptors.Prototype) {
+			method := descriptors.Prototype[key]
+			fmt.Fprintf(out, "- `%s%s`\n", key, signature(method.ArgumentTypes, method.ReturnType))
+		}
+	}
+	if len(descriptors.ClassProperties) > 0 {
+		out.WriteString("\n**Class Properties**\n\n")
+		for _, key := range sortedKeys(descriptors.ClassProperties) {
+			fmt.Fprintf(out, "- `%s`\n", key)
+		}
+	}
+}
+
+func signature(arguments []symbols.Class, returns symbols.Class) string {
+	argumentNames := make([]string, len(arguments))
+	for idx, argument := range arguments {
+		argumentNames[idx] = className(argument)
+	}
+	if returns == nil {
+		return fmt.Sprintf("(%s)", strings.Join(argumentNames, ", "))
+	}
+	return fmt.Sprintf("(%s) %s", strings.Join(argumentNames, ", "), className(returns))
+}
+
+func className(class symbols.Class) string {
+	if class == nil {
+		return "Nil"
+	}
+	if descriptors := class.Descriptors(); descriptors != nil && descriptors.Name != "" {
+		return descriptors.Name
+	}
+	return fmt.Sprintf("%T", class)
+}
+
+func commentOf(node ast.Node) string {
+	var comment string
+	switch node := node.(type) {
+	case ast.Context:
+		comment = node.Comment
+	case ast.ContextObject:
+		comment = node.Comment
+	case ast.ContextMethod:
+		comment = node.Comment
+	}
+	return strings.TrimSpace(strings.ReplaceAll(comment, "\\n", "\n"))
+}
+
+// members returns the keys that can be accessed on a value
+func members(value symbols.ScopeValue) []string {
+	switch val := value.(type) {
+	case symbols.KeyedObject:
+		return val.Keys()
+	case symbols.Class:
+		if descriptors := val.Descriptors(); descriptors != nil {
+			return sortedKeys(descriptors.ClassProperties)
+		}
+	case symbols.ValueObject:
+		if descriptors := val.Class().Descriptors(); descriptors != nil {
+			keys := append(sortedKeys(descriptors.Properties), sortedKeys(descriptors.Prototype)...)
+			sort.Strings(keys)
+			return keys
+		}
+	}
+	return nil
+}
+
+func completionKind(value symbols.ScopeValue) CompletionItemKind {
+	switch value.(type) {
+	case *domain.Context, *domain.RemoteContext, domain.Domain:
+		return ModuleCompletion
+	case symbols.Class:
+		return ClassCompletion
+	case symbols.Callable, *symbols.ClassMethod:
+		return FunctionCompletion
+	case symbols.ValueObject:
+		return ConstantCompletion
+	case symbols.KeyedObject:
+		return ModuleCompletion
+	}
+	return VariableCompletion
+}
+
+// completions returns the completion items for the members of the value the
+// selector parent resolves to (or the items in scope if parent is empty)
+// that start with prefix.
+func completions(ctx *domain.Context, parent []string, prefix string) []CompletionItem {
+	table := ctx.Symbols()
+	var scope symbols.ScopeValue = ctx
+	keys := ctx.Keys()
+	if len(parent) == 0 {
+		keys = append(keys, sortedKeys(table.Immutable)...)
+	} else {
+		value, err := table.ResolveSelector(ast.Selector{Members: parent})
+		if err != nil {
+			return []CompletionItem{}
+		}
+		scope = value
+		keys = members(value)
+	}
+	items := make([]CompletionItem, 0)
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		value, err := table.ResolveSelector(ast.Selector{Members: append(append([]string{}, parent...), key)})
+		if err != nil {
+			value = nil
+		}
+		item := CompletionItem{Label: key, Kind: completionKind(value)}
+		if valueObject, ok := scope.(symbols.ValueObject); ok {
+			item.Kind, item.Detail = memberCompletion(valueObject.Class(), key)
+		} else if callable, ok := value.(symbols.Callable); ok {
+			item.Detail = "func" + signature(callable.Arguments(), callable.Returns())
+		} else if class, ok := value.(symbols.Class); ok {
+			item.Detail = className(class)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// memberCompletion describes the property or method of a value's class
+func memberCompletion(class symbols.Class, key string) (CompletionItemKind, string) {
+	descriptors := class.Descriptors()
+	if property, ok := descriptors.Properties[key]; ok {
+		return PropertyCompletion, className(property.PropertyClass)
+	}
+	if method, ok := descriptors.Prototype[key]; ok {
+		return MethodCompletion, "func" + signature(method.ArgumentTypes, method.ReturnType)
+	}
+	return FieldCompletion, ""
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
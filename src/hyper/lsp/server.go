@@ -0,0 +1,486 @@
+// Package lsp implements a Language Server Protocol server for hyper source
+// files, which editors talk to over stdio.
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/tokens"
+)
+
+type Server struct {
+	in    *bufio.Reader
+	out   io.Writer
+	setup func(*domain.ContextBuilder)
+	root  string
+	// documents holds the contents of the files open in the editor by their
+	// path, which take precedence over what's on disk
+	documents map[string][]byte
+	// snapshots holds the last build of each manifest that produced a context
+	// by the manifest's path, so requests can be answered while the source
+	// is being edited
+	snapshots map[string]*snapshot
+	// published holds the manifest that caused the diagnostics published for
+	// a document by its URI, so they can be cleared when they're resolved
+	published map[string]string
+	shutdown  bool
+}
+
+// NewServer creates a server that reads requests from in and writes responses
+// to out. setup is called with every builder the server creates to register
+// the interfaces and selectors contexts can use.
+func NewServer(in io.Reader, out io.Writer, setup func(*domain.ContextBuilder)) *Server {
+	return &Server{
+		in:        bufio.NewReader(in),
+		out:       out,
+		setup:     setup,
+		documents: make(map[string][]byte),
+		snapshots: make(map[string]*snapshot),
+		published: make(map[string]string),
+	}
+}
+
+// Serve handles messages until the client sends the exit notification or
+// closes the connection.
+func (s *Server) Serve() error {
+	for {
+		content, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var msg requestMessage
+		if err := json.Unmarshal(content, &msg); err != nil {
+			if err := s.reply(nil, nil, &ResponseError{Code: ParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("lsp: exit requested before shutdown")
+			}
+			return nil
+		}
+		result, err := s.handle(msg)
+		if msg.ID == nil {
+			continue
+		}
+		if err := s.reply(msg.ID, result, err); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(msg requestMessage) (result interface{}, err error) {
+	// the parser and interpreter can panic on malformed trees, which
+	// shouldn't take the whole server down while the source is being edited
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, &ResponseError{Code: InternalError, Message: fmt.Sprint(r)}
+		}
+	}()
+	if s.shutdown {
+		return nil, &ResponseError{Code: InvalidRequest, Message: "server is shutting down"}
+	}
+	switch msg.Method {
+	case "initialize":
+		var params InitializeParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.initialize(params), nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		path := uriToPath(params.TextDocument.URI)
+		s.documents[path] = []byte(params.TextDocument.Text)
+		return nil, s.check(path)
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		path := uriToPath(params.TextDocument.URI)
+		if len(params.ContentChanges) > 0 {
+			s.documents[path] = []byte(params.ContentChanges[len(params.ContentChanges)-1].Text)
+		}
+		return nil, s.check(path)
+	case "textDocument/didSave":
+		var params DidSaveTextDocumentParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return nil, s.check(uriToPath(params.TextDocument.URI))
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, uriToPath(params.TextDocument.URI))
+		return nil, nil
+	case "textDocument/definition":
+		var params TextDocumentPositionParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.definition(params)
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.hover(params)
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err := decodeParams(msg, &params); err != nil {
+			return nil, err
+		}
+		return s.completion(params)
+	}
+	return nil, &ResponseError{Code: MethodNotFound, Message: fmt.Sprintf("method %s not found", msg.Method)}
+}
+
+func decodeParams(msg requestMessage, target interface{}) error {
+	if err := json.Unmarshal(msg.Params, target); err != nil {
+		return &ResponseError{Code: InvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func (s *Server) reply(id *json.RawMessage, result interface{}, err error) error {
+	response := responseMessage{JSONRPC: "2.0", ID: id}
+	if err != nil {
+		responseErr, ok := err.(*ResponseError)
+		if !ok {
+			responseErr = &ResponseError{Code: InternalError, Message: err.Error()}
+		}
+		response.Error = responseErr
+	} else {
+		content, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		raw := json.RawMessage(content)
+		response.Result = &raw
+	}
+	return writeMessage(s.out, response)
+}
+
+func (s *Server) notify(method string, params interface{}) error {
+	return writeMessage(s.out, notificationMessage{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func (s *Server) initialize(params InitializeParams) InitializeResult {
+	if params.RootURI != "" {
+		s.root = uriToPath(params.RootURI)
+	} else {
+		s.root = params.RootPath
+	}
+	return InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:   TextDocumentSyncFull,
+			DefinitionProvider: true,
+			HoverProvider:      true,
+			CompletionProvider: &CompletionOptions{TriggerCharacters: []string{"."}},
+		},
+		ServerInfo: ServerInfo{Name: "hyper"},
+	}
+}
+
+// read returns the contents of the file at path, preferring the contents of
+// the editor's buffer if the file is open
+func (s *Server) read(path string) ([]byte, error) {
+	if src, ok := s.documents[path]; ok {
+		return src, nil
+	}
+	return os.ReadFile(path)
+}
+
+// manifestOf returns the path of the manifest the file at path is built as
+// part of, or an empty string if the file is a set of items that no manifest
+// pulls in.
+func (s *Server) manifestOf(path string) string {
+	src, err := s.read(path)
+	if err != nil || isManifest(src) {
+		return path
+	}
+	root := s.root
+	if root == "" {
+		root = filepath.Dir(path)
+	}
+	manifestPath := ""
+	filepath.WalkDir(root, func(candidate string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if candidate != root && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(candidate) != ".hyper" || candidate == path {
+			return nil
+		}
+		src, err := s.read(candidate)
+		if err != nil || !isManifest(src) {
+			return nil
+		}
+		manifest, err := domain.ParseContext(bytes.NewReader(src), candidate)
+		if err != nil {
+			return nil
+		}
+		for _, useStatement := range manifest.Context.Remotes {
+			if resolvePath(candidate, useStatement.Source) == path {
+				manifestPath = candidate
+				return filepath.SkipAll
+			}
+		}
+		return nil
+	})
+	return manifestPath
+}
+
+// build builds the context declared in the manifest at path using the
+// contents of the open documents
+func (s *Server) build(path string) *snapshot {
+	builder := domain.NewContextBuilder()
+	s.setup(builder)
+	for documentPath, src := range s.documents {
+		builder.RegisterSource(documentPath, src)
+	}
+	snap := &snapshot{path: path, builder: builder}
+	src, err := s.read(path)
+	if err != nil {
+		snap.err = err
+		return snap
+	}
+	manifest, err := domain.ParseContext(bytes.NewReader(src), path)
+	if err != nil {
+		snap.err = err
+		return snap
+	}
+	_, snap.err = builder.ParseContext(*manifest, path)
+	if builder.HostContext() != nil {
+		s.snapshots[path] = snap
+	}
+	return snap
+}
+
+// snapshotOf returns the latest snapshot that can answer requests about the
+// file at path
+func (s *Server) snapshotOf(path string) *snapshot {
+	manifestPath := s.manifestOf(path)
+	if manifestPath == "" {
+		return nil
+	}
+	if snap, ok := s.snapshots[manifestPath]; ok {
+		return snap
+	}
+	snap := s.build(manifestPath)
+	if snap.builder.HostContext() == nil {
+		return nil
+	}
+	return snap
+}
+
+// check builds the file at path and publishes the diagnostics it produces
+func (s *Server) check(path string) error {
+	var err error
+	owner := s.manifestOf(path)
+	if owner == "" {
+		owner = path
+		src, readErr := s.read(path)
+		if readErr != nil {
+			return readErr
+		}
+		_, err = domain.ParseContextItemSet(bytes.NewReader(src), path)
+	} else {
+		err = s.build(owner).err
+	}
+
+	diagnostics := map[string][]Diagnostic{
+		pathToURI(path): {},
+	}
+	if err != nil {
+		for _, diagnostic := range domain.NewDiagnostics(err, path) {
+			uri := pathToURI(diagnostic.Path)
+			diagnostics[uri] = append(diagnostics[uri], s.diagnostic(diagnostic))
+		}
+	}
+	for uri, publishedOwner := range s.published {
+		if _, ok := diagnostics[uri]; !ok && publishedOwner == owner {
+			diagnostics[uri] = []Diagnostic{}
+		}
+	}
+	for uri, list := range diagnostics {
+		if err := s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{URI: uri, Diagnostics: list}); err != nil {
+			return err
+		}
+		if len(list) > 0 {
+			s.published[uri] = owner
+		} else {
+			delete(s.published, uri)
+		}
+	}
+	return nil
+}
+
+func (s *Server) diagnostic(diagnostic domain.Diagnostic) Diagnostic {
+	pos := tokens.Position{Line: diagnostic.Line, Column: diagnostic.Column}
+	if pos.Line < 1 {
+		pos = tokens.Position{Line: 1, Column: 1}
+	}
+	if pos.Column < 1 {
+		pos.Column = 1
+	}
+	// highlight the token the error points at
+	end := toPosition(pos)
+	end.Character++
+	if src, err := s.read(diagnostic.Path); err == nil {
+		for _, tok := range lexSource(src) {
+			if tok.pos == pos && tok.tok != tokens.NEWLINE && tok.lit != "" {
+				end = toPosition(tokens.Position{Line: pos.Line, Column: tok.end()})
+				break
+			}
+		}
+	}
+	return Diagnostic{
+		Range:    Range{Start: toPosition(pos), End: end},
+		Severity: DiagnosticSeverityError,
+		Code:     int(diagnostic.Code),
+		Source:   "hyper",
+		Message:  diagnostic.Message,
+	}
+}
+
+func (s *Server) definition(params TextDocumentPositionParams) (*Location, error) {
+	path := uriToPath(params.TextDocument.URI)
+	src, err := s.read(path)
+	if err != nil {
+		return nil, err
+	}
+	selector := selectorAt(src, fromPosition(params.Position))
+	snap := s.snapshotOf(path)
+	if selector == nil || snap == nil {
+		return nil, nil
+	}
+	ctx := snap.contextOf(path)
+	if ctx == nil {
+		return nil, nil
+	}
+	node, declarationPath := declaration(ctx, selector)
+	if node == nil {
+		return nil, nil
+	}
+	return s.locate(string(declarationPath), node, selector[len(selector)-1])
+}
+
+// locate returns the location of the name a node was declared with
+func (s *Server) locate(path string, node ast.Node, name string) (*Location, error) {
+	src, err := s.read(path)
+	if err != nil {
+		return nil, err
+	}
+	start := node.Pos()
+	end := start
+	if tok, ok := nameAfter(src, node.Pos(), name); ok {
+		start, end = tok.pos, tokens.Position{Line: tok.pos.Line, Column: tok.end()}
+	}
+	return &Location{
+		URI:   pathToURI(path),
+		Range: Range{Start: toPosition(start), End: toPosition(end)},
+	}, nil
+}
+
+func (s *Server) hover(params TextDocumentPositionParams) (*Hover, error) {
+	path := uriToPath(params.TextDocument.URI)
+	src, err := s.read(path)
+	if err != nil {
+		return nil, err
+	}
+	selector := selectorAt(src, fromPosition(params.Position))
+	snap := s.snapshotOf(path)
+	if selector == nil || snap == nil {
+		return nil, nil
+	}
+	ctx := snap.contextOf(path)
+	if ctx == nil {
+		return nil, nil
+	}
+	value, err := ctx.Symbols().ResolveSelector(ast.Selector{Members: selector})
+	if err != nil || value == nil {
+		return nil, nil
+	}
+	node, _ := declaration(ctx, selector)
+	content := describe(selector[len(selector)-1], value, node)
+	if content == "" {
+		return nil, nil
+	}
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: content}}, nil
+}
+
+func (s *Server) completion(params TextDocumentPositionParams) ([]CompletionItem, error) {
+	path := uriToPath(params.TextDocument.URI)
+	src, err := s.read(path)
+	if err != nil {
+		return nil, err
+	}
+	parent, prefix, ok := completionAt(src, fromPosition(params.Position))
+	snap := s.snapshotOf(path)
+	if !ok || snap == nil {
+		return []CompletionItem{}, nil
+	}
+	ctx := snap.contextOf(path)
+	if ctx == nil {
+		return []CompletionItem{}, nil
+	}
+	return completions(ctx, parent, prefix), nil
+}
+
+// Positions in the protocol are zero based, while the lexer counts lines and
+// columns starting at one.
+func toPosition(pos tokens.Position) Position {
+	return Position{Line: pos.Line - 1, Character: pos.Column - 1}
+}
+func fromPosition(pos Position) tokens.Position {
+	return tokens.Position{Line: pos.Line + 1, Column: pos.Character + 1}
+}
+
+func uriToPath(uri string) string {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return uri
+	}
+	return filepath.FromSlash(parsed.Path)
+}
+func pathToURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// resolvePath resolves the path of a file used by a context, which is
+// relative to the context's manifest
+func resolvePath(manifestPath, source string) string {
+	return filepath.Join(filepath.Dir(manifestPath), source)
+}
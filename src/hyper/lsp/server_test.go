@@ -0,0 +1,255 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces"
+)
+
+var testFiles = map[string]string{
+	"index.hyper": `import "time"
+import "./other.hyper"
+
+context shop {
+  use "./items.hyper"
+
+  // A person in the shop
+  type Person {
+    name String
+    born time.DateTime
+  }
+}
+`,
+	"items.hyper": `type Order {
+  buyer Person
+  item  other.Item
+}
+`,
+	"other.hyper": `context other {
+  type Item {
+    label String
+  }
+
+  private type Secret {
+    value String
+  }
+}
+`,
+}
+
+type testSession struct {
+	t         *testing.T
+	dir       string
+	input     bytes.Buffer
+	nextID    int
+	responses map[int]responseMessage
+	published map[string][]PublishDiagnosticsParams
+}
+
+func newTestSession(t *testing.T) *testSession {
+	dir := t.TempDir()
+	for name, content := range testFiles {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	session := &testSession{t: t, dir: dir}
+	session.request("initialize", InitializeParams{RootURI: pathToURI(dir)})
+	session.notify("initialized", struct{}{})
+	return session
+}
+
+func (ts *testSession) uri(name string) string {
+	return pathToURI(filepath.Join(ts.dir, name))
+}
+
+func (ts *testSession) write(msg interface{}) {
+	if err := writeMessage(&ts.input, msg); err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+func (ts *testSession) request(method string, params interface{}) int {
+	ts.nextID++
+	ts.write(map[string]interface{}{"jsonrpc": "2.0", "id": ts.nextID, "method": method, "params": params})
+	return ts.nextID
+}
+
+func (ts *testSession) notify(method string, params interface{}) {
+	ts.write(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (ts *testSession) position(name string, line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: ts.uri(name)},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+// run sends everything written to the session to a server, and collects what
+// it sends back
+func (ts *testSession) run() {
+	ts.request("shutdown", nil)
+	ts.notify("exit", nil)
+	var output bytes.Buffer
+	server := NewServer(&ts.input, &output, func(builder *domain.ContextBuilder) {
+		builder.RegisterInterface("type", interfaces.TypeInterface{})
+	})
+	if err := server.Serve(); err != nil {
+		ts.t.Fatal(err)
+	}
+	ts.responses = make(map[int]responseMessage)
+	ts.published = make(map[string][]PublishDiagnosticsParams)
+	reader := bufio.NewReader(&output)
+	for {
+		content, err := readMessage(reader)
+		if err != nil {
+			break
+		}
+		var msg struct {
+			responseMessage
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.Unmarshal(content, &msg); err != nil {
+			ts.t.Fatal(err)
+		}
+		if msg.Method == "textDocument/publishDiagnostics" {
+			var params PublishDiagnosticsParams
+			if err := json.Unmarshal(msg.Params, &params); err != nil {
+				ts.t.Fatal(err)
+			}
+			ts.published[params.URI] = append(ts.published[params.URI], params)
+			continue
+		}
+		var id int
+		json.Unmarshal(*msg.ID, &id)
+		ts.responses[id] = msg.responseMessage
+	}
+}
+
+func (ts *testSession) result(id int, target interface{}) {
+	response, ok := ts.responses[id]
+	if !ok {
+		ts.t.Fatalf("Expected a response for request %d", id)
+	}
+	if response.Error != nil {
+		ts.t.Fatalf("Expected request %d to succeed, but got %s", id, response.Error.Error())
+	}
+	if response.Result == nil {
+		// a null result isn't distinguishable from a missing one once decoded
+		return
+	}
+	if err := json.Unmarshal(*response.Result, target); err != nil {
+		ts.t.Fatal(err)
+	}
+}
+
+// CAN PUBLISH DIAGNOSTICS
+func TestDiagnostics(t *testing.T) {
+	ts := newTestSession(t)
+	ts.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: ts.uri("items.hyper"), Text: testFiles["items.hyper"]},
+	})
+	ts.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   TextDocumentIdentifier{URI: ts.uri("items.hyper")},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "type Order {\n  buyer Customer\n}\n"}},
+	})
+	ts.run()
+
+	published := ts.published[ts.uri("items.hyper")]
+	if len(published) != 2 {
+		t.Fatalf("Expected diagnostics to be published twice, but got %d", len(published))
+	}
+	if len(published[0].Diagnostics) != 0 {
+		t.Fatalf("Expected no diagnostics, but got %v", published[0].Diagnostics)
+	}
+	if len(published[1].Diagnostics) != 1 {
+		t.Fatalf("Expected 1 diagnostic, but got %v", published[1].Diagnostics)
+	}
+	diagnostic := published[1].Diagnostics[0]
+	expectedRange := Range{Start: Position{Line: 1, Character: 8}, End: Position{Line: 1, Character: 16}}
+	if diagnostic.Range != expectedRange {
+		t.Fatalf("Expected diagnostic at %v, but got %v (%s)", expectedRange, diagnostic.Range, diagnostic.Message)
+	}
+}
+
+// CAN GO TO DEFINITION
+func TestDefinition(t *testing.T) {
+	ts := newTestSession(t)
+	person := ts.request("textDocument/definition", ts.position("items.hyper", 1, 10))
+	item := ts.request("textDocument/definition", ts.position("items.hyper", 2, 14))
+	context := ts.request("textDocument/definition", ts.position("items.hyper", 2, 8))
+	builtin := ts.request("textDocument/definition", ts.position("index.hyper", 8, 10))
+	ts.run()
+
+	tests := []struct {
+		id       int
+		expects  *Location
+		selector string
+	}{
+		{person, &Location{URI: ts.uri("index.hyper"), Range: Range{Start: Position{7, 7}, End: Position{7, 13}}}, "Person"},
+		{item, &Location{URI: ts.uri("other.hyper"), Range: Range{Start: Position{1, 7}, End: Position{1, 11}}}, "other.Item"},
+		{context, &Location{URI: ts.uri("other.hyper"), Range: Range{Start: Position{0, 8}, End: Position{0, 13}}}, "other"},
+		{builtin, nil, "String"},
+	}
+	for _, test := range tests {
+		var location *Location
+		ts.result(test.id, &location)
+		if fmt.Sprint(location) != fmt.Sprint(test.expects) {
+			t.Errorf("Expected definition of %s to be %v, but got %v", test.selector, test.expects, location)
+		}
+	}
+}
+
+// CAN DESCRIBE CLASSES ON HOVER
+func TestHover(t *testing.T) {
+	ts := newTestSession(t)
+	id := ts.request("textDocument/hover", ts.position("items.hyper", 1, 10))
+	ts.run()
+
+	var hover Hover
+	ts.result(id, &hover)
+	for _, expected := range []string{"Person", "`born DateTime`", "`name String`", "A person in the shop"} {
+		if !strings.Contains(hover.Contents.Value, expected) {
+			t.Errorf("Expected hover to contain %q, but got\n%s", expected, hover.Contents.Value)
+		}
+	}
+}
+
+// CAN COMPLETE SELECTORS
+func TestCompletion(t *testing.T) {
+	ts := newTestSession(t)
+	remote := ts.request("textDocument/completion", ts.position("items.hyper", 2, 14))
+	stdlib := ts.request("textDocument/completion", ts.position("index.hyper", 9, 15))
+	items := ts.request("textDocument/completion", ts.position("items.hyper", 1, 9))
+	ts.run()
+
+	tests := []struct {
+		id      int
+		expects []string
+	}{
+		{remote, []string{"Item"}},
+		{stdlib, []string{"DateTime", "Duration"}},
+		{items, []string{"Person"}},
+	}
+	for _, test := range tests {
+		var completions []CompletionItem
+		ts.result(test.id, &completions)
+		labels := make([]string, len(completions))
+		for idx, item := range completions {
+			labels[idx] = item.Label
+		}
+		if strings.Join(labels, ",") != strings.Join(test.expects, ",") {
+			t.Errorf("Expected completions %v, but got %v", test.expects, labels)
+		}
+	}
+}
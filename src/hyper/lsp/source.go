@@ -0,0 +1,149 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"unicode/utf8"
+
+	"github.com/hntrl/hyper/src/hyper/parser"
+	"github.com/hntrl/hyper/src/hyper/tokens"
+)
+
+type sourceToken struct {
+	pos tokens.Position
+	tok tokens.Token
+	lit string
+}
+
+// end returns the column right after the last character of the token
+func (t sourceToken) end() int {
+	return t.pos.Column + utf8.RuneCountInString(t.lit)
+}
+
+// lexSource returns the tokens in src. Documents being edited are often
+// incomplete, so instead of failing on a lexer error the tokens read up until
+// that point are returned.
+func lexSource(src []byte) (out []sourceToken) {
+	out = make([]sourceToken, 0)
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(parser.LexerError); !ok {
+				panic(r)
+			}
+		}
+	}()
+	// the lexer panics when it needs to look ahead at the end of the source,
+	// which happens for a trailing period (like when asking for completions)
+	src = append(append([]byte{}, src...), '\n')
+	lexer := parser.NewLexer(bufio.NewReader(bytes.NewReader(src)))
+	for {
+		pos, tok, lit := lexer.Lex()
+		if tok == tokens.EOF {
+			return out
+		}
+		out = append(out, sourceToken{pos, tok, lit})
+	}
+}
+
+// identAt returns the index of the identifier at pos (including the position
+// right after it), or -1 if there isn't one.
+func identAt(toks []sourceToken, pos tokens.Position) int {
+	for idx, tok := range toks {
+		if tok.tok != tokens.IDENT || tok.pos.Line != pos.Line {
+			continue
+		}
+		if tok.pos.Column <= pos.Column && pos.Column <= tok.end() {
+			return idx
+		}
+	}
+	return -1
+}
+
+// selectorBefore returns the members of the selector that ends with the
+// token at idx. It returns false if the selector is a member of something
+// other than a selector (like the result of a call).
+func selectorBefore(toks []sourceToken, idx int) ([]string, bool) {
+	members := []string{toks[idx].lit}
+	for idx > 0 && toks[idx-1].tok == tokens.PERIOD {
+		if idx < 2 || toks[idx-2].tok != tokens.IDENT {
+			return nil, false
+		}
+		members = append([]string{toks[idx-2].lit}, members...)
+		idx -= 2
+	}
+	return members, true
+}
+
+// selectorAt returns the members of the selector that the identifier at pos is
+// the last member of.
+func selectorAt(src []byte, pos tokens.Position) []string {
+	toks := lexSource(src)
+	idx := identAt(toks, pos)
+	if idx == -1 {
+		return nil
+	}
+	members, ok := selectorBefore(toks, idx)
+	if !ok {
+		return nil
+	}
+	return members
+}
+
+// completionAt returns the members of the selector the identifier being
+// typed at pos is a member of (which is empty when it isn't a member of
+// anything), and the part of the identifier that has been typed so far.
+func completionAt(src []byte, pos tokens.Position) (parent []string, prefix string, ok bool) {
+	toks := lexSource(src)
+	if idx := identAt(toks, pos); idx != -1 {
+		tok := toks[idx]
+		prefix = string([]rune(tok.lit)[:pos.Column-tok.pos.Column])
+		members, ok := selectorBefore(toks, idx)
+		if !ok {
+			return nil, "", false
+		}
+		return members[:len(members)-1], prefix, true
+	}
+	for idx := len(toks) - 1; idx >= 0; idx-- {
+		tok := toks[idx]
+		if tok.pos.Line > pos.Line || tok.pos.Line == pos.Line && tok.pos.Column >= pos.Column {
+			continue
+		}
+		if tok.tok != tokens.PERIOD || tok.pos.Line != pos.Line || tok.pos.Column+1 != pos.Column {
+			break
+		}
+		if idx == 0 || toks[idx-1].tok != tokens.IDENT {
+			return nil, "", false
+		}
+		members, ok := selectorBefore(toks, idx-1)
+		return members, "", ok
+	}
+	return []string{}, "", true
+}
+
+// nameAfter returns the first identifier with the given name at or after pos
+func nameAfter(src []byte, pos tokens.Position, name string) (sourceToken, bool) {
+	for _, tok := range lexSource(src) {
+		if tok.pos.Line < pos.Line || tok.pos.Line == pos.Line && tok.pos.Column < pos.Column {
+			continue
+		}
+		if tok.tok == tokens.IDENT && tok.lit == name {
+			return tok, true
+		}
+	}
+	return sourceToken{}, false
+}
+
+// isManifest reports if src declares a context (as opposed to the set of
+// items a context pulls in with `use`).
+func isManifest(src []byte) bool {
+	for _, tok := range lexSource(src) {
+		switch tok.tok {
+		case tokens.NEWLINE, tokens.COMMENT:
+			continue
+		case tokens.IMPORT, tokens.CONTEXT:
+			return true
+		}
+		return false
+	}
+	return false
+}
@@ -17,6 +17,12 @@ type LexerError struct {
 func (le LexerError) Error() string {
 	return fmt.Sprintf("(%s) %s", le.pos.String(), le.err.Error())
 }
+func (le LexerError) Unwrap() error {
+	return le.err
+}
+func (le LexerError) Pos() tokens.Position {
+	return le.pos
+}
 
 type Lexer struct {
 	pos    tokens.Position
@@ -302,6 +302,9 @@ func TestLexKeywords(t *testing.T) {
 		{tokens.THROW, "throw"},
 		{tokens.TRY, "try"},
 		{tokens.PARTIAL, "Partial"},
+		// timeout and requires are only keywords where their clauses are
+		{tokens.IDENT, "timeout"},
+		{tokens.IDENT, "requires"},
 		// check this doesn't become a keyword
 		{tokens.IDENT, "abc"},
 	}
@@ -0,0 +1,211 @@
+// Package repl implements an interactive loop that evaluates hyper statements
+// and expressions against a symbol table that persists between inputs.
+package repl
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/parser"
+	"github.com/hntrl/hyper/src/hyper/stdlib"
+	"github.com/hntrl/hyper/src/hyper/symbols"
+	"github.com/hntrl/hyper/src/hyper/tokens"
+)
+
+const (
+	prompt             = "> "
+	continuationPrompt = "... "
+)
+
+const help = `Enter statements or expressions to evaluate them. Blocks can span multiple lines.
+
+  :type EXPR   show the class of an expression without evaluating it
+  :help        show this message
+  :quit        exit the repl
+`
+
+type REPL struct {
+	table *symbols.SymbolTable
+	out   io.Writer
+}
+
+// New creates a REPL that evaluates input against table and writes results to
+// out. Packages in the standard library are added to the table's scope unless
+// they're shadowed by something already in it.
+func New(table *symbols.SymbolTable, out io.Writer) *REPL {
+	for name, pkg := range stdlib.Packages {
+		if existing, err := table.Get(name); err == nil && existing == nil {
+			table.Local[name] = pkg
+		}
+	}
+	return &REPL{table: table, out: out}
+}
+
+// Run reads input from in until it's exhausted or `:quit` is entered. Input is
+// buffered until every block opened in it has been closed, so statements can
+// span multiple lines.
+func (r *REPL) Run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	var input strings.Builder
+	fmt.Fprint(r.out, prompt)
+	for scanner.Scan() {
+		input.WriteString(scanner.Text() + "\n")
+		if !isComplete(input.String()) {
+			fmt.Fprint(r.out, continuationPrompt)
+			continue
+		}
+		src := strings.TrimSpace(input.String())
+		input.Reset()
+		if src == ":quit" || src == ":q" {
+			return nil
+		}
+		output, err := r.Eval(src)
+		if err != nil {
+			fmt.Fprintf(r.out, "error: %s\n", err.Error())
+		} else if output != "" {
+			fmt.Fprintln(r.out, output)
+		}
+		fmt.Fprint(r.out, prompt)
+	}
+	fmt.Fprintln(r.out)
+	return scanner.Err()
+}
+
+// Eval evaluates src and returns what should be shown for it. Statements are
+// checked with the Evaluate* pass before they're executed, so a statement that
+// fails semantic analysis doesn't leave the table half updated.
+func (r *REPL) Eval(src string) (output string, err error) {
+	// parsing incomplete or malformed input can panic
+	defer func() {
+		if rec := recover(); rec != nil {
+			output, err = "", fmt.Errorf("%v", rec)
+		}
+	}()
+	switch {
+	case src == "":
+		return "", nil
+	case src == ":help":
+		return strings.TrimSuffix(help, "\n"), nil
+	case strings.HasPrefix(src, ":type "):
+		return r.evalType(strings.TrimPrefix(src, ":type "))
+	case strings.HasPrefix(src, ":"):
+		return "", fmt.Errorf("unknown command %s", strings.Fields(src)[0])
+	}
+
+	statements, err := parseStatements(src)
+	if err != nil {
+		return "", err
+	}
+	results := make([]string, 0)
+	for _, stmt := range statements {
+		check := r.table.Clone()
+		if _, err := check.EvaluateBlockStatement(stmt, nil); err != nil {
+			return strings.Join(results, "\n"), err
+		}
+		var value symbols.ValueObject
+		if expr, ok := stmt.Init.(ast.Expression); ok {
+			value, err = r.table.ResolveExpression(expr)
+		} else {
+			value, err = r.table.ResolveBlockStatement(stmt)
+		}
+		if err != nil {
+			return strings.Join(results, "\n"), err
+		}
+		if value != nil {
+			results = append(results, formatValue(value))
+		}
+	}
+	return strings.Join(results, "\n"), nil
+}
+
+func (r *REPL) evalType(src string) (string, error) {
+	p := newParser(src)
+	expr, err := ast.ParseExpression(p)
+	if err != nil {
+		return "", err
+	}
+	if err := expr.Validate(); err != nil {
+		return "", err
+	}
+	if _, tok, lit := p.ScanIgnore(tokens.NEWLINE, tokens.COMMENT); tok != tokens.EOF {
+		return "", fmt.Errorf("unexpected %s after expression", lit)
+	}
+	check := r.table.Clone()
+	expected, err := check.EvaluateExpression(*expr)
+	if err != nil {
+		return "", err
+	}
+	return className(expected.Class), nil
+}
+
+// newParser returns a parser for src. The lexer panics when it looks ahead
+// past the end of the input, so a trailing newline is added to it.
+func newParser(src string) *parser.Parser {
+	return parser.NewParser(parser.NewLexer(bufio.NewReader(strings.NewReader(src + "\n"))))
+}
+
+func parseStatements(src string) ([]ast.BlockStatement, error) {
+	p := newParser(src)
+	statements := make([]ast.BlockStatement, 0)
+	for {
+		_, tok, _ := p.ScanIgnore(tokens.NEWLINE, tokens.COMMENT, tokens.SEMICOLON)
+		if tok == tokens.EOF {
+			return statements, nil
+		}
+		p.Unscan()
+		stmt, err := ast.ParseBlockStatement(p)
+		if err != nil {
+			return nil, err
+		}
+		if err := stmt.Validate(); err != nil {
+			return nil, err
+		}
+		statements = append(statements, *stmt)
+	}
+}
+
+// isComplete reports if every block opened in src has been closed
+func isComplete(src string) (complete bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			// the lexer ran out of input in the middle of a token (like an
+			// unterminated string), which more input won't fix
+			complete = true
+		}
+	}()
+	lexer := parser.NewLexer(bufio.NewReader(strings.NewReader(src + "\n")))
+	depth := 0
+	for {
+		_, tok, _ := lexer.Lex()
+		switch tok {
+		case tokens.EOF:
+			return depth <= 0
+		case tokens.LCURLY, tokens.LPAREN, tokens.LSQUARE:
+			depth++
+		case tokens.RCURLY, tokens.RPAREN, tokens.RSQUARE:
+			depth--
+		}
+	}
+}
+
+func formatValue(value symbols.ValueObject) string {
+	if _, ok := value.(symbols.NilValue); ok {
+		return "nil"
+	}
+	serialized, err := json.Marshal(value.Value())
+	if err != nil {
+		return fmt.Sprintf("%v (%s)", value.Value(), className(value.Class()))
+	}
+	return fmt.Sprintf("%s (%s)", serialized, className(value.Class()))
+}
+
+func className(class symbols.Class) string {
+	if class == nil {
+		return "Nil"
+	}
+	return class.Descriptors().Name
+}
@@ -0,0 +1,91 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/hntrl/hyper/src/hyper/symbols"
+)
+
+type TestFixture struct {
+	lit     string
+	expects string
+	err     bool
+}
+
+func evaluateTest(t *testing.T, r *REPL, test TestFixture) {
+	output, err := r.Eval(test.lit)
+	if test.err {
+		if err == nil {
+			t.Fatalf("Expected %q to fail, but got %q", test.lit, output)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("Expected %q to succeed, but got %s", test.lit, err.Error())
+	}
+	if output != test.expects {
+		t.Fatalf("Expected %q to output %q, but got %q", test.lit, test.expects, output)
+	}
+}
+
+// CAN EVALUATE EXPRESSIONS
+func TestExpressions(t *testing.T) {
+	r := New(symbols.NewSymbolTable(nil), &bytes.Buffer{})
+	tests := []TestFixture{
+		{lit: "1 + 2", expects: "3 (Integer)"},
+		{lit: `"abc"`, expects: `"abc" (String)`},
+		{lit: "2 > 1 && false", expects: "false (Boolean)"},
+		{lit: "math.Abs(-2)", expects: "2 (Float)"},
+		{lit: "missing", err: true},
+	}
+	for _, test := range tests {
+		evaluateTest(t, r, test)
+	}
+}
+
+// CAN KEEP DECLARATIONS BETWEEN INPUTS
+func TestDeclarations(t *testing.T) {
+	r := New(symbols.NewSymbolTable(nil), &bytes.Buffer{})
+	tests := []TestFixture{
+		{lit: "x := 2", expects: ""},
+		{lit: "x * 3", expects: "6 (Integer)"},
+		{lit: "x := 3", err: true},
+		{lit: "y := x + 1\ny", expects: "3 (Integer)"},
+	}
+	for _, test := range tests {
+		evaluateTest(t, r, test)
+	}
+}
+
+// CAN SHOW TYPES WITHOUT EVALUATING
+func TestTypeCommand(t *testing.T) {
+	r := New(symbols.NewSymbolTable(nil), &bytes.Buffer{})
+	tests := []TestFixture{
+		{lit: ":type 1.5 * 2.0", expects: "Float"},
+		{lit: ":type time.now()", expects: "DateTime"},
+		{lit: ":type z := 1", err: true},
+		{lit: ":nope", err: true},
+	}
+	for _, test := range tests {
+		evaluateTest(t, r, test)
+	}
+	if _, err := r.Eval("z"); err == nil {
+		t.Fatalf("Expected :type to not declare values")
+	}
+}
+
+// CAN READ MULTI-LINE BLOCKS
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	in := strings.NewReader("x := 1\nif (x > 0) {\n  y := 2\n}\nx\n:quit\nx\n")
+	r := New(symbols.NewSymbolTable(nil), &out)
+	if err := r.Run(in); err != nil {
+		t.Fatal(err)
+	}
+	expects := "> > ... ... > 1 (Integer)\n> "
+	if out.String() != expects {
+		t.Fatalf("Expected output %q, but got %q", expects, out.String())
+	}
+}
@@ -73,3 +73,6 @@ type ErrorsPackage struct{}
 func (ep ErrorsPackage) Get(key string) (sym.ScopeValue, error) {
 	return errorFunctions[key], nil
 }
+func (ep ErrorsPackage) Keys() []string {
+	return sortedKeys(errorFunctions)
+}
@@ -152,3 +152,6 @@ type MathPackage struct{}
 func (mp MathPackage) Get(key string) (sym.ScopeValue, error) {
 	return mathFunctions[key], nil
 }
+func (mp MathPackage) Keys() []string {
+	return sortedKeys(mathFunctions)
+}
@@ -15,6 +15,9 @@ func (mt MimeTypesPackage) Get(key string) (symbols.ScopeValue, error) {
 	}
 	return nil, nil
 }
+func (mt MimeTypesPackage) Keys() []string {
+	return []string{"MimeType"}
+}
 
 var (
 	MimeType            = MimeTypeClass{}
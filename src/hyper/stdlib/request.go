@@ -110,8 +110,10 @@ func sendRequest(method string, path string, config *HTTPRequestConfigValue, bod
 
 type RequestPackage struct{}
 
-func (rp RequestPackage) Get(key string) (symbols.ScopeValue, error) {
-	functions := map[string]symbols.Callable{
+// requestFunctions is built when accessed since the classes it uses aren't
+// initialized until after the package's variables are
+func requestFunctions() map[string]symbols.Callable {
+	return map[string]symbols.Callable{
 		"get": symbols.NewFunction(symbols.FunctionOptions{
 			Arguments: []symbols.Class{
 				symbols.String,
@@ -186,7 +188,10 @@ func (rp RequestPackage) Get(key string) (symbols.ScopeValue, error) {
 			},
 		}),
 	}
-	if fn, ok := functions[key]; ok {
+}
+
+func (rp RequestPackage) Get(key string) (symbols.ScopeValue, error) {
+	if fn, ok := requestFunctions()[key]; ok {
 		return fn, nil
 	}
 	if status, ok := statusCodes[key]; ok {
@@ -194,6 +199,9 @@ func (rp RequestPackage) Get(key string) (symbols.ScopeValue, error) {
 	}
 	return nil, nil
 }
+func (rp RequestPackage) Keys() []string {
+	return append(sortedKeys(requestFunctions()), sortedKeys(statusCodes)...)
+}
 
 var (
 	HTTPAuthConfig            = HTTPAuthConfigClass{}
@@ -1,6 +1,10 @@
 package stdlib
 
-import "github.com/hntrl/hyper/src/hyper/symbols"
+import (
+	"sort"
+
+	"github.com/hntrl/hyper/src/hyper/symbols"
+)
 
 var Packages = map[string]symbols.Object{
 	"errors":  ErrorsPackage{},
@@ -10,3 +14,12 @@ var Packages = map[string]symbols.Object{
 	"time":    TimePackage{},
 	"units":   UnitsPackage{},
 }
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
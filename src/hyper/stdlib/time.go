@@ -17,24 +17,28 @@ const (
 
 type TimePackage struct{}
 
+var timeObjects = map[string]symbols.ScopeValue{
+	"DateTime":    DateTime,
+	"Duration":    Duration,
+	"Microsecond": microsecond,
+	"Millisecond": millisecond,
+	"Second":      second,
+	"Minute":      minute,
+	"Hour":        hour,
+	"now": symbols.NewFunction(symbols.FunctionOptions{
+		Arguments: []symbols.Class{},
+		Returns:   DateTime,
+		Handler: func() (DateTimeValue, error) {
+			return DateTimeValue{t: time.Now()}, nil
+		},
+	}),
+}
+
 func (tp TimePackage) Get(key string) (symbols.ScopeValue, error) {
-	objects := map[string]symbols.ScopeValue{
-		"DateTime":    DateTime,
-		"Duration":    Duration,
-		"Microsecond": microsecond,
-		"Millisecond": millisecond,
-		"Second":      second,
-		"Minute":      minute,
-		"Hour":        hour,
-		"now": symbols.NewFunction(symbols.FunctionOptions{
-			Arguments: []symbols.Class{},
-			Returns:   DateTime,
-			Handler: func() (DateTimeValue, error) {
-				return DateTimeValue{t: time.Now()}, nil
-			},
-		}),
-	}
-	return objects[key], nil
+	return timeObjects[key], nil
+}
+func (tp TimePackage) Keys() []string {
+	return sortedKeys(timeObjects)
 }
 
 var (
@@ -6,11 +6,15 @@ import (
 
 type UnitsPackage struct{}
 
+var unitsClasses = map[string]symbols.Class{
+	"Dimension": Dimension,
+}
+
 func (up UnitsPackage) Get(key string) (symbols.ScopeValue, error) {
-	classes := map[string]symbols.Class{
-		"Dimension": Dimension,
-	}
-	return classes[key], nil
+	return unitsClasses[key], nil
+}
+func (up UnitsPackage) Keys() []string {
+	return sortedKeys(unitsClasses)
 }
 
 var (
@@ -109,4 +109,14 @@ const (
 	CannotEnumerateNilValue
 
 	CannotUnmarshal
+
+	// Error codes that are yielded when building a context
+
+	UnknownInterface
+
+	InvalidInterface
+
+	// Error codes that are yielded when running tests
+
+	FailedAssertion
 )
@@ -373,6 +373,9 @@ func resolveValueExpressionCallMember(st *SymbolTable, value ScopeValue, node as
 				return nil, WrappedNodeError(node, err)
 			}
 		}
+		if scoped, ok := object.(ScopedCallable); ok {
+			return scoped.CallFrom(st, passedArguments...)
+		}
 		return object.Call(passedArguments...)
 	case Class:
 		if len(node.Arguments) != 1 {
@@ -462,6 +465,11 @@ func (st *SymbolTable) ResolveValueExpression(node ast.ValueExpression) (ValueOb
 		case ast.CallExpression:
 			current, err = resolveValueExpressionCallMember(st, current, member)
 			if err != nil {
+				// errors raised by a callable don't know where they were called
+				// from, so they're attributed to the call
+				if interpreterErr, ok := err.(InterpreterError); ok && interpreterErr.Node == nil {
+					return nil, WrappedNodeError(node, err)
+				}
 				return nil, err
 			}
 		case ast.IndexExpression:
@@ -490,6 +498,10 @@ func (st *SymbolTable) ResolveValueExpression(node ast.ValueExpression) (ValueOb
 			}
 		}
 	}
+	if _, ok := node.Members[len(node.Members)-1].Init.(ast.CallExpression); ok && current == nil {
+		// calling a function that doesn't return anything
+		return nil, nil
+	}
 	valueObj, ok := current.(ValueObject)
 	if !ok {
 		return nil, NodeError(node, InvalidValueExpression, "invalid value expression")
@@ -13,8 +13,22 @@ type Function struct {
 	argumentTypes []Class
 	returnType    Class
 	handler       functionHandlerFn
+	// scopedHandler is the handler of functions declared in hyper, which is
+	// called with the frame the function runs in and values added to its scope
+	scopedHandler func(ScopeValue, map[string]ScopeValue, ...ValueObject) (ValueObject, error)
+	// frame and scope are set with WithFrame and WithScope. Without a frame of
+	// its own, the function runs in the frame of the table it's called from.
+	frame ScopeValue
+	scope map[string]ScopeValue
+	// guard is called before the function with the table it's called from
+	// (nil if it isn't called from hyper), and the function isn't called if
+	// it returns an error
+	guard Guard
 }
 
+// Guard decides whether a function can be called from the scope st with args
+type Guard func(st *SymbolTable, args ...ValueObject) error
+
 func (fn Function) Arguments() []Class {
 	return fn.argumentTypes
 }
@@ -22,9 +36,51 @@ func (fn Function) Returns() Class {
 	return fn.returnType
 }
 func (fn Function) Call(args ...ValueObject) (ValueObject, error) {
+	return fn.CallFrom(nil, args...)
+}
+
+// CallFrom calls fn from the scope st, which its guard (if it has one) is
+// given to decide whether it can be called. Functions declared in hyper run in
+// the frame of st, unless they have a frame of their own.
+func (fn Function) CallFrom(st *SymbolTable, args ...ValueObject) (ValueObject, error) {
+	if fn.guard != nil {
+		if err := fn.guard(st, args...); err != nil {
+			return nil, err
+		}
+	}
+	if fn.scopedHandler != nil {
+		frame := fn.frame
+		if frame == nil && st != nil {
+			frame = st.Frame
+		}
+		return fn.scopedHandler(frame, fn.scope, args...)
+	}
 	return fn.handler(args...)
 }
 
+// WithGuard returns a copy of fn that's only called if guard doesn't return an
+// error
+func (fn Function) WithGuard(guard Guard) *Function {
+	fn.guard = guard
+	return &fn
+}
+
+// WithScope returns a copy of fn that's called with the values in scope added
+// to the immutable values it can access (like the message a command handles
+// as self). Functions that aren't declared in hyper are returned as is.
+func (fn Function) WithScope(scope map[string]ScopeValue) *Function {
+	fn.scope = scope
+	return &fn
+}
+
+// WithFrame returns a copy of fn that runs in frame, no matter which table
+// it's called from. Functions that aren't declared in hyper are returned as
+// is.
+func (fn Function) WithFrame(frame ScopeValue) *Function {
+	fn.frame = frame
+	return &fn
+}
+
 type FunctionOptions struct {
 	Arguments []Class
 	Returns   Class
@@ -69,10 +125,10 @@ func makeFunctionHandlerFn(args []Class, returns Class, callback interface{}) (f
 		}
 		returnValues := cb.Call(argValues)
 		if value, ok := returnValues[0].Interface().(ValueObject); ok {
-			err := returnValues[1].Interface().(error)
+			err, _ := returnValues[1].Interface().(error)
 			return value, err
 		} else {
-			err := returnValues[0].Interface().(error)
+			err, _ := returnValues[0].Interface().(error)
 			return nil, err
 		}
 	}, nil
@@ -91,24 +147,32 @@ func (st *SymbolTable) ResolveFunctionBlock(node ast.FunctionBlock) (*Function,
 	if returns != nil && !blockDoesReturn {
 		return nil, NodeError(node.Body, MissingReturn, "missing return")
 	}
+	scopedHandler := func(frame ScopeValue, scope map[string]ScopeValue, args ...ValueObject) (ValueObject, error) {
+		scopeTable := st.Clone()
+		scopeTable.Frame = frame
+		for key, value := range scope {
+			scopeTable.Immutable[key] = value
+		}
+		err := scopeTable.ApplyArgumentList(node.Parameters.Arguments, args)
+		if err != nil {
+			return nil, err
+		}
+		obj, err := scopeTable.ResolveBlock(node.Body)
+		if err != nil {
+			return nil, err
+		}
+		if obj != nil {
+			return Construct(returns, obj)
+		}
+		return nil, nil
+	}
 	return &Function{
 		argumentTypes: argumentTypes,
 		returnType:    returns,
 		handler: func(args ...ValueObject) (ValueObject, error) {
-			scopeTable := st.Clone()
-			err = scopeTable.ApplyArgumentList(node.Parameters.Arguments, args)
-			if err != nil {
-				return nil, err
-			}
-			obj, err := scopeTable.ResolveBlock(node.Body)
-			if err != nil {
-				return nil, err
-			}
-			if obj != nil {
-				return Construct(returns, obj)
-			}
-			return nil, nil
+			return scopedHandler(nil, nil, args...)
 		},
+		scopedHandler: scopedHandler,
 	}, nil
 }
 
@@ -0,0 +1,79 @@
+package symbols_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hntrl/hyper/src/hyper/symbols"
+)
+
+// CAN CALL NATIVE FUNCTIONS THAT RETURN A NIL ERROR
+func TestFunctionNilError(t *testing.T) {
+	withValue := symbols.NewFunction(symbols.FunctionOptions{
+		Arguments: []symbols.Class{symbols.String},
+		Returns:   symbols.String,
+		Handler: func(val symbols.StringValue) (symbols.StringValue, error) {
+			return val, nil
+		},
+	})
+	if result, err := withValue.Call(symbols.StringValue("foo")); err != nil || result != symbols.StringValue("foo") {
+		t.Errorf("Expected the function to return its value, but got %v, %v", result, err)
+	}
+
+	withoutValue := symbols.NewFunction(symbols.FunctionOptions{
+		Arguments: []symbols.Class{},
+		Handler: func() error {
+			return nil
+		},
+	})
+	if result, err := withoutValue.Call(); err != nil || result != nil {
+		t.Errorf("Expected the function to return nothing, but got %v, %v", result, err)
+	}
+}
+
+// CAN GUARD FUNCTIONS AND CLASS METHODS
+func TestFunctionGuard(t *testing.T) {
+	denied := errors.New("denied")
+	var guardedTable *symbols.SymbolTable
+	guard := func(st *symbols.SymbolTable, args ...symbols.ValueObject) error {
+		guardedTable = st
+		if args[0] == symbols.StringValue("deny") {
+			return denied
+		}
+		return nil
+	}
+	fn := symbols.NewFunction(symbols.FunctionOptions{
+		Arguments: []symbols.Class{symbols.String},
+		Returns:   symbols.String,
+		Handler: func(val symbols.StringValue) (symbols.StringValue, error) {
+			return val, nil
+		},
+	}).WithGuard(guard)
+
+	st := &symbols.SymbolTable{}
+	if _, err := fn.CallFrom(st, symbols.StringValue("deny")); err != denied {
+		t.Errorf("Expected the guard to stop the call, but got %v", err)
+	}
+	if guardedTable != st {
+		t.Errorf("Expected the guard to be given the table the function was called from")
+	}
+	if result, err := fn.Call(symbols.StringValue("allow")); err != nil || result != symbols.StringValue("allow") {
+		t.Errorf("Expected the function to be called, but got %v, %v", result, err)
+	}
+	if guardedTable != nil {
+		t.Errorf("Expected the guard to be given a nil table when the function isn't called from hyper")
+	}
+
+	method := symbols.NewClassMethod(symbols.ClassMethodOptions{
+		Class:     symbols.String,
+		Arguments: []symbols.Class{},
+		Returns:   symbols.String,
+		Handler: func(val symbols.StringValue) (symbols.StringValue, error) {
+			return val, nil
+		},
+	}).WithGuard(guard)
+	callable := method.CallableForValue(symbols.StringValue("deny")).(symbols.ScopedCallable)
+	if _, err := callable.CallFrom(st); err != denied {
+		t.Errorf("Expected the guard to be given the value the method is called on, but got %v", err)
+	}
+}
@@ -12,6 +12,11 @@ type SymbolTable struct {
 	Immutable map[string]ScopeValue
 	Local     map[string]ScopeValue
 	LoopState *SymbolTableLoopState
+
+	// Frame is what the code running in the table is running for (like the
+	// message a command is handling). It's passed on to the functions that are
+	// called from the table, so it isn't lost in nested calls.
+	Frame ScopeValue
 }
 
 type SymbolTableLoopState struct {
@@ -69,6 +74,7 @@ func (st *SymbolTable) Clone() SymbolTable {
 		Immutable: immutable,
 		Local:     local,
 		LoopState: st.LoopState,
+		Frame:     st.Frame,
 	}
 }
 func (st *SymbolTable) StartLoop() SymbolTable {
@@ -19,6 +19,13 @@ type Object interface {
 	Get(string) (ScopeValue, error)
 }
 
+// Objects that can list the keys they resolve with Get. The interpreter never
+// needs to enumerate an object, but tooling (like completions) does.
+type KeyedObject interface {
+	Object
+	Keys() []string
+}
+
 // @ 2.1.2 `ValueObject` Type
 
 var emptyValueObjectType = reflect.TypeOf((*ValueObject)(nil)).Elem()
@@ -111,6 +118,14 @@ type Callable interface {
 	Call(...ValueObject) (ValueObject, error)
 }
 
+// ScopedCallable is implemented by callables that depend on the scope they're
+// called from (like emitters, which forward the identity of the message being
+// handled). The interpreter calls them with CallFrom instead of Call.
+type ScopedCallable interface {
+	Callable
+	CallFrom(st *SymbolTable, args ...ValueObject) (ValueObject, error)
+}
+
 // @ 2.1.4 `Class` Type
 
 type ClassHash uint64
@@ -147,6 +162,9 @@ type ClassMethod struct {
 	ArgumentTypes []Class
 	ReturnType    Class
 	handler       functionHandlerFn
+	// guard is given the value the method is called on followed by the
+	// arguments
+	guard Guard
 }
 
 type ClassMethodOptions struct {
@@ -171,7 +189,7 @@ func NewClassMethod(opts ClassMethodOptions) *ClassMethod {
 }
 
 func (cm ClassMethod) CallableForValue(val ValueObject) Callable {
-	return Function{
+	fn := Function{
 		argumentTypes: cm.ArgumentTypes,
 		returnType:    cm.ReturnType,
 		handler: func(args ...ValueObject) (ValueObject, error) {
@@ -179,6 +197,20 @@ func (cm ClassMethod) CallableForValue(val ValueObject) Callable {
 			return cm.handler(argsWithValue...)
 		},
 	}
+	if cm.guard != nil {
+		fn.guard = func(st *SymbolTable, args ...ValueObject) error {
+			return cm.guard(st, append([]ValueObject{val}, args...)...)
+		}
+	}
+	return fn
+}
+
+// WithGuard returns a copy of cm that's only called if guard doesn't return an
+// error. The guard is given the value the method is called on followed by the
+// arguments.
+func (cm ClassMethod) WithGuard(guard Guard) *ClassMethod {
+	cm.guard = guard
+	return &cm
 }
 
 // @ 2.1.4.2 `Constructors` Class Descriptor
@@ -427,7 +459,7 @@ func makeClassOperatorFn(operandClass Class, callback interface{}) (classOperato
 		args := []reflect.Value{reflect.ValueOf(a), reflect.ValueOf(b)}
 		returnValues := cb.Call(args)
 		value := returnValues[0].Interface().(ValueObject)
-		err := returnValues[1].Interface().(error)
+		err, _ := returnValues[1].Interface().(error)
 		return value, err
 	}, nil
 }
@@ -509,7 +541,7 @@ func makeClassComparatorFn(operandClass Class, callback interface{}) (classCompa
 		args := []reflect.Value{reflect.ValueOf(a), reflect.ValueOf(b)}
 		returnValues := cb.Call(args)
 		value := returnValues[0].Interface().(bool)
-		err := returnValues[1].Interface().(error)
+		err, _ := returnValues[1].Interface().(error)
 		return value, err
 	}, nil
 }
@@ -590,7 +622,7 @@ func makeClassGetterMethod(propertyClass Class, callback interface{}) (ClassGett
 		args := []reflect.Value{reflect.ValueOf(a)}
 		returnValues := cb.Call(args)
 		value := returnValues[0].Interface().(ValueObject)
-		err := returnValues[1].Interface().(error)
+		err, _ := returnValues[1].Interface().(error)
 		return value, err
 	}, nil
 }
@@ -606,7 +638,7 @@ func makeClassSetterMethod(propertyClass Class, callback interface{}) (ClassSett
 	return func(a, b ValueObject) error {
 		args := []reflect.Value{reflect.ValueOf(a), reflect.ValueOf(b)}
 		returnValues := cb.Call(args)
-		err := returnValues[0].Interface().(error)
+		err, _ := returnValues[0].Interface().(error)
 		return err
 	}, nil
 }
@@ -688,7 +720,7 @@ func makeEnumerableGetLengthMethod(callback interface{}) (EnumerableGetLengthMet
 		args := []reflect.Value{reflect.ValueOf(a)}
 		returnValues := cb.Call(args)
 		value := returnValues[0].Interface().(int)
-		err := returnValues[1].Interface().(error)
+		err, _ := returnValues[1].Interface().(error)
 		return value, err
 	}, nil
 }
@@ -705,7 +737,7 @@ func makeEnumerableGetIndexMethod(callback interface{}) (EnumerableGetIndexMetho
 		args := []reflect.Value{reflect.ValueOf(a), reflect.ValueOf(b)}
 		returnValues := cb.Call(args)
 		value := returnValues[0].Interface().(ValueObject)
-		err := returnValues[1].Interface().(error)
+		err, _ := returnValues[1].Interface().(error)
 		return value, err
 	}, nil
 }
@@ -721,7 +753,7 @@ func makeEnumerableSetIndexMethod(callback interface{}) (EnumerableSetIndexMetho
 	return func(a ValueObject, b int, c ValueObject) error {
 		args := []reflect.Value{reflect.ValueOf(a), reflect.ValueOf(b), reflect.ValueOf(c)}
 		returnValues := cb.Call(args)
-		err := returnValues[0].Interface().(error)
+		err, _ := returnValues[0].Interface().(error)
 		return err
 	}, nil
 }
@@ -738,7 +770,7 @@ func makeEnumerableGetRangeMethod(callback interface{}) (EnumerableGetRangeMetho
 		args := []reflect.Value{reflect.ValueOf(a), reflect.ValueOf(b), reflect.ValueOf(c)}
 		returnValues := cb.Call(args)
 		value := returnValues[0].Interface().(ValueObject)
-		err := returnValues[1].Interface().(error)
+		err, _ := returnValues[1].Interface().(error)
 		return value, err
 	}, nil
 }
@@ -754,7 +786,7 @@ func makeEnumerableSetRangeMethod(callback interface{}) (EnumerableSetRangeMetho
 	return func(a ValueObject, b int, c int, d ValueObject) error {
 		args := []reflect.Value{reflect.ValueOf(a), reflect.ValueOf(b), reflect.ValueOf(c), reflect.ValueOf(d)}
 		returnValues := cb.Call(args)
-		err := returnValues[0].Interface().(error)
+		err, _ := returnValues[0].Interface().(error)
 		return err
 	}, nil
 }
@@ -0,0 +1,178 @@
+// Package testrunner discovers the tests declared alongside a context and runs
+// each of them against a freshly built and attached copy of it.
+package testrunner
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hntrl/hyper/src/hyper/ast"
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces"
+	"github.com/hntrl/hyper/src/runtime/"
+	"github.com/hntrl/hyper/src/runtime//resource"
+)
+
+// TestFileSuffix is the suffix of the files tests are declared in. Test files
+// are pulled into the context declared in the same directory as if they were
+// `use`d by it, but only when running tests.
+const TestFileSuffix = "_test.hyper"
+
+// Setup registers the interfaces (and anything else the context needs) on a
+// builder before the context is built. It's called once for every test, with a
+// new builder and process each time. The process is already configured to keep
+// state in memory and pass messages over a bus only it's connected to, which
+// setup can change.
+type Setup func(*domain.ContextBuilder, *runtime.Process)
+
+// lastBus numbers the buses each test's process is connected to
+var lastBus int64
+
+type Result struct {
+	Name     string
+	Path     domain.ContextPath
+	Err      error
+	Duration time.Duration
+}
+
+func (r Result) Passed() bool {
+	return r.Err == nil
+}
+
+// Diagnostic returns the positioned representation of the reason the test
+// failed.
+func (r Result) Diagnostic() domain.Diagnostic {
+	return domain.NewDiagnostic(r.Err, string(r.Path))
+}
+
+// Discover returns the paths of the test files in the same directory as the
+// manifest at path.
+func Discover(path string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0)
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), TestFileSuffix) {
+			files = append(files, filepath.Join(filepath.Dir(path), entry.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Build builds the context declared by the manifest at path with the items in
+// testFiles added to it.
+func Build(path string, testFiles []string, setup Setup) (*domain.ContextBuilder, *runtime.Process, error) {
+	manifest, err := domain.ParseContextFromFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	cwd := filepath.Dir(path)
+	for _, testFile := range testFiles {
+		source, err := filepath.Rel(cwd, testFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !usesSource(*manifest, cwd, testFile) {
+			manifest.Context.Remotes = append(manifest.Context.Remotes, ast.UseStatement{Source: source})
+		}
+	}
+	builder := domain.NewContextBuilder()
+	process := runtime.NewProcess()
+	process.UseResourceConfig(map[string]resource.Config{
+		"stream": {Type: "bus", URL: fmt.Sprintf("test-%d", atomic.AddInt64(&lastBus, 1))},
+		"state":  {Type: "memory"},
+	})
+	setup(builder, process)
+	if _, err := builder.ParseContext(*manifest, path); err != nil {
+		return nil, nil, err
+	}
+	if err := process.UseContextBuilder(builder); err != nil {
+		return nil, nil, err
+	}
+	return builder, process, nil
+}
+
+func usesSource(manifest ast.Manifest, cwd, path string) bool {
+	for _, useStatement := range manifest.Context.Remotes {
+		if filepath.Join(cwd, useStatement.Source) == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Tests returns the names of the tests in ctx in the order they were declared.
+func Tests(ctx *domain.Context) []string {
+	names := make([]string, 0)
+	for _, item := range ctx.Manifest().Context.Items {
+		method, ok := item.Init.(ast.ContextMethod)
+		if !ok {
+			continue
+		}
+		if _, ok := ctx.Items[method.Name].HostItem.(interfaces.Test); ok {
+			names = append(names, method.Name)
+		}
+	}
+	return names
+}
+
+// Run runs the tests declared alongside the manifest at path whose names match
+// filter (or all of them if filter is nil), and calls report with the result of
+// each one as it finishes. Every test is run against its own build of the
+// context and its own process, so resources are never shared between tests.
+// An error is only returned if the context can't be built.
+func Run(path string, filter *regexp.Regexp, setup Setup, report func(Result)) error {
+	testFiles, err := Discover(path)
+	if err != nil {
+		return err
+	}
+	builder, _, err := Build(path, testFiles, setup)
+	if err != nil {
+		return err
+	}
+	for _, name := range Tests(builder.HostContext()) {
+		if filter != nil && !filter.MatchString(name) {
+			continue
+		}
+		_, declaredIn := builder.HostContext().Declaration(name)
+		start := time.Now()
+		err := runTest(path, testFiles, setup, name)
+		report(Result{
+			Name:     name,
+			Path:     declaredIn,
+			Err:      err,
+			Duration: time.Since(start),
+		})
+	}
+	return nil
+}
+
+func runTest(path string, testFiles []string, setup Setup, name string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	builder, process, err := Build(path, testFiles, setup)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := process.Attach(ctx); err != nil {
+		process.Close(ctx)
+		return err
+	}
+	defer process.Close(ctx)
+	test := builder.HostContext().Items[name].HostItem.(interfaces.Test)
+	return test.Run()
+}
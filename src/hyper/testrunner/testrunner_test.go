@@ -0,0 +1,165 @@
+package testrunner
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/hyper/interfaces"
+	"github.com/hntrl/hyper/src/hyper/symbols/errors"
+	"github.com/hntrl/hyper/src/runtime/"
+)
+
+var testFiles = map[string]string{
+	"index.hyper": `context shop {
+  type Item {
+    price Int
+  }
+
+  func double(a: Int) Int {
+    return a * 2
+  }
+}
+`,
+	"shop_test.hyper": `test doubles() {
+  expect(double(2), 4)
+}
+
+test failsExpect() {
+  expect(double(2), 5)
+}
+
+test failsAssert() {
+  assert(double(1) > 2)
+}
+`,
+	"other_test.hyper": `test constructsItems() {
+  item := Item{ price: 2 }
+  expect(item.price, 2)
+}
+`,
+}
+
+func writeTestFiles(t *testing.T) string {
+	dir := t.TempDir()
+	for name, content := range testFiles {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return filepath.Join(dir, "index.hyper")
+}
+
+func setup(builder *domain.ContextBuilder, process *runtime.Process) {
+	builder.RegisterInterface("type", interfaces.TypeInterface{})
+	builder.RegisterInterface("test", interfaces.TestInterface{})
+}
+
+func runTests(t *testing.T, path string, filter *regexp.Regexp) map[string]Result {
+	results := make(map[string]Result)
+	err := Run(path, filter, setup, func(result Result) {
+		results[result.Name] = result
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+// CAN DISCOVER TESTS
+func TestDiscover(t *testing.T) {
+	path := writeTestFiles(t)
+	files, err := Discover(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expects := []string{filepath.Join(filepath.Dir(path), "other_test.hyper"), filepath.Join(filepath.Dir(path), "shop_test.hyper")}
+	if len(files) != len(expects) || files[0] != expects[0] || files[1] != expects[1] {
+		t.Fatalf("Expected test files %v, but got %v", expects, files)
+	}
+	builder, _, err := Build(path, files, setup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := Tests(builder.HostContext())
+	if len(names) != 4 {
+		t.Fatalf("Expected 4 tests, but got %v", names)
+	}
+}
+
+// CAN RUN TESTS
+func TestRun(t *testing.T) {
+	path := writeTestFiles(t)
+	results := runTests(t, path, nil)
+	testFile := filepath.Join(filepath.Dir(path), "shop_test.hyper")
+	tests := []struct {
+		name    string
+		passes  bool
+		line    int
+		column  int
+		message string
+	}{
+		{name: "doubles", passes: true},
+		{name: "constructsItems", passes: true},
+		{name: "failsExpect", line: 6, column: 3, message: "expected 5 (Integer), got 4 (Integer)"},
+		{name: "failsAssert", line: 10, column: 3, message: "assertion failed"},
+	}
+	for _, test := range tests {
+		result, ok := results[test.name]
+		if !ok {
+			t.Errorf("Expected %s to be run", test.name)
+			continue
+		}
+		if result.Passed() != test.passes {
+			t.Errorf("Expected %s to pass=%t, but got %v", test.name, test.passes, result.Err)
+			continue
+		}
+		if test.passes {
+			continue
+		}
+		diagnostic := result.Diagnostic()
+		if diagnostic.Path != testFile || diagnostic.Line != test.line || diagnostic.Column != test.column {
+			t.Errorf("Expected %s to fail at %s:%d:%d, but got %s", test.name, testFile, test.line, test.column, diagnostic.String())
+		}
+		if diagnostic.Code != errors.FailedAssertion || diagnostic.Message != test.message {
+			t.Errorf("Expected %s to fail with %q, but got %s", test.name, test.message, diagnostic.String())
+		}
+	}
+}
+
+// CAN FILTER TESTS
+func TestRunFilter(t *testing.T) {
+	path := writeTestFiles(t)
+	results := runTests(t, path, regexp.MustCompile("^fails"))
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 tests to be run, but got %d", len(results))
+	}
+	if _, ok := results["doubles"]; ok {
+		t.Fatalf("Expected doubles to be filtered out")
+	}
+}
+
+// CAN GIVE EVERY TEST RESOURCES OF ITS OWN
+func TestBuildResources(t *testing.T) {
+	path := writeTestFiles(t)
+	urls := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		_, process, err := Build(path, nil, setup)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state, ok := process.ResourceConfig("state"); !ok || state.Type != "memory" {
+			t.Errorf("Expected state to be kept in memory, but got %+v", state)
+		}
+		stream, ok := process.ResourceConfig("stream")
+		if !ok || stream.Type != "bus" {
+			t.Fatalf("Expected messages to be passed over an in-process bus, but got %+v", stream)
+		}
+		if urls[stream.URL] {
+			t.Errorf("Expected every build to get a bus of its own, but %s was shared", stream.URL)
+		}
+		urls[stream.URL] = true
+	}
+}
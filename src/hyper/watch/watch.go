@@ -0,0 +1,77 @@
+// Package watch detects changes to the files a context is built from by
+// polling them, so it works the same on every platform without any
+// dependencies.
+package watch
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watcher compares the state of a set of paths to the state they were in the
+// last time they were checked. Directories are watched recursively, and paths
+// that don't exist are watched for being created.
+type Watcher struct {
+	paths func() []string
+	last  map[string]fileState
+}
+
+// NewWatcher creates a watcher for the paths returned by paths, which is
+// called again every time the watcher checks for changes so the set of paths
+// can change (like when an import is added to a manifest).
+func NewWatcher(paths func() []string) *Watcher {
+	w := &Watcher{paths: paths}
+	w.last = w.snapshot()
+	return w
+}
+
+// Changed reports if any of the watched files have been created, removed or
+// modified since it was last called (or since the watcher was created).
+func (w *Watcher) Changed() bool {
+	current := w.snapshot()
+	changed := len(current) != len(w.last)
+	if !changed {
+		for path, state := range current {
+			if last, ok := w.last[path]; !ok || last != state {
+				changed = true
+				break
+			}
+		}
+	}
+	w.last = current
+	return changed
+}
+
+// Reset forgets any changes made since the watcher last checked for them.
+func (w *Watcher) Reset() {
+	w.last = w.snapshot()
+}
+
+func (w *Watcher) snapshot() map[string]fileState {
+	states := make(map[string]fileState)
+	for _, root := range w.paths() {
+		filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				// the path doesn't exist (yet) or can't be read
+				return nil
+			}
+			if entry.IsDir() {
+				return nil
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil
+			}
+			states[path] = fileState{modTime: info.ModTime(), size: info.Size()}
+			return nil
+		})
+	}
+	return states
+}
@@ -0,0 +1,68 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// CAN DETECT CHANGES
+func TestChanged(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "index.hyper")
+	templates := filepath.Join(dir, "templates")
+	writeFile(t, manifest, "context a {}\n")
+
+	watcher := NewWatcher(func() []string {
+		return []string{manifest, templates}
+	})
+	tests := []struct {
+		name    string
+		change  func()
+		expects bool
+	}{
+		{"nothing", func() {}, false},
+		{"modified file", func() { writeFile(t, manifest, "context ab {}\n") }, true},
+		{"nothing after a change", func() {}, false},
+		{"created directory", func() {
+			if err := os.Mkdir(templates, 0755); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+		{"created file in directory", func() { writeFile(t, filepath.Join(templates, "index.html"), "<p></p>") }, true},
+		{"removed file", func() {
+			if err := os.Remove(manifest); err != nil {
+				t.Fatal(err)
+			}
+		}, true},
+	}
+	for _, test := range tests {
+		test.change()
+		if changed := watcher.Changed(); changed != test.expects {
+			t.Errorf("Expected Changed() to be %t after %s, but got %t", test.expects, test.name, changed)
+		}
+	}
+}
+
+// CAN CHANGE THE WATCHED PATHS
+func TestReset(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.hyper")}
+	writeFile(t, paths[0], "context a {}\n")
+	writeFile(t, filepath.Join(dir, "b.hyper"), "context b {}\n")
+
+	watcher := NewWatcher(func() []string {
+		return paths
+	})
+	paths = append(paths, filepath.Join(dir, "b.hyper"))
+	watcher.Reset()
+	if watcher.Changed() {
+		t.Fatalf("Expected adding a path and resetting to not be a change")
+	}
+}
@@ -0,0 +1,86 @@
+// Package audit records the authorization decisions a process makes for the
+// messages it receives, so who was allowed to do what (and who wasn't) can be
+// accounted for after the fact.
+package audit
+
+import (
+	"fmt"
+	"time"
+)
+
+type Kind string
+
+const (
+	// Grant decisions are made on whether the caller has a grant
+	Grant Kind = "grant"
+	// Policy decisions are made by a policy written in hyper
+	Policy Kind = "policy"
+)
+
+// Decision is the outcome of checking one grant or policy an item requires
+// for a message sent to it
+type Decision struct {
+	Time time.Time `json:"time"`
+	// Correlation identifies the incoming message the decision was made for,
+	// and is shared by the requests made while handling it
+	Correlation string `json:"correlation"`
+	// Caller is the subject of the caller's token, or empty if the caller is
+	// anonymous
+	Caller string `json:"caller"`
+	// Item is the item the message was sent to (like acme.orders.PlaceOrder)
+	Item        string `json:"item"`
+	Kind        Kind   `json:"kind"`
+	Requirement string `json:"requirement"`
+	Allowed     bool   `json:"allowed"`
+	// Reason is why the caller was denied, if they were
+	Reason string `json:"reason,omitempty"`
+}
+
+// Sink is where a process records its decisions. Sinks are used by every
+// message a process handles at once, so they have to be safe for concurrent
+// use.
+type Sink interface {
+	Record(decision Decision) error
+	// Close flushes the decisions that have been recorded and releases the
+	// sink
+	Close() error
+}
+
+// Config describes the sink a process records its decisions to
+type Config struct {
+	// File is the file decisions are appended to as JSON lines
+	File string `yaml:"file"`
+	// Sync flushes each decision to disk before the message it was made for
+	// is handled, so none are lost if the machine goes down
+	Sync bool `yaml:"sync"`
+	// FailClosed denies the messages a decision can't be recorded for,
+	// instead of only logging that it couldn't be
+	FailClosed bool `yaml:"failClosed"`
+}
+
+// Check returns an error if the configuration can't be used
+func (c Config) Check() error {
+	if c.File == "" {
+		return fmt.Errorf("a file to record decisions to is required")
+	}
+	return nil
+}
+
+// Auditor is the sink a process records its decisions to, along with what
+// happens to a message when a decision made for it can't be recorded
+type Auditor struct {
+	Sink
+	FailClosed bool
+}
+
+// New opens the sink described by config
+func New(config Config) (*Auditor, error) {
+	if err := config.Check(); err != nil {
+		return nil, err
+	}
+	sink, err := OpenFile(config.File, config.Sync)
+	if err != nil {
+		return nil, err
+	}
+	return &Auditor{Sink: sink, FailClosed: config.FailClosed}, nil
+}
@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testDecision(requirement string, allowed bool) Decision {
+	return Decision{
+		Time:        time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC),
+		Correlation: "c0ffee",
+		Caller:      "alice",
+		Item:        "acme.orders.PlaceOrder",
+		Kind:        Grant,
+		Requirement: requirement,
+		Allowed:     allowed,
+	}
+}
+
+// CAN RECORD DECISIONS TO A FILE AND READ THE LAST OF THEM
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "decisions.jsonl")
+	sink, err := New(Config{File: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded := []Decision{
+		testDecision("orders:view", true),
+		testDecision("orders:manage", false),
+		testDecision("orders:cancel", true),
+	}
+	for _, decision := range recorded {
+		if err := sink.Record(decision); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// reopening the file appends to it instead of replacing it
+	sink, err = New(Config{File: path, Sync: true, FailClosed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sink.FailClosed {
+		t.Errorf("Expected the sink to fail closed")
+	}
+	recorded = append(recorded, testDecision("orders:refund", false))
+	if err := sink.Record(recorded[3]); err != nil {
+		t.Fatal(err)
+	}
+	sink.Close()
+
+	tests := []struct {
+		n       int
+		expects []Decision
+	}{
+		{-1, recorded},
+		{2, recorded[2:]},
+		{0, []Decision{}},
+	}
+	for _, test := range tests {
+		decisions := make([]Decision, 0)
+		err := Tail(context.Background(), path, test.n, false, func(decision Decision) error {
+			decisions = append(decisions, decision)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decisions, test.expects) {
+			t.Errorf("Expected the last %d decisions to be %v, but got %v", test.n, test.expects, decisions)
+		}
+	}
+
+	if _, err := New(Config{}); err == nil {
+		t.Errorf("Expected a sink without a file to be rejected")
+	}
+}
+
+// CAN FOLLOW DECISIONS AS THEY'RE RECORDED
+func TestTailFollow(t *testing.T) {
+	defer func(interval time.Duration) { TailInterval = interval }(TailInterval)
+	TailInterval = 10 * time.Millisecond
+	path := filepath.Join(t.TempDir(), "decisions.jsonl")
+	sink, err := OpenFile(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	sink.Record(testDecision("orders:view", true))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	decisions := make(chan Decision, 3)
+	done := make(chan error)
+	go func() {
+		done <- Tail(ctx, path, 10, true, func(decision Decision) error {
+			decisions <- decision
+			return nil
+		})
+	}()
+	if decision := <-decisions; decision.Requirement != "orders:view" {
+		t.Errorf("Expected the decision already in the file first, but got %v", decision)
+	}
+
+	// a line that's still being written isn't read until it's finished
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	file.WriteString(`{"requirement":"orders:`)
+	time.Sleep(5 * TailInterval)
+	file.WriteString(`manage","allowed":false}` + "\n")
+	sink.Record(testDecision("orders:cancel", true))
+
+	for _, expected := range []string{"orders:manage", "orders:cancel"} {
+		select {
+		case decision := <-decisions:
+			if decision.Requirement != expected {
+				t.Errorf("Expected a decision on %s, but got %v", expected, decision)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Expected a decision on %s to be followed", expected)
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected following to stop without an error, but got %s", err)
+	}
+}
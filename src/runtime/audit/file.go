@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileSink appends decisions to a file as JSON lines, one decision per line
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+	// sync flushes the file to disk after each decision is written to it
+	sync bool
+}
+
+// OpenFile opens the file at path to append decisions to, creating it (and
+// the directories it's in) if it doesn't exist. With sync, each decision is
+// flushed to disk before Record returns.
+func OpenFile(path string, sync bool) (*FileSink, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{file: file, sync: sync}, nil
+}
+
+func (s *FileSink) Record(decision Decision) error {
+	line, err := json.Marshal(decision)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// each decision is written in one call, so a reader never sees half of
+	// one followed by another
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if s.sync {
+		return s.file.Sync()
+	}
+	return nil
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// TailInterval is how often Tail checks the file for new decisions when it's
+// following it
+var TailInterval = 250 * time.Millisecond
+
+// Tail calls fn with the last n decisions in the file at path (or all of them
+// if n is negative), oldest first. With follow, it then keeps calling fn with
+// the decisions appended to the file until ctx is done.
+func Tail(ctx context.Context, path string, n int, follow bool, fn func(Decision) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	lineNumber := 0
+	last := make([]Decision, 0)
+	var partial []byte
+	// readLines decodes the complete lines that have been written to the file
+	// since it was last called. A line that's still being written is kept in
+	// partial until the rest of it is.
+	readLines := func(emit func(Decision) error) error {
+		for {
+			line, err := reader.ReadBytes('\n')
+			if err == io.EOF {
+				partial = append(partial, line...)
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			line = append(partial, line...)
+			partial = nil
+			lineNumber++
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var decision Decision
+			if err := json.Unmarshal(line, &decision); err != nil {
+				return fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+			}
+			if err := emit(decision); err != nil {
+				return err
+			}
+		}
+	}
+	err = readLines(func(decision Decision) error {
+		last = append(last, decision)
+		if n >= 0 && len(last) > n {
+			last = last[1:]
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, decision := range last {
+		if err := fn(decision); err != nil {
+			return err
+		}
+	}
+	if !follow {
+		return nil
+	}
+	ticker := time.NewTicker(TailInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := readLines(fn); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,279 @@
+// Package auth signs and verifies the tokens messages carry the identity of
+// whoever sent them in. Tokens are JWTs signed with either a shared HMAC key
+// or an Ed25519 key pair.
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Header is the message header tokens are sent in
+const Header = "Hyper-Authorization"
+
+type Algorithm string
+
+const (
+	// HS256 signs tokens with a shared secret, which every process that signs
+	// or verifies tokens has a copy of
+	HS256 Algorithm = "HS256"
+	// EdDSA signs tokens with an Ed25519 private key, so processes that only
+	// verify tokens only need the public key
+	EdDSA Algorithm = "EdDSA"
+)
+
+var (
+	ErrMalformed = errors.New("malformed token")
+	ErrSignature = errors.New("invalid token signature")
+	ErrExpired   = errors.New("token has expired")
+)
+
+// Claims are the claims in a token. Besides the registered claims (like sub
+// and exp), tokens carry the names of the grants their subject has in
+// "grants" and the names of the roles they have in "roles".
+type Claims map[string]interface{}
+
+// Subject returns the id of whoever the token identifies
+func (c Claims) Subject() string {
+	subject, _ := c["sub"].(string)
+	return subject
+}
+
+// Grants returns the names of the grants in the token
+func (c Claims) Grants() []string {
+	return c.strings("grants")
+}
+
+// Roles returns the names of the roles in the token
+func (c Claims) Roles() []string {
+	return c.strings("roles")
+}
+
+func (c Claims) strings(key string) []string {
+	values, _ := c[key].([]interface{})
+	out := make([]string, 0, len(values))
+	for _, value := range values {
+		if str, ok := value.(string); ok {
+			out = append(out, str)
+		}
+	}
+	return out
+}
+
+// time returns the claim under key as a time, if it's a NumericDate
+func (c Claims) time(key string) (time.Time, bool) {
+	switch value := c[key].(type) {
+	case float64:
+		return time.Unix(int64(value), 0), true
+	case int64:
+		return time.Unix(value, 0), true
+	case int:
+		return time.Unix(int64(value), 0), true
+	}
+	return time.Time{}, false
+}
+
+type header struct {
+	Algorithm Algorithm `json:"alg"`
+	Type      string    `json:"typ"`
+}
+
+// Signer signs tokens with a private key
+type Signer struct {
+	algorithm  Algorithm
+	secret     []byte
+	privateKey ed25519.PrivateKey
+}
+
+// Sign returns a token carrying claims
+func (s Signer) Sign(claims Claims) (string, error) {
+	headerBytes, err := json.Marshal(header{Algorithm: s.algorithm, Type: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claimsBytes, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := encode(headerBytes) + "." + encode(claimsBytes)
+	var signature []byte
+	switch s.algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case EdDSA:
+		signature = ed25519.Sign(s.privateKey, []byte(signed))
+	}
+	return signed + "." + encode(signature), nil
+}
+
+// Verifier checks that tokens were signed by a trusted key and haven't expired
+type Verifier struct {
+	algorithm Algorithm
+	secret    []byte
+	publicKey ed25519.PublicKey
+}
+
+// Verify returns the claims in token if it's valid
+func (v Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+	headerBytes, err := decode(parts[0])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	var h header
+	if err := json.Unmarshal(headerBytes, &h); err != nil {
+		return nil, ErrMalformed
+	}
+	// the algorithm in the token is never trusted, only compared to the one
+	// the key is for
+	if h.Algorithm != v.algorithm {
+		return nil, fmt.Errorf("unexpected token algorithm %q", h.Algorithm)
+	}
+	signature, err := decode(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	switch v.algorithm {
+	case HS256:
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, ErrSignature
+		}
+	case EdDSA:
+		if !ed25519.Verify(v.publicKey, signed, signature) {
+			return nil, ErrSignature
+		}
+	}
+	claimsBytes, err := decode(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	var claims Claims
+	if err := json.Unmarshal(claimsBytes, &claims); err != nil {
+		return nil, ErrMalformed
+	}
+	now := time.Now()
+	if expiresAt, ok := claims.time("exp"); ok && !now.Before(expiresAt) {
+		return nil, ErrExpired
+	}
+	if notBefore, ok := claims.time("nbf"); ok && now.Before(notBefore) {
+		return nil, fmt.Errorf("token isn't valid until %s", notBefore.UTC().Format(time.RFC3339))
+	}
+	return claims, nil
+}
+
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+func decode(data string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(data)
+}
+
+// LoadSigner reads the key to sign tokens with from the file at path. HMAC
+// secrets are read as is (without any trailing newline), and Ed25519 keys are
+// read from a PEM encoded PKCS #8 private key.
+func LoadSigner(algorithm Algorithm, path string) (*Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch algorithm {
+	case HS256:
+		secret, err := parseSecret(data, path)
+		if err != nil {
+			return nil, err
+		}
+		return &Signer{algorithm: algorithm, secret: secret}, nil
+	case EdDSA:
+		privateKey, err := parsePrivateKey(data, path)
+		if err != nil {
+			return nil, err
+		}
+		return &Signer{algorithm: algorithm, privateKey: privateKey}, nil
+	default:
+		return nil, fmt.Errorf("unknown token algorithm %q (expected %s or %s)", algorithm, HS256, EdDSA)
+	}
+}
+
+// LoadVerifier reads the key to verify tokens with from the file at path.
+// HMAC secrets are read as is (without any trailing newline), and Ed25519 keys
+// are read from a PEM encoded PKIX public key (or a PKCS #8 private key, whose
+// public key is used).
+func LoadVerifier(algorithm Algorithm, path string) (*Verifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch algorithm {
+	case HS256:
+		secret, err := parseSecret(data, path)
+		if err != nil {
+			return nil, err
+		}
+		return &Verifier{algorithm: algorithm, secret: secret}, nil
+	case EdDSA:
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s: expected a PEM encoded key", path)
+		}
+		if block.Type != "PUBLIC KEY" {
+			privateKey, err := parsePrivateKey(data, path)
+			if err != nil {
+				return nil, err
+			}
+			return &Verifier{algorithm: algorithm, publicKey: privateKey.Public().(ed25519.PublicKey)}, nil
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		publicKey, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected an Ed25519 public key, got %T", path, key)
+		}
+		return &Verifier{algorithm: algorithm, publicKey: publicKey}, nil
+	default:
+		return nil, fmt.Errorf("unknown token algorithm %q (expected %s or %s)", algorithm, HS256, EdDSA)
+	}
+}
+
+func parseSecret(data []byte, path string) ([]byte, error) {
+	secret := []byte(strings.TrimRight(string(data), "\r\n"))
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("%s: HMAC secrets must be at least 32 bytes", path)
+	}
+	return secret, nil
+}
+
+func parsePrivateKey(data []byte, path string) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: expected a PEM encoded key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected an Ed25519 private key, got %T", path, key)
+	}
+	return privateKey, nil
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hntrl/hyper/src/runtime//transport"
+)
+
+const testSecret = "a-shared-secret-that-is-long-enough"
+
+func writeKey(t *testing.T, name string, data []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// writeKeyPair writes a PEM encoded Ed25519 key pair and returns the paths to
+// the private and public keys
+func writeKeyPair(t *testing.T) (string, string) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicBytes, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privatePath := writeKey(t, "private.pem", pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateBytes}))
+	publicPath := writeKey(t, "public.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicBytes}))
+	return privatePath, publicPath
+}
+
+// CAN SIGN AND VERIFY TOKENS
+func TestSignVerify(t *testing.T) {
+	secretPath := writeKey(t, "secret", []byte(testSecret+"\n"))
+	privatePath, publicPath := writeKeyPair(t)
+	otherPrivatePath, _ := writeKeyPair(t)
+	tests := []struct {
+		name       string
+		algorithm  Algorithm
+		signingKey string
+		verifyKey  string
+		claims     Claims
+		expected   error
+	}{
+		{"hmac", HS256, secretPath, secretPath, Claims{"sub": "ada"}, nil},
+		{"ed25519", EdDSA, privatePath, publicPath, Claims{"sub": "ada"}, nil},
+		{"ed25519 verified with a private key", EdDSA, privatePath, privatePath, Claims{"sub": "ada"}, nil},
+		{"wrong key", EdDSA, otherPrivatePath, publicPath, Claims{"sub": "ada"}, ErrSignature},
+		{"expired", HS256, secretPath, secretPath, Claims{"sub": "ada", "exp": time.Now().Add(-time.Minute).Unix()}, ErrExpired},
+	}
+	for _, test := range tests {
+		signer, err := LoadSigner(test.algorithm, test.signingKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		verifier, err := LoadVerifier(test.algorithm, test.verifyKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := signer.Sign(test.claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := verifier.Verify(token)
+		if err != test.expected {
+			t.Errorf("Expected verifying a token signed with %s to return %v, but got %v", test.name, test.expected, err)
+		}
+		if err == nil && claims.Subject() != "ada" {
+			t.Errorf("Expected the token signed with %s to identify ada, but got %q", test.name, claims.Subject())
+		}
+	}
+
+	// a token can't pick the algorithm it's verified with
+	hmacSigner, _ := LoadSigner(HS256, secretPath)
+	token, _ := hmacSigner.Sign(Claims{"sub": "ada"})
+	verifier, _ := LoadVerifier(EdDSA, publicPath)
+	if _, err := verifier.Verify(token); err == nil {
+		t.Errorf("Expected a token signed with another algorithm to be rejected")
+	}
+	if _, err := LoadVerifier(HS256, writeKey(t, "short", []byte("short"))); err == nil {
+		t.Errorf("Expected a short HMAC secret to be rejected")
+	}
+}
+
+// CAN IDENTIFY CALLERS
+func TestAuthenticator(t *testing.T) {
+	privatePath, publicPath := writeKeyPair(t)
+	signing, err := New(Config{Algorithm: EdDSA, SigningKey: privatePath, Subject: "acme.shop", Grants: []string{"ManageOrders"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifying, err := New(Config{Algorithm: EdDSA, VerifyKey: publicPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := signing.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unsigned, _ := verifying.Token(); unsigned != "" {
+		t.Errorf("Expected a process without a signing key to not sign tokens, but got %s", unsigned)
+	}
+	_, claims, err := verifying.Identify(transport.Header{Header: token})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject() != "acme.shop" || len(claims.Grants()) != 1 || claims.Grants()[0] != "ManageOrders" {
+		t.Errorf("Expected the process's own identity, but got %v", claims)
+	}
+	if _, claims, err := verifying.Identify(transport.Header{}); claims != nil || err != nil {
+		t.Errorf("Expected a message without a token to be anonymous, but got %v, %v", claims, err)
+	}
+	if _, _, err := verifying.Identify(transport.Header{Header: "not.a.token"}); err == nil {
+		t.Errorf("Expected an invalid token to fail")
+	}
+	var none *Authenticator
+	if _, claims, err := none.Identify(transport.Header{Header: token}); claims != nil || err != nil {
+		t.Errorf("Expected tokens to be ignored without an authenticator, but got %v, %v", claims, err)
+	}
+	if _, err := New(Config{Algorithm: HS256, SigningKey: privatePath}); err == nil {
+		t.Errorf("Expected signing without a subject to fail")
+	}
+}
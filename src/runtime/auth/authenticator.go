@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hntrl/hyper/src/runtime//transport"
+)
+
+// DefaultTTL is how long the tokens a process signs for itself are valid for
+// when its configuration doesn't say
+const DefaultTTL = 5 * time.Minute
+
+// Config describes how a process verifies the tokens in the messages it
+// receives, and the identity it sends with the requests it makes itself
+type Config struct {
+	Algorithm Algorithm `yaml:"algorithm"`
+	// VerifyKey is the file with the key tokens are verified with. Without
+	// one, tokens are ignored and every caller is anonymous.
+	VerifyKey string `yaml:"verifyKey"`
+	// SigningKey is the file with the key the process signs tokens for its
+	// own identity with
+	SigningKey string `yaml:"signingKey"`
+	// Subject and Grants are the identity the process sends with requests
+	// that aren't made on behalf of another caller
+	Subject string        `yaml:"subject"`
+	Grants  []string      `yaml:"grants"`
+	TTL     time.Duration `yaml:"ttl"`
+}
+
+// Check returns an error if the configuration can't be used
+func (c Config) Check() error {
+	if c.Algorithm != HS256 && c.Algorithm != EdDSA {
+		return fmt.Errorf("unknown token algorithm %q (expected %s or %s)", c.Algorithm, HS256, EdDSA)
+	}
+	if c.SigningKey != "" && c.Subject == "" {
+		return fmt.Errorf("a subject is required to sign tokens")
+	}
+	if c.TTL < 0 {
+		return fmt.Errorf("ttl can't be negative")
+	}
+	return nil
+}
+
+// Authenticator identifies the callers of the messages a process receives,
+// and attaches tokens to the messages it sends. A nil authenticator treats
+// every caller as anonymous and doesn't sign anything.
+type Authenticator struct {
+	config   Config
+	signer   *Signer
+	verifier *Verifier
+}
+
+// New loads the keys in config
+func New(config Config) (*Authenticator, error) {
+	if err := config.Check(); err != nil {
+		return nil, err
+	}
+	a := &Authenticator{config: config}
+	if a.config.TTL == 0 {
+		a.config.TTL = DefaultTTL
+	}
+	var err error
+	if config.VerifyKey != "" {
+		if a.verifier, err = LoadVerifier(config.Algorithm, config.VerifyKey); err != nil {
+			return nil, err
+		}
+	}
+	if config.SigningKey != "" {
+		if a.signer, err = LoadSigner(config.Algorithm, config.SigningKey); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Identify returns the token in header and its claims. Both are empty if the
+// caller is anonymous, which they are when the message doesn't carry a token
+// or the authenticator can't verify one. An error is returned if the token
+// is invalid.
+func (a *Authenticator) Identify(header transport.Header) (string, Claims, error) {
+	token, ok := header[Header]
+	if !ok || a == nil || a.verifier == nil {
+		return "", nil, nil
+	}
+	claims, err := a.verifier.Verify(token)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
+}
+
+// Token returns a token signed for the process's own identity, which is sent
+// with the requests the process makes on its own behalf. It's empty if the
+// process doesn't sign tokens. Requests made on behalf of a caller forward the
+// caller's token instead, and are never sent with this one.
+func (a *Authenticator) Token() (string, error) {
+	if a == nil || a.signer == nil {
+		return "", nil
+	}
+	now := time.Now()
+	grants := make([]interface{}, len(a.config.Grants))
+	for idx, grant := range a.config.Grants {
+		grants[idx] = grant
+	}
+	return a.signer.Sign(Claims{
+		"sub":    a.config.Subject,
+		"grants": grants,
+		"iat":    now.Unix(),
+		"exp":    now.Add(a.config.TTL).Unix(),
+	})
+}
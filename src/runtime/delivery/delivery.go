@@ -0,0 +1,295 @@
+// Package delivery retries the messages runtime nodes fail to handle, and
+// keeps the ones they give up on as dead letters so they can be inspected and
+// replayed later.
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hntrl/hyper/src/runtime//auth"
+	"github.com/hntrl/hyper/src/runtime//log"
+	"github.com/hntrl/hyper/src/runtime//transport"
+)
+
+// Policy describes how many times a consumer tries to handle a message and
+// how long it waits between attempts. Zero values are taken from the policy
+// it's merged onto.
+type Policy struct {
+	MaxAttempts int `yaml:"maxAttempts"`
+	// Backoff is how long to wait before the first retry. It doubles for
+	// every retry after that, up to MaxBackoff.
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+	// DeadLetterTopic is the subject messages that can't be handled are
+	// published on (deadletter.<consumer> if it isn't set)
+	DeadLetterTopic string `yaml:"deadLetterTopic"`
+}
+
+// DefaultPolicy is the policy consumers use when none is configured
+var DefaultPolicy = Policy{
+	MaxAttempts: 5,
+	Backoff:     100 * time.Millisecond,
+	MaxBackoff:  10 * time.Second,
+}
+
+// Merge returns p with the options set in override replacing its own
+func (p Policy) Merge(override Policy) Policy {
+	if override.MaxAttempts != 0 {
+		p.MaxAttempts = override.MaxAttempts
+	}
+	if override.Backoff != 0 {
+		p.Backoff = override.Backoff
+	}
+	if override.MaxBackoff != 0 {
+		p.MaxBackoff = override.MaxBackoff
+	}
+	if override.DeadLetterTopic != "" {
+		p.DeadLetterTopic = override.DeadLetterTopic
+	}
+	return p
+}
+
+// Delay returns how long to wait before the given retry (starting at 1)
+func (p Policy) Delay(retry int) time.Duration {
+	delay := p.Backoff
+	for idx := 1; idx < retry && delay < p.MaxBackoff; idx++ {
+		delay *= 2
+	}
+	if p.MaxBackoff != 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	return delay
+}
+
+// Check returns an error if the policy can't be used
+func (p Policy) Check() error {
+	if p.MaxAttempts < 0 || p.Backoff < 0 || p.MaxBackoff < 0 {
+		return fmt.Errorf("retry policy options can't be negative")
+	}
+	return nil
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string {
+	return e.err.Error()
+}
+func (e permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as an error that retrying won't fix (like a message that
+// can't be decoded), so the message is dead-lettered without retrying it
+func Permanent(err error) error {
+	return permanentError{err}
+}
+
+// SubjectHeader is the header dead letters carry the subject they were
+// originally received on in. Replays are sent to the subject of the consumer
+// that failed to handle them (so nothing else receives them again) with the
+// same header.
+const SubjectHeader = "Hyper-Original-Subject"
+
+// ErrorHeader is the header dead letters carry the error that made the
+// consumer give up on them in. Replies to replays that failed again carry it
+// too.
+const ErrorHeader = "Hyper-Error"
+
+// Consumer handles the messages a runtime node receives, retrying them
+// according to its policy and dead-lettering the ones it gives up on.
+type Consumer struct {
+	// Name identifies the consumer in dead letters and is the subject
+	// replays are sent to (like acme.shop.notify)
+	Name      string
+	Policy    Policy
+	Transport transport.Transport
+	// Store returns the store dead letters are kept in. It's only called when
+	// a message is dead-lettered.
+	Store  func(ctx context.Context) (*Store, error)
+	Signal *string
+	ctx    context.Context
+	cancel context.CancelFunc
+	// pending are the messages waiting to be retried, and closed is set once
+	// no more can be
+	mu      sync.Mutex
+	pending sync.WaitGroup
+	closed  bool
+}
+
+func NewConsumer(name string, policy Policy, t transport.Transport, store func(context.Context) (*Store, error), signal *string) *Consumer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Consumer{
+		Name:      name,
+		Policy:    policy,
+		Transport: t,
+		Store:     store,
+		Signal:    signal,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// DeadLetterTopic returns the subject messages the consumer gives up on are
+// published on
+func (c *Consumer) DeadLetterTopic() string {
+	if c.Policy.DeadLetterTopic != "" {
+		return c.Policy.DeadLetterTopic
+	}
+	return "deadletter." + c.Name
+}
+
+// Close stops waiting to retry messages, and returns once the ones that were
+// waiting are settled. Messages from durable subscriptions that were waiting
+// are left for the transport to deliver again, and the others are
+// dead-lettered right away.
+func (c *Consumer) Close() {
+	c.mu.Lock()
+	c.closed = true
+	c.cancel()
+	c.mu.Unlock()
+	c.pending.Wait()
+}
+
+// Handle calls handler with m, and calls it again until it succeeds or the
+// policy's attempts are used up. Retries are waited for in the background, so
+// the messages received after m aren't held up by it. Messages from durable
+// subscriptions are acked once they've been handled or dead-lettered.
+// Replayed messages are only tried once, and the result is replied to whoever
+// replayed it instead of being dead-lettered again.
+func (c *Consumer) Handle(m transport.Message, handler func(transport.Message) error) {
+	if subject, ok := m.Header[SubjectHeader]; ok {
+		m.Subject = subject
+		err := handler(m)
+		reply := transport.Message{Header: transport.Header{}}
+		if err != nil {
+			log.Printf(log.LevelERROR, c.Signal, "replay of \"%s\" for \"%s\" failed: %s", subject, c.Name, err.Error())
+			reply.Header[ErrorHeader] = err.Error()
+		}
+		m.RespondMsg(reply)
+		return
+	}
+	c.attempt(m, handler, 1)
+}
+
+// attempt calls handler with m, and schedules the next attempt if it fails and
+// the policy allows for another one
+func (c *Consumer) attempt(m transport.Message, handler func(transport.Message) error, attempts int) {
+	err := handler(m)
+	if err == nil {
+		c.ack(m)
+		return
+	}
+	var permanent permanentError
+	if errors.As(err, &permanent) || attempts >= c.Policy.MaxAttempts {
+		c.deadLetter(m, err, attempts)
+		c.ack(m)
+		return
+	}
+	delay := c.Policy.Delay(attempts)
+	log.Printf(log.LevelWARN, c.Signal, "\"%s\" failed to handle \"%s\" (attempt %d of %d), retrying in %s: %s", c.Name, m.Subject, attempts, c.Policy.MaxAttempts, delay, err.Error())
+	m.InProgress()
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		c.giveUp(m, err, attempts)
+		return
+	}
+	c.pending.Add(1)
+	c.mu.Unlock()
+	go func() {
+		defer c.pending.Done()
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			c.attempt(m, handler, attempts+1)
+		case <-c.ctx.Done():
+			c.giveUp(m, err, attempts)
+		}
+	}()
+}
+
+// giveUp settles a message that was waiting to be retried when the consumer
+// closed
+func (c *Consumer) giveUp(m transport.Message, err error, attempts int) {
+	if m.Acknowledger != nil {
+		m.Nak()
+		return
+	}
+	c.deadLetter(m, err, attempts)
+}
+
+func (c *Consumer) ack(m transport.Message) {
+	if err := m.Ack(); err != nil {
+		log.Printf(log.LevelERROR, c.Signal, "\"%s\" cannot ack \"%s\": %s", c.Name, m.Subject, err.Error())
+	}
+}
+
+// deadLetter publishes m on the consumer's dead letter topic and keeps it in
+// the store. The token of whoever sent m (if there is one) is left out, so it
+// isn't kept around or handed to whoever reads dead letters.
+func (c *Consumer) deadLetter(m transport.Message, err error, attempts int) {
+	log.Printf(log.LevelERROR, c.Signal, "\"%s\" gave up on \"%s\" after %d attempt(s): %s", c.Name, m.Subject, attempts, err.Error())
+	letterHeader := transport.Header{}
+	for key, value := range m.Header {
+		if key != auth.Header {
+			letterHeader[key] = value
+		}
+	}
+	letter := DeadLetter{
+		Consumer: c.Name,
+		Subject:  m.Subject,
+		Header:   letterHeader,
+		Data:     m.Data,
+		Error:    err.Error(),
+		Attempts: attempts,
+		FailedAt: time.Now().UTC(),
+	}
+	// the consumer may be closing, so this doesn't use its context
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	header := transport.Header{}
+	for key, value := range letterHeader {
+		header[key] = value
+	}
+	header[SubjectHeader] = m.Subject
+	header[ErrorHeader] = letter.Error
+	if err := c.Transport.Publish(ctx, transport.Message{Subject: c.DeadLetterTopic(), Header: header, Data: m.Data}); err != nil {
+		log.Printf(log.LevelERROR, c.Signal, "cannot publish dead letter for \"%s\": %s", c.Name, err.Error())
+	}
+	store, err := c.Store(ctx)
+	if err == nil {
+		_, err = store.Add(ctx, letter)
+	}
+	if err != nil {
+		log.Printf(log.LevelERROR, c.Signal, "cannot store dead letter for \"%s\": %s", c.Name, err.Error())
+	}
+}
+
+// Replay sends letter back to the consumer that failed to handle it, and
+// waits for it to be handled again.
+func Replay(ctx context.Context, t transport.Transport, letter DeadLetter) error {
+	header := transport.Header{}
+	for key, value := range letter.Header {
+		header[key] = value
+	}
+	header[SubjectHeader] = letter.Subject
+	reply, err := t.Request(ctx, transport.Message{Subject: letter.Consumer, Header: header, Data: letter.Data})
+	if err == transport.ErrNoResponders {
+		return fmt.Errorf("%s isn't running", letter.Consumer)
+	}
+	if err != nil {
+		return err
+	}
+	if message, ok := reply.Header[ErrorHeader]; ok {
+		return errors.New(message)
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+package delivery_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hntrl/hyper/src/runtime//auth"
+	"github.com/hntrl/hyper/src/runtime//delivery"
+	"github.com/hntrl/hyper/src/runtime//resource"
+	"github.com/hntrl/hyper/src/runtime//storage"
+	"github.com/hntrl/hyper/src/runtime//transport"
+)
+
+var testSignal = "TEST"
+
+func attach(t *testing.T, res resource.Resource) resource.Resource {
+	attached, err := res.Attach(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { attached.Detach(context.Background()) })
+	return attached
+}
+
+// newConsumer returns a consumer that dead-letters to an in-memory store and
+// publishes on a bus of its own
+func newConsumer(t *testing.T, policy delivery.Policy) (*delivery.Consumer, transport.Transport, *delivery.Store) {
+	conn := attach(t, resource.Bus{Config: resource.Config{URL: t.Name()}}).(transport.Transport)
+	driver := attach(t, resource.MemoryStore{}).(storage.Driver)
+	store, err := delivery.NewStore(context.Background(), driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer := delivery.NewConsumer("acme.shop.notify", policy, conn, func(context.Context) (*delivery.Store, error) {
+		return store, nil
+	}, &testSignal)
+	t.Cleanup(consumer.Close)
+	return consumer, conn, store
+}
+
+// CAN BACK OFF EXPONENTIALLY
+func TestPolicyDelay(t *testing.T) {
+	policy := delivery.Policy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	tests := []struct {
+		retry    int
+		expected time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+	for _, test := range tests {
+		if delay := policy.Delay(test.retry); delay != test.expected {
+			t.Errorf("Expected retry %d to wait %s, but got %s", test.retry, test.expected, delay)
+		}
+	}
+}
+
+// CAN MERGE POLICIES
+func TestPolicyMerge(t *testing.T) {
+	policy := delivery.DefaultPolicy.Merge(delivery.Policy{MaxAttempts: 2, DeadLetterTopic: "failed"})
+	expected := delivery.Policy{
+		MaxAttempts:     2,
+		Backoff:         delivery.DefaultPolicy.Backoff,
+		MaxBackoff:      delivery.DefaultPolicy.MaxBackoff,
+		DeadLetterTopic: "failed",
+	}
+	if policy != expected {
+		t.Errorf("Expected merged policy %+v, but got %+v", expected, policy)
+	}
+}
+
+// CAN RETRY AND DEAD-LETTER MESSAGES
+func TestHandle(t *testing.T) {
+	consumer, conn, store := newConsumer(t, delivery.Policy{MaxAttempts: 3, Backoff: time.Millisecond})
+	published := make(chan transport.Message, 1)
+	sub, err := conn.QueueSubscribe(consumer.DeadLetterTopic(), "test", func(m transport.Message) {
+		published <- m
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Drain(context.Background())
+
+	// handle returns how many attempts it took for a message to be acked,
+	// where fail decides whether an attempt fails
+	acker := testAcknowledger{settled: make(chan string, 1)}
+	handle := func(data string, fail func(attempt int) error) int {
+		attempts := 0
+		consumer.Handle(transport.Message{Subject: "acme.orders.Placed", Data: []byte(data), Acknowledger: acker}, func(transport.Message) error {
+			attempts++
+			return fail(attempts)
+		})
+		select {
+		case <-acker.settled:
+			return attempts
+		case <-time.After(time.Second):
+			t.Fatalf("Expected %s to be settled", data)
+			return 0
+		}
+	}
+
+	attempts := handle(`{"id":1}`, func(attempt int) error {
+		if attempt < 2 {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+	if attempts != 2 {
+		t.Fatalf("Expected the message to be handled after 2 attempts, but it took %d", attempts)
+	}
+
+	attempts = handle(`{"id":2}`, func(int) error {
+		return errors.New("unavailable")
+	})
+	if attempts != 3 {
+		t.Fatalf("Expected the message to be attempted 3 times, but it was attempted %d times", attempts)
+	}
+	select {
+	case m := <-published:
+		if m.Header[delivery.SubjectHeader] != "acme.orders.Placed" || m.Header[delivery.ErrorHeader] != "unavailable" {
+			t.Errorf("Expected the dead letter to carry its subject and error, but got %v", m.Header)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the dead letter to be published on %s", consumer.DeadLetterTopic())
+	}
+
+	attempts = handle(`{`, func(int) error {
+		return delivery.Permanent(errors.New("invalid message"))
+	})
+	if attempts != 1 {
+		t.Fatalf("Expected a permanent error to not be retried, but the message was attempted %d times", attempts)
+	}
+
+	letters, err := store.List(context.Background(), "acme.shop.notify")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 2 {
+		t.Fatalf("Expected 2 dead letters, but got %d", len(letters))
+	}
+	if string(letters[0].Data) != `{"id":2}` || letters[0].Attempts != 3 || letters[0].Error != "unavailable" {
+		t.Errorf("Expected the first dead letter to be the exhausted message, but got %+v", letters[0])
+	}
+	if letters[1].Error != "invalid message" || letters[1].Attempts != 1 {
+		t.Errorf("Expected the second dead letter to be the invalid message, but got %+v", letters[1])
+	}
+}
+
+// CAN REPLAY DEAD LETTERS
+func TestReplay(t *testing.T) {
+	consumer, conn, store := newConsumer(t, delivery.Policy{MaxAttempts: 1})
+	fail := true
+	handled := make([]string, 0)
+	handler := func(m transport.Message) error {
+		handled = append(handled, m.Subject)
+		if fail {
+			return errors.New("unavailable")
+		}
+		return nil
+	}
+	sub, err := conn.QueueSubscribe(consumer.Name, consumer.Name, func(m transport.Message) {
+		consumer.Handle(m, handler)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Drain(context.Background())
+
+	consumer.Handle(transport.Message{Subject: "acme.orders.Placed", Data: []byte(`{"id":1}`)}, handler)
+	letters, err := store.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 {
+		t.Fatalf("Expected 1 dead letter, but got %d", len(letters))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := delivery.Replay(ctx, conn, letters[0]); err == nil || err.Error() != "unavailable" {
+		t.Errorf("Expected replaying to fail with the handler's error, but got %v", err)
+	}
+	fail = false
+	if err := delivery.Replay(ctx, conn, letters[0]); err != nil {
+		t.Errorf("Expected replaying to succeed, but got %s", err)
+	}
+	if len(handled) != 3 || handled[2] != "acme.orders.Placed" {
+		t.Errorf("Expected replays to be handled with their original subject, but got %v", handled)
+	}
+	letters, err = store.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 {
+		t.Errorf("Expected a replay that failed again to not be dead-lettered twice, but got %d dead letters", len(letters))
+	}
+
+	unknown := delivery.DeadLetter{Consumer: "acme.shop.missing", Subject: "acme.orders.Placed"}
+	if err := delivery.Replay(ctx, conn, unknown); err == nil || err.Error() != "acme.shop.missing isn't running" {
+		t.Errorf("Expected replaying to a consumer that isn't running to fail, but got %v", err)
+	}
+}
+
+// CAN REMOVE DEAD LETTERS
+func TestStoreDelete(t *testing.T) {
+	_, _, store := newConsumer(t, delivery.DefaultPolicy)
+	letter, err := store.Add(context.Background(), delivery.DeadLetter{Consumer: "acme.shop.notify", Subject: "acme.orders.Placed", Data: []byte(`{}`), FailedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(context.Background(), letter.ID); err != nil {
+		t.Fatal(err)
+	}
+	letters, err := store.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 0 {
+		t.Errorf("Expected no dead letters after deleting, but got %d", len(letters))
+	}
+}
+
+type testAcknowledger struct {
+	settled chan string
+}
+
+func (a testAcknowledger) Ack() error {
+	a.settled <- "ack"
+	return nil
+}
+func (a testAcknowledger) Nak() error {
+	a.settled <- "nak"
+	return nil
+}
+func (a testAcknowledger) InProgress() error {
+	return nil
+}
+
+// CAN SETTLE DURABLE MESSAGES
+func TestHandleDurable(t *testing.T) {
+	consumer, _, store := newConsumer(t, delivery.Policy{MaxAttempts: 2, Backoff: time.Millisecond})
+	acker := testAcknowledger{settled: make(chan string, 1)}
+	message := transport.Message{Subject: "acme.orders.Placed", Data: []byte(`{}`), Acknowledger: acker}
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"handled", nil, "ack"},
+		{"dead-lettered", errors.New("unavailable"), "ack"},
+	}
+	for _, test := range tests {
+		consumer.Handle(message, func(transport.Message) error {
+			return test.err
+		})
+		if settled := <-acker.settled; settled != test.expected {
+			t.Errorf("Expected a message that was %s to %s, but it got %s", test.name, test.expected, settled)
+		}
+	}
+
+	// closing while a message waits to be retried leaves it to be delivered
+	// again instead of dead-lettering it
+	consumer.Policy.Backoff = time.Minute
+	consumer.Handle(message, func(transport.Message) error {
+		return errors.New("unavailable")
+	})
+	consumer.Close()
+	if settled := <-acker.settled; settled != "nak" {
+		t.Errorf("Expected a message that was waiting when the consumer closed to nak, but it got %s", settled)
+	}
+	letters, err := store.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 {
+		t.Errorf("Expected only the exhausted message to be dead-lettered, but got %d dead letters", len(letters))
+	}
+}
+
+// CAN HANDLE OTHER MESSAGES WHILE ONE WAITS TO BE RETRIED
+func TestHandleWhileRetrying(t *testing.T) {
+	consumer, _, store := newConsumer(t, delivery.Policy{MaxAttempts: 2, Backoff: time.Minute})
+	handled := make(chan string, 2)
+	handler := func(m transport.Message) error {
+		handled <- string(m.Data)
+		if string(m.Data) == "slow" {
+			return errors.New("unavailable")
+		}
+		return nil
+	}
+	returned := make(chan struct{})
+	go func() {
+		consumer.Handle(transport.Message{Subject: "acme.orders.Placed", Data: []byte("slow")}, handler)
+		consumer.Handle(transport.Message{Subject: "acme.orders.Placed", Data: []byte("fast")}, handler)
+		close(returned)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("Expected handling to not wait for a retry")
+	}
+	if first, second := <-handled, <-handled; first != "slow" || second != "fast" {
+		t.Errorf("Expected both messages to be handled, but got %s and %s", first, second)
+	}
+
+	// the message that was waiting is dead-lettered once the consumer closes
+	consumer.Close()
+	letters, err := store.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || string(letters[0].Data) != "slow" || letters[0].Attempts != 1 {
+		t.Errorf("Expected the waiting message to be dead-lettered after 1 attempt, but got %+v", letters)
+	}
+}
+
+// CAN KEEP TOKENS OUT OF DEAD LETTERS
+func TestDeadLetterHeader(t *testing.T) {
+	consumer, conn, store := newConsumer(t, delivery.Policy{MaxAttempts: 1})
+	published := make(chan transport.Message, 1)
+	sub, err := conn.QueueSubscribe(consumer.DeadLetterTopic(), "test", func(m transport.Message) {
+		published <- m
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Drain(context.Background())
+
+	header := transport.Header{auth.Header: "secret-token", "Trace-Id": "abc"}
+	consumer.Handle(transport.Message{Subject: "acme.orders.Placed", Header: header, Data: []byte(`{}`)}, func(transport.Message) error {
+		return errors.New("unavailable")
+	})
+	select {
+	case m := <-published:
+		if _, ok := m.Header[auth.Header]; ok || m.Header["Trace-Id"] != "abc" {
+			t.Errorf("Expected the published dead letter to carry everything but the token, but got %v", m.Header)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected the dead letter to be published on %s", consumer.DeadLetterTopic())
+	}
+	letters, err := store.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 {
+		t.Fatalf("Expected 1 dead letter, but got %d", len(letters))
+	}
+	if _, ok := letters[0].Header[auth.Header]; ok || letters[0].Header["Trace-Id"] != "abc" {
+		t.Errorf("Expected the stored dead letter to carry everything but the token, but got %v", letters[0].Header)
+	}
+	if header[auth.Header] != "secret-token" {
+		t.Errorf("Expected the message's own header to be left alone")
+	}
+}
@@ -0,0 +1,106 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/hntrl/hyper/src/runtime//storage"
+	"github.com/hntrl/hyper/src/runtime//transport"
+)
+
+// DeadLetter is a message a consumer gave up on
+type DeadLetter struct {
+	ID       string           `json:"-"`
+	Consumer string           `json:"consumer"`
+	Subject  string           `json:"subject"`
+	Header   transport.Header `json:"header,omitempty"`
+	Data     []byte           `json:"-"`
+	Error    string           `json:"error"`
+	Attempts int              `json:"attempts"`
+	FailedAt time.Time        `json:"failedAt"`
+}
+
+// Store keeps dead letters in a collection of a storage driver, so they can be
+// inspected and replayed by another process.
+type Store struct {
+	collection storage.Collection
+}
+
+// NewStore returns the dead letter store kept by driver
+func NewStore(ctx context.Context, driver storage.Driver) (*Store, error) {
+	collection, err := driver.Collection(ctx, "hyper", "dead_letters")
+	if err != nil {
+		return nil, err
+	}
+	return &Store{collection: collection}, nil
+}
+
+// Add stores letter and returns it with its ID
+func (s *Store) Add(ctx context.Context, letter DeadLetter) (DeadLetter, error) {
+	bytes, err := json.Marshal(letter)
+	if err != nil {
+		return letter, err
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(bytes, &data); err != nil {
+		return letter, err
+	}
+	// the data of a message is JSON, and keeping it as text makes it
+	// readable in the underlying storage
+	data["data"] = string(letter.Data)
+	data["failedAt"] = letter.FailedAt
+	record, err := s.collection.Insert(ctx, data)
+	if err != nil {
+		return letter, err
+	}
+	letter.ID = record.ID
+	return letter, nil
+}
+
+// List returns the dead letters of consumer (or every consumer if it's
+// empty), oldest first
+func (s *Store) List(ctx context.Context, consumer string) ([]DeadLetter, error) {
+	filter := storage.Filter{}
+	if consumer != "" {
+		filter["consumer"] = consumer
+	}
+	records, err := s.collection.Find(ctx, filter, storage.FindOptions{})
+	if err != nil {
+		return nil, err
+	}
+	letters := make([]DeadLetter, 0, len(records))
+	for _, record := range records {
+		letter, err := deadLetterFromRecord(record)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, letter)
+	}
+	sort.SliceStable(letters, func(i, j int) bool {
+		return letters[i].FailedAt.Before(letters[j].FailedAt)
+	})
+	return letters, nil
+}
+
+// Delete removes the dead letter with id
+func (s *Store) Delete(ctx context.Context, id string) error {
+	return s.collection.Delete(ctx, id)
+}
+
+func deadLetterFromRecord(record storage.Record) (DeadLetter, error) {
+	var letter DeadLetter
+	bytes, err := json.Marshal(record.Data)
+	if err != nil {
+		return letter, err
+	}
+	if err := json.Unmarshal(bytes, &letter); err != nil {
+		return letter, err
+	}
+	letter.ID = record.ID
+	if data, ok := record.Data["data"].(string); ok {
+		letter.Data = []byte(data)
+	}
+	return letter, nil
+}
@@ -1,7 +1,12 @@
 package runtime
 
-// RuntimeNode represents anything that requires shared resources to function
+import "context"
+
+// RuntimeNode represents anything that requires shared resources to function.
+// Nodes are detached in the reverse order they were attached in, and should
+// stop taking on new work and wait for the work they've already started to
+// finish when they're detached, unless ctx is done first.
 type RuntimeNode interface {
-	Attach(*Process) error
-	Detach() error
+	Attach(context.Context, *Process) error
+	Detach(context.Context) error
 }
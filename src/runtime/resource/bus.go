@@ -0,0 +1,227 @@
+package resource
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/hntrl/hyper/src/runtime//transport"
+)
+
+// Bus is a transport that passes messages between the contexts running in the
+// same program without a broker. Buses configured with the same URL are
+// connected to each other, so separate processes in one program can talk to
+// each other.
+type Bus struct {
+	Config Config
+	bus    *bus
+}
+
+var (
+	busesMu sync.Mutex
+	buses   = make(map[string]*bus)
+)
+
+func (b Bus) Attach(ctx context.Context) (Resource, error) {
+	busesMu.Lock()
+	defer busesMu.Unlock()
+	if buses[b.Config.URL] == nil {
+		buses[b.Config.URL] = &bus{name: b.Config.URL, groups: make(map[string]int)}
+	}
+	b.bus = buses[b.Config.URL]
+	b.bus.attached++
+	return b, nil
+}
+func (b Bus) Detach(ctx context.Context) error {
+	busesMu.Lock()
+	defer busesMu.Unlock()
+	b.bus.attached--
+	if b.bus.attached == 0 {
+		delete(buses, b.bus.name)
+	}
+	return nil
+}
+
+func (b Bus) Publish(ctx context.Context, msg transport.Message) error {
+	msg.Responder = nil
+	b.bus.deliver(msg)
+	return nil
+}
+
+func (b Bus) Request(ctx context.Context, msg transport.Message) (transport.Message, error) {
+	replies := make(chan transport.Message, 1)
+	msg.Responder = func(reply transport.Message) error {
+		select {
+		case replies <- reply:
+		default:
+			// another subscriber already replied
+		}
+		return nil
+	}
+	if !b.bus.deliver(msg) {
+		return transport.Message{}, transport.ErrNoResponders
+	}
+	select {
+	case reply := <-replies:
+		return reply, nil
+	case <-ctx.Done():
+		return transport.Message{}, ctx.Err()
+	}
+}
+
+func (b Bus) QueueSubscribe(subject string, queue string, handler transport.Handler) (transport.Subscription, error) {
+	sub := &busSubscription{
+		bus:     b.bus,
+		subject: subject,
+		queue:   queue,
+		handler: handler,
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	b.bus.mu.Lock()
+	b.bus.subs = append(b.bus.subs, sub)
+	b.bus.mu.Unlock()
+	go sub.run()
+	return sub, nil
+}
+
+type bus struct {
+	name     string
+	attached int
+
+	mu   sync.Mutex
+	subs []*busSubscription
+	// groups keeps the index of the subscriber that was last given a message
+	// for each queue, so messages are spread between them
+	groups map[string]int
+}
+
+// deliver gives msg to every matching subscriber that isn't in a queue and to
+// one subscriber in each queue. It reports if anything was subscribed.
+func (b *bus) deliver(msg transport.Message) bool {
+	msg.Data = append([]byte(nil), msg.Data...)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	queues := make(map[string][]*busSubscription)
+	queueNames := make([]string, 0)
+	delivered := false
+	for _, sub := range b.subs {
+		if !matchSubject(sub.subject, msg.Subject) {
+			continue
+		}
+		delivered = true
+		if sub.queue == "" {
+			sub.push(msg)
+			continue
+		}
+		if queues[sub.queue] == nil {
+			queueNames = append(queueNames, sub.queue)
+		}
+		queues[sub.queue] = append(queues[sub.queue], sub)
+	}
+	for _, name := range queueNames {
+		members := queues[name]
+		key := msg.Subject + " " + name
+		idx := (b.groups[key] + 1) % len(members)
+		b.groups[key] = idx
+		members[idx].push(msg)
+	}
+	return delivered
+}
+
+func (b *bus) remove(sub *busSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for idx, existing := range b.subs {
+		if existing == sub {
+			b.subs = append(b.subs[:idx], b.subs[idx+1:]...)
+			return
+		}
+	}
+}
+
+// matchSubject reports if subject matches pattern, where subjects are period
+// delimited tokens and patterns can use * to match one token and > to match
+// the rest of them (like NATS subjects)
+func matchSubject(pattern string, subject string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	subjectTokens := strings.Split(subject, ".")
+	for idx, token := range patternTokens {
+		if token == ">" {
+			return len(subjectTokens) > idx
+		}
+		if idx >= len(subjectTokens) || (token != "*" && token != subjectTokens[idx]) {
+			return false
+		}
+	}
+	return len(patternTokens) == len(subjectTokens)
+}
+
+// busSubscription handles the messages it's given one at a time, in the order
+// they were delivered in, without holding up whoever sent them
+type busSubscription struct {
+	bus     *bus
+	subject string
+	queue   string
+	handler transport.Handler
+
+	mu       sync.Mutex
+	pending  []transport.Message
+	draining bool
+	stopped  bool
+	notify   chan struct{}
+	done     chan struct{}
+}
+
+func (sub *busSubscription) push(msg transport.Message) {
+	sub.mu.Lock()
+	sub.pending = append(sub.pending, msg)
+	sub.mu.Unlock()
+	sub.wake()
+}
+
+func (sub *busSubscription) wake() {
+	select {
+	case sub.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (sub *busSubscription) run() {
+	defer close(sub.done)
+	for {
+		sub.mu.Lock()
+		if sub.stopped || (sub.draining && len(sub.pending) == 0) {
+			sub.mu.Unlock()
+			return
+		}
+		if len(sub.pending) == 0 {
+			sub.mu.Unlock()
+			<-sub.notify
+			continue
+		}
+		msg := sub.pending[0]
+		sub.pending = sub.pending[1:]
+		sub.mu.Unlock()
+		sub.handler(msg)
+	}
+}
+
+func (sub *busSubscription) Drain(ctx context.Context) error {
+	sub.bus.remove(sub)
+	sub.mu.Lock()
+	sub.draining = true
+	sub.mu.Unlock()
+	sub.wake()
+	select {
+	case <-sub.done:
+		return nil
+	case <-ctx.Done():
+		sub.mu.Lock()
+		sub.stopped = true
+		sub.pending = nil
+		sub.mu.Unlock()
+		sub.wake()
+		return ctx.Err()
+	}
+}
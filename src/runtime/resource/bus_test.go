@@ -0,0 +1,138 @@
+package resource
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hntrl/hyper/src/runtime//transport"
+)
+
+func attachBus(t *testing.T, name string) Bus {
+	res, err := Bus{Config: Config{URL: name}}.Attach(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Detach(context.Background()) })
+	return res.(Bus)
+}
+
+// CAN MATCH SUBJECTS
+func TestMatchSubject(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		subject  string
+		expected bool
+	}{
+		{"acme.orders.Placed", "acme.orders.Placed", true},
+		{"acme.orders.Placed", "acme.orders.Cancelled", false},
+		{"acme.*.Placed", "acme.orders.Placed", true},
+		{"acme.*", "acme.orders.Placed", false},
+		{"acme.>", "acme.orders.Placed", true},
+		{"acme.>", "acme", false},
+	}
+	for _, test := range tests {
+		if matched := matchSubject(test.pattern, test.subject); matched != test.expected {
+			t.Errorf("Expected %s matching %s to be %t", test.pattern, test.subject, test.expected)
+		}
+	}
+}
+
+// CAN DELIVER MESSAGES BETWEEN BUSES
+func TestBusQueues(t *testing.T) {
+	ctx := context.Background()
+	publisher := attachBus(t, "TestBusQueues")
+	subscriber := attachBus(t, "TestBusQueues")
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	received := make(map[string]int)
+	handler := func(name string) transport.Handler {
+		return func(msg transport.Message) {
+			mu.Lock()
+			received[name]++
+			mu.Unlock()
+			wg.Done()
+		}
+	}
+	subscriber.QueueSubscribe("orders.Placed", "workers", handler("worker1"))
+	subscriber.QueueSubscribe("orders.Placed", "workers", handler("worker2"))
+	subscriber.QueueSubscribe("orders.*", "", handler("audit"))
+
+	// each message goes to one worker and the audit subscriber
+	wg.Add(8)
+	for idx := 0; idx < 4; idx++ {
+		if err := publisher.Publish(ctx, transport.Message{Subject: "orders.Placed"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if received["worker1"] != 2 || received["worker2"] != 2 || received["audit"] != 4 {
+		t.Errorf("Expected messages to be split between workers and all given to audit, but got %v", received)
+	}
+	other := attachBus(t, "TestBusQueues-other")
+	if _, err := other.Request(ctx, transport.Message{Subject: "orders.Placed"}); err != transport.ErrNoResponders {
+		t.Errorf("Expected buses with different names to not be connected, but got %v", err)
+	}
+}
+
+// CAN REQUEST AND REPLY
+func TestBusRequest(t *testing.T) {
+	ctx := context.Background()
+	bus := attachBus(t, "TestBusRequest")
+	bus.QueueSubscribe("math.Double", "handlers", func(msg transport.Message) {
+		msg.RespondMsg(transport.Message{Data: append(msg.Data, msg.Data...), Header: msg.Header})
+	})
+	reply, err := bus.Request(ctx, transport.Message{
+		Subject: "math.Double",
+		Header:  transport.Header{"id": "1"},
+		Data:    []byte("ab"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply.Data) != "abab" || reply.Header["id"] != "1" {
+		t.Errorf("Expected abab with the request's header, but got %+v", reply)
+	}
+	if _, err := bus.Request(ctx, transport.Message{Subject: "math.Triple"}); err != transport.ErrNoResponders {
+		t.Errorf("Expected ErrNoResponders, but got %v", err)
+	}
+	if err := (transport.Message{}).Respond(nil); err != transport.ErrNoReply {
+		t.Errorf("Expected responding to a published message to fail, but got %v", err)
+	}
+}
+
+// CAN DRAIN SUBSCRIPTIONS
+func TestBusDrain(t *testing.T) {
+	ctx := context.Background()
+	bus := attachBus(t, "TestBusDrain")
+	release := make(chan struct{})
+	sub, _ := bus.QueueSubscribe("slow", "", func(msg transport.Message) {
+		<-release
+	})
+	bus.Publish(ctx, transport.Message{Subject: "slow"})
+	bus.Publish(ctx, transport.Message{Subject: "slow"})
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	go func() {
+		<-timeoutCtx.Done()
+		close(release)
+	}()
+	if err := sub.Drain(timeoutCtx); err != context.DeadlineExceeded {
+		t.Errorf("Expected draining to give up at the deadline, but got %v", err)
+	}
+	if err := bus.Publish(ctx, transport.Message{Subject: "slow"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bus.Request(ctx, transport.Message{Subject: "slow"}); err != transport.ErrNoResponders {
+		t.Errorf("Expected a drained subscription to not receive messages, but got %v", err)
+	}
+
+	sub, _ = bus.QueueSubscribe("fast", "", func(msg transport.Message) {})
+	bus.Publish(ctx, transport.Message{Subject: "fast"})
+	if err := sub.Drain(ctx); err != nil {
+		t.Errorf("Expected draining to finish, but got %v", err)
+	}
+}
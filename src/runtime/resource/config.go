@@ -0,0 +1,460 @@
+package resource
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/hntrl/hyper/src/runtime//audit"
+	"github.com/hntrl/hyper/src/runtime//auth"
+	"github.com/hntrl/hyper/src/runtime//delivery"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of a single named resource. Which of the
+// options are used depends on the type of the resource.
+type Config struct {
+	Type     string        `yaml:"type"`
+	URL      string        `yaml:"url"`
+	Path     string        `yaml:"path"`
+	Username string        `yaml:"username"`
+	Password string        `yaml:"password"`
+	Timeout  time.Duration `yaml:"timeout"`
+	PoolSize uint64        `yaml:"poolSize"`
+	TLS      *TLSConfig    `yaml:"tls"`
+	// Embedded runs the server the resource connects to in the same process
+	// (for the resources that support it), listening on URL if it's set or on
+	// the default port of the server if it isn't. It's a pointer (like
+	// JetStream) so a profile can turn it off explicitly.
+	Embedded *bool `yaml:"embedded"`
+	// JetStream keeps the events published through a nats resource in
+	// JetStream streams, so they're delivered at least once even to
+	// consumers that weren't running when they were published. It's enabled
+	// on the embedded server too.
+	JetStream *bool  `yaml:"jetstream"`
+	DataDir   string `yaml:"dataDir"`
+}
+
+// enabled reports whether an option that can be left unset is turned on
+func enabled(option *bool) bool {
+	return option != nil && *option
+}
+
+// merge returns c with every option that's set in override replaced
+func (c Config) merge(override Config) Config {
+	if override.Type != "" {
+		c.Type = override.Type
+	}
+	if override.URL != "" {
+		c.URL = override.URL
+	}
+	if override.Path != "" {
+		c.Path = override.Path
+	}
+	if override.Username != "" {
+		c.Username = override.Username
+	}
+	if override.Password != "" {
+		c.Password = override.Password
+	}
+	if override.Timeout != 0 {
+		c.Timeout = override.Timeout
+	}
+	if override.PoolSize != 0 {
+		c.PoolSize = override.PoolSize
+	}
+	if override.TLS != nil {
+		c.TLS = override.TLS
+	}
+	if override.Embedded != nil {
+		c.Embedded = override.Embedded
+	}
+	if override.JetStream != nil {
+		c.JetStream = override.JetStream
+	}
+	if override.DataDir != "" {
+		c.DataDir = override.DataDir
+	}
+	return c
+}
+
+type TLSConfig struct {
+	CA                 string `yaml:"ca"`
+	Cert               string `yaml:"cert"`
+	Key                string `yaml:"key"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify"`
+}
+
+// Load reads the certificate files referenced by the configuration
+func (c TLSConfig) Load() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CA != "" {
+		pem, err := os.ReadFile(c.CA)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CA)
+		}
+	}
+	if c.Cert != "" || c.Key != "" {
+		cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// Configuration is the contents of a resource configuration file. Resources
+// are keyed by the name runtime nodes request them with, and profiles
+// override the options of those resources (or add new ones) per environment.
+type Configuration struct {
+	Resources map[string]Config `yaml:"resources"`
+	// Timeouts are how long requests to commands and queries wait for a
+	// reply, keyed by their topic (like acme.orders.PlaceOrder)
+	Timeouts map[string]time.Duration `yaml:"timeouts"`
+	// Retries are the retry policies of subscriptions and projections, keyed
+	// by their name (like acme.shop.notify) or "default" for all of them
+	Retries map[string]delivery.Policy `yaml:"retries"`
+	// Audit is where the authorization decisions made for messages are
+	// recorded. They aren't recorded without it.
+	Audit *audit.Config `yaml:"audit"`
+	// Auth is how the tokens in messages are verified and signed
+	Auth     *auth.Config       `yaml:"auth"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+type Profile struct {
+	Resources map[string]Config          `yaml:"resources"`
+	Timeouts  map[string]time.Duration   `yaml:"timeouts"`
+	Retries   map[string]delivery.Policy `yaml:"retries"`
+	// Audit replaces the audit configuration outside the profile entirely
+	Audit *audit.Config `yaml:"audit"`
+	// Auth replaces the auth configuration outside the profile entirely, so
+	// keys are never mixed between environments
+	Auth *auth.Config `yaml:"auth"`
+}
+
+// LoadConfiguration parses the YAML resource configuration file at path.
+// References to environment variables (like ${MONGO_PASSWORD}) in string
+// options are expanded after the file is parsed, so secrets don't have to be
+// kept in it. They're only replaced with the value of the variable, so the
+// value can't change the structure of the file, and a $ that isn't followed
+// by a name in braces (like in a password) is kept as it is.
+func LoadConfiguration(path string) (*Configuration, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config Configuration
+	if err := yaml.Unmarshal(raw, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	expandEnv(reflect.ValueOf(&config).Elem())
+	dir := filepath.Dir(path)
+	for name, resource := range config.Resources {
+		if resource.Type == "" {
+			return nil, fmt.Errorf("%s: resource %s has no type", path, name)
+		}
+		config.Resources[name] = resource.resolvePaths(dir)
+	}
+	if err := checkTimeouts(config.Timeouts); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := checkRetries(config.Retries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := checkAuth(config.Auth, dir); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := checkAudit(config.Audit, dir); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, profile := range config.Profiles {
+		for name, resource := range profile.Resources {
+			profile.Resources[name] = resource.resolvePaths(dir)
+		}
+		if err := checkTimeouts(profile.Timeouts); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := checkRetries(profile.Retries); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := checkAuth(profile.Auth, dir); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if err := checkAudit(profile.Audit, dir); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return &config, nil
+}
+
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the references to environment variables in the strings
+// of v (and of the structs, pointers, slices and map values in it)
+func expandEnv(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.String:
+		if v.CanSet() {
+			v.SetString(envReference.ReplaceAllStringFunc(v.String(), func(ref string) string {
+				return os.Getenv(ref[2 : len(ref)-1])
+			}))
+		}
+	case reflect.Pointer:
+		if !v.IsNil() {
+			expandEnv(v.Elem())
+		}
+	case reflect.Struct:
+		for idx := 0; idx < v.NumField(); idx++ {
+			if v.Type().Field(idx).IsExported() {
+				expandEnv(v.Field(idx))
+			}
+		}
+	case reflect.Slice:
+		for idx := 0; idx < v.Len(); idx++ {
+			expandEnv(v.Index(idx))
+		}
+	case reflect.Map:
+		// map values can't be changed in place, so they're copied, expanded
+		// and put back
+		iter := v.MapRange()
+		for iter.Next() {
+			value := reflect.New(iter.Value().Type()).Elem()
+			value.Set(iter.Value())
+			expandEnv(value)
+			v.SetMapIndex(iter.Key(), value)
+		}
+	}
+}
+
+func checkTimeouts(timeouts map[string]time.Duration) error {
+	for topic, timeout := range timeouts {
+		if timeout <= 0 {
+			return fmt.Errorf("timeout for %s must be greater than 0", topic)
+		}
+	}
+	return nil
+}
+
+func checkRetries(policies map[string]delivery.Policy) error {
+	for name, policy := range policies {
+		if err := policy.Check(); err != nil {
+			return fmt.Errorf("retry policy for %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// checkAuth checks config (if there is one) and makes the key files in it that
+// are relative to dir absolute
+func checkAuth(config *auth.Config, dir string) error {
+	if config == nil {
+		return nil
+	}
+	if err := config.Check(); err != nil {
+		return fmt.Errorf("auth: %w", err)
+	}
+	for _, path := range []*string{&config.VerifyKey, &config.SigningKey} {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(dir, *path)
+		}
+	}
+	return nil
+}
+
+// checkAudit checks config (if there is one) and makes the file in it absolute
+// if it's relative to dir
+func checkAudit(config *audit.Config, dir string) error {
+	if config == nil {
+		return nil
+	}
+	if err := config.Check(); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	if !filepath.IsAbs(config.File) {
+		config.File = filepath.Join(dir, config.File)
+	}
+	return nil
+}
+
+// resolvePaths makes the file paths in c that are relative to dir absolute
+func (c Config) resolvePaths(dir string) Config {
+	resolve := func(path string) string {
+		if path == "" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	c.Path = resolve(c.Path)
+	c.DataDir = resolve(c.DataDir)
+	if c.TLS != nil {
+		tlsConfig := *c.TLS
+		tlsConfig.CA = resolve(tlsConfig.CA)
+		tlsConfig.Cert = resolve(tlsConfig.Cert)
+		tlsConfig.Key = resolve(tlsConfig.Key)
+		c.TLS = &tlsConfig
+	}
+	return c
+}
+
+// Profile returns the resources configured for the named profile. An empty
+// name selects the resources without any profile applied.
+func (c Configuration) Profile(profile string) (map[string]Config, error) {
+	resources := make(map[string]Config)
+	for name, resource := range c.Resources {
+		resources[name] = resource
+	}
+	if profile == "" {
+		return resources, nil
+	}
+	overrides, ok := c.Profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %s (expected one of %v)", profile, c.profileNames())
+	}
+	for name, override := range overrides.Resources {
+		resources[name] = resources[name].merge(override)
+		if resources[name].Type == "" {
+			return nil, fmt.Errorf("resource %s in profile %s has no type", name, profile)
+		}
+	}
+	return resources, nil
+}
+
+// RequestTimeouts returns the request timeouts configured for the named
+// profile. An empty profile name returns the timeouts without any profile
+// applied.
+func (c Configuration) RequestTimeouts(profile string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for topic, timeout := range c.Timeouts {
+		timeouts[topic] = timeout
+	}
+	if profile == "" {
+		return timeouts, nil
+	}
+	overrides, ok := c.Profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %s (expected one of %v)", profile, c.profileNames())
+	}
+	for topic, timeout := range overrides.Timeouts {
+		timeouts[topic] = timeout
+	}
+	return timeouts, nil
+}
+
+// RetryPolicies returns the retry policies configured for the named profile.
+// Policies in the profile are merged onto the ones they override. An empty
+// profile name returns the policies without any profile applied.
+func (c Configuration) RetryPolicies(profile string) (map[string]delivery.Policy, error) {
+	policies := make(map[string]delivery.Policy)
+	for name, policy := range c.Retries {
+		policies[name] = policy
+	}
+	if profile == "" {
+		return policies, nil
+	}
+	overrides, ok := c.Profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %s (expected one of %v)", profile, c.profileNames())
+	}
+	for name, override := range overrides.Retries {
+		policies[name] = policies[name].Merge(override)
+	}
+	return policies, nil
+}
+
+// AuthConfig returns the auth configuration for the named profile, or nil if
+// there isn't one. An empty profile name returns the configuration without
+// any profile applied.
+func (c Configuration) AuthConfig(profile string) (*auth.Config, error) {
+	if profile == "" {
+		return c.Auth, nil
+	}
+	overrides, ok := c.Profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %s (expected one of %v)", profile, c.profileNames())
+	}
+	if overrides.Auth != nil {
+		return overrides.Auth, nil
+	}
+	return c.Auth, nil
+}
+
+// AuditConfig returns the audit configuration for the named profile, or nil
+// if there isn't one. An empty profile name returns the configuration without
+// any profile applied.
+func (c Configuration) AuditConfig(profile string) (*audit.Config, error) {
+	if profile == "" {
+		return c.Audit, nil
+	}
+	overrides, ok := c.Profiles[profile]
+	if !ok {
+		return nil, fmt.Errorf("unknown profile %s (expected one of %v)", profile, c.profileNames())
+	}
+	if overrides.Audit != nil {
+		return overrides.Audit, nil
+	}
+	return c.Audit, nil
+}
+
+func (c Configuration) profileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultConfig is the configuration used for resources that aren't in a
+// configuration file. It's read from the environment variables that were used
+// before resources could be configured.
+func DefaultConfig() map[string]Config {
+	return map[string]Config{
+		"stream": {Type: "nats", URL: os.Getenv("NATS_URL")},
+		"state": {
+			Type:     "mongo",
+			URL:      os.Getenv("MONGO_URL"),
+			Username: os.Getenv("MONGO_USER"),
+			Password: os.Getenv("MONGO_PASSWORD"),
+		},
+	}
+}
+
+// Factory creates the (unattached) resource described by config
+type Factory func(config Config) (Resource, error)
+
+// DefaultFactories returns the factories for the resource types that are
+// built in.
+func DefaultFactories() map[string]Factory {
+	return map[string]Factory{
+		"nats": func(config Config) (Resource, error) {
+			return NatsConnection{Config: config}, nil
+		},
+		"mongo": func(config Config) (Resource, error) {
+			return MongoConnection{Config: config}, nil
+		},
+		"bus": func(config Config) (Resource, error) {
+			return Bus{Config: config}, nil
+		},
+		"memory": func(config Config) (Resource, error) {
+			return MemoryStore{Config: config}, nil
+		},
+		"file": func(config Config) (Resource, error) {
+			if config.Path == "" {
+				return nil, fmt.Errorf("file resources need a path")
+			}
+			return FileStore{Config: config}, nil
+		},
+	}
+}
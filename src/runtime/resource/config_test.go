@@ -0,0 +1,300 @@
+package resource
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testConfig = `resources:
+  stream:
+    type: nats
+    url: nats://localhost:4222
+  state:
+    type: mongo
+    url: mongodb://localhost:27017
+    password: ${TEST_MONGO_PASSWORD}
+    timeout: 5s
+timeouts:
+  acme.orders.PlaceOrder: 10s
+  acme.orders.ListOrders: 2s
+retries:
+  default:
+    maxAttempts: 3
+  acme.shop.notify:
+    backoff: 1s
+    deadLetterTopic: failed.notify
+profiles:
+  production:
+    timeouts:
+      acme.orders.PlaceOrder: 30s
+    retries:
+      acme.shop.notify:
+        maxAttempts: 10
+    resources:
+      state:
+        url: mongodb://db.internal:27017
+        poolSize: 50
+        tls:
+          ca: /etc/ssl/ca.pem
+  edge:
+    resources:
+      state:
+        type: file
+        path: ./state.db
+`
+
+func loadTestConfig(t *testing.T, content string) (*Configuration, error) {
+	path := filepath.Join(t.TempDir(), "hyper.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadConfiguration(path)
+}
+
+// CAN LOAD A CONFIGURATION FILE
+func TestLoadConfiguration(t *testing.T) {
+	t.Setenv("TEST_MONGO_PASSWORD", "hunter2")
+	config, err := loadTestConfig(t, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := config.Resources["state"]
+	if state.Type != "mongo" || state.Password != "hunter2" || state.Timeout != 5*time.Second {
+		t.Errorf("Expected state to be a mongo resource with an expanded password and a timeout, but got %+v", state)
+	}
+	if _, err := loadTestConfig(t, "resources:\n  stream:\n    url: nats://localhost\n"); err == nil {
+		t.Errorf("Expected a resource without a type to fail")
+	}
+}
+
+// CAN EXPAND ENVIRONMENT VARIABLES IN STRING OPTIONS
+func TestConfigurationEnv(t *testing.T) {
+	t.Setenv("TEST_MONGO_PASSWORD", "hunter2\n    type: file")
+	t.Setenv("TEST_DEAD_LETTERS", "failed")
+	config, err := loadTestConfig(t, `resources:
+  state:
+    type: mongo
+    username: $USER
+    password: p4$$${TEST_MONGO_PASSWORD}
+retries:
+  acme.shop.notify:
+    deadLetterTopic: ${TEST_DEAD_LETTERS}.notify
+profiles:
+  production:
+    resources:
+      state:
+        url: mongodb://${TEST_UNSET_HOST}:27017
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := config.Resources["state"]
+	// the value of a variable can't add options, and a $ that isn't followed
+	// by a name in braces is kept
+	if state.Type != "mongo" || state.Username != "$USER" || state.Password != "p4$$hunter2\n    type: file" {
+		t.Errorf("Expected only the reference to be replaced with the variable, but got %+v", state)
+	}
+	if topic := config.Retries["acme.shop.notify"].DeadLetterTopic; topic != "failed.notify" {
+		t.Errorf("Expected variables to be expanded in map values, but got %s", topic)
+	}
+	if url := config.Profiles["production"].Resources["state"].URL; url != "mongodb://:27017" {
+		t.Errorf("Expected variables to be expanded in profiles, and unset ones to be empty, but got %s", url)
+	}
+}
+
+// CAN APPLY PROFILES
+func TestProfile(t *testing.T) {
+	config, err := loadTestConfig(t, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources, err := config.Profile("production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := resources["state"]
+	if state.URL != "mongodb://db.internal:27017" || state.PoolSize != 50 || state.TLS == nil || state.TLS.CA != "/etc/ssl/ca.pem" {
+		t.Errorf("Expected the production options to be applied to state, but got %+v", state)
+	}
+	if state.Type != "mongo" || state.Timeout != 5*time.Second {
+		t.Errorf("Expected the options production doesn't set to be kept, but got %+v", state)
+	}
+	if resources["stream"].URL != "nats://localhost:4222" {
+		t.Errorf("Expected stream to be unaffected by the profile, but got %+v", resources["stream"])
+	}
+	if config.Resources["state"].URL != "mongodb://localhost:27017" {
+		t.Errorf("Expected applying a profile to not change the configuration")
+	}
+	edge, err := config.Profile("edge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path := edge["state"].Path; !filepath.IsAbs(path) || filepath.Base(path) != "state.db" {
+		t.Errorf("Expected the path of state to be resolved next to the configuration file, but got %s", path)
+	}
+	if _, err := config.Profile("staging"); err == nil {
+		t.Errorf("Expected an unknown profile to fail")
+	}
+}
+
+func boolOption(value bool) *bool {
+	return &value
+}
+
+// CAN TURN OPTIONS OFF IN PROFILES
+func TestProfileDisablesOptions(t *testing.T) {
+	config, err := loadTestConfig(t, `resources:
+  stream:
+    type: nats
+    embedded: true
+    jetstream: true
+profiles:
+  production:
+    resources:
+      stream:
+        url: nats://broker.internal:4222
+        embedded: false
+  staging:
+    resources:
+      stream:
+        url: nats://staging.internal:4222
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		profile   string
+		embedded  bool
+		jetStream bool
+	}{
+		{"", true, true},
+		{"production", false, true},
+		{"staging", true, true},
+	}
+	for _, test := range tests {
+		resources := config.Resources
+		if test.profile != "" {
+			if resources, err = config.Profile(test.profile); err != nil {
+				t.Fatal(err)
+			}
+		}
+		stream := resources["stream"]
+		if enabled(stream.Embedded) != test.embedded || enabled(stream.JetStream) != test.jetStream {
+			t.Errorf("Expected stream in %q to have embedded=%t and jetstream=%t, but got %+v", test.profile, test.embedded, test.jetStream, stream)
+		}
+	}
+}
+
+// CAN APPLY PROFILES TO REQUEST TIMEOUTS
+func TestRequestTimeouts(t *testing.T) {
+	config, err := loadTestConfig(t, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timeouts, err := config.RequestTimeouts("production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeouts["acme.orders.PlaceOrder"] != 30*time.Second || timeouts["acme.orders.ListOrders"] != 2*time.Second {
+		t.Errorf("Expected the production timeouts to override the ones it sets, but got %v", timeouts)
+	}
+	if config.Timeouts["acme.orders.PlaceOrder"] != 10*time.Second {
+		t.Errorf("Expected applying a profile to not change the configuration")
+	}
+	if _, err := loadTestConfig(t, "timeouts:\n  acme.orders.PlaceOrder: 0s\n"); err == nil {
+		t.Errorf("Expected a timeout that isn't greater than 0 to fail")
+	}
+}
+
+// CAN CONFIGURE RETRY POLICIES
+func TestRetryPolicies(t *testing.T) {
+	config, err := loadTestConfig(t, testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies, err := config.RetryPolicies("production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notify := policies["acme.shop.notify"]
+	if notify.MaxAttempts != 10 || notify.Backoff != time.Second || notify.DeadLetterTopic != "failed.notify" {
+		t.Errorf("Expected the production policy to be merged onto the one it overrides, but got %+v", notify)
+	}
+	if policies["default"].MaxAttempts != 3 {
+		t.Errorf("Expected the default policy to be kept, but got %+v", policies["default"])
+	}
+	if config.Retries["acme.shop.notify"].MaxAttempts != 0 {
+		t.Errorf("Expected applying a profile to not change the configuration")
+	}
+	if _, err := loadTestConfig(t, "retries:\n  default:\n    backoff: -1s\n"); err == nil {
+		t.Errorf("Expected a negative backoff to fail")
+	}
+}
+
+// CAN CONFIGURE AUTH
+func TestAuthConfig(t *testing.T) {
+	config, err := loadTestConfig(t, `auth:
+  algorithm: EdDSA
+  verifyKey: keys/public.pem
+profiles:
+  production:
+    auth:
+      algorithm: HS256
+      verifyKey: /etc/hyper/secret
+      signingKey: /etc/hyper/secret
+      subject: acme.shop
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := config.AuthConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filepath.IsAbs(base.VerifyKey) || filepath.Base(base.VerifyKey) != "public.pem" {
+		t.Errorf("Expected the verify key to be resolved relative to the configuration file, but got %s", base.VerifyKey)
+	}
+	production, err := config.AuthConfig("production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if production.Algorithm != "HS256" || production.VerifyKey != "/etc/hyper/secret" {
+		t.Errorf("Expected the production profile to replace the auth configuration, but got %+v", production)
+	}
+	if _, err := loadTestConfig(t, "auth:\n  algorithm: RS256\n"); err == nil {
+		t.Errorf("Expected an unknown algorithm to fail")
+	}
+}
+
+// CAN CONFIGURE THE AUDIT SINK PER PROFILE
+func TestAuditConfig(t *testing.T) {
+	config, err := loadTestConfig(t, `audit:
+  file: audit/decisions.jsonl
+profiles:
+  production:
+    audit:
+      file: /var/log/hyper/decisions.jsonl
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := config.AuditConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !filepath.IsAbs(base.File) || filepath.Base(base.File) != "decisions.jsonl" {
+		t.Errorf("Expected the audit file to be resolved relative to the configuration file, but got %s", base.File)
+	}
+	production, err := config.AuditConfig("production")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if production.File != "/var/log/hyper/decisions.jsonl" {
+		t.Errorf("Expected the production profile to replace the audit configuration, but got %+v", production)
+	}
+	if _, err := loadTestConfig(t, "audit: {}\n"); err == nil {
+		t.Errorf("Expected an audit configuration without a file to fail")
+	}
+}
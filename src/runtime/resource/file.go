@@ -0,0 +1,461 @@
+package resource
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hntrl/hyper/src/runtime//storage"
+)
+
+// FileStore is a storage driver that keeps everything in a single file, for
+// deployments that are too small to warrant a database. Every change is
+// appended to the file and synced to disk before it's acknowledged, and the
+// file is replayed into memory when the store is attached.
+//
+// Each line of the file is a checksum followed by a JSON encoded operation. A
+// line that was only partially written (like when the process crashed while
+// writing it) is dropped when the file is replayed, and the file is rewritten
+// with only the current state so it doesn't grow without bound. A write that
+// fails is cut off the end of the file again, so it can't corrupt the writes
+// that come after it.
+//
+// Only one process can use the file at a time. The store creates a lock file
+// next to it when it's attached and removes it when it's detached, and
+// attaching fails while the lock file exists.
+type FileStore struct {
+	Config Config
+	memory MemoryStore
+	file   *fileLog
+}
+
+type fileOperation struct {
+	Op        string                 `json:"op"`
+	Key       string                 `json:"key"`
+	ID        string                 `json:"id"`
+	EntityID  string                 `json:"entityId,omitempty"`
+	Timestamp *time.Time             `json:"timestamp,omitempty"`
+	Effect    string                 `json:"effect,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+}
+
+const (
+	fileOpAppend = "append"
+	fileOpUpsert = "upsert"
+	fileOpDelete = "delete"
+)
+
+func appendOperation(key string, event storage.Event) fileOperation {
+	return fileOperation{
+		Op:        fileOpAppend,
+		Key:       key,
+		ID:        event.ID,
+		EntityID:  event.EntityID,
+		Timestamp: &event.Timestamp,
+		Effect:    event.Effect,
+		Data:      event.State,
+	}
+}
+
+func (op fileOperation) event() storage.Event {
+	event := storage.Event{
+		ID:       op.ID,
+		EntityID: op.EntityID,
+		Effect:   op.Effect,
+		State:    op.Data,
+	}
+	if op.Timestamp != nil {
+		event.Timestamp = *op.Timestamp
+	}
+	return event
+}
+
+func (fs FileStore) Attach(ctx context.Context) (res Resource, err error) {
+	if err := fs.lock(); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(fs.lockPath())
+		}
+	}()
+	memory, err := MemoryStore{}.Attach(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fs.memory = memory.(MemoryStore)
+	if err := fs.replay(); err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", fs.Config.Path, err)
+	}
+	if err := fs.compact(); err != nil {
+		return nil, fmt.Errorf("cannot write %s: %w", fs.Config.Path, err)
+	}
+	file, err := os.OpenFile(fs.Config.Path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	fs.file = &fileLog{file: file, size: info.Size()}
+	return fs, nil
+}
+func (fs FileStore) Detach(ctx context.Context) error {
+	memoryErr := fs.memory.Detach(ctx)
+	fileErr := fs.file.close()
+	if err := os.Remove(fs.lockPath()); err != nil && fileErr == nil {
+		fileErr = err
+	}
+	if fileErr != nil {
+		return fileErr
+	}
+	return memoryErr
+}
+
+func (fs FileStore) lockPath() string {
+	return fs.Config.Path + ".lock"
+}
+
+// lock creates the lock file, or fails if another process already has
+func (fs FileStore) lock() error {
+	file, err := os.OpenFile(fs.lockPath(), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%s is in use by another process (remove %s if it isn't)", fs.Config.Path, fs.lockPath())
+		}
+		return err
+	}
+	_, err = fmt.Fprintf(file, "%d\n", os.Getpid())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(fs.lockPath())
+	}
+	return err
+}
+
+func (fs FileStore) EventLog(ctx context.Context, namespace string, name string) (storage.EventLog, error) {
+	key := namespace + "." + name
+	return fileEventLog{log: fs.memory.state.eventLog(key), file: fs.file, key: key}, nil
+}
+
+func (fs FileStore) Collection(ctx context.Context, namespace string, name string) (storage.Collection, error) {
+	key := namespace + "." + name
+	return fileCollection{coll: fs.memory.state.collection(key), file: fs.file, key: key}, nil
+}
+
+// replay applies the operations in the file to the memory store
+func (fs FileStore) replay() error {
+	file, err := os.Open(fs.Config.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+	ctx := context.Background()
+	state := fs.memory.state
+	reader := bufio.NewReader(file)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// anything after the last newline was only partially written
+			break
+		}
+		if err != nil {
+			return err
+		}
+		op, err := decodeFileOperation(line)
+		if err != nil {
+			if _, peekErr := reader.Peek(1); peekErr == io.EOF {
+				// only the last line can be corrupt from being interrupted
+				break
+			}
+			return fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if id, err := strconv.Atoi(op.ID); err == nil && id > state.lastID {
+			state.lastID = id
+		}
+		switch op.Op {
+		case fileOpAppend:
+			state.eventLog(op.Key).add(op.event())
+		case fileOpUpsert:
+			state.collection(op.Key).Upsert(ctx, storage.Record{ID: op.ID, Data: op.Data})
+		case fileOpDelete:
+			state.collection(op.Key).Delete(ctx, op.ID)
+		default:
+			return fmt.Errorf("line %d: unknown operation %s", lineNumber, op.Op)
+		}
+	}
+	return nil
+}
+
+// compact replaces the file with one that only has the operations needed to
+// recreate what's in the memory store. The new file is written next to the
+// old one and renamed over it, so the file is never left half written.
+func (fs FileStore) compact() error {
+	ctx := context.Background()
+	state := fs.memory.state
+	tmpPath := fs.Config.Path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	writer := bufio.NewWriter(file)
+	write := func(op fileOperation) error {
+		line, err := encodeFileOperation(op)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(line)
+		return err
+	}
+
+	ops := make([]fileOperation, 0)
+	for _, key := range sortedKeys(state.eventLogs) {
+		events, _ := state.eventLogs[key].Events(ctx, "")
+		for _, event := range events {
+			ops = append(ops, appendOperation(key, event))
+		}
+	}
+	for _, key := range sortedKeys(state.collections) {
+		records, _ := state.collections[key].Find(ctx, storage.Filter{}, storage.FindOptions{})
+		for _, record := range records {
+			ops = append(ops, fileOperation{Op: fileOpUpsert, Key: key, ID: record.ID, Data: record.Data})
+		}
+	}
+	for _, op := range ops {
+		if err := write(op); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, fs.Config.Path); err != nil {
+		return err
+	}
+	// sync the directory so the rename itself is durable
+	dir, err := os.Open(filepath.Dir(fs.Config.Path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	dir.Sync()
+	return nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// encodeFileOperation formats op as a line of the file. Times aren't
+// preserved by JSON, so they're tagged and turned back into times when the
+// line is decoded.
+func encodeFileOperation(op fileOperation) ([]byte, error) {
+	op.Data = copyDocument(op.Data)
+	tagTimes(op.Data)
+	encoded, err := json.Marshal(op)
+	if err != nil {
+		return nil, err
+	}
+	line := fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(encoded), encoded)
+	return []byte(line), nil
+}
+
+func decodeFileOperation(line []byte) (fileOperation, error) {
+	var op fileOperation
+	line = bytes.TrimSuffix(line, []byte("\n"))
+	checksum, encoded, ok := bytes.Cut(line, []byte(" "))
+	if !ok {
+		return op, fmt.Errorf("malformed operation")
+	}
+	if fmt.Sprintf("%08x", crc32.ChecksumIEEE(encoded)) != string(checksum) {
+		return op, fmt.Errorf("checksum mismatch")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	if err := decoder.Decode(&op); err != nil {
+		return op, err
+	}
+	untagTimes(op.Data)
+	return op, nil
+}
+
+const timeTag = "$time"
+
+func tagTimes(document map[string]interface{}) {
+	for key, value := range document {
+		document[key] = tagTime(value)
+	}
+}
+
+// tagTime returns value with the times in it (including the ones in nested
+// objects and lists) replaced by tagged objects
+func tagTime(value interface{}) interface{} {
+	switch v := value.(type) {
+	case time.Time:
+		return map[string]interface{}{timeTag: v.Format(time.RFC3339Nano)}
+	case map[string]interface{}:
+		tagTimes(v)
+	case []interface{}:
+		for idx, item := range v {
+			v[idx] = tagTime(item)
+		}
+	}
+	return value
+}
+
+func untagTimes(document map[string]interface{}) {
+	for key, value := range document {
+		document[key] = untagTime(value)
+	}
+}
+
+// untagTime returns value with the tagged objects in it turned back into times
+func untagTime(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if raw, ok := v[timeTag].(string); ok && len(v) == 1 {
+			if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+				return t
+			}
+		}
+		untagTimes(v)
+	case []interface{}:
+		for idx, item := range v {
+			v[idx] = untagTime(item)
+		}
+	}
+	return value
+}
+
+// logFile is what a fileLog writes to, which is an *os.File outside of tests
+type logFile interface {
+	io.WriteCloser
+	Sync() error
+	Truncate(size int64) error
+}
+
+// fileLog is the file operations are appended to
+type fileLog struct {
+	mu   sync.Mutex
+	file logFile
+	// size is how much of the file was written by operations that succeeded
+	size int64
+	// broken is set if a failed write couldn't be cut off the file, after
+	// which nothing else can be written to it
+	broken error
+}
+
+// write appends op to the file and waits for it to be synced to disk, and then
+// calls apply to make the same change in memory. Both happen under one lock, so
+// changes are made in memory in the same order they're written to the file. If
+// op can't be written, whatever was written of it is cut off the file again.
+func (f *fileLog) write(op fileOperation, apply func() error) error {
+	line, err := encodeFileOperation(op)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.broken != nil {
+		return fmt.Errorf("the file can't be written to after a failed write: %w", f.broken)
+	}
+	_, err = f.file.Write(line)
+	if err == nil {
+		err = f.file.Sync()
+	}
+	if err != nil {
+		if truncateErr := f.file.Truncate(f.size); truncateErr != nil {
+			f.broken = truncateErr
+		}
+		return err
+	}
+	f.size += int64(len(line))
+	return apply()
+}
+
+func (f *fileLog) close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+type fileEventLog struct {
+	log  *memoryEventLog
+	file *fileLog
+	key  string
+}
+
+func (l fileEventLog) Append(ctx context.Context, event storage.Event) (storage.Event, error) {
+	event.ID = l.log.store.nextID()
+	var added storage.Event
+	err := l.file.write(appendOperation(l.key, event), func() error {
+		added = l.log.add(event)
+		return nil
+	})
+	return added, err
+}
+func (l fileEventLog) Events(ctx context.Context, entityID string) ([]storage.Event, error) {
+	return l.log.Events(ctx, entityID)
+}
+func (l fileEventLog) Subscribe(ctx context.Context) (storage.EventStream, error) {
+	return l.log.Subscribe(ctx)
+}
+
+type fileCollection struct {
+	coll *memoryCollection
+	file *fileLog
+	key  string
+}
+
+func (c fileCollection) Find(ctx context.Context, filter storage.Filter, options storage.FindOptions) ([]storage.Record, error) {
+	return c.coll.Find(ctx, filter, options)
+}
+func (c fileCollection) FindOne(ctx context.Context, filter storage.Filter, options storage.FindOptions) (storage.Record, error) {
+	return c.coll.FindOne(ctx, filter, options)
+}
+func (c fileCollection) Insert(ctx context.Context, data map[string]interface{}) (storage.Record, error) {
+	record := storage.Record{ID: c.coll.store.nextID(), Data: data}
+	return record, c.Upsert(ctx, record)
+}
+func (c fileCollection) Upsert(ctx context.Context, record storage.Record) error {
+	return c.file.write(fileOperation{Op: fileOpUpsert, Key: c.key, ID: record.ID, Data: record.Data}, func() error {
+		return c.coll.Upsert(ctx, record)
+	})
+}
+func (c fileCollection) Delete(ctx context.Context, id string) error {
+	return c.file.write(fileOperation{Op: fileOpDelete, Key: c.key, ID: id}, func() error {
+		return c.coll.Delete(ctx, id)
+	})
+}
@@ -0,0 +1,226 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hntrl/hyper/src/runtime//storage"
+)
+
+func attachFileStore(t *testing.T, path string) FileStore {
+	res, err := FileStore{Config: Config{Path: path}}.Attach(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.(FileStore)
+}
+
+// CAN REPLAY THE FILE WHEN ATTACHED
+func TestFileStoreReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.db")
+	created := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	store := attachFileStore(t, path)
+	log, _ := store.EventLog(ctx, "app", "Todo_events")
+	coll, _ := store.Collection(ctx, "app", "Todo_projection")
+	if _, err := log.Append(ctx, storage.Event{EntityID: "a", Timestamp: created, Effect: "CREATE", State: map[string]interface{}{"title": "a"}}); err != nil {
+		t.Fatal(err)
+	}
+	kept, _ := coll.Insert(ctx, map[string]interface{}{"entity_id": "a", "created_at": created})
+	removed, _ := coll.Insert(ctx, map[string]interface{}{"entity_id": "b"})
+	coll.Upsert(ctx, storage.Record{ID: kept.ID, Data: map[string]interface{}{
+		"entity_id":  "a",
+		"created_at": created,
+		"count":      2,
+		"history":    []interface{}{created, map[string]interface{}{"at": created}},
+	}})
+	coll.Delete(ctx, removed.ID)
+	if err := store.Detach(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	store = attachFileStore(t, path)
+	defer store.Detach(ctx)
+	log, _ = store.EventLog(ctx, "app", "Todo_events")
+	coll, _ = store.Collection(ctx, "app", "Todo_projection")
+	events, _ := log.Events(ctx, "")
+	if len(events) != 1 || !events[0].Timestamp.Equal(created) || events[0].State["title"] != "a" {
+		t.Errorf("Expected the event to be replayed, but got %+v", events)
+	}
+	records, _ := coll.Find(ctx, storage.Filter{}, storage.FindOptions{})
+	if len(records) != 1 || records[0].ID != kept.ID {
+		t.Fatalf("Expected only %s to be replayed, but got %+v", kept.ID, records)
+	}
+	if createdAt, ok := records[0].Data["created_at"].(time.Time); !ok || !createdAt.Equal(created) {
+		t.Errorf("Expected created_at to be replayed as a time, but got %#v", records[0].Data["created_at"])
+	}
+	history, _ := records[0].Data["history"].([]interface{})
+	if len(history) != 2 {
+		t.Fatalf("Expected history to be replayed as a list, but got %#v", records[0].Data["history"])
+	}
+	if at, ok := history[0].(time.Time); !ok || !at.Equal(created) {
+		t.Errorf("Expected a time in a list to be replayed as a time, but got %#v", history[0])
+	}
+	if object, _ := history[1].(map[string]interface{}); object == nil {
+		t.Errorf("Expected an object in a list to be replayed as an object, but got %#v", history[1])
+	} else if at, ok := object["at"].(time.Time); !ok || !at.Equal(created) {
+		t.Errorf("Expected a time in an object in a list to be replayed as a time, but got %#v", object["at"])
+	}
+	if found, err := coll.FindOne(ctx, storage.Filter{"count": 2}, storage.FindOptions{}); err != nil || found.ID != kept.ID {
+		t.Errorf("Expected the updated record to be found, but got %+v (%v)", found, err)
+	}
+	inserted, _ := coll.Insert(ctx, map[string]interface{}{})
+	insertedID, _ := strconv.Atoi(inserted.ID)
+	removedID, _ := strconv.Atoi(removed.ID)
+	if insertedID <= removedID {
+		t.Errorf("Expected ids to keep increasing after being replayed, but got %d after %d", insertedID, removedID)
+	}
+}
+
+// CAN RECOVER FROM INTERRUPTED WRITES
+func TestFileStoreRecovery(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.db")
+	store := attachFileStore(t, path)
+	coll, _ := store.Collection(ctx, "app", "Todo_projection")
+	coll.Insert(ctx, map[string]interface{}{"title": "a"})
+	store.Detach(ctx)
+
+	intact, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		content   string
+		expectErr bool
+	}{
+		{"partial line", string(intact) + `1234abcd {"op":"ups`, false},
+		{"corrupt last line", string(intact) + "1234abcd {}\n", false},
+		{"corrupt line before the last", "1234abcd {}\n" + string(intact), true},
+	}
+	for _, test := range tests {
+		if err := os.WriteFile(path, []byte(test.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		res, err := FileStore{Config: Config{Path: path}}.Attach(ctx)
+		if test.expectErr {
+			if err == nil {
+				t.Errorf("Expected replaying a file with a %s to fail", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Expected replaying a file with a %s to succeed, but got %s", test.name, err.Error())
+			continue
+		}
+		store := res.(FileStore)
+		coll, _ := store.Collection(ctx, "app", "Todo_projection")
+		if records, _ := coll.Find(ctx, storage.Filter{}, storage.FindOptions{}); len(records) != 1 {
+			t.Errorf("Expected the intact record to be replayed with a %s, but got %+v", test.name, records)
+		}
+		store.Detach(ctx)
+		if content, _ := os.ReadFile(path); string(content) != string(intact) {
+			t.Errorf("Expected the %s to be compacted away, but got %q", test.name, content)
+		}
+	}
+}
+
+// CAN REPLAY CONCURRENT WRITES IN THE ORDER THEY WERE MADE IN MEMORY
+func TestFileStoreConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.db")
+	store := attachFileStore(t, path)
+	coll, _ := store.Collection(ctx, "app", "Todo_projection")
+	record, _ := coll.Insert(ctx, map[string]interface{}{"count": 0})
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 50; i++ {
+		wg.Add(1)
+		go func(count int) {
+			defer wg.Done()
+			coll.Upsert(ctx, storage.Record{ID: record.ID, Data: map[string]interface{}{"count": count}})
+		}(i)
+	}
+	wg.Wait()
+	inMemory, _ := coll.FindOne(ctx, storage.Filter{}, storage.FindOptions{})
+	store.Detach(ctx)
+
+	store = attachFileStore(t, path)
+	defer store.Detach(ctx)
+	coll, _ = store.Collection(ctx, "app", "Todo_projection")
+	replayed, _ := coll.FindOne(ctx, storage.Filter{}, storage.FindOptions{})
+	if fmt.Sprint(replayed.Data["count"]) != fmt.Sprint(inMemory.Data["count"]) {
+		t.Errorf("Expected the last write in memory (%v) to be the one replayed, but got %v", inMemory.Data["count"], replayed.Data["count"])
+	}
+}
+
+// failingFile writes only half of what it's given and fails once fail is set
+type failingFile struct {
+	*os.File
+	fail bool
+}
+
+func (f *failingFile) Write(p []byte) (int, error) {
+	if f.fail {
+		f.fail = false
+		n, _ := f.File.Write(p[:len(p)/2])
+		return n, errors.New("no space left on device")
+	}
+	return f.File.Write(p)
+}
+
+// CAN KEEP A FAILED WRITE FROM CORRUPTING THE WRITES AFTER IT
+func TestFileStoreFailedWrite(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.db")
+	store := attachFileStore(t, path)
+	file := &failingFile{File: store.file.file.(*os.File)}
+	store.file.file = file
+	coll, _ := store.Collection(ctx, "app", "Todo_projection")
+	coll.Insert(ctx, map[string]interface{}{"title": "a"})
+	file.fail = true
+	if _, err := coll.Insert(ctx, map[string]interface{}{"title": "b"}); err == nil {
+		t.Fatal("Expected the failed write to return an error")
+	}
+	coll.Insert(ctx, map[string]interface{}{"title": "c"})
+	store.Detach(ctx)
+
+	store = attachFileStore(t, path)
+	defer store.Detach(ctx)
+	coll, _ = store.Collection(ctx, "app", "Todo_projection")
+	records, _ := coll.Find(ctx, storage.Filter{}, storage.FindOptions{})
+	titles := make([]string, len(records))
+	for idx, record := range records {
+		titles[idx] = fmt.Sprint(record.Data["title"])
+	}
+	sort.Strings(titles)
+	if strings.Join(titles, ",") != "a,c" {
+		t.Errorf("Expected the writes around the failed one to be replayed, but got %v", titles)
+	}
+}
+
+// CAN KEEP ANOTHER PROCESS FROM USING THE FILE
+func TestFileStoreLock(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "state.db")
+	store := attachFileStore(t, path)
+	if _, err := (FileStore{Config: Config{Path: path}}).Attach(ctx); err == nil || !strings.Contains(err.Error(), "in use by another process") {
+		t.Errorf("Expected attaching a file that's in use to fail, but got %v", err)
+	}
+	if err := store.Detach(ctx); err != nil {
+		t.Fatal(err)
+	}
+	store = attachFileStore(t, path)
+	store.Detach(ctx)
+}
@@ -0,0 +1,150 @@
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/hntrl/hyper/src/runtime//transport"
+	"github.com/nats-io/nats.go"
+)
+
+// JetStreamConnection is a NATS connection that keeps what's published
+// durably in JetStream streams. It's what a nats resource attaches as when
+// JetStream is enabled in its configuration.
+//
+// Messages are kept under their subject prefixed with the stream they're in
+// (like acme.orders.Placed is kept as _HYPER.stream.acme_orders.acme.orders.Placed),
+// so each stream keeps every subject under its prefix from when it's created
+// and never has to be changed to keep another one. The prefix is taken off
+// again before messages are handled.
+type JetStreamConnection struct {
+	NatsConnection
+	js      nats.JetStreamContext
+	streams *jetStreamStreams
+}
+
+// jetStreamStreams remembers the streams that are known to exist, so they're
+// only looked up once
+type jetStreamStreams struct {
+	mu    sync.Mutex
+	known map[string]bool
+}
+
+func newJetStreamConnection(conn NatsConnection) (JetStreamConnection, error) {
+	js, err := conn.Client.JetStream()
+	if err != nil {
+		return JetStreamConnection{}, err
+	}
+	return JetStreamConnection{
+		NatsConnection: conn,
+		js:             js,
+		streams:        &jetStreamStreams{known: make(map[string]bool)},
+	}, nil
+}
+
+// jetStreamPrefix returns the prefix of the subjects kept in the named stream
+func jetStreamPrefix(stream string) string {
+	return "_HYPER.stream." + stream + "."
+}
+
+// ensureStream creates the named stream if it doesn't exist
+func (conn JetStreamConnection) ensureStream(stream string) error {
+	conn.streams.mu.Lock()
+	defer conn.streams.mu.Unlock()
+	if conn.streams.known[stream] {
+		return nil
+	}
+	subject := jetStreamPrefix(stream) + ">"
+	_, err := conn.js.AddStream(&nats.StreamConfig{
+		Name:     stream,
+		Subjects: []string{subject},
+		Storage:  nats.FileStorage,
+	})
+	if errors.Is(err, nats.ErrStreamNameAlreadyInUse) {
+		// it already exists (like when another process created it first), which
+		// is only a problem if it keeps other subjects
+		var info *nats.StreamInfo
+		info, err = conn.js.StreamInfo(stream)
+		if err == nil && (len(info.Config.Subjects) != 1 || info.Config.Subjects[0] != subject) {
+			err = fmt.Errorf("stream %s keeps %s instead of %s", stream, strings.Join(info.Config.Subjects, ", "), subject)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	conn.streams.known[stream] = true
+	return nil
+}
+
+func (conn JetStreamConnection) PublishDurable(ctx context.Context, stream string, msg transport.Message) error {
+	stream = jetStreamName(stream)
+	if err := conn.ensureStream(stream); err != nil {
+		return err
+	}
+	msg.Subject = jetStreamPrefix(stream) + msg.Subject
+	_, err := conn.js.PublishMsg(natsMsg(msg), nats.Context(ctx))
+	return err
+}
+
+func (conn JetStreamConnection) SubscribeDurable(stream string, subject string, name string, options transport.DurableOptions, handler transport.Handler) (transport.Subscription, error) {
+	stream, name = jetStreamName(stream), jetStreamName(name)
+	if err := conn.ensureStream(stream); err != nil {
+		return nil, err
+	}
+	prefix := jetStreamPrefix(stream)
+	// the consumer is created separately from the subscription so it isn't
+	// deleted when the subscription is drained
+	_, err := conn.js.ConsumerInfo(stream, name)
+	if errors.Is(err, nats.ErrConsumerNotFound) {
+		deliverPolicy := nats.DeliverNewPolicy
+		if options.DeliverAll {
+			deliverPolicy = nats.DeliverAllPolicy
+		}
+		_, err = conn.js.AddConsumer(stream, &nats.ConsumerConfig{
+			Durable:        name,
+			DeliverSubject: "_HYPER.deliver." + stream + "." + name,
+			DeliverGroup:   name,
+			DeliverPolicy:  deliverPolicy,
+			FilterSubject:  prefix + subject,
+			AckPolicy:      nats.AckExplicitPolicy,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	sub, err := conn.js.QueueSubscribe(prefix+subject, name, func(m *nats.Msg) {
+		msg := transportMessage(m)
+		msg.Subject = strings.TrimPrefix(msg.Subject, prefix)
+		// the reply subject of messages from a stream is where they're acked
+		msg.Responder = nil
+		msg.Acknowledger = jetStreamAcknowledger{m}
+		handler(msg)
+	}, nats.Bind(stream, name), nats.ManualAck())
+	if err != nil {
+		return nil, err
+	}
+	return natsSubscription{sub}, nil
+}
+
+// jetStreamName replaces the characters that aren't allowed in the names of
+// streams and consumers (like acme.orders becomes acme_orders)
+func jetStreamName(name string) string {
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_").Replace(name)
+}
+
+type jetStreamAcknowledger struct {
+	msg *nats.Msg
+}
+
+func (a jetStreamAcknowledger) Ack() error {
+	return a.msg.Ack()
+}
+func (a jetStreamAcknowledger) Nak() error {
+	return a.msg.Nak()
+}
+func (a jetStreamAcknowledger) InProgress() error {
+	return a.msg.InProgress()
+}
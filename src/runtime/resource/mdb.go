@@ -2,7 +2,6 @@ package resource
 
 import (
 	"context"
-	"os"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
@@ -11,21 +10,40 @@ import (
 
 type MongoConnection struct {
 	Client *mongo.Client
+	Config Config
 }
 
-func (conn MongoConnection) Attach() (Resource, error) {
-	url := os.Getenv("MONGO_URL")
+func (conn MongoConnection) Attach(ctx context.Context) (Resource, error) {
+	url := conn.Config.URL
+	if url == "" {
+		url = "mongodb://localhost:27017"
+	}
 	opts := options.Client().ApplyURI(url)
-	if os.Getenv("MONGO_PASSWORD") != "" {
+	if conn.Config.Password != "" {
 		// creds enabled
 		cred := options.Credential{
-			Username: os.Getenv("MONGO_USER"),
-			Password: os.Getenv("MONGO_PASSWORD"),
+			Username: conn.Config.Username,
+			Password: conn.Config.Password,
 		}
 		opts = opts.SetAuth(cred)
 	}
+	if conn.Config.PoolSize != 0 {
+		opts = opts.SetMaxPoolSize(conn.Config.PoolSize)
+	}
+	if conn.Config.TLS != nil {
+		tlsConfig, err := conn.Config.TLS.Load()
+		if err != nil {
+			return nil, err
+		}
+		opts = opts.SetTLSConfig(tlsConfig)
+	}
+	timeout := 10 * time.Second
+	if conn.Config.Timeout != 0 {
+		timeout = conn.Config.Timeout
+	}
+	opts = opts.SetConnectTimeout(timeout)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	client, err := mongo.Connect(ctx, opts)
@@ -35,11 +53,11 @@ func (conn MongoConnection) Attach() (Resource, error) {
 	conn.Client = client
 	return conn, nil
 }
-func (conn MongoConnection) Detach() error {
+func (conn MongoConnection) Detach(ctx context.Context) error {
 	if conn.Client == nil {
 		return nil
 	}
-	err := conn.Client.Disconnect(context.TODO())
+	err := conn.Client.Disconnect(ctx)
 	if err != nil {
 		return err
 	}
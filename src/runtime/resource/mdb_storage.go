@@ -0,0 +1,286 @@
+package resource
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hntrl/hyper/src/runtime//storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (conn MongoConnection) EventLog(ctx context.Context, namespace string, name string) (storage.EventLog, error) {
+	coll, err := conn.EnsureCollection(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return mongoEventLog{coll}, nil
+}
+
+func (conn MongoConnection) Collection(ctx context.Context, namespace string, name string) (storage.Collection, error) {
+	coll, err := conn.EnsureCollection(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return mongoCollection{coll}, nil
+}
+
+// mongoEvent is how entity events are stored in the event log collection
+type mongoEvent struct {
+	RecordID  *primitive.ObjectID `bson:"_id,omitempty"`
+	EntityID  string              `bson:"entity_id,omitempty"`
+	Timestamp time.Time           `bson:"timestamp,omitempty"`
+	// the field name is kept for compatibility with existing event logs
+	Effect string `bson:"esfect,omitempty"`
+	State  bson.M `bson:"state,omitempty"`
+}
+
+func (ev mongoEvent) event() (storage.Event, error) {
+	state, err := plainDocument(ev.State)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	event := storage.Event{
+		EntityID:  ev.EntityID,
+		Timestamp: ev.Timestamp,
+		Effect:    ev.Effect,
+		State:     state,
+	}
+	if ev.RecordID != nil {
+		event.ID = ev.RecordID.Hex()
+	}
+	return event, nil
+}
+
+type mongoEventLog struct {
+	coll *mongo.Collection
+}
+
+func (log mongoEventLog) Append(ctx context.Context, event storage.Event) (storage.Event, error) {
+	res, err := log.coll.InsertOne(ctx, mongoEvent{
+		EntityID:  event.EntityID,
+		Timestamp: event.Timestamp,
+		Effect:    event.Effect,
+		State:     bson.M(event.State),
+	})
+	if err != nil {
+		return storage.Event{}, err
+	}
+	event.ID = recordID(res.InsertedID)
+	return event, nil
+}
+
+func (log mongoEventLog) Events(ctx context.Context, entityID string) ([]storage.Event, error) {
+	filter := bson.M{}
+	if entityID != "" {
+		filter["entity_id"] = entityID
+	}
+	cursor, err := log.coll.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var results []mongoEvent
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+	events := make([]storage.Event, len(results))
+	for idx, result := range results {
+		if events[idx], err = result.event(); err != nil {
+			return nil, err
+		}
+	}
+	return events, nil
+}
+
+func (log mongoEventLog) Subscribe(ctx context.Context) (storage.EventStream, error) {
+	pipeline := mongo.Pipeline{
+		{{
+			Key:   "$match",
+			Value: bson.D{{Key: "operationType", Value: "insert"}},
+		}},
+	}
+	streamOptions := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	stream, err := log.coll.Watch(ctx, pipeline, streamOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &mongoEventStream{stream: stream}, nil
+}
+
+// mongoEventStream follows the inserts into an event log with a change stream,
+// which requires the database to be a replica set
+type mongoEventStream struct {
+	stream  *mongo.ChangeStream
+	current storage.Event
+	err     error
+}
+
+func (s *mongoEventStream) Next(ctx context.Context) bool {
+	if s.err != nil || !s.stream.Next(ctx) {
+		return false
+	}
+	var insert struct {
+		FullDocument mongoEvent `bson:"fullDocument"`
+	}
+	if err := s.stream.Decode(&insert); err != nil {
+		s.err = err
+		return false
+	}
+	s.current, s.err = insert.FullDocument.event()
+	return s.err == nil
+}
+func (s *mongoEventStream) Event() storage.Event {
+	return s.current
+}
+func (s *mongoEventStream) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.stream.Err()
+}
+func (s *mongoEventStream) Close(ctx context.Context) error {
+	return s.stream.Close(ctx)
+}
+
+type mongoCollection struct {
+	coll *mongo.Collection
+}
+
+func (c mongoCollection) Find(ctx context.Context, filter storage.Filter, opts storage.FindOptions) ([]storage.Record, error) {
+	findOptions := options.Find()
+	if opts.Skip != 0 {
+		findOptions = findOptions.SetSkip(opts.Skip)
+	}
+	if opts.Limit != 0 {
+		findOptions = findOptions.SetLimit(opts.Limit)
+	}
+	cursor, err := c.coll.Find(ctx, bson.M(filter), findOptions)
+	if err != nil {
+		return nil, err
+	}
+	var documents []bson.M
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, err
+	}
+	records := make([]storage.Record, len(documents))
+	for idx, document := range documents {
+		if records[idx], err = record(document); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+func (c mongoCollection) FindOne(ctx context.Context, filter storage.Filter, opts storage.FindOptions) (storage.Record, error) {
+	findOptions := options.FindOne()
+	if opts.Skip != 0 {
+		findOptions = findOptions.SetSkip(opts.Skip)
+	}
+	var document bson.M
+	err := c.coll.FindOne(ctx, bson.M(filter), findOptions).Decode(&document)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return storage.Record{}, storage.ErrNotFound
+		}
+		return storage.Record{}, err
+	}
+	return record(document)
+}
+
+func (c mongoCollection) Insert(ctx context.Context, data map[string]interface{}) (storage.Record, error) {
+	res, err := c.coll.InsertOne(ctx, bson.M(data))
+	if err != nil {
+		return storage.Record{}, err
+	}
+	return storage.Record{ID: recordID(res.InsertedID), Data: data}, nil
+}
+
+func (c mongoCollection) Upsert(ctx context.Context, record storage.Record) error {
+	_, err := c.coll.ReplaceOne(ctx, bson.M{"_id": objectID(record.ID)}, bson.M(record.Data), options.Replace().SetUpsert(true))
+	return err
+}
+
+func (c mongoCollection) Delete(ctx context.Context, id string) error {
+	_, err := c.coll.DeleteOne(ctx, bson.M{"_id": objectID(id)})
+	return err
+}
+
+// recordID formats the _id of a document as a string
+func recordID(id interface{}) string {
+	if oid, ok := id.(primitive.ObjectID); ok {
+		return oid.Hex()
+	}
+	return fmt.Sprint(id)
+}
+
+// objectID is the inverse of recordID
+func objectID(id string) interface{} {
+	if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+		return oid
+	}
+	return id
+}
+
+func record(document bson.M) (storage.Record, error) {
+	id := recordID(document["_id"])
+	delete(document, "_id")
+	data, err := plainDocument(document)
+	if err != nil {
+		return storage.Record{}, err
+	}
+	return storage.Record{ID: id, Data: data}, nil
+}
+
+// plainDocument converts a BSON document into plain values: nested documents
+// become maps, arrays become slices, dates become time.Time and object ids
+// become their hex string.
+func plainDocument(document bson.M) (map[string]interface{}, error) {
+	if document == nil {
+		return nil, nil
+	}
+	out, ok := plainValue(document).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot convert %T to a document", document)
+	}
+	return out, nil
+}
+
+func plainValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case bson.M:
+		return plainValue(map[string]interface{}(v))
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[key] = plainValue(value)
+		}
+		return out
+	case bson.D:
+		out := make(map[string]interface{}, len(v))
+		for _, elem := range v {
+			out[elem.Key] = plainValue(elem.Value)
+		}
+		return out
+	case bson.A:
+		return plainValue([]interface{}(v))
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for idx, value := range v {
+			out[idx] = plainValue(value)
+		}
+		return out
+	case int32:
+		return int64(v)
+	case primitive.DateTime:
+		return v.Time().UTC()
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.Decimal128:
+		return v.String()
+	default:
+		return v
+	}
+}
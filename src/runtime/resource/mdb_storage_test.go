@@ -0,0 +1,48 @@
+package resource
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CAN CONVERT DOCUMENTS TO PLAIN VALUES
+func TestPlainDocument(t *testing.T) {
+	oid := primitive.NewObjectID()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	document := bson.M{
+		"id":      oid,
+		"count":   int32(3),
+		"created": primitive.NewDateTimeFromTime(now),
+		"tags":    bson.A{"a", int32(1)},
+		"nested":  bson.D{{Key: "name", Value: "hyper"}},
+	}
+	expected := map[string]interface{}{
+		"id":      oid.Hex(),
+		"count":   int64(3),
+		"created": now,
+		"tags":    []interface{}{"a", int64(1)},
+		"nested":  map[string]interface{}{"name": "hyper"},
+	}
+	out, err := plainDocument(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, expected) {
+		t.Errorf("Expected %v, but got %v", expected, out)
+	}
+}
+
+// CAN ROUND TRIP RECORD IDS
+func TestRecordID(t *testing.T) {
+	oid := primitive.NewObjectID()
+	tests := []interface{}{oid, "123456789012"}
+	for _, id := range tests {
+		if out := objectID(recordID(id)); out != id {
+			t.Errorf("Expected %v to round trip, but got %v", id, out)
+		}
+	}
+}
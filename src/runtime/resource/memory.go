@@ -0,0 +1,341 @@
+package resource
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hntrl/hyper/src/runtime//storage"
+)
+
+// MemoryStore is a storage driver that keeps everything in memory, so state
+// can be used without a database (like in development and tests). Nothing is
+// kept once the process exits.
+type MemoryStore struct {
+	Config Config
+	state  *memoryState
+}
+
+type memoryState struct {
+	mu          sync.Mutex
+	lastID      int
+	eventLogs   map[string]*memoryEventLog
+	collections map[string]*memoryCollection
+}
+
+func (ms MemoryStore) Attach(ctx context.Context) (Resource, error) {
+	ms.state = &memoryState{
+		eventLogs:   make(map[string]*memoryEventLog),
+		collections: make(map[string]*memoryCollection),
+	}
+	return ms, nil
+}
+func (ms MemoryStore) Detach(ctx context.Context) error {
+	ms.state.mu.Lock()
+	defer ms.state.mu.Unlock()
+	for _, log := range ms.state.eventLogs {
+		log.closeStreams()
+	}
+	return nil
+}
+
+// nextID returns an id that's unique to the store
+func (s *memoryState) nextID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastID++
+	return strconv.Itoa(s.lastID)
+}
+
+func (ms MemoryStore) EventLog(ctx context.Context, namespace string, name string) (storage.EventLog, error) {
+	return ms.state.eventLog(namespace + "." + name), nil
+}
+
+func (ms MemoryStore) Collection(ctx context.Context, namespace string, name string) (storage.Collection, error) {
+	return ms.state.collection(namespace + "." + name), nil
+}
+
+func (s *memoryState) eventLog(key string) *memoryEventLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.eventLogs[key] == nil {
+		s.eventLogs[key] = &memoryEventLog{store: s}
+	}
+	return s.eventLogs[key]
+}
+
+func (s *memoryState) collection(key string) *memoryCollection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.collections[key] == nil {
+		s.collections[key] = &memoryCollection{
+			store:   s,
+			records: make(map[string]map[string]interface{}),
+		}
+	}
+	return s.collections[key]
+}
+
+type memoryEventLog struct {
+	store   *memoryState
+	mu      sync.Mutex
+	events  []storage.Event
+	streams []*memoryEventStream
+}
+
+func (log *memoryEventLog) Append(ctx context.Context, event storage.Event) (storage.Event, error) {
+	event.ID = log.store.nextID()
+	return log.add(event), nil
+}
+
+// add appends an event that already has an id
+func (log *memoryEventLog) add(event storage.Event) storage.Event {
+	event.State = copyDocument(event.State)
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.events = append(log.events, event)
+	for _, stream := range log.streams {
+		stream.push(event)
+	}
+	return event
+}
+
+func (log *memoryEventLog) Events(ctx context.Context, entityID string) ([]storage.Event, error) {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	events := make([]storage.Event, 0)
+	for _, event := range log.events {
+		if entityID == "" || event.EntityID == entityID {
+			event.State = copyDocument(event.State)
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (log *memoryEventLog) Subscribe(ctx context.Context) (storage.EventStream, error) {
+	stream := &memoryEventStream{
+		log:    log,
+		notify: make(chan struct{}, 1),
+		closed: make(chan struct{}),
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.streams = append(log.streams, stream)
+	return stream, nil
+}
+
+func (log *memoryEventLog) closeStreams() {
+	log.mu.Lock()
+	streams := log.streams
+	log.mu.Unlock()
+	for _, stream := range streams {
+		stream.Close(context.Background())
+	}
+}
+
+// memoryEventStream queues the events appended to a log until they're taken
+// with Next, so events appended while one is being handled aren't missed
+type memoryEventStream struct {
+	log       *memoryEventLog
+	mu        sync.Mutex
+	queue     []storage.Event
+	current   storage.Event
+	notify    chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (s *memoryEventStream) push(event storage.Event) {
+	s.mu.Lock()
+	s.queue = append(s.queue, event)
+	s.mu.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *memoryEventStream) Next(ctx context.Context) bool {
+	for {
+		select {
+		case <-s.closed:
+			return false
+		default:
+		}
+		s.mu.Lock()
+		if len(s.queue) > 0 {
+			s.current = s.queue[0]
+			s.current.State = copyDocument(s.current.State)
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+			return true
+		}
+		s.mu.Unlock()
+		select {
+		case <-s.notify:
+		case <-s.closed:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+func (s *memoryEventStream) Event() storage.Event {
+	return s.current
+}
+func (s *memoryEventStream) Err() error {
+	return nil
+}
+func (s *memoryEventStream) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+		s.log.mu.Lock()
+		defer s.log.mu.Unlock()
+		for idx, stream := range s.log.streams {
+			if stream == s {
+				s.log.streams = append(s.log.streams[:idx], s.log.streams[idx+1:]...)
+				break
+			}
+		}
+	})
+	return nil
+}
+
+type memoryCollection struct {
+	store *memoryState
+	mu    sync.Mutex
+	// order keeps the ids of the records in the order they were inserted in,
+	// so finding records is deterministic
+	order   []string
+	records map[string]map[string]interface{}
+}
+
+func (c *memoryCollection) Find(ctx context.Context, filter storage.Filter, options storage.FindOptions) ([]storage.Record, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	records := make([]storage.Record, 0)
+	skipped := int64(0)
+	for _, id := range c.order {
+		if options.Limit != 0 && int64(len(records)) >= options.Limit {
+			break
+		}
+		data := c.records[id]
+		if !matchesFilter(data, filter) {
+			continue
+		}
+		if skipped < options.Skip {
+			skipped++
+			continue
+		}
+		records = append(records, storage.Record{ID: id, Data: copyDocument(data)})
+	}
+	return records, nil
+}
+
+func (c *memoryCollection) FindOne(ctx context.Context, filter storage.Filter, options storage.FindOptions) (storage.Record, error) {
+	options.Limit = 1
+	records, err := c.Find(ctx, filter, options)
+	if err != nil {
+		return storage.Record{}, err
+	}
+	if len(records) == 0 {
+		return storage.Record{}, storage.ErrNotFound
+	}
+	return records[0], nil
+}
+
+func (c *memoryCollection) Insert(ctx context.Context, data map[string]interface{}) (storage.Record, error) {
+	record := storage.Record{ID: c.store.nextID(), Data: data}
+	return record, c.Upsert(ctx, record)
+}
+
+func (c *memoryCollection) Upsert(ctx context.Context, record storage.Record) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.records[record.ID]; !ok {
+		c.order = append(c.order, record.ID)
+	}
+	c.records[record.ID] = copyDocument(record.Data)
+	return nil
+}
+
+func (c *memoryCollection) Delete(ctx context.Context, id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.records[id]; !ok {
+		return nil
+	}
+	delete(c.records, id)
+	for idx, orderedID := range c.order {
+		if orderedID == id {
+			c.order = append(c.order[:idx], c.order[idx+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// matchesFilter reports if every field in filter is equal to the field at the
+// same path in data. Values are compared by their JSON encoding, so numbers
+// match regardless of the type they're stored as.
+func matchesFilter(data map[string]interface{}, filter storage.Filter) bool {
+	for path, expected := range filter {
+		var value interface{} = data
+		for _, key := range strings.Split(path, ".") {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				return false
+			}
+			if value, ok = object[key]; !ok {
+				return false
+			}
+		}
+		if !jsonEqual(value, expected) {
+			return false
+		}
+	}
+	return true
+}
+
+func jsonEqual(a, b interface{}) bool {
+	aBytes, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bBytes, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(aBytes) == string(bBytes)
+}
+
+// copyDocument deeply copies the maps and slices in document, so documents
+// held by the store can't be changed by whoever gave or was given them
+func copyDocument(document map[string]interface{}) map[string]interface{} {
+	if document == nil {
+		return nil
+	}
+	return copyValue(document).(map[string]interface{})
+}
+
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			out[key] = copyValue(value)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for idx, value := range v {
+			out[idx] = copyValue(value)
+		}
+		return out
+	default:
+		return v
+	}
+}
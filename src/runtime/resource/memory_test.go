@@ -0,0 +1,115 @@
+package resource
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hntrl/hyper/src/runtime//storage"
+)
+
+func attachMemoryStore(t *testing.T) MemoryStore {
+	res, err := MemoryStore{}.Attach(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.(MemoryStore)
+}
+
+// CAN STREAM APPENDED EVENTS
+func TestMemoryEventLog(t *testing.T) {
+	ctx := context.Background()
+	store := attachMemoryStore(t)
+	log, _ := store.EventLog(ctx, "app", "Todo_events")
+	if _, err := log.Append(ctx, storage.Event{EntityID: "a", Effect: "CREATE"}); err != nil {
+		t.Fatal(err)
+	}
+	stream, _ := log.Subscribe(ctx)
+	for _, entityID := range []string{"b", "a"} {
+		if _, err := log.Append(ctx, storage.Event{EntityID: entityID, Effect: "UPDATE"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, expected := range []string{"b", "a"} {
+		if !stream.Next(ctx) {
+			t.Fatalf("Expected an event for %s", expected)
+		}
+		if event := stream.Event(); event.EntityID != expected || event.ID == "" {
+			t.Errorf("Expected an event with an id for %s, but got %+v", expected, event)
+		}
+	}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if stream.Next(timeoutCtx) {
+		t.Errorf("Expected Next to stop waiting once its context is done")
+	}
+	if events, _ := log.Events(ctx, "a"); len(events) != 2 {
+		t.Errorf("Expected 2 events for a, but got %d", len(events))
+	}
+	store.Detach(ctx)
+	if stream.Next(ctx) {
+		t.Errorf("Expected Next to return false once the store is detached")
+	}
+}
+
+// CAN FIND RECORDS
+func TestMemoryCollection(t *testing.T) {
+	ctx := context.Background()
+	store := attachMemoryStore(t)
+	coll, _ := store.Collection(ctx, "app", "Todo_projection")
+	ids := make([]string, 0)
+	for idx, title := range []string{"a", "b", "a", "a"} {
+		record, err := coll.Insert(ctx, map[string]interface{}{
+			"state": map[string]interface{}{"title": title, "order": int64(idx)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, record.ID)
+	}
+	tests := []struct {
+		filter   storage.Filter
+		options  storage.FindOptions
+		expected []string
+	}{
+		{storage.Filter{}, storage.FindOptions{}, ids},
+		{storage.Filter{"state.title": "a"}, storage.FindOptions{}, []string{ids[0], ids[2], ids[3]}},
+		{storage.Filter{"state.title": "a"}, storage.FindOptions{Skip: 1, Limit: 1}, []string{ids[2]}},
+		{storage.Filter{"state.order": 1.0}, storage.FindOptions{}, []string{ids[1]}},
+		{storage.Filter{"state.missing": "a"}, storage.FindOptions{}, []string{}},
+	}
+	for _, test := range tests {
+		records, err := coll.Find(ctx, test.filter, test.options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := make([]string, len(records))
+		for idx, record := range records {
+			found[idx] = record.ID
+		}
+		if len(found) != len(test.expected) {
+			t.Errorf("Expected %v for %v, but got %v", test.expected, test.filter, found)
+			continue
+		}
+		for idx := range found {
+			if found[idx] != test.expected[idx] {
+				t.Errorf("Expected %v for %v, but got %v", test.expected, test.filter, found)
+				break
+			}
+		}
+	}
+
+	err := coll.Upsert(ctx, storage.Record{ID: ids[1], Data: map[string]interface{}{"state": map[string]interface{}{"title": "c"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record, err := coll.FindOne(ctx, storage.Filter{"state.title": "c"}, storage.FindOptions{}); err != nil || record.ID != ids[1] {
+		t.Errorf("Expected to find the updated record, but got %+v (%v)", record, err)
+	}
+	if err := coll.Delete(ctx, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := coll.FindOne(ctx, storage.Filter{"state.title": "c"}, storage.FindOptions{}); err != storage.ErrNotFound {
+		t.Errorf("Expected ErrNotFound after deleting the record, but got %v", err)
+	}
+}
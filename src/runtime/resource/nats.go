@@ -1,30 +1,57 @@
 package resource
 
 import (
+	"context"
 	"log"
-	"os"
 	"time"
 
+	"github.com/hntrl/hyper/src/runtime//transport"
+	"github.com/nats-io/nats-server/v2/server"
 	"github.com/nats-io/nats.go"
 )
 
 type NatsConnection struct {
 	Client *nats.Conn
+	Config Config
+	// Server is the server the connection is to when the configuration asks for
+	// an embedded one
+	Server *server.Server
+	// tempDir is where the embedded server stores streams when the
+	// configuration doesn't have a data directory, removed when it's shut down
+	tempDir string
+	closed  chan struct{}
 }
 
-func (conn NatsConnection) Attach() (Resource, error) {
-	nc, err := nats.Connect(
-		os.Getenv("NATS_URL"),
-		nats.PingInterval(20*time.Second),
+func (conn NatsConnection) Attach(ctx context.Context) (Resource, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	closed := make(chan struct{})
+	url := conn.Config.URL
+	if enabled(conn.Config.Embedded) {
+		srv, tempDir, err := startEmbeddedServer(conn.Config)
+		if err != nil {
+			return nil, err
+		}
+		conn.Server, conn.tempDir = srv, tempDir
+		url = srv.ClientURL()
+		log.Printf("embedded server listening on %s", url)
+	}
+	if url == "" {
+		url = nats.DefaultURL
+	}
+	opts := []nats.Option{
+		nats.PingInterval(20 * time.Second),
 		nats.MaxPingsOutstanding(5),
 		// TODO: this will never stop reconnecting. should it?
 		nats.MaxReconnects(-1),
-		nats.ReconnectWait(time.Second*5),
+		nats.ReconnectWait(time.Second * 5),
 		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
 			log.Printf("client disconnected: %v", err)
 		}),
 		nats.ClosedHandler(func(_ *nats.Conn) {
-			panic("queue connection closed: goodbye world!")
+			log.Printf("queue connection closed")
+			close(closed)
 		}),
 		nats.ErrorHandler(func(nc *nats.Conn, s *nats.Subscription, err error) {
 			if s != nil {
@@ -32,13 +59,140 @@ func (conn NatsConnection) Attach() (Resource, error) {
 			} else {
 				log.Printf("Async error outside subscription: %v", err)
 			}
-		}))
+		}),
+	}
+	if conn.Config.Username != "" {
+		opts = append(opts, nats.UserInfo(conn.Config.Username, conn.Config.Password))
+	}
+	if conn.Config.Timeout != 0 {
+		opts = append(opts, nats.Timeout(conn.Config.Timeout))
+	}
+	if conn.Config.TLS != nil {
+		tlsConfig, err := conn.Config.TLS.Load()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, nats.Secure(tlsConfig))
+	}
+	nc, err := nats.Connect(url, opts...)
 	if err != nil {
+		conn.shutdownServer()
 		return nil, err
 	}
 	conn.Client = nc
+	conn.closed = closed
+	if enabled(conn.Config.JetStream) {
+		jsConn, err := newJetStreamConnection(conn)
+		if err != nil {
+			conn.Detach(ctx)
+			return nil, err
+		}
+		return jsConn, nil
+	}
 	return conn, nil
 }
-func (conn NatsConnection) Detach() error {
+
+// Detach drains the connection, so messages that have already been received
+// are handled and anything that's been published is flushed before it's
+// closed. If ctx is done before the connection is drained, it's closed
+// immediately.
+func (conn NatsConnection) Detach(ctx context.Context) error {
+	defer conn.shutdownServer()
+	if conn.Client == nil || conn.Client.IsClosed() {
+		return nil
+	}
+	if err := conn.Client.Drain(); err != nil {
+		conn.Client.Close()
+		return err
+	}
+	select {
+	case <-conn.closed:
+		return nil
+	case <-ctx.Done():
+		conn.Client.Close()
+		return ctx.Err()
+	}
+}
+
+func (conn NatsConnection) Publish(ctx context.Context, msg transport.Message) error {
+	return conn.Client.PublishMsg(natsMsg(msg))
+}
+
+func (conn NatsConnection) Request(ctx context.Context, msg transport.Message) (transport.Message, error) {
+	res, err := conn.Client.RequestMsgWithContext(ctx, natsMsg(msg))
+	if err != nil {
+		if err == nats.ErrNoResponders {
+			return transport.Message{}, transport.ErrNoResponders
+		}
+		return transport.Message{}, err
+	}
+	return transportMessage(res), nil
+}
+
+func (conn NatsConnection) QueueSubscribe(subject string, queue string, handler transport.Handler) (transport.Subscription, error) {
+	sub, err := conn.Client.QueueSubscribe(subject, queue, func(m *nats.Msg) {
+		handler(transportMessage(m))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return natsSubscription{sub}, nil
+}
+
+func natsMsg(msg transport.Message) *nats.Msg {
+	m := nats.NewMsg(msg.Subject)
+	m.Data = msg.Data
+	for key, value := range msg.Header {
+		m.Header.Set(key, value)
+	}
+	return m
+}
+
+func transportMessage(m *nats.Msg) transport.Message {
+	msg := transport.Message{
+		Subject: m.Subject,
+		Data:    m.Data,
+	}
+	if len(m.Header) > 0 {
+		msg.Header = make(transport.Header)
+		for key := range m.Header {
+			msg.Header[key] = m.Header.Get(key)
+		}
+	}
+	if m.Reply != "" {
+		msg.Responder = func(reply transport.Message) error {
+			replyMsg := natsMsg(reply)
+			replyMsg.Subject = m.Reply
+			return m.RespondMsg(replyMsg)
+		}
+	}
+	return msg
+}
+
+type natsSubscription struct {
+	sub *nats.Subscription
+}
+
+// Drain stops the subscription from receiving new messages and waits for the
+// handlers of the messages that have already been received to finish, or for
+// ctx to be done, whichever comes first.
+func (s natsSubscription) Drain(ctx context.Context) error {
+	// the subscription may already be gone if the connection was closed
+	if !s.sub.IsValid() {
+		return nil
+	}
+	if err := s.sub.Drain(); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for s.sub.IsValid() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			s.sub.Unsubscribe()
+			return ctx.Err()
+		}
+	}
 	return nil
 }
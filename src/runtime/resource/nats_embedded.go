@@ -0,0 +1,88 @@
+package resource
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+)
+
+// embeddedServerOptions returns the options of the NATS server started for
+// config. It listens on the host and port in config.URL (where port 0 picks a
+// random free port), or on 127.0.0.1:4222 like a standalone server would if it
+// isn't set. With JetStream enabled, streams are stored under config.DataDir.
+func embeddedServerOptions(config Config) (*server.Options, error) {
+	opts := &server.Options{
+		Host:      "127.0.0.1",
+		Port:      server.DEFAULT_PORT,
+		NoLog:     true,
+		NoSigs:    true,
+		JetStream: enabled(config.JetStream),
+		StoreDir:  config.DataDir,
+	}
+	if config.URL != "" {
+		listenURL, err := url.Parse(config.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url for embedded server: %w", err)
+		}
+		opts.Host = listenURL.Hostname()
+		if listenURL.Port() != "" {
+			if opts.Port, err = strconv.Atoi(listenURL.Port()); err != nil {
+				return nil, fmt.Errorf("invalid url for embedded server: %w", err)
+			}
+			if opts.Port == 0 {
+				opts.Port = server.RANDOM_PORT
+			}
+		}
+	}
+	return opts, nil
+}
+
+// startEmbeddedServer starts a NATS server in this process with the options
+// config asks for. If JetStream is enabled without a data directory, streams
+// are stored in a temporary directory of their own, which is returned so it
+// can be removed when the server is shut down.
+func startEmbeddedServer(config Config) (srv *server.Server, tempDir string, err error) {
+	opts, err := embeddedServerOptions(config)
+	if err != nil {
+		return nil, "", err
+	}
+	if opts.JetStream && opts.StoreDir == "" {
+		if tempDir, err = os.MkdirTemp("", "hyper-jetstream-"); err != nil {
+			return nil, "", err
+		}
+		opts.StoreDir = tempDir
+		defer func() {
+			if err != nil {
+				os.RemoveAll(tempDir)
+			}
+		}()
+	}
+	srv, err = server.NewServer(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	go srv.Start()
+	timeout := 10 * time.Second
+	if config.Timeout != 0 {
+		timeout = config.Timeout
+	}
+	if !srv.ReadyForConnections(timeout) {
+		srv.Shutdown()
+		return nil, "", fmt.Errorf("embedded server wasn't ready for connections after %s", timeout)
+	}
+	return srv, tempDir, nil
+}
+
+func (conn NatsConnection) shutdownServer() {
+	if conn.Server != nil {
+		conn.Server.Shutdown()
+		conn.Server.WaitForShutdown()
+	}
+	if conn.tempDir != "" {
+		os.RemoveAll(conn.tempDir)
+	}
+}
@@ -0,0 +1,263 @@
+package resource
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hntrl/hyper/src/runtime//transport"
+	"github.com/nats-io/nats.go"
+)
+
+// attachEmbeddedNats attaches an embedded server with config, listening on a
+// random port so tests don't need 4222 to be free
+func attachEmbeddedNats(t *testing.T, config Config) NatsConnection {
+	config.Embedded = boolOption(true)
+	config.URL = "nats://127.0.0.1:0"
+	res, err := NatsConnection{Config: config}.Attach(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Detach(context.Background()) })
+	if jsConn, ok := res.(JetStreamConnection); ok {
+		return jsConn.NatsConnection
+	}
+	return res.(NatsConnection)
+}
+
+// CAN REQUEST AND REPLY THROUGH AN EMBEDDED SERVER
+func TestEmbeddedNats(t *testing.T) {
+	ctx := context.Background()
+	conn := attachEmbeddedNats(t, Config{})
+	sub, err := conn.QueueSubscribe("math.Double", "handlers", func(msg transport.Message) {
+		msg.RespondMsg(transport.Message{Data: append(msg.Data, msg.Data...), Header: msg.Header})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := conn.Request(ctx, transport.Message{
+		Subject: "math.Double",
+		Header:  transport.Header{"id": "1"},
+		Data:    []byte("ab"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(reply.Data) != "abab" || reply.Header["id"] != "1" {
+		t.Errorf("Expected abab with the request's header, but got %+v", reply)
+	}
+	if err := sub.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Request(ctx, transport.Message{Subject: "math.Double"}); err != transport.ErrNoResponders {
+		t.Errorf("Expected ErrNoResponders after draining, but got %v", err)
+	}
+
+	if err := conn.Detach(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if conn.Server.Running() {
+		t.Errorf("Expected the embedded server to be shut down when detached")
+	}
+}
+
+// CAN STORE JETSTREAM DATA IN THE DATA DIRECTORY
+func TestEmbeddedNatsJetStream(t *testing.T) {
+	dataDir := t.TempDir()
+	conn := attachEmbeddedNats(t, Config{JetStream: boolOption(true), DataDir: dataDir})
+	js, err := conn.Client.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.AddStream(&nats.StreamConfig{Name: "orders", Subjects: []string{"orders.>"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.Publish("orders.Placed", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "jetstream")); err != nil {
+		t.Errorf("Expected JetStream to store data in %s, but got %v", dataDir, err)
+	}
+}
+
+// CAN LISTEN WHERE THE CONFIGURATION ASKS
+func TestEmbeddedServerOptions(t *testing.T) {
+	tests := []struct {
+		url  string
+		host string
+		port int
+	}{
+		{"", "127.0.0.1", 4222},
+		{"nats://0.0.0.0:4333", "0.0.0.0", 4333},
+		{"nats://127.0.0.1:0", "127.0.0.1", -1},
+		{"nats://localhost", "localhost", 4222},
+	}
+	for _, test := range tests {
+		opts, err := embeddedServerOptions(Config{URL: test.url})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opts.Host != test.host || opts.Port != test.port {
+			t.Errorf("Expected %q to listen on %s:%d, but got %s:%d", test.url, test.host, test.port, opts.Host, opts.Port)
+		}
+	}
+}
+
+// CAN STORE JETSTREAM DATA IN A TEMPORARY DIRECTORY OF ITS OWN
+func TestEmbeddedNatsTempDir(t *testing.T) {
+	first := attachEmbeddedNats(t, Config{JetStream: boolOption(true)})
+	second := attachEmbeddedNats(t, Config{JetStream: boolOption(true)})
+	if first.tempDir == "" || first.tempDir == second.tempDir {
+		t.Fatalf("Expected each server to have a temporary directory of its own, but got %q and %q", first.tempDir, second.tempDir)
+	}
+	if _, err := os.Stat(first.tempDir); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Detach(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(first.tempDir); !os.IsNotExist(err) {
+		t.Errorf("Expected the temporary directory to be removed when the server is shut down, but got %v", err)
+	}
+}
+
+// CAN DELIVER DURABLY THROUGH JETSTREAM
+func TestJetStreamDurable(t *testing.T) {
+	ctx := context.Background()
+	res, err := NatsConnection{Config: Config{Embedded: boolOption(true), URL: "nats://127.0.0.1:0", JetStream: boolOption(true), DataDir: t.TempDir()}}.Attach(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Detach(context.Background()) })
+	conn, ok := res.(transport.DurableTransport)
+	if !ok {
+		t.Fatalf("Expected a nats resource with JetStream to be a durable transport, but got %T", res)
+	}
+
+	// published before anything subscribes
+	if err := conn.PublishDurable(ctx, "acme.orders", transport.Message{Subject: "acme.orders.Placed", Data: []byte("1")}); err != nil {
+		t.Fatal(err)
+	}
+	received := make(chan transport.Message, 10)
+	subscribe := func(name string, options transport.DurableOptions) transport.Subscription {
+		sub, err := conn.SubscribeDurable("acme.orders", "acme.orders.Placed", name, options, func(m transport.Message) {
+			received <- m
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sub
+	}
+	next := func() transport.Message {
+		select {
+		case m := <-received:
+			return m
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected a message to be delivered")
+		}
+		return transport.Message{}
+	}
+
+	sub := subscribe("acme.shop.Orders", transport.DurableOptions{DeliverAll: true})
+	m := next()
+	if string(m.Data) != "1" || m.Subject != "acme.orders.Placed" || m.Responder != nil {
+		t.Errorf("Expected the message published before subscribing, on its subject and without a responder, but got %+v", m)
+	}
+	if err := m.Nak(); err != nil {
+		t.Fatal(err)
+	}
+	if m = next(); string(m.Data) != "1" {
+		t.Errorf("Expected a nak'd message to be delivered again, but got %s", m.Data)
+	}
+	if err := m.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Drain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// published while the subscription isn't running
+	if err := conn.PublishDurable(ctx, "acme.orders", transport.Message{Subject: "acme.orders.Placed", Data: []byte("2")}); err != nil {
+		t.Fatal(err)
+	}
+	sub = subscribe("acme.shop.Orders", transport.DurableOptions{DeliverAll: true})
+	if m = next(); string(m.Data) != "2" {
+		t.Errorf("Expected the subscription to resume after the acked message, but got %s", m.Data)
+	}
+	m.Ack()
+	sub.Drain(ctx)
+
+	sub = subscribe("acme.shop.notify", transport.DurableOptions{})
+	defer sub.Drain(ctx)
+	select {
+	case m := <-received:
+		t.Errorf("Expected a new subscription to not receive messages published before it, but got %s", m.Data)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if err := conn.PublishDurable(ctx, "acme.orders", transport.Message{Subject: "acme.orders.Placed", Data: []byte("3")}); err != nil {
+		t.Fatal(err)
+	}
+	if m = next(); string(m.Data) != "3" {
+		t.Errorf("Expected a new subscription to receive the next message, but got %s", m.Data)
+	}
+}
+
+// CAN KEEP SUBJECTS PUBLISHED TO THE SAME STREAM BY SEPARATE CONNECTIONS
+func TestJetStreamConcurrentSubjects(t *testing.T) {
+	ctx := context.Background()
+	server := attachEmbeddedNats(t, Config{JetStream: boolOption(true), DataDir: t.TempDir()})
+	subjects := []string{"acme.orders.Placed", "acme.orders.Cancelled", "acme.orders.Shipped", "acme.orders.Refunded"}
+
+	// each connection sets up the stream on its own, like separate processes
+	// emitting different events of the same context would
+	conns := make([]JetStreamConnection, len(subjects))
+	for idx := range subjects {
+		client, err := nats.Connect(server.Client.ConnectedUrl())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(client.Close)
+		if conns[idx], err = newJetStreamConnection(NatsConnection{Client: client}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, len(subjects))
+	for idx, subject := range subjects {
+		wg.Add(1)
+		go func(conn JetStreamConnection, subject string) {
+			defer wg.Done()
+			errs <- conn.PublishDurable(ctx, "acme.orders", transport.Message{Subject: subject, Data: []byte(subject)})
+		}(conns[idx], subject)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, subject := range subjects {
+		received := make(chan transport.Message, 1)
+		sub, err := conns[0].SubscribeDurable("acme.orders", subject, "acme.shop."+subject[len("acme.orders."):], transport.DurableOptions{DeliverAll: true}, func(m transport.Message) {
+			m.Ack()
+			received <- m
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case m := <-received:
+			if m.Subject != subject || string(m.Data) != subject {
+				t.Errorf("Expected the message published on %s, but got %+v", subject, m)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Expected the message published on %s to be kept", subject)
+		}
+		sub.Drain(ctx)
+	}
+}
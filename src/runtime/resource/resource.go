@@ -1,6 +1,12 @@
 package resource
 
+import "context"
+
+// Resource is a connection (or anything else) that's shared between the
+// runtime nodes of a process. Resources are attached the first time they're
+// requested, and detached after every node has been detached when the process
+// is closed.
 type Resource interface {
-	Attach() (Resource, error)
-	Detach() error
+	Attach(context.Context) (Resource, error)
+	Detach(context.Context) error
 }
@@ -1,11 +1,19 @@
 package runtime
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"sync"
+	"time"
 
 	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/runtime//audit"
+	"github.com/hntrl/hyper/src/runtime//auth"
+	"github.com/hntrl/hyper/src/runtime//delivery"
 	"github.com/hntrl/hyper/src/runtime//resource"
+	"github.com/hntrl/hyper/src/runtime//storage"
 )
 
 type Process struct {
@@ -13,6 +21,17 @@ type Process struct {
 	ctxBuilder       *domain.ContextBuilder
 	initializedNodes []RuntimeNode
 	resources        map[string]resource.Resource
+	resourceKeys     []string
+	resourceConfig   map[string]resource.Config
+	factories        map[string]resource.Factory
+	requestTimeouts  map[string]time.Duration
+	retryPolicies    map[string]delivery.Policy
+	authenticator    *auth.Authenticator
+	auditor          *audit.Auditor
+
+	// mu guards the resources, since nodes can request them while handling
+	// messages
+	mu sync.Mutex
 }
 
 func NewProcess() *Process {
@@ -21,7 +40,115 @@ func NewProcess() *Process {
 		ctxBuilder:       nil,
 		initializedNodes: nil,
 		resources:        make(map[string]resource.Resource),
+		resourceKeys:     nil,
+		resourceConfig:   resource.DefaultConfig(),
+		factories:        resource.DefaultFactories(),
+		requestTimeouts:  make(map[string]time.Duration),
+		retryPolicies:    make(map[string]delivery.Policy),
+	}
+}
+
+// RegisterResourceFactory makes resources with the type resourceType
+// available to the process, replacing the factory that was registered for it
+// before (if any).
+func (p *Process) RegisterResourceFactory(resourceType string, factory resource.Factory) {
+	p.factories[resourceType] = factory
+}
+
+// UseResourceConfig configures the resources in config. Resources that are
+// already configured are replaced, and the rest of them are kept. Resources
+// that have already been attached aren't affected.
+func (p *Process) UseResourceConfig(config map[string]resource.Config) {
+	for key, resourceConfig := range config {
+		p.resourceConfig[key] = resourceConfig
+	}
+}
+
+// ResourceConfig returns the configuration of the resource with key, if it's
+// configured.
+func (p *Process) ResourceConfig(key string) (resource.Config, bool) {
+	config, ok := p.resourceConfig[key]
+	return config, ok
+}
+
+// UseRequestTimeouts sets how long requests to the topics in timeouts wait
+// for a reply, overriding the timeouts the items they're sent to declare.
+// Nodes that have already been attached aren't affected.
+func (p *Process) UseRequestTimeouts(timeouts map[string]time.Duration) {
+	for topic, timeout := range timeouts {
+		p.requestTimeouts[topic] = timeout
+	}
+}
+
+// RequestTimeout returns the timeout configured for requests to topic, if
+// there is one.
+func (p *Process) RequestTimeout(topic string) (time.Duration, bool) {
+	timeout, ok := p.requestTimeouts[topic]
+	return timeout, ok
+}
+
+// UseRetryPolicies sets the retry policies of consumers, keyed by the name of
+// the consumer (like acme.shop.notify). The policy under "default" applies to
+// every consumer. Nodes that have already been attached aren't affected.
+func (p *Process) UseRetryPolicies(policies map[string]delivery.Policy) {
+	for name, policy := range policies {
+		p.retryPolicies[name] = policy
+	}
+}
+
+// RetryPolicy returns the retry policy of the named consumer
+func (p *Process) RetryPolicy(consumer string) delivery.Policy {
+	return delivery.DefaultPolicy.Merge(p.retryPolicies["default"]).Merge(p.retryPolicies[consumer])
+}
+
+// UseAuth loads the keys the process verifies and signs tokens with. A nil
+// config leaves every caller anonymous.
+func (p *Process) UseAuth(config *auth.Config) error {
+	if config == nil {
+		p.authenticator = nil
+		return nil
+	}
+	authenticator, err := auth.New(*config)
+	if err != nil {
+		return err
+	}
+	p.authenticator = authenticator
+	return nil
+}
+
+// Authenticator returns what identifies the callers of the messages the
+// process receives. It's nil if the process doesn't use auth.
+func (p *Process) Authenticator() *auth.Authenticator {
+	return p.authenticator
+}
+
+// UseAudit records the authorization decisions the process makes with
+// auditor, closing the sink it recorded them to before (if any). A nil auditor
+// stops them from being recorded. Nodes that have already been attached aren't
+// affected.
+func (p *Process) UseAudit(auditor *audit.Auditor) error {
+	var err error
+	if p.auditor != nil {
+		err = p.auditor.Close()
+	}
+	p.auditor = auditor
+	return err
+}
+
+// Audit returns the auditor the process records its authorization decisions
+// with. It's nil if the process doesn't record them.
+func (p *Process) Audit() *audit.Auditor {
+	return p.auditor
+}
+
+// DeadLetters returns the store dead letters are kept in, which is part of
+// the state resource.
+func (p *Process) DeadLetters(ctx context.Context) (*delivery.Store, error) {
+	var driver storage.Driver
+	if err := p.Resource(ctx, "state", &driver); err != nil {
+		return nil, err
 	}
+	return delivery.NewStore(ctx, driver)
 }
 
 func (p *Process) UseContextBuilder(bd *domain.ContextBuilder) error {
@@ -30,63 +157,132 @@ func (p *Process) UseContextBuilder(bd *domain.ContextBuilder) error {
 	return nil
 }
 
-func (p *Process) Attach() error {
+// Attach attaches the runtime nodes of the host context and the remote items
+// of the contexts it imports. If any of them can't be attached, the nodes that
+// were attached before it are detached again.
+func (p *Process) Attach(ctx context.Context) error {
 	p.initializedNodes = make([]RuntimeNode, 0)
+	nodes := make([]RuntimeNode, 0)
 	// Initialize Host Context Resources
 	for _, item := range p.Context.Items {
 		if hostRuntimeNode, ok := item.HostItem.(RuntimeNode); ok {
-			err := hostRuntimeNode.Attach(p)
-			if err != nil {
-				p.Close()
-				return err
-			}
-			p.initializedNodes = append(p.initializedNodes, hostRuntimeNode)
+			nodes = append(nodes, hostRuntimeNode)
 		}
 	}
 	// Initialize Imported Context Resources
 	for _, ctxPath := range p.Context.ImportedContexts {
-		ctx := p.ctxBuilder.GetContextByPath(string(ctxPath))
-		for _, item := range ctx.Items {
+		importedCtx := p.ctxBuilder.GetContextByPath(string(ctxPath))
+		for _, item := range importedCtx.Items {
 			if remoteRuntimeNode, ok := item.RemoteItem.(RuntimeNode); ok {
-				err := remoteRuntimeNode.Attach(p)
-				if err != nil {
-					p.Close()
-					return err
-				}
-				p.initializedNodes = append(p.initializedNodes, remoteRuntimeNode)
+				nodes = append(nodes, remoteRuntimeNode)
 			}
 		}
 	}
+	for _, node := range nodes {
+		if err := node.Attach(ctx, p); err != nil {
+			if detachErr := p.detachNodes(ctx); detachErr != nil {
+				return errors.Join(err, detachErr)
+			}
+			return err
+		}
+		p.initializedNodes = append(p.initializedNodes, node)
+	}
 	return nil
 }
-func (p *Process) Close() error {
-	for _, node := range p.initializedNodes {
-		err := node.Detach()
-		if err != nil {
-			return err
+
+// Close detaches every runtime node in the reverse order they were attached
+// in, and then detaches the resources they used and closes the audit sink.
+// Everything is detached even if something fails to, and the errors are
+// returned together. Nodes and resources are expected to give up waiting on
+// in-flight work once ctx is done, so a deadline on ctx bounds how long
+// shutting down can take.
+func (p *Process) Close(ctx context.Context) error {
+	nodesErr := p.detachNodes(ctx)
+	resourcesErr := p.detachResources(ctx)
+	auditErr := p.UseAudit(nil)
+	return errors.Join(nodesErr, resourcesErr, auditErr)
+}
+
+func (p *Process) detachNodes(ctx context.Context) error {
+	errs := make([]error, 0)
+	for idx := len(p.initializedNodes) - 1; idx >= 0; idx-- {
+		if err := p.initializedNodes[idx].Detach(ctx); err != nil {
+			errs = append(errs, err)
 		}
 	}
 	p.initializedNodes = nil
-	return nil
+	return errors.Join(errs...)
+}
+
+func (p *Process) detachResources(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	errs := make([]error, 0)
+	for idx := len(p.resourceKeys) - 1; idx >= 0; idx-- {
+		key := p.resourceKeys[idx]
+		if err := p.resources[key].Detach(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("cannot detach resource %s: %w", key, err))
+		}
+		delete(p.resources, key)
+	}
+	p.resourceKeys = nil
+	return errors.Join(errs...)
+}
+
+// Reload detaches the nodes of the context being served and attaches the nodes
+// of the host context in bd in their place. Resources are kept, so connections
+// aren't re-established. The new nodes are attached even if the previous ones
+// fail to detach, and if the new nodes can't be attached, the previous context
+// is attached again, so a failed reload never leaves the process serving
+// nothing. Whichever context is served afterwards is in p.Context.
+func (p *Process) Reload(ctx context.Context, bd *domain.ContextBuilder) error {
+	previous := p.ctxBuilder
+	detachErr := p.detachNodes(ctx)
+	if detachErr != nil {
+		detachErr = fmt.Errorf("cannot detach the previous context: %w", detachErr)
+	}
+	p.UseContextBuilder(bd)
+	if err := p.Attach(ctx); err != nil {
+		p.UseContextBuilder(previous)
+		if reattachErr := p.Attach(ctx); reattachErr != nil {
+			err = fmt.Errorf("%w (and the previous context couldn't be attached again: %s)", err, reattachErr.Error())
+		}
+		return errors.Join(detachErr, err)
+	}
+	return detachErr
 }
 
-func (p *Process) Resource(key string, vPtr interface{}) error {
+// Resource sets the value vPtr points to to the resource stored under key,
+// creating it with the factory for its configured type and attaching it with
+// ctx first if nothing has requested it yet.
+func (p *Process) Resource(ctx context.Context, key string, vPtr interface{}) error {
 	ptr := reflect.ValueOf(vPtr)
 	if ptr.Kind() != reflect.Ptr {
 		return fmt.Errorf("%s is not a pointer", key)
 	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	if p.resources[key] == nil {
-		if blankRes, ok := reflect.New(ptr.Type().Elem()).Interface().(resource.Resource); ok {
-			res, err := blankRes.Attach()
-			if err != nil {
-				return err
-			}
-			p.resources[key] = res
-		} else {
-			return fmt.Errorf("%T is not a resource", vPtr)
+		config, ok := p.resourceConfig[key]
+		if !ok {
+			return fmt.Errorf("resource %s is not configured", key)
+		}
+		factory, ok := p.factories[config.Type]
+		if !ok {
+			return fmt.Errorf("resource %s has unknown type %s", key, config.Type)
+		}
+		blankRes, err := factory(config)
+		if err != nil {
+			return fmt.Errorf("cannot create resource %s: %w", key, err)
+		}
+		res, err := blankRes.Attach(ctx)
+		if err != nil {
+			return err
 		}
+		p.resources[key] = res
+		p.resourceKeys = append(p.resourceKeys, key)
 	}
-	if ptr.Type().Elem() != reflect.TypeOf(p.resources[key]) {
+	if !reflect.TypeOf(p.resources[key]).AssignableTo(ptr.Type().Elem()) {
 		return fmt.Errorf("resource %s is not of type %s", key, ptr.Type().Elem())
 	}
 	ptr.Elem().Set(reflect.ValueOf(p.resources[key]))
@@ -0,0 +1,218 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hntrl/hyper/src/hyper/domain"
+	"github.com/hntrl/hyper/src/runtime//resource"
+)
+
+// recorder keeps the order things were attached and detached in
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) record(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+// reversed returns the names recorded with prefix, from last to first
+func (r *recorder) reversed(prefix string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]string, 0)
+	for idx := len(r.events) - 1; idx >= 0; idx-- {
+		if strings.HasPrefix(r.events[idx], prefix) {
+			out = append(out, strings.TrimPrefix(r.events[idx], prefix))
+		}
+	}
+	return out
+}
+
+func (r *recorder) recorded(prefix string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := make([]string, 0)
+	for _, event := range r.events {
+		if strings.HasPrefix(event, prefix) {
+			out = append(out, strings.TrimPrefix(event, prefix))
+		}
+	}
+	return out
+}
+
+// fakeNode records when it's attached and detached. Detaching fails if fail is
+// set, and waits for ctx to be done first if block is set. Attaching fails if
+// failAttach is set.
+type fakeNode struct {
+	name       string
+	recorder   *recorder
+	fail       bool
+	failAttach bool
+	block      bool
+}
+
+func (n fakeNode) Attach(ctx context.Context, p *Process) error {
+	if n.failAttach {
+		return errors.New(n.name + " failed to attach")
+	}
+	n.recorder.record("attach " + n.name)
+	return nil
+}
+func (n fakeNode) Detach(ctx context.Context) error {
+	if n.block {
+		<-ctx.Done()
+	}
+	n.recorder.record("detach " + n.name)
+	if n.fail {
+		return errors.New(n.name + " failed")
+	}
+	return nil
+}
+
+// fakeResource records when it's detached, and fails to be if fail is set
+type fakeResource struct {
+	name     string
+	recorder *recorder
+	fail     bool
+}
+
+func (r fakeResource) Attach(ctx context.Context) (resource.Resource, error) {
+	return r, nil
+}
+func (r fakeResource) Detach(ctx context.Context) error {
+	r.recorder.record("detach resource " + r.name)
+	if r.fail {
+		return errors.New(r.name + " failed")
+	}
+	return nil
+}
+
+// newFakeProcess returns a process serving a context with nodes, that has the
+// resources attached in the order they're given in
+func newFakeProcess(t *testing.T, nodes []fakeNode, resources []fakeResource) *Process {
+	process := NewProcess()
+	items := make(map[string]domain.ContextItem)
+	for _, node := range nodes {
+		items[node.name] = domain.ContextItem{HostItem: node}
+	}
+	process.Context = &domain.Context{Items: items}
+	if err := process.Attach(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, res := range resources {
+		res := res
+		process.RegisterResourceFactory(res.name, func(resource.Config) (resource.Resource, error) {
+			return res, nil
+		})
+		process.UseResourceConfig(map[string]resource.Config{res.name: {Type: res.name}})
+		var attached resource.Resource
+		if err := process.Resource(context.Background(), res.name, &attached); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return process
+}
+
+// CAN DETACH EVERYTHING IN THE REVERSE ORDER IT WAS ATTACHED IN
+func TestProcessClose(t *testing.T) {
+	rec := &recorder{}
+	process := newFakeProcess(t, []fakeNode{
+		{name: "a", recorder: rec},
+		{name: "b", recorder: rec, fail: true},
+		{name: "c", recorder: rec},
+	}, []fakeResource{
+		{name: "stream", recorder: rec, fail: true},
+		{name: "state", recorder: rec},
+	})
+
+	err := process.Close(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "b failed") || !strings.Contains(err.Error(), "cannot detach resource stream: stream failed") {
+		t.Errorf("Expected the errors of the node and the resource that failed to be returned, but got %v", err)
+	}
+	// nodes are detached in reverse, even after one of them fails
+	if attached, detached := rec.reversed("attach "), rec.recorded("detach "); strings.Join(detached[:3], ",") != strings.Join(attached, ",") {
+		t.Errorf("Expected the nodes to be detached in the reverse of %v, but got %v", attached, detached)
+	}
+	// and then the resources they used
+	if detached := rec.recorded("detach resource "); strings.Join(detached, ",") != "state,stream" {
+		t.Errorf("Expected the resources to be detached in reverse after the nodes, but got %v", detached)
+	}
+	if len(process.initializedNodes) != 0 || len(process.resources) != 0 {
+		t.Errorf("Expected nothing to be left attached")
+	}
+}
+
+// CAN STOP WAITING TO CLOSE ONCE THE DEADLINE PASSES
+func TestProcessCloseDeadline(t *testing.T) {
+	rec := &recorder{}
+	process := newFakeProcess(t, []fakeNode{
+		{name: "a", recorder: rec},
+		{name: "b", recorder: rec, block: true},
+	}, []fakeResource{
+		{name: "stream", recorder: rec},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	process.Close(ctx)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected Close to return once its deadline passed, but it took %s", elapsed)
+	}
+	if detached := rec.recorded("detach "); len(detached) != 3 {
+		t.Errorf("Expected everything to be detached after the deadline passed, but got %v", detached)
+	}
+}
+
+// newFakeBuilder returns a builder whose host context has nodes
+func newFakeBuilder(nodes []fakeNode) *domain.ContextBuilder {
+	builder := domain.NewContextBuilder()
+	items := make(map[string]domain.ContextItem)
+	for _, node := range nodes {
+		items[node.name] = domain.ContextItem{HostItem: node}
+	}
+	builder.Contexts[""] = &domain.Context{Items: items}
+	return builder
+}
+
+// CAN RELOAD WHEN THE PREVIOUS CONTEXT FAILS TO DETACH
+func TestProcessReloadDetachError(t *testing.T) {
+	rec := &recorder{}
+	process := NewProcess()
+	process.UseContextBuilder(newFakeBuilder([]fakeNode{{name: "old", recorder: rec, fail: true}}))
+	if err := process.Attach(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	next := newFakeBuilder([]fakeNode{{name: "new", recorder: rec, fail: true}})
+	err := process.Reload(context.Background(), next)
+	if err == nil || !strings.Contains(err.Error(), "cannot detach the previous context: old failed") {
+		t.Errorf("Expected the detach error to be returned, but got %v", err)
+	}
+	if process.Context != next.HostContext() {
+		t.Errorf("Expected the new context to be served")
+	}
+	if len(process.initializedNodes) != 1 || process.initializedNodes[0].(fakeNode).name != "new" {
+		t.Errorf("Expected the new nodes to be attached, but got %v", process.initializedNodes)
+	}
+
+	// the previous context is served again if the new one can't be attached
+	// either
+	broken := newFakeBuilder([]fakeNode{{name: "broken", recorder: rec, failAttach: true}})
+	err = process.Reload(context.Background(), broken)
+	if err == nil || !strings.Contains(err.Error(), "new failed") || !strings.Contains(err.Error(), "broken failed to attach") {
+		t.Errorf("Expected the detach and attach errors to be returned, but got %v", err)
+	}
+	if process.Context != next.HostContext() || len(process.initializedNodes) != 1 {
+		t.Errorf("Expected the previous context to be served again")
+	}
+}
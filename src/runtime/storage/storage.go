@@ -0,0 +1,85 @@
+// Package storage describes the backends that entities and projections keep
+// their state in. Documents are passed to and from drivers as plain values
+// (the kind encoding/json produces), so the state interfaces don't depend on
+// how any one backend encodes them.
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotFound is returned when no document matches a lookup
+var ErrNotFound = errors.New("no matching documents")
+
+// Event is an entry in the event log of an entity
+type Event struct {
+	// ID is assigned by the driver when the event is appended
+	ID        string
+	EntityID  string
+	Timestamp time.Time
+	Effect    string
+	State     map[string]interface{}
+}
+
+// Record is a document in a collection
+type Record struct {
+	// ID is assigned by the driver when the record is inserted
+	ID   string
+	Data map[string]interface{}
+}
+
+// Filter matches the records whose fields are equal to every value in the
+// filter. Nested fields are referred to by their period delimited path (like
+// "state.name").
+type Filter map[string]interface{}
+
+// FindOptions are applied to the records that match a filter. Zero values
+// mean the option isn't set.
+type FindOptions struct {
+	Skip  int64
+	Limit int64
+}
+
+// Driver is a storage backend. Collections and event logs are grouped by
+// namespace (like the context they belong to), and are created when they're
+// first requested.
+type Driver interface {
+	EventLog(ctx context.Context, namespace string, name string) (EventLog, error)
+	Collection(ctx context.Context, namespace string, name string) (Collection, error)
+}
+
+// EventLog is an append-only log of entity events
+type EventLog interface {
+	Append(ctx context.Context, event Event) (Event, error)
+	// Events returns the events of the entity with entityID in the order they
+	// were appended in, or the events of every entity if entityID is empty.
+	Events(ctx context.Context, entityID string) ([]Event, error)
+	// Subscribe returns a stream of the events appended after it's called
+	Subscribe(ctx context.Context) (EventStream, error)
+}
+
+// EventStream iterates over the events appended to an event log
+type EventStream interface {
+	// Next waits for the next event and reports if there is one. It returns
+	// false once ctx is done, the stream is closed, or the stream fails (in
+	// which case Err returns why).
+	Next(ctx context.Context) bool
+	// Event returns the event Next waited for
+	Event() Event
+	Err() error
+	Close(ctx context.Context) error
+}
+
+// Collection is a set of records that can be changed in place
+type Collection interface {
+	Find(ctx context.Context, filter Filter, options FindOptions) ([]Record, error)
+	// FindOne returns ErrNotFound if no records match filter
+	FindOne(ctx context.Context, filter Filter, options FindOptions) (Record, error)
+	Insert(ctx context.Context, data map[string]interface{}) (Record, error)
+	// Upsert replaces the data of the record with record.ID, or inserts the
+	// record if there isn't one
+	Upsert(ctx context.Context, record Record) error
+	Delete(ctx context.Context, id string) error
+}
@@ -0,0 +1,231 @@
+// Package transport describes how messages are passed between contexts, so
+// the stream interfaces don't depend on any one message broker.
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNoResponders is returned from requests when nothing is subscribed to the
+// subject of the request
+var ErrNoResponders = errors.New("no responders available for request")
+
+// ErrNoReply is returned when responding to a message that wasn't a request
+var ErrNoReply = errors.New("message does not expect a reply")
+
+type Header map[string]string
+
+// DeadlineHeader is the header a request's deadline is sent in, so whatever
+// handles it can stop once the requester has stopped waiting for a reply
+const DeadlineHeader = "Hyper-Deadline"
+
+// CorrelationHeader is the header that identifies the incoming message a
+// message was sent while handling, so everything done for one message can be
+// traced across the contexts it passes through
+const CorrelationHeader = "Hyper-Correlation-Id"
+
+type Message struct {
+	Subject string
+	Header  Header
+	Data    []byte
+	// Responder sends a reply to the sender of the message. It's nil if the
+	// sender isn't waiting for one.
+	Responder func(Message) error
+	// Acknowledger settles messages received from durable subscriptions. It's
+	// nil for messages that aren't redelivered.
+	Acknowledger Acknowledger
+}
+
+// Acknowledger tells a durable transport what happened to a message it
+// delivered
+type Acknowledger interface {
+	// Ack tells the transport the message was handled, so it isn't delivered
+	// again
+	Ack() error
+	// Nak tells the transport the message wasn't handled, so it's delivered
+	// again
+	Nak() error
+	// InProgress tells the transport the message is still being handled, so
+	// it isn't redelivered while it is
+	InProgress() error
+}
+
+// Respond replies to a request with data
+func (msg Message) Respond(data []byte) error {
+	return msg.RespondMsg(Message{Data: data})
+}
+
+// RespondMsg replies to a request with reply
+func (msg Message) RespondMsg(reply Message) error {
+	if msg.Responder == nil {
+		return ErrNoReply
+	}
+	return msg.Responder(reply)
+}
+
+// Ack acknowledges a message received from a durable subscription. It does
+// nothing for other messages.
+func (msg Message) Ack() error {
+	if msg.Acknowledger == nil {
+		return nil
+	}
+	return msg.Acknowledger.Ack()
+}
+
+// Nak asks for a message received from a durable subscription to be delivered
+// again. It does nothing for other messages.
+func (msg Message) Nak() error {
+	if msg.Acknowledger == nil {
+		return nil
+	}
+	return msg.Acknowledger.Nak()
+}
+
+// InProgress keeps a message received from a durable subscription from being
+// redelivered while it's handled. It does nothing for other messages.
+func (msg Message) InProgress() error {
+	if msg.Acknowledger == nil {
+		return nil
+	}
+	return msg.Acknowledger.InProgress()
+}
+
+// WithDeadline returns a copy of msg with the deadline of ctx (if it has one)
+// in its header
+func (msg Message) WithDeadline(ctx context.Context) Message {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return msg
+	}
+	header := make(Header, len(msg.Header)+1)
+	for key, value := range msg.Header {
+		header[key] = value
+	}
+	header[DeadlineHeader] = deadline.UTC().Format(time.RFC3339Nano)
+	msg.Header = header
+	return msg
+}
+
+// Context returns a context derived from parent that's canceled at the
+// deadline in msg's header, if it has one
+func (msg Message) Context(parent context.Context) (context.Context, context.CancelFunc) {
+	if value, ok := msg.Header[DeadlineHeader]; ok {
+		if deadline, err := time.Parse(time.RFC3339Nano, value); err == nil {
+			return context.WithDeadline(parent, deadline)
+		}
+	}
+	return context.WithCancel(parent)
+}
+
+// CorrelationID returns the correlation ID in msg's header, or a new one if
+// msg is the first of the messages sent for something
+func (msg Message) CorrelationID() string {
+	if id, ok := msg.Header[CorrelationHeader]; ok && id != "" {
+		return id
+	}
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+type Handler func(Message)
+
+// Transport passes messages between contexts
+type Transport interface {
+	// Publish sends msg to everything subscribed to its subject without
+	// waiting for a reply
+	Publish(ctx context.Context, msg Message) error
+	// Request sends msg to one of the subscribers of its subject and waits for
+	// its reply, or for ctx to be done
+	Request(ctx context.Context, msg Message) (Message, error)
+	// QueueSubscribe calls handler with the messages sent to subject. Each
+	// message is only given to one of the subscribers in the same queue.
+	QueueSubscribe(subject string, queue string, handler Handler) (Subscription, error)
+}
+
+// DurableOptions configures a durable subscription
+type DurableOptions struct {
+	// DeliverAll starts a subscription that doesn't exist yet from the first
+	// message that's kept in the stream, instead of from the next message
+	// that's published
+	DeliverAll bool
+}
+
+// DurableTransport is implemented by transports that keep the messages
+// published with them in streams, so subscribers that aren't running when a
+// message is published still receive it once they are.
+type DurableTransport interface {
+	Transport
+	// PublishDurable stores msg in the named stream, and returns once the
+	// transport has confirmed it's been stored
+	PublishDurable(ctx context.Context, stream string, msg Message) error
+	// SubscribeDurable calls handler with the messages in the named stream
+	// that were published on subject. Subscribers with the same name share
+	// one position in the stream, which is kept when they aren't running, and
+	// each message is only given to one of them. Messages are delivered again
+	// until they're acked.
+	SubscribeDurable(stream string, subject string, name string, options DurableOptions, handler Handler) (Subscription, error)
+}
+
+type Subscription interface {
+	// Drain stops the subscription from receiving new messages and waits for
+	// the messages that have already been received to be handled, or for ctx
+	// to be done, whichever comes first
+	Drain(ctx context.Context) error
+}
+
+// Subscriptions keeps track of the subscriptions a runtime node makes, so they
+// can be drained when the node is detached.
+type Subscriptions struct {
+	mu   sync.Mutex
+	subs []Subscription
+}
+
+func (s *Subscriptions) QueueSubscribe(t Transport, subject string, queue string, handler Handler) error {
+	sub, err := t.QueueSubscribe(subject, queue, handler)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.subs = append(s.subs, sub)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Subscriptions) SubscribeDurable(t DurableTransport, stream string, subject string, name string, options DurableOptions, handler Handler) error {
+	sub, err := t.SubscribeDurable(stream, subject, name, options, handler)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.subs = append(s.subs, sub)
+	s.mu.Unlock()
+	return nil
+}
+
+// Drain drains every subscription at once
+func (s *Subscriptions) Drain(ctx context.Context) error {
+	s.mu.Lock()
+	subs := s.subs
+	s.subs = nil
+	s.mu.Unlock()
+
+	errs := make(chan error, len(subs))
+	for _, sub := range subs {
+		go func(sub Subscription) {
+			errs <- sub.Drain(ctx)
+		}(sub)
+	}
+	drainErrs := make([]error, 0)
+	for range subs {
+		if err := <-errs; err != nil {
+			drainErrs = append(drainErrs, err)
+		}
+	}
+	return errors.Join(drainErrs...)
+}
@@ -0,0 +1,93 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// CAN SEND DEADLINES IN HEADERS
+func TestDeadline(t *testing.T) {
+	deadline := time.Now().Add(time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	msg := Message{Subject: "orders.Place", Header: Header{"id": "1"}}
+	sent := msg.WithDeadline(ctx)
+	if _, ok := msg.Header[DeadlineHeader]; ok {
+		t.Errorf("Expected WithDeadline to not modify the header of the original message")
+	}
+	if sent.Header["id"] != "1" {
+		t.Errorf("Expected WithDeadline to keep the rest of the header, but got %v", sent.Header)
+	}
+	received, cancel := sent.Context(context.Background())
+	defer cancel()
+	if got, ok := received.Deadline(); !ok || !got.Equal(deadline.Round(0)) {
+		t.Errorf("Expected the context of the message to have the deadline %s, but got %s", deadline, got)
+	}
+
+	received, cancel = Message{}.WithDeadline(context.Background()).Context(context.Background())
+	defer cancel()
+	if _, ok := received.Deadline(); ok {
+		t.Errorf("Expected a message without a deadline to not have one")
+	}
+}
+
+// CAN IDENTIFY MESSAGES WITH CORRELATION IDS
+func TestCorrelationID(t *testing.T) {
+	msg := Message{Header: Header{CorrelationHeader: "c0ffee"}}
+	if id := msg.CorrelationID(); id != "c0ffee" {
+		t.Errorf("Expected the correlation ID in the header, but got %s", id)
+	}
+	first, second := Message{}.CorrelationID(), Message{}.CorrelationID()
+	if first == "" || first == second {
+		t.Errorf("Expected messages without a correlation ID to be given new ones, but got %q and %q", first, second)
+	}
+}
+
+// fakeSubscription is drained after delay, or once ctx is done if that comes
+// first, and fails to be if err is set
+type fakeSubscription struct {
+	delay   time.Duration
+	err     error
+	drained *int32
+}
+
+func (s fakeSubscription) Drain(ctx context.Context) error {
+	select {
+	case <-time.After(s.delay):
+	case <-ctx.Done():
+	}
+	atomic.AddInt32(s.drained, 1)
+	return s.err
+}
+
+// CAN DRAIN EVERY SUBSCRIPTION AT ONCE
+func TestSubscriptionsDrain(t *testing.T) {
+	var drained int32
+	subs := &Subscriptions{subs: []Subscription{
+		fakeSubscription{delay: 100 * time.Millisecond, drained: &drained},
+		fakeSubscription{delay: 100 * time.Millisecond, err: errors.New("broken"), drained: &drained},
+		fakeSubscription{delay: time.Hour, drained: &drained},
+	}}
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := subs.Drain(ctx)
+	// the subscriptions are drained concurrently, so the slow one only holds
+	// things up until the deadline
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected draining to stop at the deadline, but it took %s", elapsed)
+	}
+	if count := atomic.LoadInt32(&drained); count != 3 {
+		t.Errorf("Expected every subscription to be drained, but %d were", count)
+	}
+	if err == nil || err.Error() != "broken" {
+		t.Errorf("Expected the error of the subscription that failed, but got %v", err)
+	}
+	if err := subs.Drain(context.Background()); err != nil || len(subs.subs) != 0 {
+		t.Errorf("Expected the subscriptions to be forgotten once they're drained")
+	}
+}